@@ -0,0 +1,350 @@
+package audit
+
+import (
+	"reflect"
+	"time"
+
+	"my-go-project/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// skippedTables are never audited: the activity log itself and internal bookkeeping.
+var skippedTables = map[string]bool{
+	"activities":     true,
+	"blob_deletions": true,
+	"notifications":  true,
+	"undo_entries":   true,
+}
+
+// ignoredColumns change on every write and would only add noise to diffs.
+var ignoredColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+
+	"digest_sent_on": true, // Bookkeeping of the digest scheduler
+}
+
+// secretColumns are recorded as changed without their values, since anyone
+// can read the activity log.
+var secretColumns = map[string]bool{
+	"calendar_token": true,
+}
+
+const redacted = "[redacted]"
+
+const beforeKey = "audit:before"
+
+// observers are told of every activity recorded; see Observe.
+var observers []func(models.Activity)
+
+// Observe calls fn with each activity recorded from now on, for instance to
+// count domain events. The activity may still be rolled back with its
+// transaction. Observe must be called before the database is used.
+func Observe(fn func(models.Activity)) {
+	observers = append(observers, fn)
+}
+
+// Register installs GORM callbacks that write a models.Activity row for every
+// create, update and delete made through db, in the same transaction as the
+// change. The actor and request ID are read from the statement context; see
+// WithActor and WithRequestID.
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("audit:after_create", afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("audit:before_update", captureBefore); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("audit:after_update", afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("audit:before_delete", captureBefore); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("audit:after_delete", afterDelete)
+}
+
+// audited reports whether the statement is a successful change to an audited table.
+func audited(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error == nil && !stmt.DryRun && stmt.Schema != nil &&
+		stmt.Schema.PrioritizedPrimaryField != nil && !skippedTables[stmt.Schema.Table]
+}
+
+func captureBefore(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	rows, err := matchingRows(db)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(beforeKey, rows)
+}
+
+func afterCreate(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	keys := primaryKeys(db)
+	if len(keys) == 0 {
+		return
+	}
+	rows, err := rowsByKey(db, keys)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+
+	var activities []models.Activity
+	for _, row := range rows {
+		changes := models.FieldChanges{}
+		for column, value := range row {
+			if !skipColumn(db, column) && value != nil {
+				changes[column] = models.FieldChange{After: value}
+			}
+		}
+		activities = append(activities, newActivity(db, models.ActionCreate, row, changes))
+	}
+	record(db, activities)
+}
+
+func afterUpdate(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	before := capturedRows(db)
+	if len(before) == 0 {
+		return
+	}
+
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	keys := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		keys = append(keys, row[pk])
+	}
+	rows, err := rowsByKey(db, keys)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	after := make(map[interface{}]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		after[row[pk]] = row
+	}
+
+	var activities []models.Activity
+	for _, old := range before {
+		current, ok := after[old[pk]]
+		if !ok {
+			continue
+		}
+		changes := models.FieldChanges{}
+		for column, value := range current {
+			if !skipColumn(db, column) && !equalValues(old[column], value) {
+				changes[column] = models.FieldChange{Before: old[column], After: value}
+			}
+		}
+		if old["deleted_at"] != nil && current["deleted_at"] == nil {
+			activities = append(activities, newActivity(db, models.ActionRestore, current, changes))
+		} else if len(changes) > 0 { // Saving an unchanged record is not worth an entry
+			activities = append(activities, newActivity(db, models.ActionUpdate, current, changes))
+		}
+	}
+	record(db, activities)
+}
+
+func afterDelete(db *gorm.DB) {
+	if !audited(db) {
+		return
+	}
+	var activities []models.Activity
+	for _, row := range capturedRows(db) {
+		changes := models.FieldChanges{}
+		for column, value := range row {
+			if !skipColumn(db, column) && value != nil {
+				changes[column] = models.FieldChange{Before: value}
+			}
+		}
+		activities = append(activities, newActivity(db, models.ActionDelete, row, changes))
+	}
+	record(db, activities)
+}
+
+// newActivity builds the activity for one row of the statement's table.
+func newActivity(db *gorm.DB, action string, row map[string]interface{}, changes models.FieldChanges) models.Activity {
+	stmt := db.Statement
+	for column, change := range changes {
+		if secretColumns[column] {
+			changes[column] = models.FieldChange{Before: redact(change.Before), After: redact(change.After)}
+		}
+	}
+	activity := models.Activity{
+		Action:     action,
+		EntityType: stmt.Schema.Name,
+		EntityID:   toUint(row[stmt.Schema.PrioritizedPrimaryField.DBName]),
+		Changes:    changes,
+		RequestID:  RequestIDFrom(stmt.Context),
+	}
+	if actor, ok := ActorFrom(stmt.Context); ok {
+		activity.ActorID = &actor.ID
+		activity.Actor = actor.Name
+	}
+
+	// Tie the entry to its todo so a todo's history includes its notes and checklist
+	if stmt.Schema.Table == "todos" {
+		activity.TodoID = &activity.EntityID
+	} else if todoID, ok := row["todo_id"]; ok && todoID != nil {
+		id := toUint(todoID)
+		activity.TodoID = &id
+	}
+	return activity
+}
+
+// record appends activities in the statement's transaction, failing the
+// statement if the audit trail cannot be written.
+func record(db *gorm.DB, activities []models.Activity) {
+	if len(activities) == 0 {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&activities).Error; err != nil {
+		db.AddError(err)
+		return
+	}
+	for _, activity := range activities {
+		for _, observe := range observers {
+			observe(activity)
+		}
+	}
+}
+
+// newQuery starts a query on the statement's table inside the same connection
+// or transaction, honouring Unscoped.
+func newQuery(db *gorm.DB) *gorm.DB {
+	tx := db.Session(&gorm.Session{NewDB: true}).Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+	if db.Statement.Unscoped {
+		tx = tx.Unscoped()
+	}
+	return tx
+}
+
+// matchingRows loads the rows the statement is about to change, using its
+// WHERE clause and the primary keys of the value it was given.
+func matchingRows(db *gorm.DB) ([]map[string]interface{}, error) {
+	tx := newQuery(db)
+	where, hasWhere := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	if hasWhere {
+		tx = tx.Clauses(where)
+	}
+	keys := primaryKeys(db)
+	if len(keys) > 0 {
+		tx = tx.Where(clause.IN{
+			Column: clause.Column{Table: clause.CurrentTable, Name: db.Statement.Schema.PrioritizedPrimaryField.DBName},
+			Values: keys,
+		})
+	}
+	if !hasWhere && len(keys) == 0 {
+		return nil, nil // GORM refuses global updates and deletes anyway
+	}
+
+	var rows []map[string]interface{}
+	err := tx.Find(&rows).Error
+	return normalizeRows(rows), err
+}
+
+// rowsByKey loads rows of the statement's table by primary key, including soft-deleted ones.
+func rowsByKey(db *gorm.DB, keys []interface{}) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	err := newQuery(db).Unscoped().Where(clause.IN{
+		Column: clause.Column{Table: clause.CurrentTable, Name: db.Statement.Schema.PrioritizedPrimaryField.DBName},
+		Values: keys,
+	}).Find(&rows).Error
+	return normalizeRows(rows), err
+}
+
+func capturedRows(db *gorm.DB) []map[string]interface{} {
+	rows, _ := db.InstanceGet(beforeKey)
+	before, _ := rows.([]map[string]interface{})
+	return before
+}
+
+// primaryKeys returns the non-zero primary keys of the value passed to the statement.
+func primaryKeys(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	field := stmt.Schema.PrioritizedPrimaryField
+	value := reflect.Indirect(stmt.ReflectValue)
+
+	var keys []interface{}
+	add := func(v reflect.Value) {
+		v = reflect.Indirect(v)
+		if v.Kind() != reflect.Struct || v.Type() != stmt.Schema.ModelType {
+			return
+		}
+		if key, isZero := field.ValueOf(stmt.Context, v); !isZero {
+			keys = append(keys, key)
+		}
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		add(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			add(value.Index(i))
+		}
+	}
+	return keys
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return redacted
+}
+
+func skipColumn(db *gorm.DB, column string) bool {
+	return ignoredColumns[column] || column == db.Statement.Schema.PrioritizedPrimaryField.DBName
+}
+
+// normalizeRows converts driver values into JSON-friendly ones.
+func normalizeRows(rows []map[string]interface{}) []map[string]interface{} {
+	for _, row := range rows {
+		for column, value := range row {
+			if b, ok := value.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+	}
+	return rows
+}
+
+func equalValues(a, b interface{}) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toUint(v interface{}) uint {
+	switch n := v.(type) {
+	case int64:
+		return uint(n)
+	case int32:
+		return uint(n)
+	case int:
+		return uint(n)
+	case uint64:
+		return uint(n)
+	case uint32:
+		return uint(n)
+	case uint:
+		return n
+	}
+	return 0
+}
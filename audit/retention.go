@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"my-go-project/health"
+	"my-go-project/models"
+	"my-go-project/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Prune permanently removes activities recorded before cutoff and returns how
+// many were removed. It is the only way rows leave the activity log.
+func Prune(ctx context.Context, db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.WithContext(ctx).Where("created_at < ?", cutoff).Delete(&models.Activity{})
+	return result.RowsAffected, result.Error
+}
+
+// RunRetention prunes activities older than retention once per interval until
+// ctx is cancelled. A zero retention keeps the log forever.
+func RunRetention(ctx context.Context, db *gorm.DB, retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		health.Beat(ctx)
+		var removed int64
+		err := tracing.Job(ctx, "audit.prune", func(ctx context.Context) (err error) {
+			removed, err = Prune(ctx, db, time.Now().Add(-retention))
+			return err
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error pruning activity log", "error", err)
+		} else if removed > 0 {
+			slog.InfoContext(ctx, "Pruned activity log", "removed", removed, "retention", retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
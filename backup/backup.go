@@ -0,0 +1,302 @@
+// Package backup writes the database, and the blobs of its attachments, to a
+// portable archive and restores it, into PostgreSQL or SQLite alike.
+//
+// An archive is a gzip-compressed tar file. It holds tables/<table>.jsonl
+// for every registered model and many-to-many join table, in the order they
+// can be restored in, with one JSON object per row keyed by column; then
+// blobs/<key> for every attachment blob; and last manifest.json, which lists
+// every entry with its SHA-256 checksum.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Version is the version of the archives written. Archives of newer
+// versions are refused.
+const Version = 1
+
+const manifestName = "manifest.json"
+
+// batchSize is how many rows are read or written at a time.
+const batchSize = 500
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Dialect   string    `json:"dialect"` // The database it was taken from, postgres or sqlite
+	Tables    []Table   `json:"tables"`
+	Blobs     []Blob    `json:"blobs"`
+}
+
+// Table is the entry of a table in an archive.
+type Table struct {
+	Name   string `json:"name"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// Blob is the entry of an attachment blob in an archive.
+type Blob struct {
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+func tablePath(name string) string { return "tables/" + name + ".jsonl" }
+
+func blobPath(key string) string { return "blobs/" + key }
+
+// table is a table to back up: a registered model, or a join table, which
+// has no schema of its own.
+type table struct {
+	name   string
+	schema *schema.Schema
+}
+
+// tables lists the tables of the registered models, each after those its
+// foreign keys refer to, then the many-to-many join tables.
+func tables(db *gorm.DB) ([]table, error) {
+	var schemas []*schema.Schema
+	byTable := map[string]*schema.Schema{}
+	for _, model := range models.GetRegisteredModels() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, stmt.Schema)
+		byTable[stmt.Schema.Table] = stmt.Schema
+	}
+
+	// A foreign key may be declared on either side of a relationship
+	refers := map[string][]string{}
+	var joins []table
+	seen := map[string]bool{}
+	for _, s := range schemas {
+		for _, rel := range s.Relationships.Relations {
+			if c := rel.ParseConstraint(); c != nil && c.Schema != c.ReferenceSchema {
+				refers[c.Schema.Table] = append(refers[c.Schema.Table], c.ReferenceSchema.Table)
+			}
+			if rel.JoinTable != nil && !seen[rel.JoinTable.Table] {
+				seen[rel.JoinTable.Table] = true
+				joins = append(joins, table{name: rel.JoinTable.Table})
+			}
+		}
+	}
+
+	var list []table
+	done := map[string]bool{}
+	var visit func(s *schema.Schema)
+	visit = func(s *schema.Schema) {
+		if done[s.Table] {
+			return
+		}
+		done[s.Table] = true
+		for _, name := range refers[s.Table] {
+			if referred, ok := byTable[name]; ok {
+				visit(referred)
+			}
+		}
+		list = append(list, table{name: s.Table, schema: s})
+	}
+	for _, s := range schemas {
+		visit(s)
+	}
+	return append(list, joins...), nil
+}
+
+// Write writes an archive of the database to w, with the blobs of the
+// attachments from store unless it is nil. Every row is read from the same
+// snapshot of the database, so that the archive is consistent; blobs that
+// have gone missing from the store are left out with a warning.
+func Write(ctx context.Context, db *gorm.DB, store storage.BlobStore, w io.Writer) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Version: Version, CreatedAt: time.Now().UTC(), Dialect: db.Dialector.Name(), Tables: []Table{}, Blobs: []Blob{}}
+
+	err := snapshot(db.WithContext(ctx), func(tx *gorm.DB) error {
+		list, err := tables(tx)
+		if err != nil {
+			return err
+		}
+		for _, t := range list {
+			entry, err := writeTable(tw, tx, t)
+			if err != nil {
+				return fmt.Errorf("table %s: %w", t.name, err)
+			}
+			manifest.Tables = append(manifest.Tables, *entry)
+		}
+		if store == nil {
+			return nil
+		}
+		manifest.Blobs, err = writeBlobs(ctx, tw, tx, store)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(fileHeader(manifestName, int64(len(content)))); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// snapshot runs fn in a read-only transaction that sees the database as it
+// was when it began. SQLite transactions always do; PostgreSQL ones need
+// repeatable read.
+func snapshot(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() == "postgres" {
+		return db.Transaction(fn, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	}
+	return db.Transaction(fn)
+}
+
+func fileHeader(name string, size int64) *tar.Header {
+	return &tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+}
+
+// writeTable adds the rows of t to the archive. They are spooled to a
+// temporary file first, as tar needs to know their size up front.
+func writeTable(tw *tar.Writer, tx *gorm.DB, t table) (*Table, error) {
+	spool, err := os.CreateTemp("", "backup-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	hash := sha256.New()
+	encoder := json.NewEncoder(io.MultiWriter(spool, hash))
+	rows := 0
+	if t.schema == nil {
+		// Join tables only hold keys, which read the same from every driver
+		var batch []map[string]interface{}
+		if err := tx.Table(t.name).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range batch {
+			if err := encoder.Encode(row); err != nil {
+				return nil, err
+			}
+		}
+		rows = len(batch)
+	} else {
+		// Rows are read into their models and written by column, so that
+		// every value is encoded as its Go type, whatever the driver
+		batch := reflect.New(reflect.SliceOf(t.schema.ModelType))
+		err := tx.Session(&gorm.Session{SkipHooks: true}).Unscoped().Table(t.name).
+			FindInBatches(batch.Interface(), batchSize, func(*gorm.DB, int) error {
+				for i := 0; i < batch.Elem().Len(); i++ {
+					row := make(map[string]interface{}, len(t.schema.DBNames))
+					for _, column := range t.schema.DBNames {
+						row[column], _ = t.schema.FieldsByDBName[column].ValueOf(tx.Statement.Context, batch.Elem().Index(i))
+					}
+					if err := encoder.Encode(row); err != nil {
+						return err
+					}
+				}
+				rows += batch.Elem().Len()
+				return nil
+			}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(fileHeader(tablePath(t.name), size)); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tw, spool); err != nil {
+		return nil, err
+	}
+	return &Table{Name: t.name, Rows: rows, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// writeBlobs adds the files and thumbnails of every attachment to the
+// archive.
+func writeBlobs(ctx context.Context, tw *tar.Writer, tx *gorm.DB, store storage.BlobStore) ([]Blob, error) {
+	var attachments []models.Attachment
+	if err := tx.Unscoped().Order("id").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	blobs := []Blob{}
+	for _, attachment := range attachments {
+		for _, blob := range []Blob{
+			{Key: attachment.StorageKey, ContentType: attachment.ContentType},
+			{Key: attachment.ThumbnailKey, ContentType: "image/png"},
+		} {
+			if blob.Key == "" {
+				continue
+			}
+			err := writeBlob(ctx, tw, store, &blob)
+			if errors.Is(err, storage.ErrNotFound) {
+				slog.WarnContext(ctx, "Blob of attachment missing from storage, not backed up", "attachment_id", attachment.ID, "key", blob.Key)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("blob %s: %w", blob.Key, err)
+			}
+			blobs = append(blobs, blob)
+		}
+	}
+	return blobs, nil
+}
+
+// writeBlob copies a blob into the archive, filling in its size and
+// checksum.
+func writeBlob(ctx context.Context, tw *tar.Writer, store storage.BlobStore, blob *Blob) error {
+	content, err := store.Open(ctx, blob.Key)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	blob.Size = content.Size()
+	if err := tw.WriteHeader(fileHeader(blobPath(blob.Key), blob.Size)); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, hash), content); err != nil {
+		return err
+	}
+	blob.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
@@ -0,0 +1,412 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"my-go-project/database"
+	"my-go-project/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrCorrupt is returned for an archive that is damaged or incomplete.
+	ErrCorrupt = errors.New("corrupt backup")
+	// ErrNotEmpty is returned when restoring into a database that has rows,
+	// without merging.
+	ErrNotEmpty = errors.New("database is not empty")
+	// ErrConflict is returned when merging a row whose primary or unique
+	// key is taken by a row that holds something else.
+	ErrConflict = errors.New("backup conflicts with the database")
+)
+
+// Options say how Restore restores.
+type Options struct {
+	// Merge adds the rows of the archive to a database that has rows
+	// already, skipping those it holds as they are. As rows refer to one
+	// another by primary key, a key taken by a row that holds something else
+	// is an ErrConflict, and nothing is restored. Without Merge the database
+	// must be empty.
+	Merge bool
+}
+
+// Verify reads the archive at path and checks it against its manifest: that
+// it is a version this app can read, that every entry is listed and present
+// and that every checksum matches. It returns the manifest.
+func Verify(path string) (*Manifest, error) {
+	sums := map[string]string{}
+	var manifest *Manifest
+	err := readArchive(path, func(header *tar.Header, r io.Reader) error {
+		if header.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(r).Decode(manifest); err != nil {
+				return fmt.Errorf("%w: manifest: %v", ErrCorrupt, err)
+			}
+			return nil
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return err
+		}
+		sums[header.Name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: no manifest", ErrCorrupt)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, fmt.Errorf("backup version %d is not supported, this app reads up to version %d", manifest.Version, Version)
+	}
+
+	want := map[string]string{}
+	for _, t := range manifest.Tables {
+		want[tablePath(t.Name)] = t.SHA256
+	}
+	for _, blob := range manifest.Blobs {
+		want[blobPath(blob.Key)] = blob.SHA256
+	}
+	for name, sum := range want {
+		got, ok := sums[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrCorrupt, name)
+		}
+		if got != sum {
+			return nil, fmt.Errorf("%w: checksum of %s does not match", ErrCorrupt, name)
+		}
+	}
+	for name := range sums {
+		if _, ok := want[name]; !ok {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrCorrupt, name)
+		}
+	}
+	return manifest, nil
+}
+
+// Restore verifies the archive at path, restores its rows in one
+// transaction and then puts its blobs in store, unless store is nil. Rows
+// keep their primary keys, and PostgreSQL sequences continue after them.
+// Columns this version of the app no longer has are dropped; tables it
+// does not know are an error.
+func Restore(ctx context.Context, db *gorm.DB, store storage.BlobStore, path string, opts Options) (*Manifest, error) {
+	manifest, err := Verify(path)
+	if err != nil {
+		return nil, err
+	}
+	db = db.WithContext(ctx)
+	list, err := tables(db)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]table{}
+	for _, t := range list {
+		known[tablePath(t.name)] = t
+	}
+	for _, t := range manifest.Tables {
+		if _, ok := known[tablePath(t.Name)]; !ok {
+			return nil, fmt.Errorf("backup has table %s, which this version does not know", t.Name)
+		}
+	}
+
+	err = database.Transaction(db, func(tx *gorm.DB) error {
+		if !opts.Merge {
+			for _, t := range list {
+				var count int64
+				if err := tx.Table(t.name).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return fmt.Errorf("%w: %s has rows; merge to add to them", ErrNotEmpty, t.name)
+				}
+			}
+		}
+		// Verify checked the layout, so only the tables need looking at
+		err := readArchive(path, func(header *tar.Header, r io.Reader) error {
+			t, ok := known[header.Name]
+			if !ok {
+				return nil
+			}
+			if err := restoreTable(tx, t, r, opts.Merge); err != nil {
+				return fmt.Errorf("table %s: %w", t.name, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return resetSequences(tx, list)
+	})
+	if err != nil || store == nil {
+		return manifest, err
+	}
+
+	// Blobs are stored once the rows referring to them are
+	contentTypes := map[string]string{}
+	for _, blob := range manifest.Blobs {
+		contentTypes[blobPath(blob.Key)] = blob.ContentType
+	}
+	err = readArchive(path, func(header *tar.Header, r io.Reader) error {
+		if !strings.HasPrefix(header.Name, "blobs/") {
+			return nil
+		}
+		key := strings.TrimPrefix(header.Name, "blobs/")
+		if err := store.Put(ctx, key, r, header.Size, contentTypes[header.Name]); err != nil {
+			return fmt.Errorf("blob %s: %w", key, err)
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+// readArchive calls fn with each file in the archive at path.
+func readArchive(path string, fn func(header *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// restoreTable inserts the rows read from r into t, in batches. Rows are
+// inserted as column maps: that bypasses the hooks of the models and the
+// activity log, which would change what is restored, and GORM's defaults,
+// which would turn false into true for columns that default to true. When
+// merging, rows that are stored already are skipped, see alreadyStored.
+func restoreTable(tx *gorm.DB, t table, r io.Reader, merge bool) error {
+	decoder := json.NewDecoder(r)
+	query := tx.Table(t.name)
+	if merge {
+		query = query.Clauses(clause.OnConflict{DoNothing: true})
+	}
+	var batch []map[string]interface{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := query.Create(&batch).Error
+		batch = batch[:0]
+		return err
+	}
+	for {
+		var raw map[string]json.RawMessage
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		row, err := decodeRow(t, raw)
+		if err != nil {
+			return err
+		}
+		if merge && t.schema != nil {
+			stored, err := alreadyStored(tx, t, row)
+			if err != nil {
+				return err
+			}
+			if stored {
+				continue
+			}
+		}
+		if batch = append(batch, row); len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// alreadyStored reports whether a row of a model's table, being merged, is
+// stored as it is. A row whose primary or unique keys are taken by one that
+// differs in any column is an ErrConflict: the rows referring to it by its
+// primary key would otherwise end up on the wrong row, or on none. Join
+// tables hold nothing but keys, so their rows are never in conflict.
+func alreadyStored(tx *gorm.DB, t table, row map[string]interface{}) (bool, error) {
+	var keys [][]string
+	keys = append(keys, t.schema.PrimaryFieldDBNames)
+	for _, index := range t.schema.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		var columns []string
+		for _, option := range index.Fields {
+			columns = append(columns, option.DBName)
+		}
+		keys = append(keys, columns)
+	}
+
+	var matches []clause.Expression
+	for _, columns := range keys {
+		var equal []clause.Expression
+		for _, column := range columns {
+			value, ok := row[column]
+			if !ok || isNull(value) {
+				equal = nil // NULLs collide with nothing
+				break
+			}
+			equal = append(equal, clause.Eq{Column: clause.Column{Name: column}, Value: value})
+		}
+		if len(equal) > 0 {
+			matches = append(matches, clause.And(equal...))
+		}
+	}
+	if len(matches) == 0 {
+		return false, nil
+	}
+
+	// Stored rows are read as Write reads them, so that they compare alike
+	stored := reflect.New(reflect.SliceOf(t.schema.ModelType))
+	err := tx.Session(&gorm.Session{SkipHooks: true, NewDB: true}).Unscoped().Table(t.name).
+		Where(clause.Or(matches...)).Limit(2).Find(stored.Interface()).Error
+	if err != nil {
+		return false, err
+	}
+	if stored.Elem().Len() == 0 {
+		return false, nil
+	}
+	id := primaryKey(t, row)
+	if stored.Elem().Len() > 1 {
+		return false, fmt.Errorf("%w: the keys of row %s are taken by several rows", ErrConflict, id)
+	}
+	for column, value := range row {
+		storedValue, _ := t.schema.FieldsByDBName[column].ValueOf(tx.Statement.Context, stored.Elem().Index(0))
+		if !sameValue(value, storedValue) {
+			return false, fmt.Errorf("%w: a row with the keys of row %s differs in %s", ErrConflict, id, column)
+		}
+	}
+	return true, nil
+}
+
+// primaryKey formats the primary key of a row for messages.
+func primaryKey(t table, row map[string]interface{}) string {
+	var values []string
+	for _, column := range t.schema.PrimaryFieldDBNames {
+		values = append(values, fmt.Sprint(row[column]))
+	}
+	return strings.Join(values, ",")
+}
+
+// isNull reports whether a column value is NULL.
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// sameValue reports whether two values of a column are equal. Times are
+// equal at the same instant, whatever the zone the database returns them in.
+func sameValue(a, b interface{}) bool {
+	ta, aIsTime := asTime(a)
+	tb, bIsTime := asTime(b)
+	if aIsTime || bIsTime {
+		return aIsTime && bIsTime && ta.Equal(tb)
+	}
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// asTime returns the time a column value holds, if it holds one.
+func asTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case gorm.DeletedAt:
+		if v.Valid {
+			return v.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// decodeRow turns the JSON of a row into the values of its columns, decoding
+// each as the Go type of its model field.
+func decodeRow(t table, raw map[string]json.RawMessage) (map[string]interface{}, error) {
+	row := make(map[string]interface{}, len(raw))
+	for column, value := range raw {
+		if t.schema == nil {
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return nil, err
+			}
+			// Join tables hold integer keys
+			if n, ok := v.(float64); ok {
+				v = int64(n)
+			}
+			row[column] = v
+			continue
+		}
+		field := t.schema.FieldsByDBName[column]
+		if field == nil {
+			continue // A column this version no longer has
+		}
+		v := reflect.New(field.FieldType)
+		if err := json.Unmarshal(value, v.Interface()); err != nil {
+			return nil, fmt.Errorf("column %s: %w", column, err)
+		}
+		row[column] = v.Elem().Interface()
+	}
+	return row, nil
+}
+
+// resetSequences moves PostgreSQL's ID sequences past the restored rows, so
+// that new rows do not collide with them. SQLite needs nothing of the sort.
+func resetSequences(tx *gorm.DB, list []table) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, t := range list {
+		if t.schema == nil || t.schema.PrioritizedPrimaryField == nil || !t.schema.PrioritizedPrimaryField.AutoIncrement {
+			continue
+		}
+		pk := t.schema.PrioritizedPrimaryField.DBName
+		err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, ?), MAX("+tx.Statement.Quote(pk)+")) FROM "+tx.Statement.Quote(t.name)+" HAVING MAX("+tx.Statement.Quote(pk)+") IS NOT NULL", t.name, pk).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
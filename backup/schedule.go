@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"my-go-project/health"
+	"my-go-project/storage"
+	"my-go-project/tracing"
+
+	"gorm.io/gorm"
+)
+
+// filePattern matches the names of the archives WriteFile writes; they sort
+// by the time they were taken.
+const filePattern = "backup-*.tar.gz"
+
+// WriteFile writes an archive, as Write does, to a new file in dir named
+// after the time, and then removes all but the keep newest archives in dir;
+// a keep of zero keeps them all. The file only appears once it is complete.
+func WriteFile(ctx context.Context, db *gorm.DB, store storage.BlobStore, dir string, keep int) (string, *Manifest, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", nil, err
+	}
+	path := filepath.Join(dir, "backup-"+time.Now().UTC().Format("20060102T150405Z")+".tar.gz")
+	tmp, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	manifest, err := Write(ctx, db, store, tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return path, manifest, Prune(dir, keep)
+}
+
+// List returns the archives in dir written by WriteFile, oldest first.
+func List(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, filePattern))
+	sort.Strings(paths)
+	return paths, err
+}
+
+// Prune removes all but the keep newest archives in dir; a keep of zero
+// keeps them all.
+func Prune(dir string, keep int) error {
+	paths, err := List(dir)
+	if err != nil || keep <= 0 || len(paths) <= keep {
+		return err
+	}
+	for _, path := range paths[:len(paths)-keep] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		slog.Info("Removed old backup", "path", path)
+	}
+	return nil
+}
+
+// RunScheduler writes an archive into dir whenever the newest one there is
+// older than interval, checking every minute until ctx is cancelled, and
+// keeps the keep newest. As the archives themselves are the schedule, one is
+// written at startup when it is due, however often the server restarts.
+func RunScheduler(ctx context.Context, db *gorm.DB, store storage.BlobStore, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		health.Beat(ctx)
+		if due, err := backupDue(dir, interval); err != nil {
+			slog.ErrorContext(ctx, "Error listing backups", "dir", dir, "error", err)
+		} else if due {
+			var path string
+			err := tracing.Job(ctx, "backup.write", func(ctx context.Context) (err error) {
+				path, _, err = WriteFile(ctx, db, store, dir, keep)
+				return err
+			})
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Error writing backup", "dir", dir, "error", err)
+			} else if err == nil {
+				slog.InfoContext(ctx, "Wrote backup", "path", path)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backupDue reports whether the newest archive in dir is older than
+// interval, or there is none.
+func backupDue(dir string, interval time.Duration) (bool, error) {
+	paths, err := List(dir)
+	if err != nil || len(paths) == 0 {
+		return err == nil, err
+	}
+	info, err := os.Stat(paths[len(paths)-1])
+	if err != nil {
+		return false, fmt.Errorf("newest backup: %w", err)
+	}
+	return time.Since(info.ModTime()) >= interval, nil
+}
@@ -0,0 +1,273 @@
+// Package caldav implements the request and response bodies of the WebDAV
+// (RFC 4918), CalDAV (RFC 4791) and collection sync (RFC 6578) subset the
+// server speaks. It knows nothing about storage; see routes/dav.go.
+package caldav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// XML namespaces
+const (
+	NSDAV       = "DAV:"
+	NSCalDAV    = "urn:ietf:params:xml:ns:caldav"
+	NSCalServer = "http://calendarserver.org/ns/"
+)
+
+// Names of the properties the server knows about
+var (
+	ResourceType                  = xml.Name{Space: NSDAV, Local: "resourcetype"}
+	DisplayName                   = xml.Name{Space: NSDAV, Local: "displayname"}
+	GetETag                       = xml.Name{Space: NSDAV, Local: "getetag"}
+	GetContentType                = xml.Name{Space: NSDAV, Local: "getcontenttype"}
+	GetLastModified               = xml.Name{Space: NSDAV, Local: "getlastmodified"}
+	CurrentUserPrincipal          = xml.Name{Space: NSDAV, Local: "current-user-principal"}
+	CurrentUserPrivilegeSet       = xml.Name{Space: NSDAV, Local: "current-user-privilege-set"}
+	PrincipalURL                  = xml.Name{Space: NSDAV, Local: "principal-URL"}
+	SupportedReportSet            = xml.Name{Space: NSDAV, Local: "supported-report-set"}
+	SyncToken                     = xml.Name{Space: NSDAV, Local: "sync-token"}
+	CalendarHomeSet               = xml.Name{Space: NSCalDAV, Local: "calendar-home-set"}
+	CalendarData                  = xml.Name{Space: NSCalDAV, Local: "calendar-data"}
+	SupportedCalendarComponentSet = xml.Name{Space: NSCalDAV, Local: "supported-calendar-component-set"}
+	SupportedCalendarData         = xml.Name{Space: NSCalDAV, Local: "supported-calendar-data"}
+	GetCTag                       = xml.Name{Space: NSCalServer, Local: "getctag"}
+)
+
+// Names of precondition elements in error bodies
+var (
+	ValidSyncToken             = xml.Name{Space: NSDAV, Local: "valid-sync-token"}
+	SupportedCalendarComponent = xml.Name{Space: NSCalDAV, Local: "supported-calendar-component"}
+	ValidCalendarData          = xml.Name{Space: NSCalDAV, Local: "valid-calendar-data"}
+)
+
+// prefixes used for well-known namespaces in responses
+var prefixes = map[string]string{
+	NSDAV:       "D",
+	NSCalDAV:    "C",
+	NSCalServer: "CS",
+}
+
+// Element is an XML element whose content is not interpreted.
+type Element struct {
+	XMLName xml.Name
+}
+
+// Prop lists requested property names.
+type Prop struct {
+	Names []Element `xml:",any"`
+}
+
+// PropNames returns the requested names, or nil if p is nil.
+func (p *Prop) PropNames() []xml.Name {
+	if p == nil {
+		return nil
+	}
+	names := make([]xml.Name, len(p.Names))
+	for i, e := range p.Names {
+		names[i] = e.XMLName
+	}
+	return names
+}
+
+// PropFind is a PROPFIND request body. An empty body means allprop.
+type PropFind struct {
+	XMLName  xml.Name  `xml:"DAV: propfind"`
+	Prop     *Prop     `xml:"DAV: prop"`
+	AllProp  *struct{} `xml:"DAV: allprop"`
+	PropName *struct{} `xml:"DAV: propname"`
+}
+
+// PropertyUpdate is a PROPPATCH request body.
+type PropertyUpdate struct {
+	XMLName xml.Name `xml:"DAV: propertyupdate"`
+	Set     []Prop   `xml:"DAV: set>prop"`
+	Remove  []Prop   `xml:"DAV: remove>prop"`
+}
+
+// CalendarQuery is a calendar-query REPORT body.
+type CalendarQuery struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-query"`
+	Prop    *Prop    `xml:"DAV: prop"`
+	Filter  struct {
+		CompFilter CompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// CalendarMultiget is a calendar-multiget REPORT body.
+type CalendarMultiget struct {
+	XMLName xml.Name `xml:"urn:ietf:params:xml:ns:caldav calendar-multiget"`
+	Prop    *Prop    `xml:"DAV: prop"`
+	Hrefs   []string `xml:"DAV: href"`
+}
+
+// SyncCollection is a sync-collection REPORT body.
+type SyncCollection struct {
+	XMLName   xml.Name `xml:"DAV: sync-collection"`
+	SyncToken string   `xml:"DAV: sync-token"`
+	SyncLevel string   `xml:"DAV: sync-level"`
+	Prop      *Prop    `xml:"DAV: prop"`
+}
+
+// ReadPropFind parses a PROPFIND body, treating an empty body as allprop.
+func ReadPropFind(body []byte) (*PropFind, error) {
+	var pf PropFind
+	if len(strings.TrimSpace(string(body))) == 0 {
+		pf.AllProp = &struct{}{}
+		return &pf, nil
+	}
+	if err := xml.Unmarshal(body, &pf); err != nil {
+		return nil, err
+	}
+	if pf.Prop == nil && pf.PropName == nil {
+		pf.AllProp = &struct{}{}
+	}
+	return &pf, nil
+}
+
+// ReadReport parses a REPORT body into a *CalendarQuery, *CalendarMultiget or
+// *SyncCollection.
+func ReadReport(body []byte) (interface{}, error) {
+	var root Element
+	if err := xml.Unmarshal(body, &root); err != nil {
+		return nil, err
+	}
+	var report interface{}
+	switch root.XMLName {
+	case xml.Name{Space: NSCalDAV, Local: "calendar-query"}:
+		report = &CalendarQuery{}
+	case xml.Name{Space: NSCalDAV, Local: "calendar-multiget"}:
+		report = &CalendarMultiget{}
+	case xml.Name{Space: NSDAV, Local: "sync-collection"}:
+		report = &SyncCollection{}
+	default:
+		return nil, fmt.Errorf("unsupported report %s %s", root.XMLName.Space, root.XMLName.Local)
+	}
+	if err := xml.Unmarshal(body, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Response is one resource in a multistatus body. Either Status is set, or
+// the resource's properties are listed in Found, NotFound and Forbidden.
+type Response struct {
+	Href      string
+	Status    int
+	Found     map[xml.Name]string // Property values as XML fragments
+	NotFound  []xml.Name
+	Forbidden []xml.Name // Properties that cannot be changed
+}
+
+// Multistatus is a 207 Multi-Status body.
+type Multistatus struct {
+	Responses []Response
+	SyncToken string // Only for sync-collection reports
+}
+
+// Encode writes the multistatus document.
+func (m *Multistatus) Encode(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="` + NSCalDAV + `" xmlns:CS="` + NSCalServer + `">`)
+	for _, r := range m.Responses {
+		b.WriteString("<D:response>")
+		b.WriteString(Href(r.Href))
+		if r.Status != 0 {
+			b.WriteString(status(r.Status))
+		} else {
+			if len(r.Found) > 0 || len(r.NotFound)+len(r.Forbidden) == 0 {
+				b.WriteString("<D:propstat><D:prop>")
+				for _, name := range sortedNames(r.Found) {
+					b.WriteString(Element{name}.wrap(r.Found[name]))
+				}
+				b.WriteString("</D:prop>" + status(http.StatusOK) + "</D:propstat>")
+			}
+			writeEmptyPropstat(&b, r.NotFound, http.StatusNotFound)
+			writeEmptyPropstat(&b, r.Forbidden, http.StatusForbidden)
+		}
+		b.WriteString("</D:response>")
+	}
+	if m.SyncToken != "" {
+		b.WriteString("<D:sync-token>" + Text(m.SyncToken) + "</D:sync-token>")
+	}
+	b.WriteString("</D:multistatus>")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeEmptyPropstat lists property names without values under one status.
+func writeEmptyPropstat(b *strings.Builder, names []xml.Name, code int) {
+	if len(names) == 0 {
+		return
+	}
+	b.WriteString("<D:propstat><D:prop>")
+	for _, name := range names {
+		b.WriteString(Element{name}.wrap(""))
+	}
+	b.WriteString("</D:prop>" + status(code) + "</D:propstat>")
+}
+
+// Error returns a DAV:error body holding a single precondition element.
+func Error(precondition xml.Name) string {
+	return xml.Header + `<D:error xmlns:D="DAV:" xmlns:C="` + NSCalDAV + `">` +
+		Element{precondition}.wrap("") + "</D:error>"
+}
+
+// wrap renders the element around content, which must already be escaped.
+func (e Element) wrap(content string) string {
+	name := e.XMLName.Local
+	open := name
+	if prefix, ok := prefixes[e.XMLName.Space]; ok {
+		name = prefix + ":" + name
+		open = name
+	} else if e.XMLName.Space != "" {
+		name = "X:" + name
+		open = name + ` xmlns:X="` + strings.ReplaceAll(Text(e.XMLName.Space), `"`, "&quot;") + `"`
+	}
+	if content == "" {
+		return "<" + open + "/>"
+	}
+	return "<" + open + ">" + content + "</" + name + ">"
+}
+
+// Tag renders an empty element, for values such as resource types.
+func Tag(space, local string) string {
+	return Element{xml.Name{Space: space, Local: local}}.wrap("")
+}
+
+// Href renders a DAV:href element.
+func Href(href string) string {
+	return "<D:href>" + Text(href) + "</D:href>"
+}
+
+// textEscaper escapes character data, keeping carriage returns that XML
+// parsers would otherwise normalize away.
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+// Text escapes character data.
+func Text(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func status(code int) string {
+	return fmt.Sprintf("<D:status>HTTP/1.1 %d %s</D:status>", code, http.StatusText(code))
+}
+
+func sortedNames(m map[xml.Name]string) []xml.Name {
+	names := make([]xml.Name, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Space != names[j].Space {
+			return names[i].Space < names[j].Space
+		}
+		return names[i].Local < names[j].Local
+	})
+	return names
+}
@@ -0,0 +1,182 @@
+package caldav
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"my-go-project/ical"
+)
+
+// CompFilter is a CALDAV:comp-filter element.
+type CompFilter struct {
+	Name         string       `xml:"name,attr"`
+	IsNotDefined *struct{}    `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *TimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	PropFilters  []PropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+	CompFilters  []CompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// PropFilter is a CALDAV:prop-filter element.
+type PropFilter struct {
+	Name         string     `xml:"name,attr"`
+	IsNotDefined *struct{}  `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *TimeRange `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	TextMatch    *TextMatch `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+// TimeRange is a CALDAV:time-range element. Either bound may be empty.
+type TimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// TextMatch is a CALDAV:text-match element. Matching is always case-insensitive.
+type TextMatch struct {
+	Text            string `xml:",chardata"`
+	NegateCondition string `xml:"negate-condition,attr"`
+}
+
+// Match reports whether the calendar object satisfies the filter, whose
+// top-level comp-filter must name VCALENDAR.
+func Match(filter CompFilter, calendar *ical.Component) (bool, error) {
+	if !strings.EqualFold(filter.Name, calendar.Name) {
+		return false, nil
+	}
+	return matchComp(filter, calendar)
+}
+
+func matchComp(filter CompFilter, c *ical.Component) (bool, error) {
+	if filter.TimeRange != nil {
+		ok, err := filter.TimeRange.matchComponent(c)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	for _, child := range filter.CompFilters {
+		matches := c.Components(strings.ToUpper(child.Name))
+		if child.IsNotDefined != nil {
+			if len(matches) > 0 {
+				return false, nil
+			}
+			continue
+		}
+		found := false
+		for _, m := range matches {
+			ok, err := matchComp(child, m)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	for _, pf := range filter.PropFilters {
+		ok, err := matchProp(pf, c)
+		if !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchProp(filter PropFilter, c *ical.Component) (bool, error) {
+	prop := c.Get(strings.ToUpper(filter.Name))
+	if filter.IsNotDefined != nil {
+		return prop == nil, nil
+	}
+	if prop == nil {
+		return false, nil
+	}
+	if filter.TimeRange != nil {
+		t, _, err := ical.ParseTime(prop)
+		if err != nil {
+			return false, nil
+		}
+		start, end, err := filter.TimeRange.bounds()
+		if err != nil {
+			return false, err
+		}
+		if t.Before(start) || !t.Before(end) {
+			return false, nil
+		}
+	}
+	if filter.TextMatch != nil {
+		contains := strings.Contains(strings.ToLower(ical.UnescapeText(prop.Value)),
+			strings.ToLower(strings.TrimSpace(filter.TextMatch.Text)))
+		if filter.TextMatch.NegateCondition == "yes" {
+			contains = !contains
+		}
+		return contains, nil
+	}
+	return true, nil
+}
+
+// bounds parses the range; missing bounds are open-ended.
+func (r *TimeRange) bounds() (start, end time.Time, err error) {
+	start = time.Unix(0, 0).AddDate(-100, 0, 0)
+	end = time.Unix(0, 0).AddDate(1000, 0, 0)
+	if r.Start != "" {
+		if start, _, err = ical.ParseTime(&ical.Property{Value: r.Start}); err != nil {
+			return start, end, fmt.Errorf("invalid time-range start %q", r.Start)
+		}
+	}
+	if r.End != "" {
+		if end, _, err = ical.ParseTime(&ical.Property{Value: r.End}); err != nil {
+			return start, end, fmt.Errorf("invalid time-range end %q", r.End)
+		}
+	}
+	return start, end, nil
+}
+
+// matchComponent applies the time-range rules of RFC 4791 section 9.9 for
+// the properties todos and mirrored events carry.
+func (r *TimeRange) matchComponent(c *ical.Component) (bool, error) {
+	start, end, err := r.bounds()
+	if err != nil {
+		return false, err
+	}
+	get := func(name string) (time.Time, bool) {
+		if p := c.Get(name); p != nil {
+			if t, _, err := ical.ParseTime(p); err == nil {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	switch c.Name {
+	case "VEVENT":
+		dtstart, ok := get("DTSTART")
+		if !ok {
+			return false, nil
+		}
+		dtend, ok := get("DTEND")
+		if !ok || !dtend.After(dtstart) {
+			return !start.After(dtstart) && end.After(dtstart), nil
+		}
+		return start.Before(dtend) && end.After(dtstart), nil
+	case "VTODO":
+		if due, ok := get("DUE"); ok {
+			return start.Before(due) && !end.Before(due), nil
+		}
+		created, hasCreated := get("CREATED")
+		completed, hasCompleted := get("COMPLETED")
+		switch {
+		case hasCompleted && hasCreated:
+			return (!start.After(created) || !start.After(completed)) &&
+				(!end.Before(created) || !end.Before(completed)), nil
+		case hasCompleted:
+			return !start.After(completed) && !end.Before(completed), nil
+		case hasCreated:
+			return end.After(created), nil
+		}
+		return true, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the path of the config
+// file, which the -config flag overrides.
+const FileEnv = "CONFIG_FILE"
+
+// Redacted replaces secrets in Print.
+const Redacted = "[redacted]"
+
+// setting is one leaf of a Config.
+type setting struct {
+	key    string // Dotted key, e.g. "database.port"
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists the settings of cfg in declaration order.
+func settings(cfg *Config) []setting {
+	var list []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			key := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			list = append(list, setting{
+				key:    key,
+				env:    field.Tag.Get("env"),
+				usage:  field.Tag.Get("usage"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return list
+}
+
+// envOf returns the environment variable of a key.
+func envOf(key string) string {
+	for _, s := range settings(&Config{}) {
+		if s.key == key {
+			return s.env
+		}
+	}
+	return ""
+}
+
+// set parses s into the setting.
+func (s setting) set(value string) error {
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		s.value.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		s.value.SetBool(b)
+	default:
+		panic("config: unsupported type " + s.value.Type().String())
+	}
+	return nil
+}
+
+// flagValue records a flag; flags are applied after the file and the
+// environment, which the -config flag must be known to read.
+type flagValue struct {
+	setting setting
+	set     *[]func() error
+	isBool  bool
+}
+
+func (f *flagValue) String() string { return "" }
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+func (f *flagValue) Set(value string) error {
+	s := f.setting
+	*f.set = append(*f.set, func() error {
+		if err := s.set(value); err != nil {
+			return &FieldError{Key: s.key, Msg: "-" + s.key + ": " + err.Error()}
+		}
+		return nil
+	})
+	return nil
+}
+
+// Load builds the configuration from, in order of increasing precedence, the
+// defaults, the file named by -config or CONFIG_FILE (YAML, or TOML when it
+// ends in .toml), the environment and the flags in args. Every environment
+// variable NAME can instead be given as NAME_FILE, the path of a file holding
+// the value, as Docker and Kubernetes secrets are mounted. The result is
+// validated. Load returns the arguments left after the flags, the
+// subcommand.
+func Load(args []string) (*Config, []string, error) {
+	cfg := Default()
+	list := settings(cfg)
+
+	fs := flag.NewFlagSet("todo", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("config", os.Getenv(FileEnv), "YAML or TOML config file (env "+FileEnv+")")
+	var flags []func() error
+	for _, s := range list {
+		usage := s.usage
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		fs.Var(&flagValue{setting: s, set: &flags, isBool: s.value.Kind() == reflect.Bool}, s.key, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return nil, nil, err
+	}
+
+	if *path != "" {
+		if err := loadFile(cfg, *path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	for _, s := range list {
+		value, ok, err := lookupEnv(s.env)
+		if err != nil {
+			errs = append(errs, &FieldError{Key: s.key, Env: s.env, Msg: err.Error()})
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := s.set(value); err != nil {
+			errs = append(errs, &FieldError{Key: s.key, Env: s.env, Msg: err.Error()})
+		}
+	}
+	for _, apply := range flags {
+		if err := apply(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// lookupEnv reads name, or the file named by name_FILE.
+func lookupEnv(name string) (string, bool, error) {
+	if name == "" {
+		return "", false, nil
+	}
+	value, ok := os.LookupEnv(name)
+	file, fromFile := os.LookupEnv(name + "_FILE")
+	switch {
+	case ok && fromFile:
+		return "", false, fmt.Errorf("set %s or %s_FILE, not both", name, name)
+	case !fromFile:
+		return value, ok, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
+}
+
+// loadFile reads the settings in a YAML or TOML file into cfg. Unknown keys
+// are errors, so that typos do not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		meta, err := toml.Decode(string(content), cfg)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("config file %s: unknown setting %s", path, undecoded[0])
+		}
+		return nil
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Print writes the configuration as YAML with its secrets redacted. Only the
+// password of a URL is, so that the rest can be checked.
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	for _, s := range settings(&redacted) {
+		if !s.secret || s.value.String() == "" {
+			continue
+		}
+		// A list of URLs has each redacted
+		values := strings.Split(s.value.String(), ",")
+		for i, value := range values {
+			values[i] = redact(strings.TrimSpace(value))
+		}
+		s.value.SetString(strings.Join(values, ","))
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&redacted); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// redact hides a secret, or only the password when it is a URL.
+func redact(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return Redacted
+	}
+	if query := u.Query(); query.Has("password") {
+		query.Set("password", Redacted)
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
@@ -1,58 +1,280 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 
+	"my-go-project/audit"
+	"my-go-project/config"
+	"my-go-project/logging"
+	"my-go-project/metrics"
 	"my-go-project/models"
+	"my-go-project/tracing"
 
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-// Init initializes the database connection and performs migrations
-func Init() {
-	// Database connection string from environment variables
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
-		os.Getenv("POSTGRES_HOSTNAME"),
-		os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"),
-		os.Getenv("POSTGRES_DB"),
-		os.Getenv("POSTGRES_PORT"),
-		os.Getenv("POSTGRES_SSLMODE"),
-		os.Getenv("POSTGRES_TIMEZONE"),
-	)
-
-	// Configure GORM logger for SQL query logging
-	logLevel := logger.Silent
-	switch os.Getenv("GORM_LOG_LEVEL") {
-	case "Info":
-		logLevel = logger.Info
-	case "Warn":
-		logLevel = logger.Warn
-	case "Error":
-		logLevel = logger.Error
-	}
-	config := &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
-	}
-
-	// Connect to the database
+// Init connects to the database, waiting for it as Connect does, routes
+// reads to the replicas when there are any, registers the audit, metrics and
+// tracing callbacks, and migrates the schema.
+func Init(cfg config.Database) {
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), config)
+	DB, err = Connect(context.Background(), cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+		logging.Fatal("Failed to connect to the database", "error", err)
 	}
-	// Auto-migrate all registered models
+	if replicas := cfg.Replicas(); len(replicas) > 0 {
+		dialectors := make([]gorm.Dialector, len(replicas))
+		for i, replica := range replicas {
+			dialectors[i] = postgres.Open(replica)
+		}
+		if err := UseReplicas(DB, cfg, dialectors...); err != nil {
+			logging.Fatal("Failed to set up the read replicas", "error", err)
+		}
+	}
+	// Time and trace every statement and export the connection pool
+	name := cfg.Name
+	if cfg.Driver == "sqlite" {
+		name = "sqlite"
+	}
+	if err := metrics.RegisterDB(DB, name); err != nil {
+		logging.Fatal("Failed to register database metrics", "error", err)
+	}
+	if err := DB.Use(tracing.GormPlugin{}); err != nil {
+		logging.Fatal("Failed to register database tracing", "error", err)
+	}
+	if err := Migrate(DB); err != nil {
+		logging.Fatal("Failed to migrate the database", "error", err)
+	}
+	// Record every mutation in the activity log, once migrated so the
+	// backfills do not leave an entry without an actor for every todo
+	if err := audit.Register(DB); err != nil {
+		logging.Fatal("Failed to register audit callbacks", "error", err)
+	}
+}
+
+// Connect opens the database as Open does and waits until it answers,
+// retrying with exponential backoff for up to cfg.ConnectTimeoutSeconds, so
+// that the app can start before the database does.
+func Connect(ctx context.Context, cfg config.Database) (*gorm.DB, error) {
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(time.Duration(cfg.ConnectTimeoutSeconds) * time.Second)
+	wait := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = Ping(pingCtx, db)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			closePool(db)
+			return nil, fmt.Errorf("database not reachable after %d attempts: %w", attempt, err)
+		}
+		slog.WarnContext(ctx, "Database not reachable, retrying", "attempt", attempt, "retry_in", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			closePool(db)
+			return nil, ctx.Err()
+		}
+		wait = min(wait*2, 10*time.Second)
+	}
+}
+
+// Open returns the database cfg selects, PostgreSQL or SQLite, with its
+// connection pool sized as cfg says, sending GORM's logs, and warnings
+// about slow statements, to slog. It does not wait for the database to
+// answer; see Connect.
+func Open(cfg config.Database) (*gorm.DB, error) {
+	gormConfig := &gorm.Config{
+		Logger:               logging.NewGormLogger(cfg.LogLevel, time.Duration(cfg.SlowQueryMS)*time.Millisecond),
+		DisableAutomaticPing: true,
+	}
+	dialector := postgres.Open(cfg.DSN())
+	if cfg.Driver == "sqlite" {
+		if cfg.Path != ":memory:" {
+			if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o755); err != nil {
+				return nil, err
+			}
+		}
+		dialector = sqlite.Open(SQLiteDSN(cfg.Path))
+	}
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	configurePool(sqlDB, cfg)
+	return db, nil
+}
+
+// configurePool sizes a connection pool; settings of zero keep Go's
+// defaults.
+func configurePool(pool *sql.DB, cfg config.Database) {
+	if cfg.MaxOpenConns > 0 {
+		pool.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		pool.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	// A database in memory lasts only as long as a connection to it
+	if cfg.Driver == "sqlite" && cfg.Path == ":memory:" {
+		return
+	}
+	pool.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second)
+	pool.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second)
+}
+
+// SQLiteDSN returns the connection string for the SQLite database at path,
+// or for a database in memory, shared by the pool's connections, when path
+// is ":memory:". Foreign keys are enforced as PostgreSQL enforces them, LIKE
+// is case-sensitive as it is there, and transactions take the write lock
+// up front, so that concurrent writers wait for each other for up to five
+// seconds instead of failing.
+func SQLiteDSN(path string) string {
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=case_sensitive_like(1)&_txlock=immediate"
+	if path == ":memory:" {
+		return "file::memory:?cache=shared&" + params
+	}
+	return "file:" + path + "?" + params + "&_pragma=journal_mode(WAL)"
+}
+
+// Migrate creates and updates the tables of the registered models, and
+// brings the data of older versions up to date.
+func Migrate(db *gorm.DB) error {
 	for _, model := range models.GetRegisteredModels() {
-		err := DB.AutoMigrate(model)
+		if err := db.AutoMigrate(model); err != nil {
+			return fmt.Errorf("migrating %T: %w", model, err)
+		}
+	}
+	// Todos created before UIDs existed need one for calendar sync
+	if err := assignUIDs(db); err != nil {
+		return fmt.Errorf("assigning todo UIDs: %w", err)
+	}
+	if err := migrateDueDates(db); err != nil {
+		return fmt.Errorf("migrating due dates: %w", err)
+	}
+	// Todos completed before completion times were kept count as completed
+	// when they were last changed
+	if err := db.Model(&models.Todo{}).Unscoped().Where("completed = ? AND completed_at IS NULL", true).
+		UpdateColumn("completed_at", gorm.Expr("updated_at")).Error; err != nil {
+		return fmt.Errorf("backfilling completion times: %w", err)
+	}
+	return nil
+}
+
+// assignUIDs gives every todo without a UID a new one. PostgreSQL makes
+// them itself; SQLite has no UUID function, so they are made here.
+func assignUIDs(db *gorm.DB) error {
+	missing := db.Model(&models.Todo{}).Unscoped().Where("uid IS NULL OR uid = ''")
+	if db.Dialector.Name() == "postgres" {
+		return missing.Update("uid", gorm.Expr("gen_random_uuid()")).Error
+	}
+	var ids []uint
+	if err := missing.Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := db.Model(&models.Todo{}).Unscoped().Where("id = ?", id).
+			UpdateColumn("uid", uuid.NewString()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the connection pool, waiting for queries in progress.
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// closePool closes the connections of a database that failed to start.
+func closePool(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// Ping checks that the database answers.
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// PendingMigrations lists the tables and columns of the registered models
+// that are missing from the database, which a restart would migrate.
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	var pending []string
+	for _, model := range models.GetRegisteredModels() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		table := stmt.Schema.Table
+		if !db.Migrator().HasTable(model) {
+			pending = append(pending, table)
+			continue
+		}
+		columns, err := db.Migrator().ColumnTypes(model)
 		if err != nil {
-			log.Fatalf("Failed to migrate model %T: %v", model, err)
+			return nil, err
+		}
+		existing := make(map[string]bool, len(columns))
+		for _, column := range columns {
+			existing[column.Name()] = true
 		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !field.IgnoreMigration && !existing[field.DBName] {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
+	}
+	return pending, nil
+}
+
+// migrateDueDates moves the old zoneless due_date column into due_on and
+// due_at. Midnight meant a whole day; anything else was a UTC wall clock.
+// Only PostgreSQL databases are old enough to have the column.
+func migrateDueDates(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" || !db.Migrator().HasColumn(&models.Todo{}, "due_date") {
+		return nil
 	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE todos SET due_on = due_date::date
+			WHERE due_date IS NOT NULL AND due_date::time = '00:00'`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE todos SET due_at = due_date AT TIME ZONE 'UTC'
+			WHERE due_date IS NOT NULL AND due_date::time <> '00:00'`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Todo{}, "due_date")
+	})
 }
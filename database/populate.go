@@ -1,32 +1,41 @@
 package database
 
 import (
-	"log"
+	"log/slog"
 	"my-go-project/models"
-	"my-go-project/utils"
 
 	"gorm.io/gorm"
 )
 
 // PopulateDatabase populates the database with fixture data
-func PopulateDatabase(db *gorm.DB) {
+func PopulateDatabase(db *gorm.DB) error {
 	todos := []models.Todo{
 		{Subject: "Buy groceries", Completed: false},
 		{Subject: "Read a book", Completed: true},
 		{Subject: "Write some code", Completed: false},
-		{Subject: "Due tomorrow", Completed: false, DueDate: utils.ParseDate("2023-10-01")}, // Updated to use utils.ParseDate
+		{Subject: "Due tomorrow", Completed: false, DueDate: models.MustParseDueDate("2023-10-01")},
 		{Subject: "Some notes", Completed: false,
 			Notes: []models.Note{
 				{Note: "Note 1"},
 				{Note: "Note 2"}},
 		},
+		{Subject: "Pack for the trip", Completed: false,
+			Checklist: []models.ChecklistItem{
+				{Text: "Charger", Done: true, Position: 0},
+				{Text: "Passport", Position: 1},
+				{Text: "Adapter", Position: 2}},
+		},
 	}
 
-	db.Transaction(func(tx *gorm.DB) error {
+	err := Transaction(db, func(tx *gorm.DB) error {
 		if err := tx.Create(&todos).Error; err != nil {
 			return err
 		}
 		return nil
 	})
-	log.Println("Database populated with fixture data.")
+	if err != nil {
+		return err
+	}
+	slog.Info("Database populated with fixture data")
+	return nil
 }
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"my-go-project/config"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type replicaKey struct{}
+
+// WithReplicaReads returns a context whose queries may be answered by a read
+// replica. Only reads that can tolerate replication lag should use it, such
+// as those of GET requests; everything else reads from the primary, which
+// sees its own writes at once.
+func WithReplicaReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+// replicaReads reports whether ctx allows reading from a replica.
+func replicaReads(ctx context.Context) bool {
+	allowed, _ := ctx.Value(replicaKey{}).(bool)
+	return allowed
+}
+
+// UseReplicas sends the queries of contexts from WithReplicaReads to one of
+// replicas, picked at random, with pools sized as cfg says. Writes, queries
+// in transactions and queries of other contexts go to the primary.
+func UseReplicas(db *gorm.DB, cfg config.Database, replicas ...gorm.Dialector) error {
+	resolver := dbresolver.Register(dbresolver.Config{Replicas: replicas}).
+		SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second).
+		SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second)
+	if cfg.MaxOpenConns > 0 {
+		resolver.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		resolver.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+
+	// dbresolver sends every read to the replicas; send those that may not
+	// go there back to the primary before they run
+	primary := func(db *gorm.DB) {
+		if !replicaReads(db.Statement.Context) {
+			dbresolver.Write.ModifyStatement(db.Statement)
+		}
+	}
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("database:primary_query", primary); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:primary_row", primary); err != nil {
+		return err
+	}
+	return cb.Raw().Before("gorm:raw").Register("database:primary_raw", primary)
+}
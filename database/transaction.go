@@ -0,0 +1,47 @@
+package database
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// transactionAttempts is how often Transaction runs a transaction that keeps
+// failing to serialize.
+const transactionAttempts = 4
+
+// Transaction runs fn in a transaction as db.Transaction does, running it
+// again, after a short pause, when PostgreSQL aborts it for a serialization
+// failure or a deadlock; fn must therefore only change the database. Within
+// another transaction fn runs once, as the outer transaction is the one to
+// retry.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, nested := db.Statement.ConnPool.(gorm.TxCommitter); nested {
+		return db.Transaction(fn)
+	}
+	ctx := db.Statement.Context
+	wait := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := db.Transaction(fn)
+		if err == nil || !Retryable(err) || attempt == transactionAttempts {
+			return err
+		}
+		slog.WarnContext(ctx, "Transaction failed to serialize, retrying", "attempt", attempt, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// Retryable reports whether err aborted a transaction that may succeed when
+// run again: a serialization failure or a deadlock.
+func Retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
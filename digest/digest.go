@@ -0,0 +1,110 @@
+// Package digest builds and sends the digest emails: every morning a list of
+// what is due today, what is overdue and what was recently completed, and on
+// Mondays a summary of the week ahead instead.
+package digest
+
+import (
+	"sort"
+	"time"
+
+	"my-go-project/models"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of digest
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+)
+
+// MaxItems limits each section of a digest.
+const MaxItems = 50
+
+// BaseURL is where links in digests point, without a trailing slash.
+var BaseURL = "http://localhost:8080"
+
+// Digest is what one user is told on one day.
+type Digest struct {
+	Kind     string
+	User     *models.User
+	Date     time.Time // Civil date, midnight UTC
+	SendTime time.Time // When the digest is due, in the user's zone
+	BaseURL  string
+
+	Overdue   []models.Todo
+	DueToday  []models.Todo
+	DueLater  []models.Todo // Due later this week, in weekly digests
+	Completed []models.Todo // Since the previous daily or weekly digest
+}
+
+// Empty reports whether the digest has nothing to tell.
+func (d *Digest) Empty() bool {
+	return len(d.Overdue)+len(d.DueToday)+len(d.DueLater)+len(d.Completed) == 0
+}
+
+// KindFor returns the kind of digest user gets on the civil date day, or ""
+// if the user gets none that day.
+func KindFor(user *models.User, day time.Time) string {
+	switch {
+	case day.Weekday() == time.Monday && user.DigestWeekly:
+		return Weekly
+	case day.Weekday() != time.Monday && user.DigestDaily:
+		return Daily
+	}
+	return ""
+}
+
+// SendTime returns when user's digest for the civil date day is due.
+func SendTime(user *models.User, day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), user.DigestHour, 0, 0, 0, user.Location())
+}
+
+// Build collects the digest of the given kind for user on the civil date
+// day, as of its send time.
+func Build(db *gorm.DB, user *models.User, kind string, day time.Time) (*Digest, error) {
+	loc := user.Location()
+	d := &Digest{
+		Kind:     kind,
+		User:     user,
+		Date:     day,
+		SendTime: SendTime(user, day),
+		BaseURL:  BaseURL,
+	}
+	if err := db.Where(models.OverdueCondition(d.SendTime, loc)).Limit(MaxItems).Find(&d.Overdue).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("completed = ?", false).Where(models.DueBetween(day, day.AddDate(0, 0, 1), loc)).Limit(MaxItems).Find(&d.DueToday).Error; err != nil {
+		return nil, err
+	}
+	since := d.SendTime.AddDate(0, 0, -1)
+	if kind == Weekly {
+		since = d.SendTime.AddDate(0, 0, -7)
+		if err := db.Where("completed = ?", false).Where(models.DueBetween(day.AddDate(0, 0, 1), day.AddDate(0, 0, 7), loc)).Limit(MaxItems).Find(&d.DueLater).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := db.Where("completed = ? AND completed_at >= ? AND completed_at < ?", true, since.UTC(), d.SendTime.UTC()).
+		Order("completed_at DESC").Limit(MaxItems).Find(&d.Completed).Error; err != nil {
+		return nil, err
+	}
+
+	for _, todos := range [][]models.Todo{d.Overdue, d.DueToday, d.DueLater} {
+		sortByDueDate(todos)
+		for i := range todos {
+			todos[i].SetDueStatus(d.SendTime, loc)
+		}
+	}
+	return d, nil
+}
+
+// sortByDueDate puts the todos that are due first first.
+func sortByDueDate(todos []models.Todo) {
+	sort.SliceStable(todos, func(i, j int) bool {
+		a, b := todos[i].DueDate, todos[j].DueDate
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.Time.Before(b.Time)
+	})
+}
@@ -0,0 +1,128 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"my-go-project/models"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html.tmpl"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt.tmpl"))
+)
+
+// view is what the templates see.
+type view struct {
+	Subject  string
+	Sections []section
+	BaseURL  string
+}
+
+type section struct {
+	Title string
+	Items []item
+}
+
+type item struct {
+	Subject  string
+	Due      string
+	Priority string
+}
+
+// Message is an email with plain-text and HTML bodies.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Render writes the digest as an email to its user.
+func Render(d *Digest) (*Message, error) {
+	data := view{Subject: Subject(d), BaseURL: d.BaseURL}
+	loc := d.User.Location()
+	add := func(title string, todos []models.Todo) {
+		if len(todos) == 0 {
+			return
+		}
+		s := section{Title: title}
+		for _, todo := range todos {
+			s.Items = append(s.Items, item{Subject: todo.Subject, Due: formatDue(todo, loc), Priority: priorityMark(todo.Priority)})
+		}
+		data.Sections = append(data.Sections, s)
+	}
+	add("Overdue", d.Overdue)
+	add("Due today", d.DueToday)
+	add("Later this week", d.DueLater)
+	if d.Kind == Weekly {
+		add(fmt.Sprintf("Completed last week (%d)", len(d.Completed)), d.Completed)
+	} else {
+		add(fmt.Sprintf("Completed since yesterday (%d)", len(d.Completed)), d.Completed)
+	}
+
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return nil, err
+	}
+	return &Message{To: d.User.Email, Subject: data.Subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+// Subject is the subject line of the digest, e.g. "Tuesday 4 March: 2 due
+// today, 1 overdue".
+func Subject(d *Digest) string {
+	var counts []string
+	if n := len(d.DueToday); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d due today", n))
+	}
+	if n := len(d.DueLater); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d due this week", n))
+	}
+	if n := len(d.Overdue); n > 0 {
+		counts = append(counts, fmt.Sprintf("%d overdue", n))
+	}
+	if len(counts) == 0 {
+		counts = append(counts, "nothing due")
+	}
+	prefix := d.Date.Format("Monday 2 January")
+	if d.Kind == Weekly {
+		prefix = "Week of " + d.Date.Format("2 January")
+	}
+	return prefix + ": " + strings.Join(counts, ", ")
+}
+
+// formatDue writes a due date in the user's zone, e.g. "Tue 4 Mar" or
+// "Tue 4 Mar 09:30".
+func formatDue(todo models.Todo, loc *time.Location) string {
+	if todo.DueDate == nil {
+		return ""
+	}
+	if todo.DueDate.DateOnly {
+		return todo.DueDate.Time.Format("Mon 2 Jan")
+	}
+	return todo.DueDate.Time.In(loc).Format("Mon 2 Jan 15:04")
+}
+
+// priorityMark writes a priority as quick-add does, "!high" and so on.
+func priorityMark(priority int) string {
+	switch priority {
+	case models.PriorityLow:
+		return "!low"
+	case models.PriorityMedium:
+		return "!medium"
+	case models.PriorityHigh:
+		return "!high"
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package digest
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"my-go-project/health"
+	"my-go-project/models"
+	"my-go-project/tracing"
+	"my-go-project/utils"
+
+	"gorm.io/gorm"
+)
+
+// SendDue sends every digest that is due at now: each user with an email
+// address gets one digest a day, at the first run after their digest hour in
+// their own time zone. Empty digests are skipped. It returns how many
+// digests were sent. It stops between users when ctx is cancelled.
+func SendDue(ctx context.Context, db *gorm.DB, mailer Mailer, now time.Time) (int, error) {
+	db = db.WithContext(ctx)
+	var users []models.User
+	if err := db.Where("email <> ? AND (digest_daily = ? OR digest_weekly = ?)", "", true, true).Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range users {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		user := &users[i]
+		loc := user.Location()
+		day := models.CivilDate(now, loc)
+		date := day.Format(utils.DateLayout)
+		kind := KindFor(user, day)
+		if kind == "" || user.DigestSentOn == date || now.Before(SendTime(user, day)) {
+			continue
+		}
+
+		// Claim the day first, so that a second instance does not send the same
+		// digest; the claim is released if sending fails
+		claim := db.Model(&models.User{}).Where("id = ? AND digest_sent_on = ?", user.ID, user.DigestSentOn).
+			Update("digest_sent_on", date)
+		if claim.Error != nil {
+			return sent, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		delivered, err := send(ctx, db, mailer, user, kind, day)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error sending digest", "kind", kind, "user_id", user.ID, "error", err)
+			// Release the claim even when sending failed because ctx was cancelled
+			release := db.WithContext(context.WithoutCancel(ctx))
+			if err := release.Model(&models.User{}).Where("id = ?", user.ID).Update("digest_sent_on", user.DigestSentOn).Error; err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if delivered {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// send builds, renders and sends one digest, reporting whether it was sent.
+// Empty digests are not.
+func send(ctx context.Context, db *gorm.DB, mailer Mailer, user *models.User, kind string, day time.Time) (bool, error) {
+	d, err := Build(db, user, kind, day)
+	if err != nil || d.Empty() {
+		return false, err
+	}
+	msg, err := Render(d)
+	if err != nil {
+		return false, err
+	}
+	return true, mailer.Send(ctx, msg)
+}
+
+// RunScheduler sends due digests every interval until ctx is cancelled.
+func RunScheduler(ctx context.Context, db *gorm.DB, mailer Mailer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		health.Beat(ctx)
+		var sent int
+		err := tracing.Job(ctx, "digest.send_due", func(ctx context.Context) (err error) {
+			sent, err = SendDue(ctx, db, mailer, time.Now())
+			return err
+		})
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Error sending digests", "error", err)
+		} else if sent > 0 {
+			slog.InfoContext(ctx, "Sent digests", "sent", sent)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package filter
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Fields are the fields terms can test.
+var Fields = []string{"assignee", "completed", "due", "list", "priority", "tag", "text"}
+
+// Options give the viewer's clock, against which relative due dates are read,
+// and who "me" is.
+type Options struct {
+	Now      time.Time      // Default time.Now()
+	Location *time.Location // Default utils.DefaultLocation
+	UserID   uint           // The viewer; 0 when anonymous, to whom nothing is assigned
+}
+
+// Compile turns an expression into a condition on todos. User input only
+// ever reaches the query as bound parameters.
+//
+// Fields:
+//
+//	completed:true|false
+//	due:overdue|today|tomorrow|week|none|any, or due compared with a date,
+//	    e.g. due<=2025-03-01 or due<+7d (today, tomorrow, yesterday and
+//	    +/-N days or weeks are also dates)
+//	priority:none|low|medium|high, also compared, e.g. priority>=medium
+//	tag:name or #name, list:name or @name
+//	assignee:me|none|username
+//	text:word, or a bare word or quoted string, in the subject or notes
+//
+// ":" and "=" mean the same; "!=" negates.
+func Compile(expression string, opts Options) (clause.Expr, error) {
+	node, err := Parse(expression)
+	if err != nil {
+		return clause.Expr{}, err
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Location == nil {
+		opts.Location = utils.DefaultLocation
+	}
+	return opts.build(node)
+}
+
+// Scope compiles expression into a GORM scope on todos.
+func Scope(expression string, opts Options) (func(*gorm.DB) *gorm.DB, error) {
+	condition, err := Compile(expression, opts)
+	if err != nil {
+		return nil, err
+	}
+	condition.SQL = "(" + condition.SQL + ")"
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(condition)
+	}, nil
+}
+
+func (o Options) build(node Node) (clause.Expr, error) {
+	switch n := node.(type) {
+	case *And:
+		return o.join(n.Left, n.Right, " AND ")
+	case *Or:
+		return o.join(n.Left, n.Right, " OR ")
+	case *Not:
+		x, err := o.build(n.X)
+		if err != nil {
+			return x, err
+		}
+		return not(x), nil
+	case *Term:
+		condition, err := o.term(n)
+		if err != nil {
+			return condition, err
+		}
+		if n.Op == "!=" && n.Field != "priority" {
+			return not(condition), nil
+		}
+		return condition, nil
+	}
+	panic("filter: unknown node")
+}
+
+func (o Options) join(left, right Node, op string) (clause.Expr, error) {
+	l, err := o.build(left)
+	if err != nil {
+		return l, err
+	}
+	r, err := o.build(right)
+	if err != nil {
+		return r, err
+	}
+	return clause.Expr{SQL: "(" + l.SQL + ")" + op + "(" + r.SQL + ")", Vars: append(l.Vars, r.Vars...)}, nil
+}
+
+// not negates x. A condition on a NULL column, such as the assignee of an
+// unassigned todo, is neither true nor false, so it counts as false first.
+func not(x clause.Expr) clause.Expr {
+	return clause.Expr{SQL: "NOT COALESCE(" + x.SQL + ", FALSE)", Vars: x.Vars}
+}
+
+func expr(sql string, vars ...interface{}) clause.Expr {
+	return clause.Expr{SQL: sql, Vars: vars}
+}
+
+// term compiles a single term; "!=" is applied by the caller except for
+// priority, which handles every comparison itself.
+func (o Options) term(t *Term) (clause.Expr, error) {
+	equality := t.Op == ":" || t.Op == "=" || t.Op == "!="
+	if !equality && t.Field != "due" && t.Field != "priority" {
+		return clause.Expr{}, errorf(t.FieldPos, "%s can only be compared with :, = or !=", t.Field)
+	}
+
+	switch t.Field {
+	case "completed":
+		completed, err := strconv.ParseBool(strings.ToLower(t.Value))
+		if err != nil {
+			return clause.Expr{}, errorf(t.ValuePos, "completed must be true or false")
+		}
+		return expr("completed = ?", completed), nil
+
+	case "due":
+		return o.due(t)
+
+	case "priority":
+		priority, ok := priorities[strings.ToLower(t.Value)]
+		if !ok {
+			return clause.Expr{}, errorf(t.ValuePos, "priority must be none, low, medium or high")
+		}
+		op := t.Op
+		switch op {
+		case ":":
+			op = "="
+		case "!=":
+			op = "<>"
+		}
+		return expr("priority "+op+" ?", priority), nil
+
+	case "tag":
+		// Tags are stored as a JSON array, so look for the quoted tag
+		quoted, _ := json.Marshal(t.Value)
+		return expr(`tags LIKE ? ESCAPE '\'`, "%"+escapeLike(string(quoted))+"%"), nil
+
+	case "list":
+		return expr("list = ?", t.Value), nil
+
+	case "assignee":
+		return Assignee(t.Value, o.UserID), nil
+
+	case "text":
+		pattern := "%" + escapeLike(strings.ToLower(t.Value)) + "%"
+		return expr(`LOWER(subject) LIKE ? ESCAPE '\' OR EXISTS (SELECT 1 FROM notes WHERE notes.todo_id = todos.id `+
+			`AND notes.deleted_at IS NULL AND LOWER(notes.note) LIKE ? ESCAPE '\')`, pattern, pattern), nil
+	}
+	return clause.Expr{}, errorf(t.FieldPos, "unknown field %q; expected one of %s", t.Field, strings.Join(Fields, ", "))
+}
+
+// Assignee is the condition that todos are assigned to "me", the user with
+// ID userID (nobody when 0), to "none" or to the user with a username.
+func Assignee(value string, userID uint) clause.Expr {
+	switch value {
+	case "me":
+		return expr("assignee_id = ?", userID)
+	case "none":
+		return expr("assignee_id IS NULL")
+	}
+	return expr("assignee_id IN (SELECT id FROM users WHERE username = ? AND deleted_at IS NULL)", value)
+}
+
+var priorities = map[string]int{
+	"none": models.PriorityNone, "low": models.PriorityLow, "medium": models.PriorityMedium, "high": models.PriorityHigh,
+	"0": models.PriorityNone, "1": models.PriorityLow, "2": models.PriorityMedium, "3": models.PriorityHigh,
+}
+
+func (o Options) due(t *Term) (clause.Expr, error) {
+	today := models.CivilDate(o.Now, o.Location)
+	if t.Op == ":" || t.Op == "=" || t.Op == "!=" {
+		switch strings.ToLower(t.Value) {
+		case "overdue":
+			return models.OverdueCondition(o.Now, o.Location), nil
+		case "week":
+			monday := models.StartOfWeek(today)
+			return models.DueBetween(monday, monday.AddDate(0, 0, 7), o.Location), nil
+		case "none":
+			return expr("due_on IS NULL AND due_at IS NULL"), nil
+		case "any":
+			return expr("due_on IS NOT NULL OR due_at IS NOT NULL"), nil
+		}
+	}
+
+	day, ok := relativeDate(t.Value, today)
+	if !ok {
+		return clause.Expr{}, errorf(t.ValuePos, "due must be overdue, week, none, any or a date such as 2025-03-01, today or +7d")
+	}
+	var none time.Time
+	switch t.Op {
+	case "<":
+		return models.DueBetween(none, day, o.Location), nil
+	case "<=":
+		return models.DueBetween(none, day.AddDate(0, 0, 1), o.Location), nil
+	case ">":
+		return models.DueBetween(day.AddDate(0, 0, 1), none, o.Location), nil
+	case ">=":
+		return models.DueBetween(day, none, o.Location), nil
+	}
+	return models.DueBetween(day, day.AddDate(0, 0, 1), o.Location), nil
+}
+
+var relativeDays = regexp.MustCompile(`^([+-]\d{1,4})([dw])$`)
+
+// relativeDate reads a civil date relative to today.
+func relativeDate(s string, today time.Time) (time.Time, bool) {
+	switch strings.ToLower(s) {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+	if m := relativeDays.FindStringSubmatch(strings.ToLower(s)); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if m[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, n), true
+	}
+	day, err := utils.ParseDate(s)
+	return day, err == nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
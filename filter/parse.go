@@ -0,0 +1,281 @@
+// Package filter implements the expression language of saved views, such as
+//
+//	due:overdue and priority:high
+//	due<=+7d not completed
+//	(#home or tag:garden) and text:"lawn mower"
+//
+// An expression is a list of terms joined by "and" (which may be left out),
+// "or" and "not", with parentheses for grouping. A term is field:value, a
+// comparison such as priority>=medium, #tag, @list, or a bare word or quoted
+// string matched against subjects and notes. See Compile for the fields.
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the longest expression accepted, in characters.
+const MaxLength = 1000
+
+// maxDepth limits nesting so that hostile expressions cannot exhaust the stack.
+const maxDepth = 50
+
+// Error is a syntax or semantic error at a character offset of the expression.
+type Error struct {
+	Pos int    `json:"position"`
+	Msg string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Node is a parsed expression.
+type Node interface {
+	node()
+}
+
+// And matches todos matching both sides.
+type And struct{ Left, Right Node }
+
+// Or matches todos matching either side.
+type Or struct{ Left, Right Node }
+
+// Not matches todos not matching X.
+type Not struct{ X Node }
+
+// Term is a single condition. Bare words are terms on the text field.
+type Term struct {
+	Field    string
+	Op       string // ":", "=", "!=", "<", "<=", ">" or ">="
+	Value    string
+	FieldPos int
+	ValuePos int
+}
+
+func (*And) node()  {}
+func (*Or) node()   {}
+func (*Not) node()  {}
+func (*Term) node() {}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isOpRune(r rune) bool {
+	return r == ':' || r == '=' || r == '<' || r == '>' || r == '!'
+}
+
+func tokenize(src []rune) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		r := src[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case r == '"':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, errorf(start, "unterminated string")
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				} else if src[i] == '"' {
+					break
+				}
+				b.WriteRune(src[i])
+			}
+			i++
+			tokens = append(tokens, token{tokString, b.String(), start})
+		case isOpRune(r):
+			start := i
+			for i < len(src) && isOpRune(src[i]) {
+				i++
+			}
+			op := string(src[start:i])
+			switch op {
+			case ":", "=", "!=", "<", "<=", ">", ">=":
+			default:
+				return nil, errorf(start, "unknown operator %q", op)
+			}
+			tokens = append(tokens, token{tokOp, op, start})
+		default:
+			start := i
+			for i < len(src) && !unicode.IsSpace(src[i]) && !isOpRune(src[i]) && src[i] != '(' && src[i] != ')' && src[i] != '"' {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, string(src[start:i]), start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether t is the keyword kw, in any case.
+func keyword(t token, kw string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+// Parse parses an expression. Errors are of type *Error.
+func Parse(expression string) (Node, error) {
+	src := []rune(expression)
+	if len(src) > MaxLength {
+		return nil, errorf(MaxLength, "expression is longer than %d characters", MaxLength)
+	}
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, errorf(0, "expression is empty")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %q", t.text)
+	}
+	return node, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for keyword(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if keyword(t, "and") {
+			p.next()
+		} else if t.kind == tokEOF || t.kind == tokRParen || keyword(t, "or") {
+			return left, nil
+		}
+		// Terms next to each other are joined by an implicit "and"
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{left, right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return nil, errorf(p.peek().pos, "expression is nested too deeply")
+	}
+
+	t := p.next()
+	switch {
+	case keyword(t, "not"):
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{x}, nil
+	case t.kind == tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, errorf(closing.pos, "expected )")
+		}
+		return node, nil
+	case t.kind == tokString:
+		return &Term{Field: "text", Op: ":", Value: t.text, FieldPos: t.pos, ValuePos: t.pos}, nil
+	case t.kind == tokWord && (keyword(t, "and") || keyword(t, "or")):
+		return nil, errorf(t.pos, "expected a term before %q", t.text)
+	case t.kind == tokWord:
+		return p.parseTerm(t)
+	case t.kind == tokEOF:
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %q", t.text)
+}
+
+func (p *parser) parseTerm(word token) (Node, error) {
+	if p.peek().kind != tokOp {
+		switch {
+		case strings.HasPrefix(word.text, "#") && len(word.text) > 1:
+			return &Term{Field: "tag", Op: ":", Value: word.text[1:], FieldPos: word.pos, ValuePos: word.pos + 1}, nil
+		case strings.HasPrefix(word.text, "@") && len(word.text) > 1:
+			return &Term{Field: "list", Op: ":", Value: word.text[1:], FieldPos: word.pos, ValuePos: word.pos + 1}, nil
+		}
+		return &Term{Field: "text", Op: ":", Value: word.text, FieldPos: word.pos, ValuePos: word.pos}, nil
+	}
+
+	op := p.next()
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString {
+		return nil, errorf(value.pos, "expected a value after %s", op.text)
+	}
+	return &Term{
+		Field:    strings.ToLower(word.text),
+		Op:       op.text,
+		Value:    value.text,
+		FieldPos: word.pos,
+		ValuePos: value.pos,
+	}, nil
+}
@@ -0,0 +1,195 @@
+// Package health answers the probes of orchestrators and load balancers:
+// whether the process is alive, whether it has started, and whether it is
+// ready for traffic, which takes its dependencies and background workers
+// into account and stops being true as soon as it begins to shut down.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status values of a Report and of each of its checks.
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// ErrDraining fails readiness once a shutdown has begun.
+var ErrDraining = errors.New("shutting down")
+
+// Check reports a problem with a dependency as an error. It must return
+// soon after its context is done.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of a probe.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// OK tells whether every check passed.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker holds the readiness checks and worker heartbeats of the app.
+type Checker struct {
+	timeout time.Duration
+
+	mu         sync.Mutex
+	checks     []namedCheck
+	heartbeats []*Heartbeat
+
+	started  atomic.Bool
+	draining atomic.Bool
+}
+
+// New returns a Checker that gives each check timeout to finish.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a readiness check.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name, check})
+}
+
+// Heartbeat registers a background worker that should beat at least every
+// interval; readiness fails when it has missed two beats or has stopped.
+func (c *Checker) Heartbeat(name string, interval time.Duration) *Heartbeat {
+	h := &Heartbeat{name: name, interval: interval}
+	h.last.Store(time.Now().UnixNano())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.heartbeats = append(c.heartbeats, h)
+	return h
+}
+
+// MarkStarted reports that startup, including migrations, has finished.
+func (c *Checker) MarkStarted() {
+	c.started.Store(true)
+}
+
+// Drain makes readiness fail from now on, so that load balancers stop
+// sending requests before the server stops accepting them.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Live reports that the process is serving requests at all.
+func (c *Checker) Live() Report {
+	return Report{Status: StatusOK}
+}
+
+// Startup reports whether the app has finished starting.
+func (c *Checker) Startup() Report {
+	if !c.started.Load() {
+		return Report{Status: StatusFailing, Checks: map[string]Result{
+			"startup": {Status: StatusFailing, Error: "starting"},
+		}}
+	}
+	return Report{Status: StatusOK}
+}
+
+// Ready runs the checks concurrently, each with its own timeout, and looks
+// at the heartbeats.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	heartbeats := append([]*Heartbeat(nil), c.heartbeats...)
+	c.mu.Unlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks)+len(heartbeats)+1)}
+	var mu sync.Mutex
+	record := func(name string, err error, took time.Duration) {
+		result := Result{Status: StatusOK, DurationMS: took.Milliseconds()}
+		if err != nil {
+			result.Status = StatusFailing
+			result.Error = err.Error()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		report.Checks[name] = result
+		if err != nil {
+			report.Status = StatusFailing
+		}
+	}
+
+	var shutdown error
+	if c.draining.Load() {
+		shutdown = ErrDraining
+	}
+	record("shutdown", shutdown, 0)
+
+	var wg sync.WaitGroup
+	for _, nc := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			record(nc.name, c.run(ctx, nc.check), time.Since(start))
+		}()
+	}
+	wg.Wait()
+
+	now := time.Now()
+	for _, h := range heartbeats {
+		record(h.name, h.check(now), 0)
+	}
+	return report
+}
+
+// run calls check with the timeout, and gives up on it when it does not
+// respect its context.
+func (c *Checker) run(ctx context.Context, check Check) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", c.timeout)
+		}
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", c.timeout)
+	}
+}
+
+// Cached remembers a passing check for ttl, for checks too expensive to run
+// on every probe. Failures are not remembered, so recovery shows at once.
+func Cached(ttl time.Duration, check Check) Check {
+	var passed atomic.Int64 // Unix nanoseconds of the last pass
+	return func(ctx context.Context) error {
+		if last := passed.Load(); last != 0 && time.Since(time.Unix(0, last)) < ttl {
+			return nil
+		}
+		if err := check(ctx); err != nil {
+			return err
+		}
+		passed.Store(time.Now().UnixNano())
+		return nil
+	}
+}
@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStopped fails readiness when a worker has returned while the app is
+// still running.
+var ErrStopped = errors.New("stopped")
+
+// Heartbeat tracks that a background worker is still making progress.
+type Heartbeat struct {
+	name     string
+	interval time.Duration
+	last     atomic.Int64 // Unix nanoseconds
+	stopped  atomic.Bool
+}
+
+// Beat records progress.
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Stop records that the worker has returned.
+func (h *Heartbeat) Stop() {
+	h.stopped.Store(true)
+}
+
+// check fails when the worker has stopped or has missed two beats.
+func (h *Heartbeat) check(now time.Time) error {
+	if h.stopped.Load() {
+		return ErrStopped
+	}
+	if since := now.Sub(time.Unix(0, h.last.Load())); since > 2*h.interval {
+		return fmt.Errorf("no heartbeat for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+type heartbeatKey struct{}
+
+// WithHeartbeat returns a context carrying h, for the worker it is passed to.
+func WithHeartbeat(ctx context.Context, h *Heartbeat) context.Context {
+	return context.WithValue(ctx, heartbeatKey{}, h)
+}
+
+// Beat records progress on the heartbeat in ctx, if there is one. Workers
+// call it once per round.
+func Beat(ctx context.Context) {
+	if h, ok := ctx.Value(heartbeatKey{}).(*Heartbeat); ok {
+		h.Beat()
+	}
+}
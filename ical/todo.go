@@ -0,0 +1,152 @@
+package ical
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"my-go-project/models"
+)
+
+// ProdID identifies this application in generated calendars.
+const ProdID = "-//my-go-project//Todos//EN"
+
+// NewCalendar returns an empty VCALENDAR.
+func NewCalendar(name string) *Component {
+	cal := &Component{Name: "VCALENDAR"}
+	cal.Add("VERSION", "2.0", nil)
+	cal.Add("PRODID", ProdID, nil)
+	cal.Add("CALSCALE", "GREGORIAN", nil)
+	if name != "" {
+		cal.AddText("X-WR-CALNAME", name)
+	}
+	return cal
+}
+
+// addTime appends a DATE or DATE-TIME property for a due date.
+func addTime(c *Component, name string, due models.DueDate) {
+	if due.DateOnly {
+		c.Add(name, FormatDate(due.Time), map[string]string{"VALUE": "DATE"})
+	} else {
+		c.Add(name, FormatDateTime(due.Time), nil)
+	}
+}
+
+// Description joins a todo's notes the way they are exported as DESCRIPTION.
+func Description(todo *models.Todo) string {
+	notes := make([]string, 0, len(todo.Notes))
+	for _, note := range todo.Notes {
+		notes = append(notes, note.Note)
+	}
+	return strings.Join(notes, "\n\n")
+}
+
+// TodoComponent converts a todo, with its notes loaded, into a VTODO.
+func TodoComponent(todo *models.Todo) *Component {
+	c := &Component{Name: "VTODO"}
+	c.AddText("UID", todo.UID)
+	c.Add("DTSTAMP", FormatDateTime(todo.UpdatedAt), nil)
+	c.Add("CREATED", FormatDateTime(todo.CreatedAt), nil)
+	c.Add("LAST-MODIFIED", FormatDateTime(todo.UpdatedAt), nil)
+	c.AddText("SUMMARY", todo.Subject)
+	if todo.DueDate != nil {
+		addTime(c, "DUE", *todo.DueDate)
+	}
+	if todo.RRule != "" {
+		c.Add("RRULE", todo.RRule, nil)
+	}
+	if todo.Completed {
+		c.Add("STATUS", "COMPLETED", nil)
+		completedAt := todo.UpdatedAt
+		if todo.CompletedAt != nil {
+			completedAt = *todo.CompletedAt
+		}
+		c.Add("COMPLETED", FormatDateTime(completedAt), nil)
+		c.Add("PERCENT-COMPLETE", "100", nil)
+	} else {
+		c.Add("STATUS", "NEEDS-ACTION", nil)
+	}
+	if description := Description(todo); description != "" {
+		c.AddText("DESCRIPTION", description)
+	}
+	return c
+}
+
+// EventComponent mirrors a todo's due date as an all-day or zero-length
+// VEVENT, for calendars that do not show tasks. It returns nil for todos
+// without a due date.
+func EventComponent(todo *models.Todo) *Component {
+	if todo.DueDate == nil {
+		return nil
+	}
+	c := &Component{Name: "VEVENT"}
+	c.AddText("UID", todo.UID+"-due")
+	c.Add("DTSTAMP", FormatDateTime(todo.UpdatedAt), nil)
+	c.AddText("SUMMARY", todo.Subject)
+	addTime(c, "DTSTART", *todo.DueDate)
+	if todo.DueDate.DateOnly {
+		addTime(c, "DTEND", *models.NewDueDate(todo.DueDate.AddDate(0, 0, 1), true))
+	} else {
+		addTime(c, "DTEND", *todo.DueDate)
+	}
+	if todo.RRule != "" {
+		c.Add("RRULE", todo.RRule, nil)
+	}
+	c.AddText("RELATED-TO", todo.UID)
+	return c
+}
+
+// ApplyTodo copies the fields of a VTODO onto todo and returns its
+// DESCRIPTION. Fields the VTODO does not set are cleared. A completed todo
+// without a COMPLETED time keeps the one it has, or is stamped now; a todo
+// that is not completed has none.
+func ApplyTodo(c *Component, todo *models.Todo) (description string, err error) {
+	if c.Name != "VTODO" {
+		return "", fmt.Errorf("expected VTODO, got %s", c.Name)
+	}
+	uid := c.Text("UID")
+	if uid == "" {
+		return "", fmt.Errorf("VTODO has no UID")
+	}
+	summary := c.Text("SUMMARY")
+	if summary == "" {
+		return "", fmt.Errorf("VTODO %s has no SUMMARY", uid)
+	}
+	if len(uid) > 255 || len(summary) > 255 {
+		return "", fmt.Errorf("VTODO %s: UID and SUMMARY are limited to 255 bytes", uid)
+	}
+
+	todo.UID = uid
+	todo.Subject = summary
+	todo.DueDate = nil
+	if due := c.Get("DUE"); due != nil {
+		t, dateOnly, err := ParseTime(due)
+		if err != nil {
+			return "", fmt.Errorf("VTODO %s: invalid DUE: %w", uid, err)
+		}
+		todo.DueDate = models.NewDueDate(t, dateOnly)
+	}
+	todo.Completed = strings.EqualFold(c.Text("STATUS"), "COMPLETED") || c.Get("COMPLETED") != nil
+	switch completed := c.Get("COMPLETED"); {
+	case completed != nil:
+		t, _, err := ParseTime(completed)
+		if err != nil {
+			return "", fmt.Errorf("VTODO %s: invalid COMPLETED: %w", uid, err)
+		}
+		todo.CompletedAt = &t
+	case !todo.Completed:
+		todo.CompletedAt = nil
+	case todo.CompletedAt == nil:
+		now := time.Now()
+		todo.CompletedAt = &now
+	}
+
+	todo.RRule = ""
+	if rrule := c.Get("RRULE"); rrule != nil {
+		if !strings.Contains(strings.ToUpper(rrule.Value), "FREQ=") || len(rrule.Value) > 255 {
+			return "", fmt.Errorf("VTODO %s: invalid RRULE %q", uid, rrule.Value)
+		}
+		todo.RRule = rrule.Value
+	}
+	return c.Text("DESCRIPTION"), nil
+}
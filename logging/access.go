@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AccessLog logs a line for every request that reaches it, with the method,
+// route template, path, status, latency and response size; the user and
+// request ID come from the request's user context. Server errors are logged
+// at error level, the rest at info. The query string is left out, as it may
+// hold personal data.
+func AccessLog() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		if err := c.Next(); err != nil {
+			// Let the error handler write the response now, so that its
+			// status is the one logged
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(c.UserContext(), level, "request",
+			slog.String("method", strings.Clone(c.Method())),
+			slog.String("route", c.Route().Path),
+			slog.String("path", strings.Clone(c.Path())),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", len(c.Response().Body())),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormLogger sends GORM's logs to slog, with the request ID and trace of the
+// statement's context. Failed statements are logged as errors, statements
+// slower than SlowThreshold as warnings and, at logger.Info, every statement
+// at debug level. SQL is logged with placeholders, never with the values.
+type GormLogger struct {
+	Level         logger.LogLevel
+	SlowThreshold time.Duration // 0 turns slow statement warnings off
+}
+
+// NewGormLogger reads level as silent, error, warn or info.
+func NewGormLogger(level string, slowThreshold time.Duration) *GormLogger {
+	l := &GormLogger{Level: logger.Silent, SlowThreshold: slowThreshold}
+	switch strings.ToLower(level) {
+	case "info":
+		l.Level = logger.Info
+	case "warn":
+		l.Level = logger.Warn
+	case "error":
+		l.Level = logger.Error
+	}
+	return l
+}
+
+// LogMode implements logger.Interface.
+func (l *GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *l
+	copied.Level = level
+	return &copied
+}
+
+// Info implements logger.Interface.
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn implements logger.Interface.
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error implements logger.Interface.
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace implements logger.Interface; GORM calls it after every statement.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.Level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	attrs := func() []slog.Attr {
+		sql, rows := fc()
+		return []slog.Attr{
+			slog.String("sql", sql),
+			slog.Int64("rows", rows),
+			slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+		}
+	}
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.Level >= logger.Error:
+		slog.LogAttrs(ctx, slog.LevelError, "Statement failed", append(attrs(), slog.Any("error", err))...)
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.Level >= logger.Warn:
+		slog.LogAttrs(ctx, slog.LevelWarn, "Slow statement", append(attrs(), slog.Duration("threshold", l.SlowThreshold))...)
+	case l.Level >= logger.Info:
+		slog.LogAttrs(ctx, slog.LevelDebug, "Statement", attrs()...)
+	}
+}
+
+// ParamsFilter keeps the values of statements out of the logs.
+func (l *GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
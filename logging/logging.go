@@ -0,0 +1,126 @@
+// Package logging sets up the app's structured logs: text or JSON lines,
+// each tagged with the request ID, trace and user of the context it was
+// logged with, and with secrets and personal data redacted.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"my-go-project/audit"
+	"my-go-project/config"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sensitiveKeys are redacted wherever they appear in an attribute's key.
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "dsn"}
+
+var (
+	// emailPattern finds email addresses, which are masked to their first
+	// letter and domain
+	emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})`)
+	// urlPasswordPattern finds the password of a URL such as a DSN
+	urlPasswordPattern = regexp.MustCompile(`(://[^:/@\s]+):[^@\s]+@`)
+)
+
+// New returns a logger writing to w in the format and from the level in cfg.
+func New(cfg config.Logging, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(cfg.Level), ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// Init makes a logger from cfg the default, for slog and for the log
+// package alike.
+func Init(cfg config.Logging, w io.Writer) {
+	slog.SetDefault(New(cfg, w))
+}
+
+// ParseLevel reads debug, info, warn or error; anything else is info.
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Redact masks email addresses and URL passwords in s.
+func Redact(s string) string {
+	s = urlPasswordPattern.ReplaceAllString(s, "$1:"+config.Redacted+"@")
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
+
+// redactAttr hides the values of sensitive keys and scrubs strings and
+// errors.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(a.Key, config.Redacted)
+		}
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// contextHandler adds the request ID, trace and user found in the context
+// to each record, and scrubs its message.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	record := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		record.AddAttrs(a)
+		return true
+	})
+	if ctx != nil {
+		if requestID := audit.RequestIDFrom(ctx); requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			record.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+		}
+		if actor, ok := audit.ActorFrom(ctx); ok {
+			record.AddAttrs(slog.String("user", actor.Name))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Fatal logs msg as an error and exits with status 1.
+func Fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -1,46 +1,315 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"log/slog"
+	"my-go-project/audit"
+	"my-go-project/backup"
+	"my-go-project/config"
 	"my-go-project/database"
+	"my-go-project/digest"
+	"my-go-project/health"
+	"my-go-project/logging"
+	"my-go-project/notify"
+	"my-go-project/repository"
 	"my-go-project/routes"
+	"my-go-project/server"
+	"my-go-project/service"
+	"my-go-project/storage"
+	"my-go-project/tracing"
+	"my-go-project/transfer"
+	"my-go-project/undo"
+	"my-go-project/utils"
+	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
+	// Load environment variables from a .env file, if there is one
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Failed to load .env: %v", err)
+	}
+
+	// Settings come from defaults, a config file, the environment and flags;
+	// what is left of the command line is the subcommand
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Println("Error loading .env file")
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if len(args) > 0 && args[0] == "config" {
+		if len(args) != 2 || args[1] != "print" {
+			log.Fatalf("Usage: %s [flags] config print", os.Args[0])
+		}
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print the configuration: %v", err)
+		}
+		return
 	}
 
+	// Log through slog from here on, the log package included
+	logging.Init(cfg.Logging, os.Stderr)
+
+	// Export traces when a collector is configured
+	stopTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logging.Fatal("Failed to set up tracing", "error", err)
+	}
+
+	// Dates and times sent without a zone are read in this one
+	utils.DefaultLocation = cfg.Location()
+
 	// Initialize the database
-	database.Init()
+	database.Init(cfg.Database)
 
-	// Check if the "populate" argument is present
-	if len(os.Args) > 1 && os.Args[1] == "populate" {
-		database.PopulateDatabase(database.DB)
+	// backup writes an archive of the database and the attachments, to FILE
+	// or into the backup directory; restore reads one back
+	if len(args) > 0 && (args[0] == "backup" || args[0] == "restore") {
+		storage.Init(cfg.Storage)
+		if err := runBackupCommand(cfg, args); err != nil {
+			logging.Fatal("Failed to "+args[0], "error", err)
+		}
+		if err := database.Close(); err != nil {
+			logging.Fatal("Failed to close the database", "error", err)
+		}
+		return
 	}
 
-	app := fiber.New()
+	// Check if the "populate" argument is present, optionally followed by a
+	// CSV, JSON or todo.txt file to load instead of the fixtures
+	if len(args) > 1 && args[0] == "populate" {
+		if err := transfer.PopulateFromFile(database.DB, args[1]); err != nil {
+			logging.Fatal("Failed to populate the database", "file", args[1], "error", err)
+		}
+	} else if len(args) > 0 && args[0] == "populate" {
+		if err := database.PopulateDatabase(database.DB); err != nil {
+			logging.Fatal("Failed to populate the database", "error", err)
+		}
+	}
+
+	// Readiness depends on the database, the migrations and the heartbeats
+	// of the background workers, which run until the server has shut down
+	checker := health.New(2 * time.Second)
+	checker.Add("database", func(ctx context.Context) error {
+		return database.Ping(ctx, database.DB)
+	})
+	checker.Add("migrations", health.Cached(time.Minute, func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(database.DB.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("pending: %s", strings.Join(pending, ", "))
+		}
+		return nil
+	}))
+	workers := server.NewWorkers(checker)
+
+	// Open blob storage for attachments and start removing deleted blobs
+	storage.Init(cfg.Storage)
+	workers.Go("blob sweeper", time.Minute, func(ctx context.Context) {
+		storage.RunSweeper(ctx, database.DB, storage.Store, time.Minute)
+	})
+
+	// Prune the activity log according to the retention policy
+	if retention := cfg.ActivityRetention(); retention > 0 {
+		workers.Go("activity retention", 24*time.Hour, func(ctx context.Context) {
+			audit.RunRetention(ctx, database.DB, retention, 24*time.Hour)
+		})
+	}
+	// Back up on a schedule into the backup directory
+	if interval := cfg.BackupInterval(); interval > 0 {
+		workers.Go("backup scheduler", 15*time.Minute, func(ctx context.Context) {
+			backup.RunScheduler(ctx, database.DB, storage.Store, cfg.Backup.Dir, interval, cfg.Backup.Keep)
+		})
+	}
+	undo.Window = cfg.UndoWindow()
+	routes.QueryTimeout = cfg.QueryTimeout()
+	routes.DefaultQuickAddLocale = cfg.QuickAdd.Locale
+
+	// Email digests at each user's chosen hour, when SMTP is configured
+	digest.BaseURL = strings.TrimSuffix(cfg.Server.BaseURL, "/")
+	if mailer := digest.NewMailer(cfg.Mail); mailer != nil {
+		workers.Go("digest scheduler", time.Minute, func(ctx context.Context) {
+			digest.RunScheduler(ctx, database.DB, mailer, time.Minute)
+		})
+	}
+
+	limits := routes.AttachmentLimits{MaxFileSize: cfg.Attachments.MaxBytes, UserQuota: cfg.Attachments.UserQuotaBytes}
+	bodyLimit := fiber.DefaultBodyLimit
+	if limits.MaxFileSize > 0 {
+		bodyLimit = int(limits.MaxFileSize) + 1<<20 // Leave room for multipart overhead
+	}
+	app := fiber.New(fiber.Config{
+		BodyLimit:      bodyLimit,
+		RequestMethods: routes.RequestMethods(), // CalDAV needs PROPFIND and REPORT
+	})
+
+	// Probes and metrics come before everything else, so that no middleware
+	// runs for them; metrics move to their own port when one is set
+	routes.RegisterHealthRoutes(app, checker)
+	if cfg.Server.MetricsAddr == "" {
+		routes.RegisterMetricsRoutes(app)
+	} else {
+		admin := fiber.New(fiber.Config{DisableStartupMessage: true})
+		routes.RegisterMetricsRoutes(admin)
+		ln, err := net.Listen("tcp", cfg.Server.MetricsAddr)
+		if err != nil {
+			logging.Fatal("Failed to listen for metrics", "addr", cfg.Server.MetricsAddr, "error", err)
+		}
+		workers.Go("metrics server", 0, func(ctx context.Context) {
+			if err := server.Serve(ctx, admin, ln, server.Shutdown{Timeout: time.Second}); err != nil {
+				slog.Error("Metrics server stopped", "error", err)
+			}
+		})
+	}
 
 	// Serve static files from the "static" directory
-	app.Static("/", "./static")
+	app.Static("/", cfg.Server.StaticDir)
+
+	// Register middleware first so it runs for every route
+	routes.RegisterMiddleware(app, database.DB)
 
 	// Register routes
 	routes.RegisterExampleRoute(app)
-	routes.RegisterTodoRoutes(app, database.DB)
+	todoRepo := repository.NewGormRepository(database.DB)
+	ports := service.Ports{Undo: undo.NewRecorder(database.DB), Notifier: notify.NewNotifier(database.DB), Users: todoRepo}
+	todoService := service.NewTodoService(todoRepo, ports)
+	routes.RegisterTodoRoutes(app, todoService, service.NewNoteService(todoRepo, ports))
+	routes.RegisterQuickAddRoutes(app, todoService)
+	routes.RegisterUserRoutes(app, database.DB)
+	routes.RegisterViewRoutes(app, database.DB, todoService)
+	routes.RegisterNotificationRoutes(app, database.DB)
+	routes.RegisterStatsRoutes(app, database.DB)
+	routes.RegisterDigestRoutes(app, database.DB)
+	routes.RegisterChecklistRoutes(app, database.DB)
+	routes.RegisterActivityRoutes(app, database.DB)
+	routes.RegisterUndoRoutes(app, database.DB)
+	routes.RegisterCalendarRoutes(app, database.DB, todoService)
+	routes.RegisterDAVRoutes(app, database.DB, todoService)
+	routes.RegisterTransferRoutes(app, database.DB, todoService)
+	routes.RegisterAttachmentRoutes(app, database.DB, storage.Store, limits)
+
+	// List the routes when debugging
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		for _, route := range app.Stack() {
+			for _, r := range route {
+				slog.Debug("Route registered", "method", r.Method, "path", r.Path)
+			}
+		}
+	}
+
+	// Serve until SIGTERM (docker stop, the platform) or SIGINT (Ctrl-C); a
+	// second signal kills the process without waiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	checker.MarkStarted()
+	slog.Info("Listening", "addr", cfg.Server.Addr)
+	err = server.Run(ctx, app, cfg.Server.Addr, server.Shutdown{
+		Drain:   checker.Drain,
+		Delay:   cfg.ShutdownDelay(),
+		Timeout: cfg.ShutdownTimeout(),
+	})
+	if err != nil {
+		slog.Error("Server stopped", "error", err)
+	}
+
+	// Then stop the workers, flush the traces and close the database; exit
+	// with 1 when any of it failed
+	if stopErr := workers.Stop(cfg.ShutdownTimeout()); stopErr != nil {
+		slog.Error("Failed to stop the background workers", "error", stopErr)
+		err = errors.Join(err, stopErr)
+	}
+	tracingCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout())
+	tracingErr := stopTracing(tracingCtx)
+	cancel()
+	if tracingErr != nil {
+		slog.Error("Failed to flush traces", "error", tracingErr)
+		err = errors.Join(err, tracingErr)
+	}
+	if closeErr := database.Close(); closeErr != nil {
+		slog.Error("Failed to close the database", "error", closeErr)
+		err = errors.Join(err, closeErr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+	slog.Info("Shut down cleanly")
+}
 
-	// Debug: Print all registered routes
-	for _, route := range app.Stack() {
-		for _, r := range route {
-			log.Printf("Route registered: %s %s", r.Method, r.Path)
+// runBackupCommand runs "backup [FILE]" or "restore [-merge] FILE".
+func runBackupCommand(cfg *config.Config, args []string) error {
+	ctx := context.Background()
+	if args[0] == "backup" {
+		var path string
+		var manifest *backup.Manifest
+		var err error
+		switch len(args) {
+		case 1:
+			path, manifest, err = backup.WriteFile(ctx, database.DB, storage.Store, cfg.Backup.Dir, cfg.Backup.Keep)
+		case 2:
+			path = args[1]
+			manifest, err = writeBackup(ctx, path)
+		default:
+			return fmt.Errorf("usage: %s [flags] backup [FILE]", os.Args[0])
+		}
+		if err != nil {
+			return err
 		}
+		slog.Info("Wrote backup", "path", path, "tables", len(manifest.Tables), "blobs", len(manifest.Blobs))
+		return nil
+	}
+
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	merge := flags.Bool("merge", false, "add to a database that is not empty, skipping the rows it has already")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s [flags] restore [-merge] FILE", os.Args[0])
+	}
+	manifest, err := backup.Restore(ctx, database.DB, storage.Store, flags.Arg(0), backup.Options{Merge: *merge})
+	if err != nil {
+		return err
 	}
+	rows := 0
+	for _, table := range manifest.Tables {
+		rows += table.Rows
+	}
+	slog.Info("Restored backup", "path", flags.Arg(0), "taken", manifest.CreatedAt, "rows", rows, "blobs", len(manifest.Blobs))
+	return nil
+}
 
-	// Start the server
-	app.Listen(":8080")
+// writeBackup writes a backup to the file at path, removing it again when
+// the backup fails.
+func writeBackup(ctx context.Context, path string) (*backup.Manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := backup.Write(ctx, database.DB, storage.Store, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return manifest, err
 }
@@ -0,0 +1,159 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// ErrTaskNotFound is returned when a task-list index does not exist in the source.
+var ErrTaskNotFound = errors.New("task list item not found")
+
+// Raw HTML in the source is dropped by goldmark (no html.WithUnsafe), and the
+// output is passed through an allow-list policy as a second line of defence.
+var (
+	converter = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	policy    = newPolicy()
+)
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements(
+		"p", "br", "hr", "blockquote", "pre", "code",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"ul", "ol", "li", "em", "strong", "del",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+-]+$`)).OnElements("code")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowStandardURLs()
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	// Task-list checkboxes as rendered by the GFM extension
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^$`)).OnElements("input")
+	return p
+}
+
+// Render converts CommonMark source (with GFM task lists) into sanitized HTML.
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := converter.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// SetTask checks or unchecks the task-list item at the given zero-based index
+// (in document order) and returns the updated source.
+func SetTask(source string, index int, checked bool) (string, error) {
+	src := []byte(source)
+	offsets := taskOffsets(src)
+	if index < 0 || index >= len(offsets) {
+		return "", ErrTaskNotFound
+	}
+
+	mark := byte(' ')
+	if checked {
+		mark = 'x'
+	}
+	src[offsets[index]] = mark
+	return string(src), nil
+}
+
+// taskOffsets returns the byte offset of the mark character inside each "[ ]"
+// task-list checkbox in the source.
+func taskOffsets(src []byte) []int {
+	doc := converter.Parser().Parse(text.NewReader(src))
+
+	var offsets []int
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if _, ok := n.(*extast.TaskCheckBox); !ok {
+			return ast.WalkContinue, nil
+		}
+		// The checkbox is the first inline of its paragraph, so the first line
+		// of the enclosing block starts at the opening bracket.
+		block := n.Parent()
+		if block != nil && block.Lines().Len() > 0 {
+			start := block.Lines().At(0).Start
+			if start+2 < len(src) && src[start] == '[' && src[start+2] == ']' {
+				offsets = append(offsets, start+1)
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return offsets
+}
+
+var mention = regexp.MustCompile(`(?:^|[^\w@./])@(\w(?:[\w.-]*\w)?)`)
+
+// Mentions returns the usernames @mentioned in the source, each once, in the
+// order they first appear. Mentions in code and e-mail addresses are not
+// mentions.
+func Mentions(source string) []string {
+	src := []byte(source)
+	code := codeRanges(src)
+
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mention.FindAllSubmatchIndex(src, -1) {
+		start, end := m[2], m[3]
+		if inRanges(code, start) || seen[string(src[start:end])] {
+			continue
+		}
+		seen[string(src[start:end])] = true
+		names = append(names, string(src[start:end]))
+	}
+	return names
+}
+
+// codeRanges returns the byte ranges of the code spans and code blocks in
+// the source.
+func codeRanges(src []byte) [][2]int {
+	doc := converter.Parser().Parse(text.NewReader(src))
+
+	var ranges [][2]int
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n.(type) {
+		case *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				ranges = append(ranges, [2]int{lines.At(i).Start, lines.At(i).Stop})
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeSpan:
+			for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+				if t, ok := child.(*ast.Text); ok {
+					ranges = append(ranges, [2]int{t.Segment.Start, t.Segment.Stop})
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return ranges
+}
+
+func inRanges(ranges [][2]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time to handle HTTP requests by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	httpInFlight = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being handled, by method.",
+	}, []string{"method"})
+)
+
+// Middleware records every request that reaches it. Requests are labelled
+// with the template of the route that handled them, such as /todos/:id, and
+// never with the raw path; one that no route matched keeps the route of the
+// last middleware it passed. The route is only known once the request has
+// been handled, so requests in flight are counted per method.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		method := strings.Clone(c.Method()) // Fiber reuses the request's memory
+		inFlight := httpInFlight.WithLabelValues(method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		if err := c.Next(); err != nil {
+			// Let the error handler write the response now, so that its
+			// status is the one recorded
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		route := c.Route().Path
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Response().StatusCode())).Inc()
+		return nil
+	}
+}
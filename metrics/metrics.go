@@ -0,0 +1,92 @@
+// Package metrics exposes Prometheus metrics: HTTP requests per route,
+// database queries per table and operation, the connection pool, and domain
+// events such as todos created and completed.
+//
+// Every label takes its values from a fixed set (route templates, table
+// names, methods, status codes), never from request data, so the number of
+// series stays bounded.
+package metrics
+
+import (
+	"my-go-project/audit"
+	"my-go-project/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the app's metrics, along with the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// Domain events, counted from the activity log so that every way of making a
+// change (the API, quick add, CalDAV, imports) is included.
+var (
+	TodosCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "todos_created_total",
+		Help: "Todos created.",
+	})
+	TodosCompleted = factory.NewCounter(prometheus.CounterOpts{
+		Name: "todos_completed_total",
+		Help: "Todos marked as completed.",
+	})
+	TodosDeleted = factory.NewCounter(prometheus.CounterOpts{
+		Name: "todos_deleted_total",
+		Help: "Todos deleted, to the trash or for good.",
+	})
+	NotesAdded = factory.NewCounter(prometheus.CounterOpts{
+		Name: "notes_added_total",
+		Help: "Notes added to todos.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	audit.Observe(countActivity)
+}
+
+// countActivity updates the domain counters for one activity.
+func countActivity(activity models.Activity) {
+	switch activity.EntityType {
+	case "Todo":
+		switch activity.Action {
+		case models.ActionCreate:
+			TodosCreated.Inc()
+		case models.ActionDelete:
+			TodosDeleted.Inc()
+		case models.ActionUpdate:
+			if change, ok := activity.Changes["completed"]; ok && truthy(change.After) && !truthy(change.Before) {
+				TodosCompleted.Inc()
+			}
+		}
+	case "Note":
+		if activity.Action == models.ActionCreate {
+			NotesAdded.Inc()
+		}
+	}
+}
+
+// truthy reads a boolean column as the driver returned it.
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	}
+	return false
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
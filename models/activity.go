@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+func init() {
+	RegisterModel(&Activity{})
+}
+
+// Activity actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore" // A soft-deleted entity was brought back
+)
+
+// Activity is an append-only record of a single mutation of an entity.
+// Rows are written by the audit package's GORM callbacks, never by handlers.
+type Activity struct {
+	ID         uint         `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time    `gorm:"index" json:"created_at"`
+	ActorID    *uint        `gorm:"index" json:"actor_id,omitempty"`
+	Actor      string       `gorm:"size:100" json:"actor"`
+	Action     string       `gorm:"size:20;not null;index" json:"action"`
+	EntityType string       `gorm:"size:50;not null;index:idx_activities_entity" json:"entity_type"`
+	EntityID   uint         `gorm:"not null;index:idx_activities_entity" json:"entity_id"`
+	TodoID     *uint        `gorm:"index" json:"todo_id,omitempty"` // Todo the entity belongs to, if any
+	Changes    FieldChanges `gorm:"type:text" json:"changes"`
+	RequestID  string       `gorm:"size:64;index" json:"request_id,omitempty"`
+}
+
+// FieldChange holds the value of a column before and after a mutation.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// FieldChanges maps column names to their change, stored as JSON text.
+type FieldChanges map[string]FieldChange
+
+// Value implements driver.Valuer.
+func (c FieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (c *FieldChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return fmt.Errorf("cannot scan %T into FieldChanges", value)
+	}
+}
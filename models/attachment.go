@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterModel(&Attachment{})
+	RegisterModel(&BlobDeletion{})
+}
+
+// Attachment is a file uploaded to a Todo. The content lives in blob storage
+// under StorageKey; the row only holds its metadata.
+type Attachment struct {
+	gorm.Model
+	TodoID       uint   `gorm:"not null;index" json:"todo_id"` // Foreign key to Todo
+	UploaderID   *uint  `gorm:"index" json:"uploader_id,omitempty"`
+	Filename     string `gorm:"size:255;not null" json:"filename"`
+	ContentType  string `gorm:"size:255;not null" json:"content_type"`
+	Size         int64  `gorm:"not null" json:"size"`
+	SHA256       string `gorm:"size:64;not null" json:"sha256"`
+	StorageKey   string `gorm:"size:255;not null" json:"-"`
+	ThumbnailKey string `gorm:"size:255" json:"-"`
+	HasThumbnail bool   `gorm:"-" json:"has_thumbnail"`
+}
+
+// AfterFind fills in fields derived from stored columns.
+func (a *Attachment) AfterFind(tx *gorm.DB) error {
+	a.HasThumbnail = a.ThumbnailKey != ""
+	return nil
+}
+
+// BlobDeletion is a blob queued for removal from storage. Rows are written in
+// the same transaction that deletes the owning record, so blobs are never
+// removed for a deletion that was rolled back.
+type BlobDeletion struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Key       string    `gorm:"size:255;not null" json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
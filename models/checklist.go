@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+func init() {
+	RegisterModel(&ChecklistItem{})
+}
+
+// ChecklistItem is a short entry in a Todo's checklist, ordered by Position.
+type ChecklistItem struct {
+	gorm.Model
+	TodoID   uint   `gorm:"not null;index" json:"todo_id"` // Foreign key to Todo
+	Text     string `gorm:"size:500;not null" json:"text"`
+	Done     bool   `gorm:"default:false" json:"done"`
+	Position int    `gorm:"not null;default:0" json:"position"`
+}
+
+// ChecklistProgress summarises how much of a Todo's checklist is done.
+type ChecklistProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
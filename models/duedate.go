@@ -0,0 +1,253 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"my-go-project/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DueDate is when a todo is due: either a whole day or a point in time.
+//
+// A whole day is a floating calendar date, the same day wherever the viewer
+// is. It is held as midnight UTC of the date, stored in the due_on date
+// column and written to JSON as "2006-01-02". A timed due date is an
+// instant, stored in the due_at timestamptz column and written as an RFC 3339
+// timestamp in UTC.
+type DueDate struct {
+	time.Time
+	DateOnly bool
+
+	zoneless bool // Sent as a wall-clock time without a zone, see Localize
+}
+
+// NewDueDate returns the whole day of t's calendar date if dateOnly is set,
+// otherwise the instant t.
+func NewDueDate(t time.Time, dateOnly bool) *DueDate {
+	if dateOnly {
+		return &DueDate{Time: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), DateOnly: true}
+	}
+	return &DueDate{Time: t.UTC()}
+}
+
+// ParseDueDate parses anything utils.ParseDateTime accepts. Dates and times
+// without a zone are read in loc.
+func ParseDueDate(s string, loc *time.Location) (*DueDate, error) {
+	t, kind, err := utils.ParseDateTime(s, loc)
+	if err != nil {
+		return nil, err
+	}
+	due := NewDueDate(t, kind == utils.KindDate)
+	due.zoneless = kind == utils.KindLocal
+	return due, nil
+}
+
+// Localize re-reads a due date that was sent as a time without a zone, and
+// so was read in utils.DefaultLocation, as wall-clock time in loc. Other due
+// dates are left alone.
+func (d *DueDate) Localize(loc *time.Location) {
+	if d == nil || !d.zoneless {
+		return
+	}
+	wall := d.Time.In(utils.DefaultLocation)
+	d.Time = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc).UTC()
+	d.zoneless = false
+}
+
+// Columns splits the due date into the due_on and due_at columns.
+func (d *DueDate) Columns() (on, at *time.Time) {
+	if d == nil {
+		return nil, nil
+	}
+	t := d.Time
+	if d.DateOnly {
+		return &t, nil
+	}
+	t = t.UTC()
+	return nil, &t
+}
+
+// dueDateFromColumns is the inverse of Columns.
+func dueDateFromColumns(on, at *time.Time) *DueDate {
+	switch {
+	case on != nil:
+		return NewDueDate(*on, true)
+	case at != nil:
+		return NewDueDate(*at, false)
+	}
+	return nil
+}
+
+// MustParseDueDate parses a "2006-01-02" date and panics on error. It is
+// meant for fixtures.
+func MustParseDueDate(s string) *DueDate {
+	t, err := utils.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return NewDueDate(t, true)
+}
+
+// DueDatesEqual reports whether a and b are both unset or the same due date.
+func DueDatesEqual(a, b *DueDate) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.DateOnly == b.DateOnly && a.Time.Equal(b.Time)
+}
+
+// CivilDate returns the calendar date of t in loc as midnight UTC, the way
+// whole-day due dates are held.
+func CivilDate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfWeek returns the Monday of the week holding the civil date day.
+func StartOfWeek(day time.Time) time.Time {
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// String formats the due date the way it is written to JSON.
+func (d DueDate) String() string {
+	if d.DateOnly {
+		return d.Time.Format(utils.DateLayout)
+	}
+	return d.Time.UTC().Format(time.RFC3339)
+}
+
+// MarshalJSON writes a date or an RFC 3339 timestamp.
+func (d DueDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts a string in any form ParseDueDate understands, read
+// in utils.DefaultLocation, or a Unix timestamp as a number.
+func (d *DueDate) UnmarshalJSON(data []byte) error {
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(data)
+	}
+	parsed, err := ParseDueDate(s, utils.DefaultLocation)
+	if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
+
+// Due statuses of open todos, relative to the viewer's day
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueThisWeek = "this_week" // Later this week, weeks start on Monday
+	DueLater    = "later"
+)
+
+// SetDueStatus computes DueStatus for a viewer in loc at now. Completed todos
+// and todos without a due date get none.
+func (t *Todo) SetDueStatus(now time.Time, loc *time.Location) {
+	t.DueStatus = ""
+	if t.DueDate == nil || t.Completed {
+		return
+	}
+	today := CivilDate(now, loc)
+	day := t.DueDate.Time
+	if !t.DueDate.DateOnly {
+		day = CivilDate(t.DueDate.Time, loc)
+	}
+	switch {
+	case day.Before(today) || (!t.DueDate.DateOnly && t.DueDate.Time.Before(now)):
+		t.DueStatus = DueOverdue
+	case day.Equal(today):
+		t.DueStatus = DueToday
+	case day.Before(StartOfWeek(today).AddDate(0, 0, 7)):
+		t.DueStatus = DueThisWeek
+	default:
+		t.DueStatus = DueLater
+	}
+}
+
+// DueFilters are the values DueFilter accepts.
+var DueFilters = []string{"overdue", "today", "week"}
+
+// DueFilter returns a scope selecting open todos that are overdue, or todos
+// due today or this week (Monday to Sunday), as seen by a viewer in loc at
+// now.
+func DueFilter(filter string, now time.Time, loc *time.Location) (func(*gorm.DB) *gorm.DB, error) {
+	today := CivilDate(now, loc)
+	var condition clause.Expr
+	switch filter {
+	case "overdue":
+		condition = OverdueCondition(now, loc)
+	case "today":
+		condition = DueBetween(today, today.AddDate(0, 0, 1), loc)
+	case "week":
+		monday := StartOfWeek(today)
+		condition = DueBetween(monday, monday.AddDate(0, 0, 7), loc)
+	default:
+		return nil, fmt.Errorf("unknown due filter %q, expected one of %s", filter, strings.Join(DueFilters, ", "))
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(condition)
+	}, nil
+}
+
+// OverdueCondition matches open todos whose due day is past, or whose due
+// time is, for a viewer in loc at now.
+func OverdueCondition(now time.Time, loc *time.Location) clause.Expr {
+	return clause.Expr{
+		SQL:  "completed = ? AND ((due_on IS NOT NULL AND date(due_on) < ?) OR (due_at IS NOT NULL AND due_at < ?))",
+		Vars: []interface{}{false, CivilDate(now, loc).Format(utils.DateLayout), now.UTC()},
+	}
+}
+
+// DueBetween matches todos due on a civil date in [from, to) as seen from
+// loc; a zero from or to leaves that side open. Dates are passed as
+// "2006-01-02" strings, which both PostgreSQL and SQLite compare correctly
+// with date(due_on); timed due dates are compared with the instants at which
+// the days begin in loc.
+func DueBetween(from, to time.Time, loc *time.Location) clause.Expr {
+	onSQL, atSQL := []string{"due_on IS NOT NULL"}, []string{"due_at IS NOT NULL"}
+	var onVars, atVars []interface{}
+	if !from.IsZero() {
+		onSQL, onVars = append(onSQL, "date(due_on) >= ?"), append(onVars, from.Format(utils.DateLayout))
+		atSQL, atVars = append(atSQL, "due_at >= ?"), append(atVars, dayStart(from, loc))
+	}
+	if !to.IsZero() {
+		onSQL, onVars = append(onSQL, "date(due_on) < ?"), append(onVars, to.Format(utils.DateLayout))
+		atSQL, atVars = append(atSQL, "due_at < ?"), append(atVars, dayStart(to, loc))
+	}
+	return clause.Expr{
+		SQL:  "(" + strings.Join(onSQL, " AND ") + ") OR (" + strings.Join(atSQL, " AND ") + ")",
+		Vars: append(onVars, atVars...),
+	}
+}
+
+// dayStart returns the instant at which the civil date day begins in loc.
+func dayStart(day time.Time, loc *time.Location) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc).UTC()
+}
+
+// DueOn returns a scope selecting todos with exactly the due date d, or
+// without one if d is nil.
+func DueOn(d *DueDate) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		switch {
+		case d == nil:
+			return db.Where("due_on IS NULL AND due_at IS NULL")
+		case d.DateOnly:
+			return db.Where("date(due_on) = ?", d.Time.Format(utils.DateLayout))
+		}
+		return db.Where("due_at = ?", d.Time.UTC())
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+func init() {
+	RegisterModel(&Notification{})
+}
+
+// Notification kinds
+const (
+	NotificationAssigned  = "assigned"  // The todo was assigned to the user
+	NotificationMentioned = "mentioned" // The user was @mentioned in a note
+	NotificationChanged   = "changed"   // A todo the user watches was changed
+)
+
+// Notification is an entry in a user's in-app inbox. Actor is the name of
+// the user who caused it, empty for anonymous requests.
+type Notification struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	UserID    uint       `gorm:"not null;index:idx_notifications_inbox" json:"user_id"`
+	Kind      string     `gorm:"size:20;not null" json:"kind"`
+	TodoID    uint       `gorm:"not null;index" json:"todo_id"`
+	NoteID    *uint      `json:"note_id,omitempty"` // Note the user was mentioned in
+	Actor     string     `gorm:"size:100" json:"actor"`
+	Message   string     `gorm:"size:500;not null" json:"message"`
+	ReadAt    *time.Time `gorm:"index:idx_notifications_inbox" json:"read_at"` // Nil while unread
+}
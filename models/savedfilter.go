@@ -0,0 +1,21 @@
+package models
+
+import "gorm.io/gorm"
+
+func init() {
+	RegisterModel(&SavedFilter{})
+}
+
+// SavedFilter is a named filter expression, a "smart list" of the todos
+// matching it. See the filter package for the expression language.
+type SavedFilter struct {
+	gorm.Model
+	Name       string `gorm:"size:100;not null" json:"name"`
+	Expression string `gorm:"size:1000;not null" json:"expression"`
+	OwnerID    uint   `gorm:"index;not null" json:"owner_id"`
+	Owner      *User  `json:"owner,omitempty"`
+
+	// Shared views are visible to every user. There are no teams yet, so
+	// everyone is one team.
+	Shared bool `gorm:"not null;default:false" json:"shared"`
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -14,15 +15,85 @@ func init() {
 // Todo represents a task with a summary, dates, and completion status.
 type Todo struct {
 	gorm.Model
-	Subject   string     `gorm:"size:255;not null" json:"subject"`
-	DueDate   *time.Time `gorm:"type:timestamp" json:"due_date,omitempty"` // Pointer to allow empty value
-	Completed bool       `gorm:"default:false" json:"completed"`
-	Notes     []Note     `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE;" json:"notes"` // One-to-many relationship
+	UID         string     `gorm:"size:255;uniqueIndex" json:"uid"` // Stable identifier for calendar sync
+	Subject     string     `gorm:"size:255;not null" json:"subject"`
+	DueDate     *DueDate   `gorm:"-" json:"due_date,omitempty"`   // Stored in DueOn or DueAt
+	DueOn       *time.Time `gorm:"type:date;index" json:"-"`      // Whole-day due date, the same day in every zone
+	DueAt       *time.Time `gorm:"index" json:"-"`                // Timed due date
+	DueStatus   string     `gorm:"-" json:"due_status,omitempty"` // Relative to the viewer, see SetDueStatus
+	Completed   bool       `gorm:"default:false" json:"completed"`
+	CompletedAt *time.Time `gorm:"index" json:"completed_at,omitempty"`  // When the todo was last completed, see BeforeSave
+	RRule       string     `gorm:"size:255" json:"rrule,omitempty"`      // iCalendar recurrence rule, e.g. FREQ=WEEKLY
+	Priority    int        `gorm:"not null;default:0" json:"priority"`   // One of the Priority constants
+	List        string     `gorm:"size:100;index" json:"list,omitempty"` // Name of the list the todo is filed under
+	Tags        StringList `gorm:"type:text" json:"tags"`
+	AssigneeID  *uint      `gorm:"index" json:"assignee_id"`                                    // User the todo is assigned to, if any
+	Assignee    *User      `gorm:"constraint:OnDelete:SET NULL;" json:"-"`                      // Not decoded from request bodies
+	Watchers    []User     `gorm:"many2many:todo_watchers;" json:"-"`                           // Notified of changes; see GET /todos/:id/watchers
+	Notes       []Note     `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE;" json:"notes"` // One-to-many relationship
+
+	Attachments []Attachment `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE;" json:"attachments,omitempty"`
+
+	Checklist         []ChecklistItem   `gorm:"foreignKey:TodoID;constraint:OnDelete:CASCADE;" json:"checklist"`
+	ChecklistProgress ChecklistProgress `gorm:"-" json:"checklist_progress"` // Computed from Checklist
 }
 
-// Note represents a note associated with a Todo.
+// Todo priorities
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+// BeforeSave stores the due date in its column and keeps CompletedAt in step
+// with Completed: it is stamped when a todo is saved completed without one,
+// and cleared when the todo is reopened.
+func (t *Todo) BeforeSave(tx *gorm.DB) error {
+	t.DueOn, t.DueAt = t.DueDate.Columns()
+	switch {
+	case !t.Completed:
+		t.CompletedAt = nil
+	case t.CompletedAt == nil:
+		now := tx.NowFunc()
+		t.CompletedAt = &now
+	}
+	return nil
+}
+
+// BeforeCreate assigns a UID to todos that were not imported with one.
+func (t *Todo) BeforeCreate(tx *gorm.DB) error {
+	if t.UID == "" {
+		t.UID = uuid.NewString()
+	}
+	return nil
+}
+
+// AfterFind computes derived fields once the todo and its preloads are loaded.
+func (t *Todo) AfterFind(tx *gorm.DB) error {
+	t.DueDate = dueDateFromColumns(t.DueOn, t.DueAt)
+	t.UpdateChecklistProgress()
+	return nil
+}
+
+// UpdateChecklistProgress recomputes ChecklistProgress from the loaded Checklist.
+func (t *Todo) UpdateChecklistProgress() {
+	t.ChecklistProgress = ChecklistProgress{Total: len(t.Checklist)}
+	for _, item := range t.Checklist {
+		if item.Done {
+			t.ChecklistProgress.Done++
+		}
+	}
+}
+
+// MaxNoteLength is the maximum length in bytes of a note's Markdown source.
+const MaxNoteLength = 20000
+
+// Note represents a note associated with a Todo. The note body is CommonMark
+// source; HTML is only populated when rendering was requested.
 type Note struct {
 	gorm.Model
-	Note   string `gorm:"size:500;not null" json:"note"`
+	Note   string `gorm:"type:text;not null" json:"note"`
+	HTML   string `gorm:"-" json:"html,omitempty"` // Sanitized rendering of Note, never stored
 	TodoID uint   `gorm:"not null" json:"todo_id"` // Foreign key to Todo
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+func init() {
+	RegisterModel(&UndoEntry{})
+}
+
+// UndoEntry describes how to revert a single change. It is addressed by an
+// unguessable token handed out in the response to the change.
+type UndoEntry struct {
+	ID         uint       `gorm:"primarykey" json:"-"`
+	Token      string     `gorm:"size:64;uniqueIndex;not null" json:"token"`
+	Action     string     `gorm:"size:20;not null" json:"action"` // One of the Action* constants
+	EntityType string     `gorm:"size:50;not null" json:"entity_type"`
+	EntityID   uint       `gorm:"not null" json:"entity_id"`
+	Fields     string     `gorm:"size:255" json:"-"`  // Comma-separated fields restored by an update undo
+	Snapshot   string     `gorm:"type:text" json:"-"` // JSON of the entity before an update
+	ActorID    *uint      `json:"-"`
+	ActivityID uint       `json:"-"` // Last activity of the entity when the change was made
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+}
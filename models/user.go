@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"my-go-project/utils"
+
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterModel(&User{})
+}
+
+// User is a person using the app, identified by a unique username.
+type User struct {
+	gorm.Model
+	Username string `gorm:"size:100;uniqueIndex;not null" json:"username"`
+	TimeZone string `gorm:"size:64" json:"timezone"` // IANA name; empty means the server's default
+
+	// CalendarToken is the secret in the user's calendar feed URL
+	CalendarToken *string `gorm:"size:64;uniqueIndex" json:"-"`
+
+	// Digest emails go to Email at DigestHour in the user's time zone: a
+	// weekly summary on Mondays and a daily digest on the other days, each
+	// of which can be turned off
+	Email        string `gorm:"size:255" json:"email"`
+	DigestDaily  bool   `gorm:"not null;default:true" json:"digest_daily"`
+	DigestWeekly bool   `gorm:"not null;default:true" json:"digest_weekly"`
+	DigestHour   int    `gorm:"not null;default:7" json:"digest_hour"`
+	DigestSentOn string `gorm:"size:10;not null;default:''" json:"-"` // Local date, "2006-01-02", of the last digest
+}
+
+// Location returns the user's time zone, or utils.DefaultLocation if the user
+// has none or is nil.
+func (u *User) Location() *time.Location {
+	if u == nil || u.TimeZone == "" {
+		return utils.DefaultLocation
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return utils.DefaultLocation
+	}
+	return loc
+}
@@ -0,0 +1,133 @@
+// Package notify fills the users' in-app inboxes: assignees hear that a todo
+// was assigned to them, users @mentioned in a note that they were mentioned,
+// and watchers that a todo they watch changed. Nobody is notified of their
+// own actions.
+package notify
+
+import (
+	"context"
+
+	"my-go-project/audit"
+	"my-go-project/markdown"
+	"my-go-project/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Notifier notifies on a database on behalf of the actor in the context,
+// for service.Notifier.
+type Notifier struct {
+	db *gorm.DB
+}
+
+// NewNotifier returns a notifier writing to db.
+func NewNotifier(db *gorm.DB) *Notifier {
+	return &Notifier{db: db}
+}
+
+func (n *Notifier) Assigned(ctx context.Context, todo *models.Todo) error {
+	return Assigned(n.db.WithContext(ctx), actorFrom(ctx), todo)
+}
+
+func (n *Notifier) Mentioned(ctx context.Context, todo *models.Todo, note *models.Note) ([]uint, error) {
+	return Mentioned(n.db.WithContext(ctx), actorFrom(ctx), todo, note)
+}
+
+func (n *Notifier) Changed(ctx context.Context, todo *models.Todo, action string, skip ...uint) error {
+	return Changed(n.db.WithContext(ctx), actorFrom(ctx), todo, action, skip...)
+}
+
+// actorFrom returns the user acting in ctx, or nil for anonymous requests.
+func actorFrom(ctx context.Context) *models.User {
+	actor, ok := audit.ActorFrom(ctx)
+	if !ok {
+		return nil
+	}
+	user := models.User{Username: actor.Name}
+	user.ID = actor.ID
+	return &user
+}
+
+// Assigned notifies the assignee of todo and makes them a watcher.
+func Assigned(db *gorm.DB, actor *models.User, todo *models.Todo) error {
+	if todo.AssigneeID == nil {
+		return nil
+	}
+	if err := Watch(db, todo.ID, *todo.AssigneeID); err != nil {
+		return err
+	}
+	return send(db, actor, todo, models.NotificationAssigned, nil, "assigned you", []uint{*todo.AssigneeID})
+}
+
+// Mentioned notifies the users @mentioned in note, which belongs to todo,
+// and makes them watchers. Names of unknown users are ignored. It returns
+// the IDs of the users mentioned.
+func Mentioned(db *gorm.DB, actor *models.User, todo *models.Todo, note *models.Note) ([]uint, error) {
+	names := markdown.Mentions(note.Note)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	var ids []uint
+	if err := db.Model(&models.User{}).Where("username IN ?", names).Order("id").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if err := Watch(db, todo.ID, ids...); err != nil {
+		return nil, err
+	}
+	return ids, send(db, actor, todo, models.NotificationMentioned, &note.ID, "mentioned you on", ids)
+}
+
+// Changed notifies the watchers of todo that the actor did something to it,
+// e.g. "completed" or "changed the priority of", except the users in skip,
+// who were told already.
+func Changed(db *gorm.DB, actor *models.User, todo *models.Todo, action string, skip ...uint) error {
+	var ids []uint
+	query := db.Table("todo_watchers").Where("todo_id = ?", todo.ID)
+	if len(skip) > 0 {
+		query = query.Where("user_id NOT IN ?", skip)
+	}
+	if err := query.Order("user_id").Pluck("user_id", &ids).Error; err != nil {
+		return err
+	}
+	return send(db, actor, todo, models.NotificationChanged, nil, action, ids)
+}
+
+// Watch adds users to the watchers of a todo; users already watching it are
+// left as they are.
+func Watch(db *gorm.DB, todoID uint, userIDs ...uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]map[string]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		rows[i] = map[string]interface{}{"todo_id": todoID, "user_id": id}
+	}
+	return db.Table("todo_watchers").Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error
+}
+
+// Unwatch removes a user from the watchers of a todo.
+func Unwatch(db *gorm.DB, todoID, userID uint) error {
+	return db.Exec("DELETE FROM todo_watchers WHERE todo_id = ? AND user_id = ?", todoID, userID).Error
+}
+
+// send writes one notification of kind to each of users but the actor.
+func send(db *gorm.DB, actor *models.User, todo *models.Todo, kind string, noteID *uint, action string, users []uint) error {
+	name, message := "", "Someone "+action+" “"+todo.Subject+"”"
+	if actor != nil {
+		name, message = actor.Username, actor.Username+" "+action+" “"+todo.Subject+"”"
+	}
+	var notifications []models.Notification
+	for _, id := range users {
+		if actor != nil && id == actor.ID {
+			continue
+		}
+		notifications = append(notifications, models.Notification{
+			UserID: id, Kind: kind, TodoID: todo.ID, NoteID: noteID, Actor: name, Message: message,
+		})
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.Create(&notifications).Error
+}
@@ -0,0 +1,163 @@
+package quickadd
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"my-go-project/models"
+)
+
+// Locale holds the words the parser recognises in one language. All words
+// are lower case.
+type Locale struct {
+	Name string
+
+	Today, Tomorrow []string
+	Next, In, Every []string
+	Fillers         []string // Words dropped before a date or time, e.g. "on", "at"
+	At              []string // Fillers that make a bare number an hour
+	Of              []string // Words allowed between an ordinal and "month"
+	Articles        map[string]int
+	Weekdays        map[string]time.Weekday
+	WorkingDays     []string // "weekday" in "every weekday"
+	Months          map[string]time.Month
+	Units           map[string]string // Word to day, week, month or year
+	Frequencies     map[string]string // "daily" etc. to day, week, month or year
+	Noon            []string
+	Priorities      map[string]int
+	Ordinal         *regexp.Regexp  // First group is the day number
+	Meridiem        map[string]bool // Words following an hour, true for pm
+}
+
+// English is the default locale.
+var English = &Locale{
+	Name:     "en",
+	Today:    []string{"today", "tonight"},
+	Tomorrow: []string{"tomorrow", "tmr"},
+	Next:     []string{"next"},
+	In:       []string{"in"},
+	Every:    []string{"every", "each"},
+	Fillers:  []string{"on", "at", "by", "due", "the"},
+	At:       []string{"at"},
+	Of:       []string{"of", "the", "every", "each"},
+	Articles: map[string]int{"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "other": 2},
+	Weekdays: map[string]time.Weekday{
+		"monday": time.Monday, "mon": time.Monday,
+		"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+		"wednesday": time.Wednesday, "wed": time.Wednesday,
+		"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+		"friday": time.Friday, "fri": time.Friday,
+		"saturday": time.Saturday, "sat": time.Saturday,
+		"sunday": time.Sunday, "sun": time.Sunday,
+	},
+	WorkingDays: []string{"weekday", "weekdays", "workday", "workdays"},
+	Months: map[string]time.Month{
+		"january": time.January, "jan": time.January,
+		"february": time.February, "feb": time.February,
+		"march": time.March, "mar": time.March,
+		"april": time.April, "apr": time.April,
+		"may":  time.May,
+		"june": time.June, "jun": time.June,
+		"july": time.July, "jul": time.July,
+		"august": time.August, "aug": time.August,
+		"september": time.September, "sep": time.September, "sept": time.September,
+		"october": time.October, "oct": time.October,
+		"november": time.November, "nov": time.November,
+		"december": time.December, "dec": time.December,
+	},
+	Units: map[string]string{
+		"day": "day", "days": "day",
+		"week": "week", "weeks": "week",
+		"month": "month", "months": "month",
+		"year": "year", "years": "year",
+	},
+	Frequencies: map[string]string{"daily": "day", "weekly": "week", "monthly": "month", "yearly": "year", "annually": "year"},
+	Noon:        []string{"noon", "midday"},
+	Priorities: map[string]int{
+		"low": models.PriorityLow, "medium": models.PriorityMedium, "med": models.PriorityMedium,
+		"high": models.PriorityHigh, "urgent": models.PriorityHigh,
+	},
+	Ordinal:  regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)$`),
+	Meridiem: map[string]bool{"am": false, "a.m.": false, "pm": true, "p.m.": true},
+}
+
+// Swedish locale
+var Swedish = &Locale{
+	Name:     "sv",
+	Today:    []string{"idag", "ikväll"},
+	Tomorrow: []string{"imorgon", "imorn"},
+	Next:     []string{"nästa"},
+	In:       []string{"om"},
+	Every:    []string{"varje", "var", "vart"},
+	Fillers:  []string{"på", "kl", "kl.", "klockan", "den", "senast"},
+	At:       []string{"kl", "kl.", "klockan"},
+	Of:       []string{"i", "varje"},
+	Articles: map[string]int{"en": 1, "ett": 1, "två": 2, "tre": 3, "fyra": 4, "fem": 5, "annan": 2, "annat": 2},
+	Weekdays: map[string]time.Weekday{
+		"måndag": time.Monday, "mån": time.Monday,
+		"tisdag": time.Tuesday, "tis": time.Tuesday,
+		"onsdag": time.Wednesday, "ons": time.Wednesday,
+		"torsdag": time.Thursday, "tors": time.Thursday,
+		"fredag": time.Friday, "fre": time.Friday,
+		"lördag": time.Saturday, "lör": time.Saturday,
+		"söndag": time.Sunday, "sön": time.Sunday,
+	},
+	WorkingDays: []string{"vardag", "vardagar"},
+	Months: map[string]time.Month{
+		"januari": time.January, "jan": time.January,
+		"februari": time.February, "feb": time.February,
+		"mars": time.March, "mar": time.March,
+		"april": time.April, "apr": time.April,
+		"maj":  time.May,
+		"juni": time.June, "jun": time.June,
+		"juli": time.July, "jul": time.July,
+		"augusti": time.August, "aug": time.August,
+		"september": time.September, "sep": time.September,
+		"oktober": time.October, "okt": time.October,
+		"november": time.November, "nov": time.November,
+		"december": time.December, "dec": time.December,
+	},
+	Units: map[string]string{
+		"dag": "day", "dagar": "day",
+		"vecka": "week", "veckor": "week",
+		"månad": "month", "månader": "month",
+		"år": "year",
+	},
+	Frequencies: map[string]string{"dagligen": "day", "veckovis": "week", "månadsvis": "month", "årligen": "year"},
+	Noon:        []string{"lunch"},
+	Priorities: map[string]int{
+		"låg": models.PriorityLow, "medel": models.PriorityMedium,
+		"hög": models.PriorityHigh, "viktig": models.PriorityHigh,
+	},
+	Ordinal:  regexp.MustCompile(`^(\d{1,2}):?[ae]$`),
+	Meridiem: map[string]bool{},
+}
+
+// Locales are the available locales by name.
+var Locales = map[string]*Locale{
+	English.Name: English,
+	Swedish.Name: Swedish,
+}
+
+// LookupLocale finds the locale for a language tag such as "sv-SE" or the
+// first supported language of an Accept-Language header.
+func LookupLocale(tag string) (*Locale, bool) {
+	for _, part := range strings.Split(tag, ",") {
+		lang, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ = strings.Cut(strings.ToLower(lang), "-")
+		if locale, ok := Locales[lang]; ok {
+			return locale, true
+		}
+	}
+	return nil, false
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
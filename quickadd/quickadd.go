@@ -0,0 +1,605 @@
+// Package quickadd turns a line of free text such as
+// "Pay rent every 1st of month !high #home" into the fields of a todo.
+//
+// The parser recognises, in the words of a Locale:
+//
+//   - due dates: "today", "tomorrow", "friday", "next friday", "next week",
+//     "in 3 days", "march 3", "3rd of march", "2025-03-01"
+//   - times: "9am", "9:30 pm", "at 14:00", "noon"
+//   - recurrence: "daily", "every 2 weeks", "every monday and thursday",
+//     "every weekday", "every 1st of month"
+//   - priorities: "!", "!!", "!!!", "!low", "!medium", "!high"
+//   - tags "#home" and a list "@work"
+//
+// Everything else becomes the subject. A bare weekday means the next such
+// day including today, "next <weekday>" the next one after today. Relative
+// dates are computed in Options.Location.
+package quickadd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"my-go-project/models"
+	"my-go-project/utils"
+)
+
+// Span kinds
+const (
+	KindDate       = "date"
+	KindTime       = "time"
+	KindRecurrence = "recurrence"
+	KindPriority   = "priority"
+	KindTag        = "tag"
+	KindList       = "list"
+)
+
+// Span is a recognised part of the input. Offsets count characters (runes).
+type Span struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Kind  string `json:"kind"`
+	Text  string `json:"text"`
+	Value string `json:"value"` // Normalised value, e.g. "2025-03-01" or an RRULE
+}
+
+// Options configure a parse.
+type Options struct {
+	Locale   *Locale        // Default English
+	Location *time.Location // Default time.Local, the server's zone
+	Now      time.Time      // Default time.Now()
+}
+
+// Result is the structured form of the input.
+type Result struct {
+	Subject  string          `json:"subject"`
+	DueDate  *models.DueDate `json:"due_date,omitempty"`
+	RRule    string          `json:"rrule,omitempty"`
+	Priority int             `json:"priority"`
+	Tags     []string        `json:"tags"`
+	List     string          `json:"list,omitempty"`
+	Spans    []Span          `json:"spans"`
+}
+
+// Apply copies the parsed fields onto a todo.
+func (r *Result) Apply(todo *models.Todo) {
+	todo.Subject = r.Subject
+	todo.DueDate = r.DueDate
+	todo.RRule = r.RRule
+	todo.Priority = r.Priority
+	todo.Tags = models.StringList(r.Tags)
+	todo.List = r.List
+}
+
+type token struct {
+	text       string
+	word       string // Lower case without trailing punctuation
+	start, end int
+}
+
+// recurrence is a parsed recurrence rule, kept to find its first occurrence.
+type recurrence struct {
+	unit     string
+	interval int
+	weekdays []time.Weekday
+	monthDay int
+}
+
+type parser struct {
+	locale *Locale
+	loc    *time.Location
+	today  time.Time // Midnight in loc
+	now    time.Time
+
+	tokens []token
+	date   *time.Time
+	clock  *[2]int
+	rec    *recurrence
+	result Result
+}
+
+// Parse extracts the fields of a todo from input.
+func Parse(input string, opts Options) Result {
+	p := parser{locale: opts.Locale, loc: opts.Location, now: opts.Now}
+	if p.locale == nil {
+		p.locale = English
+	}
+	if p.loc == nil {
+		p.loc = time.Local
+	}
+	if p.now.IsZero() {
+		p.now = time.Now()
+	}
+	p.now = p.now.In(p.loc)
+	p.today = time.Date(p.now.Year(), p.now.Month(), p.now.Day(), 0, 0, 0, 0, p.loc)
+	p.tokens = tokenize(input)
+	p.result.Tags = []string{}
+	p.result.Spans = []Span{}
+
+	var subject []string
+	for i := 0; i < len(p.tokens); {
+		n := p.match(i, false)
+		// "on friday", "on the 15th", "at 9": fillers belong to the expression
+		fillers := 0
+		for n == 0 && contains(p.locale.Fillers, p.word(i+fillers)) {
+			fillers++
+		}
+		if fillers > 0 && i+fillers < len(p.tokens) {
+			if n = p.match(i+fillers, true); n > 0 {
+				last := p.result.Spans[len(p.result.Spans)-1]
+				p.result.Spans = p.result.Spans[:len(p.result.Spans)-1]
+				p.addSpan(i, fillers+n, last.Kind, last.Value)
+				n += fillers
+			}
+		}
+		if n == 0 {
+			subject = append(subject, p.tokens[i].text)
+			n = 1
+		}
+		i += n
+	}
+
+	p.result.Subject = strings.Join(subject, " ")
+	if p.result.Subject == "" {
+		p.result.Subject = strings.TrimSpace(input)
+	}
+	p.finish()
+	sort.Slice(p.result.Spans, func(i, j int) bool { return p.result.Spans[i].Start < p.result.Spans[j].Start })
+	return p.result
+}
+
+// match tries every kind of expression at token i and returns the number of
+// tokens consumed.
+func (p *parser) match(i int, afterFiller bool) int {
+	matchers := []func(int, bool) int{p.matchPriority, p.matchTag, p.matchList, p.matchRecurrence, p.matchDate, p.matchTime}
+	for _, m := range matchers {
+		if n := m(i, afterFiller); n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func (p *parser) addSpan(i, n int, kind, value string) {
+	texts := make([]string, n)
+	for k := 0; k < n; k++ {
+		texts[k] = p.tokens[i+k].text
+	}
+	p.result.Spans = append(p.result.Spans, Span{
+		Start: p.tokens[i].start,
+		End:   p.tokens[i+n-1].end,
+		Kind:  kind,
+		Text:  strings.Join(texts, " "),
+		Value: value,
+	})
+}
+
+// word returns the normalised token at i, or "" past the end.
+func (p *parser) word(i int) string {
+	if i < 0 || i >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[i].word
+}
+
+var priorityNames = map[int]string{
+	models.PriorityLow:    "low",
+	models.PriorityMedium: "medium",
+	models.PriorityHigh:   "high",
+}
+
+func (p *parser) matchPriority(i int, afterFiller bool) int {
+	text := p.tokens[i].text
+	if afterFiller || !strings.HasPrefix(text, "!") {
+		return 0
+	}
+	rest := strings.ToLower(strings.TrimLeft(text, "!"))
+	priority, ok := p.locale.Priorities[rest]
+	if rest == "" {
+		priority, ok = min(len(text), models.PriorityHigh), true
+	} else if strings.Count(text, "!") > 1 {
+		ok = false
+	}
+	if !ok {
+		return 0
+	}
+	p.result.Priority = priority
+	p.addSpan(i, 1, KindPriority, priorityNames[priority])
+	return 1
+}
+
+func (p *parser) matchTag(i int, afterFiller bool) int {
+	tag := strings.TrimRightFunc(p.tokens[i].text, unicode.IsPunct)
+	if afterFiller || !strings.HasPrefix(tag, "#") || len(tag) < 2 {
+		return 0
+	}
+	tag = tag[1:]
+	if !contains(p.result.Tags, tag) {
+		p.result.Tags = append(p.result.Tags, tag)
+	}
+	p.addSpan(i, 1, KindTag, tag)
+	return 1
+}
+
+func (p *parser) matchList(i int, afterFiller bool) int {
+	list := strings.TrimRightFunc(p.tokens[i].text, unicode.IsPunct)
+	if afterFiller || !strings.HasPrefix(list, "@") || len(list) < 2 {
+		return 0
+	}
+	p.result.List = list[1:]
+	p.addSpan(i, 1, KindList, list[1:])
+	return 1
+}
+
+// number reads a count such as "3", "a" or "two".
+func (p *parser) number(i int) (int, bool) {
+	w := p.word(i)
+	if n, err := strconv.Atoi(w); err == nil && n > 0 && n < 1000 {
+		return n, true
+	}
+	n, ok := p.locale.Articles[w]
+	return n, ok
+}
+
+// ordinal reads a day of the month such as "1st" or "3:e".
+func (p *parser) ordinal(i int) (int, bool) {
+	m := p.locale.Ordinal.FindStringSubmatch(p.word(i))
+	if m == nil {
+		return 0, false
+	}
+	day, _ := strconv.Atoi(m[1])
+	return day, day >= 1 && day <= 31
+}
+
+func (p *parser) matchRecurrence(i int, afterFiller bool) int {
+	if p.rec != nil {
+		return 0
+	}
+	if unit, ok := p.locale.Frequencies[p.word(i)]; ok {
+		p.setRecurrence(i, 1, &recurrence{unit: unit, interval: 1})
+		return 1
+	}
+	if !contains(p.locale.Every, p.word(i)) {
+		return 0
+	}
+
+	j := i + 1
+	rec := &recurrence{interval: 1}
+	if n, ok := p.number(j); ok {
+		rec.interval = n
+		j++
+	}
+	w := p.word(j)
+	switch {
+	case p.locale.Units[w] != "":
+		rec.unit = p.locale.Units[w]
+		j++
+		// "every month on the 15th"
+		if rec.unit == "month" {
+			k := j
+			for contains(p.locale.Fillers, p.word(k)) {
+				k++
+			}
+			if day, ok := p.ordinal(k); ok {
+				rec.monthDay = day
+				j = k + 1
+			}
+		}
+	case contains(p.locale.WorkingDays, w) && rec.interval == 1:
+		rec.unit = "week"
+		rec.weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+		j++
+	case rec.interval == 1 && isWeekday(p.locale, w):
+		rec.unit = "week"
+		for isWeekday(p.locale, p.word(j)) {
+			rec.weekdays = append(rec.weekdays, p.locale.Weekdays[p.word(j)])
+			j++
+			// "monday and thursday", "monday, thursday"
+			if (p.word(j) == "and" || p.word(j) == "och") && isWeekday(p.locale, p.word(j+1)) {
+				j++
+			}
+		}
+	default:
+		day, ok := p.ordinal(j)
+		if !ok || rec.interval != 1 {
+			return 0
+		}
+		rec.unit, rec.monthDay = "month", day
+		j++
+		// "every 1st of the month"
+		k := j
+		for contains(p.locale.Of, p.word(k)) {
+			k++
+		}
+		if p.locale.Units[p.word(k)] == "month" {
+			j = k + 1
+		}
+	}
+	p.setRecurrence(i, j-i, rec)
+	return j - i
+}
+
+func isWeekday(locale *Locale, w string) bool {
+	_, ok := locale.Weekdays[w]
+	return ok
+}
+
+var rruleDays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (p *parser) setRecurrence(i, n int, rec *recurrence) {
+	freq := map[string]string{"day": "DAILY", "week": "WEEKLY", "month": "MONTHLY", "year": "YEARLY"}[rec.unit]
+	rule := "FREQ=" + freq
+	if rec.interval > 1 {
+		rule += ";INTERVAL=" + strconv.Itoa(rec.interval)
+	}
+	if len(rec.weekdays) > 0 {
+		days := make([]string, len(rec.weekdays))
+		for k, d := range rec.weekdays {
+			days[k] = rruleDays[d]
+		}
+		rule += ";BYDAY=" + strings.Join(days, ",")
+	}
+	if rec.monthDay > 0 {
+		rule += ";BYMONTHDAY=" + strconv.Itoa(rec.monthDay)
+	}
+	p.rec = rec
+	p.result.RRule = rule
+	p.addSpan(i, n, KindRecurrence, rule)
+}
+
+var isoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func (p *parser) matchDate(i int, afterFiller bool) int {
+	if p.date != nil {
+		return 0
+	}
+	w := p.word(i)
+	var date time.Time
+	n := 0
+	switch {
+	case contains(p.locale.Today, w):
+		date, n = p.today, 1
+	case contains(p.locale.Tomorrow, w):
+		date, n = p.today.AddDate(0, 0, 1), 1
+	case contains(p.locale.Next, w):
+		next := p.word(i + 1)
+		if weekday, ok := p.locale.Weekdays[next]; ok {
+			date, n = p.nextWeekday(weekday, false), 2
+		} else {
+			switch p.locale.Units[next] {
+			case "day":
+				date, n = p.today.AddDate(0, 0, 1), 2
+			case "week":
+				date, n = p.nextWeekday(time.Monday, false), 2
+			case "month":
+				date, n = time.Date(p.today.Year(), p.today.Month()+1, 1, 0, 0, 0, 0, p.loc), 2
+			case "year":
+				date, n = time.Date(p.today.Year()+1, time.January, 1, 0, 0, 0, 0, p.loc), 2
+			}
+		}
+	case contains(p.locale.In, w):
+		count, ok := p.number(i + 1)
+		if unit := p.locale.Units[p.word(i+2)]; ok && unit != "" {
+			date, n = addUnits(p.today, unit, count), 3
+		}
+	case isWeekday(p.locale, w) && (afterFiller || utf8.RuneCountInString(w) >= 6):
+		// Short forms such as "sun" and "wed" are common words of their own
+		date, n = p.nextWeekday(p.locale.Weekdays[w], true), 1
+	case isoDate.MatchString(w):
+		if d, err := utils.ParseDateIn(w, p.loc); err == nil {
+			date, n = d, 1
+		}
+	default:
+		date, n = p.matchCalendarDate(i, afterFiller)
+	}
+	if n == 0 {
+		return 0
+	}
+	p.date = &date
+	p.addSpan(i, n, KindDate, date.Format(utils.DateLayout))
+	return n
+}
+
+// matchCalendarDate reads "march 3", "3 march", "3rd of march 2026" and,
+// after a filler, a bare "the 5th".
+func (p *parser) matchCalendarDate(i int, afterFiller bool) (time.Time, int) {
+	day, month, year := 0, time.Month(0), 0
+	j := i
+	if m, ok := p.locale.Months[p.word(j)]; ok {
+		if d, ok := p.dayNumber(j + 1); ok {
+			month, day, j = m, d, j+2
+		}
+	} else if d, ok := p.dayNumber(j); ok {
+		k := j + 1
+		if contains(p.locale.Of, p.word(k)) {
+			k++
+		}
+		if m, ok := p.locale.Months[p.word(k)]; ok {
+			month, day, j = m, d, k+1
+		} else if _, isOrdinal := p.ordinal(j); isOrdinal && afterFiller {
+			day, j = d, j+1
+		}
+	}
+	if day == 0 {
+		return time.Time{}, 0
+	}
+	if y, err := strconv.Atoi(p.word(j)); err == nil && y >= 1970 && y < 3000 {
+		year, j = y, j+1
+	}
+
+	if month == 0 {
+		// The next time the day comes around
+		for k := 0; k < 12; k++ {
+			first := time.Date(p.today.Year(), p.today.Month()+time.Month(k), 1, 0, 0, 0, 0, p.loc)
+			date := first.AddDate(0, 0, day-1)
+			if date.Month() == first.Month() && !date.Before(p.today) {
+				return date, j - i
+			}
+		}
+		return time.Time{}, 0
+	}
+	if year == 0 {
+		year = p.today.Year()
+		if time.Date(year, month, day, 0, 0, 0, 0, p.loc).Before(p.today) {
+			year++
+		}
+	}
+	date := time.Date(year, month, day, 0, 0, 0, 0, p.loc)
+	if date.Month() != month {
+		return time.Time{}, 0 // February 30th
+	}
+	return date, j - i
+}
+
+func (p *parser) dayNumber(i int) (int, bool) {
+	if day, ok := p.ordinal(i); ok {
+		return day, true
+	}
+	day, err := strconv.Atoi(p.word(i))
+	return day, err == nil && day >= 1 && day <= 31
+}
+
+var clockPattern = regexp.MustCompile(`^(\d{1,2})(?:[:.](\d{2}))?(am|pm|a\.m\.|p\.m\.)?$`)
+
+func (p *parser) matchTime(i int, afterFiller bool) int {
+	if p.clock != nil {
+		return 0
+	}
+	w := p.word(i)
+	if contains(p.locale.Noon, w) {
+		p.clock = &[2]int{12, 0}
+		p.addSpan(i, 1, KindTime, "12:00")
+		return 1
+	}
+
+	m := clockPattern.FindStringSubmatch(w)
+	if m == nil {
+		return 0
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	meridiem, n := m[3], 1
+	if _, ok := p.locale.Meridiem[p.word(i+1)]; meridiem == "" && ok {
+		meridiem, n = p.word(i+1), 2
+	}
+	// A bare number is only a time after "at"
+	if meridiem == "" && m[2] == "" && !(afterFiller && contains(p.locale.At, p.word(i-1))) {
+		return 0
+	}
+	if meridiem != "" {
+		if hour < 1 || hour > 12 {
+			return 0
+		}
+		hour %= 12
+		if strings.HasPrefix(meridiem, "p") {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0
+	}
+	p.clock = &[2]int{hour, minute}
+	p.addSpan(i, n, KindTime, fmt.Sprintf("%02d:%02d", hour, minute))
+	return n
+}
+
+// nextWeekday returns the next date falling on weekday, today included if
+// includeToday is set.
+func (p *parser) nextWeekday(weekday time.Weekday, includeToday bool) time.Time {
+	days := (int(weekday) - int(p.today.Weekday()) + 7) % 7
+	if days == 0 && !includeToday {
+		days = 7
+	}
+	return p.today.AddDate(0, 0, days)
+}
+
+func addUnits(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "year":
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// finish works out the due date from the parts found.
+func (p *parser) finish() {
+	date := p.date
+	if date == nil && p.rec != nil {
+		first := p.firstOccurrence()
+		date = &first
+	}
+	if date == nil && p.clock != nil {
+		// A time alone means the next time the clock shows it
+		d := p.today
+		if !time.Date(d.Year(), d.Month(), d.Day(), p.clock[0], p.clock[1], 0, 0, p.loc).After(p.now) {
+			d = d.AddDate(0, 0, 1)
+		}
+		date = &d
+	}
+	if date == nil {
+		return
+	}
+
+	if p.clock != nil {
+		p.result.DueDate = models.NewDueDate(time.Date(date.Year(), date.Month(), date.Day(), p.clock[0], p.clock[1], 0, 0, p.loc), false)
+	} else {
+		p.result.DueDate = models.NewDueDate(*date, true)
+	}
+}
+
+// firstOccurrence returns the first date, from today on, matching the recurrence.
+func (p *parser) firstOccurrence() time.Time {
+	switch {
+	case len(p.rec.weekdays) > 0:
+		first := p.nextWeekday(p.rec.weekdays[0], true)
+		for _, weekday := range p.rec.weekdays[1:] {
+			if d := p.nextWeekday(weekday, true); d.Before(first) {
+				first = d
+			}
+		}
+		return first
+	case p.rec.monthDay > 0:
+		for k := 0; k < 12; k++ {
+			first := time.Date(p.today.Year(), p.today.Month()+time.Month(k), 1, 0, 0, 0, 0, p.loc)
+			date := first.AddDate(0, 0, p.rec.monthDay-1)
+			if date.Month() == first.Month() && !date.Before(p.today) {
+				return date
+			}
+		}
+	}
+	return p.today
+}
+
+// tokenize splits input at white space, keeping character offsets.
+func tokenize(input string) []token {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		text := string(runes[start:i])
+		tokens = append(tokens, token{
+			text:  text,
+			word:  strings.TrimRight(strings.ToLower(text), ",;"),
+			start: start,
+			end:   i,
+		})
+	}
+	return tokens
+}
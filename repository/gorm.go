@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"my-go-project/database"
+	"my-go-project/filter"
+	"my-go-project/models"
+	"my-go-project/transfer"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormRepository stores todos in the app's database.
+type GormRepository struct {
+	db *gorm.DB
+}
+
+// NewGormRepository returns a repository on db.
+func NewGormRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{db: db}
+}
+
+// OrderedChecklist preloads a todo's checklist in display order.
+func OrderedChecklist(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+// QueueBlobDeletions records the blobs of the given attachments for removal
+// by storage.Sweep. Call it in the transaction that deletes the attachments.
+func QueueBlobDeletions(tx *gorm.DB, attachments []models.Attachment) error {
+	var deletions []models.BlobDeletion
+	for _, attachment := range attachments {
+		deletions = append(deletions, models.BlobDeletion{Key: attachment.StorageKey})
+		if attachment.ThumbnailKey != "" {
+			deletions = append(deletions, models.BlobDeletion{Key: attachment.ThumbnailKey})
+		}
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+	return tx.Create(&deletions).Error
+}
+
+// withChildren preloads what todos are returned with.
+func withChildren(db *gorm.DB) *gorm.DB {
+	return db.Preload("Notes").Preload("Attachments").Preload("Checklist", OrderedChecklist)
+}
+
+func (r *GormRepository) List(ctx context.Context, query TodoQuery) ([]models.Todo, error) {
+	db := r.db.WithContext(ctx).Scopes(withChildren).Order("id")
+	if query.Due != "" {
+		scope, err := models.DueFilter(query.Due, query.Options.Now, query.Options.Location)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Scopes(scope)
+	}
+	if query.Assignee != "" {
+		db = db.Where(filter.Assignee(query.Assignee, query.Options.UserID))
+	}
+	if query.Filter != "" {
+		scope, err := filter.Scope(query.Filter, query.Options)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Scopes(scope)
+	}
+	var todos []models.Todo
+	if err := db.Find(&todos).Error; err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+func (r *GormRepository) Get(ctx context.Context, id uint) (*models.Todo, error) {
+	var todo models.Todo
+	if err := r.db.WithContext(ctx).Scopes(withChildren).First(&todo, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &todo, nil
+}
+
+func (r *GormRepository) Create(ctx context.Context, todo *models.Todo) error {
+	return r.db.WithContext(ctx).Create(todo).Error
+}
+
+func (r *GormRepository) Update(ctx context.Context, todo *models.Todo) error {
+	return r.db.WithContext(ctx).Save(todo).Error
+}
+
+func (r *GormRepository) Delete(ctx context.Context, id uint) (*models.Todo, error) {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&models.Todo{}, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	var todo models.Todo
+	if err := db.Unscoped().First(&todo, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &todo, nil
+}
+
+// Purge queues the blobs of the todo's attachments for removal in the
+// transaction that deletes it.
+func (r *GormRepository) Purge(ctx context.Context, id uint) error {
+	return database.Transaction(r.db.WithContext(ctx), func(tx *gorm.DB) error {
+		var attachments []models.Attachment
+		if err := tx.Unscoped().Where("todo_id = ?", id).Find(&attachments).Error; err != nil {
+			return err
+		}
+		if err := QueueBlobDeletions(tx, attachments); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("todo_id = ?", id).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("todo_id = ?", id).Delete(&models.Note{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("todo_id = ?", id).Delete(&models.ChecklistItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM todo_watchers WHERE todo_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Todo{}, id).Error
+	})
+}
+
+func (r *GormRepository) SaveUID(ctx context.Context, uid string, apply func(*models.Todo) error) (*models.Todo, bool, error) {
+	var todo models.Todo
+	created := false
+	err := database.Transaction(r.db.WithContext(ctx), func(tx *gorm.DB) error {
+		err := tx.Unscoped().Preload("Notes").Where("uid = ?", uid).First(&todo).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		created = err != nil
+		stored := todo.Notes
+		if err := apply(&todo); err != nil {
+			return err
+		}
+		todo.UID = uid
+		todo.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Omit(clause.Associations).Save(&todo).Error; err != nil {
+			return err
+		}
+		return replaceNotes(tx, &todo, stored)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &todo, created, nil
+}
+
+// replaceNotes stores the notes of todo in place of stored, its notes as
+// they were: stored notes it no longer has are deleted and its notes without
+// an ID created.
+func replaceNotes(tx *gorm.DB, todo *models.Todo, stored []models.Note) error {
+	for _, note := range stored {
+		if !slices.ContainsFunc(todo.Notes, func(kept models.Note) bool { return kept.ID == note.ID }) {
+			if err := tx.Delete(&note).Error; err != nil {
+				return err
+			}
+		}
+	}
+	for i := range todo.Notes {
+		if todo.Notes[i].ID == 0 {
+			todo.Notes[i].TodoID = todo.ID
+			if err := tx.Create(&todo.Notes[i]).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *GormRepository) Import(ctx context.Context, records []transfer.Record, dryRun bool) (*transfer.Report, error) {
+	return transfer.Import(ctx, r.db, records, dryRun)
+}
+
+// AddNote looks the todo up first, so that a missing one is ErrNotFound
+// rather than a foreign key error, and todos in the trash get no notes.
+func (r *GormRepository) AddNote(ctx context.Context, note *models.Note) error {
+	return database.Transaction(r.db.WithContext(ctx), func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.Todo{}, note.TodoID).Error; err != nil {
+			return notFound(err)
+		}
+		return tx.Create(note).Error
+	})
+}
+
+func (r *GormRepository) Note(ctx context.Context, todoID, noteID uint) (*models.Note, error) {
+	var note models.Note
+	if err := r.db.WithContext(ctx).Where("todo_id = ? AND id = ?", todoID, noteID).First(&note).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &note, nil
+}
+
+func (r *GormRepository) UpdateNote(ctx context.Context, note *models.Note) error {
+	return r.db.WithContext(ctx).Model(note).Update("note", note.Note).Error
+}
+
+func (r *GormRepository) DeleteNote(ctx context.Context, todoID, noteID uint) (bool, error) {
+	result := r.db.WithContext(ctx).Where("todo_id = ? AND id = ?", todoID, noteID).Delete(&models.Note{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// UserExists reports whether there is a user with id, for service.Users.
+func (r *GormRepository) UserExists(ctx context.Context, id uint) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// notFound turns GORM's missing record into ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
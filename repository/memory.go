@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/transfer"
+
+	"gorm.io/gorm"
+)
+
+// MemoryRepository keeps todos in memory. It runs due and assignee queries
+// for me and none, but not filter expressions, assignees by username or
+// imports, which need the database; those return ErrUnsupported. Todos are
+// returned as copies, so callers may change them freely.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	todos  map[uint]*models.Todo
+	nextID uint
+	noteID uint
+}
+
+// NewMemoryRepository returns a repository holding copies of todos. Todos
+// with an ID keep it; the others are numbered after them, as if created.
+func NewMemoryRepository(todos ...models.Todo) *MemoryRepository {
+	r := &MemoryRepository{todos: make(map[uint]*models.Todo)}
+	for i := range todos {
+		if todos[i].ID == 0 {
+			continue
+		}
+		todo := cloneTodo(&todos[i])
+		r.todos[todo.ID] = todo
+		r.nextID = max(r.nextID, todo.ID)
+		for _, note := range todo.Notes {
+			r.noteID = max(r.noteID, note.ID)
+		}
+	}
+	for i := range todos {
+		if todos[i].ID == 0 {
+			r.Create(context.Background(), cloneTodo(&todos[i]))
+		}
+	}
+	return r
+}
+
+func (r *MemoryRepository) List(ctx context.Context, query TodoQuery) ([]models.Todo, error) {
+	if query.Filter != "" {
+		return nil, fmt.Errorf("filter expressions are %w", ErrUnsupported)
+	}
+	if query.Assignee != "" && query.Assignee != "me" && query.Assignee != "none" {
+		return nil, fmt.Errorf("assignees by username are %w", ErrUnsupported)
+	}
+	match, err := dueMatcher(query)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	todos := []models.Todo{}
+	for _, todo := range r.todos {
+		if todo.DeletedAt.Valid || !match(todo) {
+			continue
+		}
+		switch query.Assignee {
+		case "":
+		case "me":
+			if todo.AssigneeID == nil || *todo.AssigneeID != query.Options.UserID {
+				continue
+			}
+		case "none":
+			if todo.AssigneeID != nil {
+				continue
+			}
+		}
+		todos = append(todos, *cloneTodo(todo))
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+	return todos, nil
+}
+
+// dueMatcher selects todos as models.DueFilter does.
+func dueMatcher(query TodoQuery) (func(*models.Todo) bool, error) {
+	now, loc := query.Options.Now, query.Options.Location
+	today := models.CivilDate(now, loc)
+	// day is the civil date a todo is due on, as seen from loc
+	day := func(todo *models.Todo) time.Time {
+		if todo.DueDate.DateOnly {
+			return todo.DueDate.Time
+		}
+		return models.CivilDate(todo.DueDate.Time, loc)
+	}
+	between := func(from, to time.Time) func(*models.Todo) bool {
+		return func(todo *models.Todo) bool {
+			return todo.DueDate != nil && !day(todo).Before(from) && day(todo).Before(to)
+		}
+	}
+	switch query.Due {
+	case "":
+		return func(*models.Todo) bool { return true }, nil
+	case "overdue":
+		return func(todo *models.Todo) bool {
+			return todo.DueDate != nil && !todo.Completed &&
+				(day(todo).Before(today) || (!todo.DueDate.DateOnly && todo.DueDate.Time.Before(now)))
+		}, nil
+	case "today":
+		return between(today, today.AddDate(0, 0, 1)), nil
+	case "week":
+		monday := models.StartOfWeek(today)
+		return between(monday, monday.AddDate(0, 0, 7)), nil
+	}
+	return nil, fmt.Errorf("unknown due filter %q, expected one of %s", query.Due, strings.Join(models.DueFilters, ", "))
+}
+
+func (r *MemoryRepository) Get(ctx context.Context, id uint) (*models.Todo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return cloneTodo(todo), nil
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, todo *models.Todo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	todo.ID = r.nextID
+	todo.CreatedAt = time.Now()
+	if err := todo.BeforeCreate(nil); err != nil {
+		return err
+	}
+	r.save(todo)
+	return nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, todo *models.Todo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.todos[todo.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	r.save(todo)
+
+	// Keep what is already attached to the todo, adding its new notes
+	saved := r.todos[todo.ID]
+	notes := slices.Clone(stored.Notes)
+	for _, note := range saved.Notes {
+		if !slices.ContainsFunc(stored.Notes, func(n models.Note) bool { return n.ID == note.ID }) {
+			notes = append(notes, note)
+		}
+	}
+	saved.Notes, saved.Attachments, saved.Checklist = notes, stored.Attachments, stored.Checklist
+	saved.UpdateChecklistProgress()
+	return nil
+}
+
+// save stores a copy of todo as the GORM hooks would leave it, numbering
+// its new notes.
+func (r *MemoryRepository) save(todo *models.Todo) {
+	now := time.Now()
+	todo.UpdatedAt = now
+	if todo.Completed && todo.CompletedAt == nil {
+		todo.CompletedAt = &now
+	}
+	todo.BeforeSave(nil)
+	for i := range todo.Notes {
+		if todo.Notes[i].ID == 0 {
+			r.noteID++
+			todo.Notes[i].ID = r.noteID
+			todo.Notes[i].CreatedAt, todo.Notes[i].UpdatedAt = now, now
+		}
+		todo.Notes[i].TodoID = todo.ID
+	}
+	todo.AfterFind(nil)
+	r.todos[todo.ID] = cloneTodo(todo)
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id uint) (*models.Todo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	todo.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return cloneTodo(todo), nil
+}
+
+func (r *MemoryRepository) Purge(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.todos, id)
+	return nil
+}
+
+func (r *MemoryRepository) SaveUID(ctx context.Context, uid string, apply func(*models.Todo) error) (*models.Todo, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var todo *models.Todo
+	for _, stored := range r.todos {
+		if stored.UID == uid {
+			todo = cloneTodo(stored)
+			break
+		}
+	}
+	created := todo == nil
+	if created {
+		todo = &models.Todo{}
+	}
+	if err := apply(todo); err != nil {
+		return nil, false, err
+	}
+	todo.UID = uid
+	todo.DeletedAt = gorm.DeletedAt{}
+	if created {
+		r.nextID++
+		todo.ID = r.nextID
+		todo.CreatedAt = time.Now()
+	}
+	r.save(todo)
+	return todo, created, nil
+}
+
+func (r *MemoryRepository) Import(ctx context.Context, records []transfer.Record, dryRun bool) (*transfer.Report, error) {
+	return nil, fmt.Errorf("imports are %w", ErrUnsupported)
+}
+
+func (r *MemoryRepository) AddNote(ctx context.Context, note *models.Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	todo, ok := r.todos[note.TodoID]
+	if !ok || todo.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	r.noteID++
+	note.ID = r.noteID
+	note.CreatedAt = time.Now()
+	note.UpdatedAt = note.CreatedAt
+	todo.Notes = append(todo.Notes, *note)
+	return nil
+}
+
+func (r *MemoryRepository) Note(ctx context.Context, todoID, noteID uint) (*models.Note, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i, todo := r.findNote(todoID, noteID); i >= 0 {
+		note := todo.Notes[i]
+		return &note, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) UpdateNote(ctx context.Context, note *models.Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, todo := r.findNote(note.TodoID, note.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	todo.Notes[i].Note = note.Note
+	todo.Notes[i].UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryRepository) DeleteNote(ctx context.Context, todoID, noteID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, todo := r.findNote(todoID, noteID)
+	if i < 0 {
+		return false, nil
+	}
+	todo.Notes = slices.Delete(todo.Notes, i, i+1)
+	return true, nil
+}
+
+// findNote returns the index of a note within its todo, or -1.
+func (r *MemoryRepository) findNote(todoID, noteID uint) (int, *models.Todo) {
+	todo, ok := r.todos[todoID]
+	if !ok {
+		return -1, nil
+	}
+	return slices.IndexFunc(todo.Notes, func(note models.Note) bool { return note.ID == noteID }), todo
+}
+
+// cloneTodo copies todo deeply enough that changing the copy leaves the
+// original alone.
+func cloneTodo(todo *models.Todo) *models.Todo {
+	copied := *todo
+	copied.Tags = slices.Clone(todo.Tags)
+	copied.Watchers = slices.Clone(todo.Watchers)
+	copied.Notes = slices.Clone(todo.Notes)
+	copied.Attachments = slices.Clone(todo.Attachments)
+	copied.Checklist = slices.Clone(todo.Checklist)
+	if todo.DueDate != nil {
+		dueDate := *todo.DueDate
+		copied.DueDate = &dueDate
+	}
+	copied.DueOn, copied.DueAt = clonePtr(todo.DueOn), clonePtr(todo.DueAt)
+	copied.CompletedAt = clonePtr(todo.CompletedAt)
+	copied.AssigneeID = clonePtr(todo.AssigneeID)
+	return &copied
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,71 @@
+// Package repository stores todos and their notes behind TodoRepository, so
+// that the services using them need neither Fiber nor GORM. GormRepository
+// is the one the app runs on; MemoryRepository keeps everything in memory,
+// for tests and tools that have no database.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"my-go-project/filter"
+	"my-go-project/models"
+	"my-go-project/transfer"
+)
+
+var (
+	// ErrNotFound is returned when a todo or note does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUnsupported is returned for queries a repository cannot run, such
+	// as filter expressions on a MemoryRepository, and for imports.
+	ErrUnsupported = errors.New("not supported by this repository")
+)
+
+// TodoQuery selects todos. Its zero value selects them all.
+type TodoQuery struct {
+	Due      string // overdue, today or week, see models.DueFilter
+	Assignee string // me, none or a username, see filter.Assignee
+	Filter   string // An expression as saved views take
+	// Options give the viewer's time, time zone and user, who is "me"
+	Options filter.Options
+}
+
+// TodoRepository stores todos with their notes. Todos are returned with
+// their notes, attachments and checklist; deleted todos are not returned.
+type TodoRepository interface {
+	// List returns the todos matching query in ID order.
+	List(ctx context.Context, query TodoQuery) ([]models.Todo, error)
+	// Get returns the todo with id, or ErrNotFound.
+	Get(ctx context.Context, id uint) (*models.Todo, error)
+	// Create stores a new todo and its notes, setting their IDs.
+	Create(ctx context.Context, todo *models.Todo) error
+	// Update stores every field of an existing todo, and adds the notes it
+	// carries that have no ID yet.
+	Update(ctx context.Context, todo *models.Todo) error
+	// Delete moves the todo with id to the trash and returns it, or returns
+	// ErrNotFound.
+	Delete(ctx context.Context, id uint) (*models.Todo, error)
+	// Purge permanently deletes the todo with id with its notes, checklist
+	// and attachments, whether or not it is in the trash. Purging a missing
+	// todo is not an error.
+	Purge(ctx context.Context, id uint) error
+	// SaveUID passes the todo with uid, also when it is in the trash, to
+	// apply, or a new todo when there is none, and stores what apply leaves
+	// in one go, out of the trash and with uid. The notes apply leaves on
+	// the todo replace the stored ones. It reports whether the todo was
+	// created; when apply fails, nothing is stored.
+	SaveUID(ctx context.Context, uid string, apply func(*models.Todo) error) (*models.Todo, bool, error)
+	// Import stores records as transfer.Import does.
+	Import(ctx context.Context, records []transfer.Record, dryRun bool) (*transfer.Report, error)
+
+	// AddNote stores a new note on the todo note.TodoID, or returns
+	// ErrNotFound when there is no such todo.
+	AddNote(ctx context.Context, note *models.Note) error
+	// Note returns the note with noteID on the todo with todoID, or ErrNotFound.
+	Note(ctx context.Context, todoID, noteID uint) (*models.Note, error)
+	// UpdateNote stores the text of an existing note.
+	UpdateNote(ctx context.Context, note *models.Note) error
+	// DeleteNote deletes the note with noteID from the todo with todoID and
+	// reports whether there was one.
+	DeleteNote(ctx context.Context, todoID, noteID uint) (bool, error)
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"log/slog"
+	"my-go-project/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 500
+)
+
+func RegisterActivityRoutes(app *fiber.App, db *gorm.DB) {
+
+	app.Get("/todos/:id/activity", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		id := c.Params("id")
+		query, err := activityPage(c, db.Where("todo_id = ?", id))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid query",
+				"details": err.Error(),
+			})
+		}
+
+		var activities []models.Activity
+		if err := query.Find(&activities).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching activity for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch activity",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(activities)
+	})
+	app.Get("/activity", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		query := db.Model(&models.Activity{})
+		filters := map[string]string{
+			"actor":       "actor = ?",
+			"actor_id":    "actor_id = ?",
+			"action":      "action = ?",
+			"entity_type": "entity_type = ?",
+			"entity_id":   "entity_id = ?",
+			"todo_id":     "todo_id = ?",
+			"request_id":  "request_id = ?",
+		}
+		for param, condition := range filters {
+			if value := c.Query(param); value != "" {
+				query = query.Where(condition, value)
+			}
+		}
+		for param, condition := range map[string]string{"since": "created_at >= ?", "until": "created_at < ?"} {
+			if value := c.Query(param); value != "" {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return c.Status(400).JSON(fiber.Map{
+						"error":   "Invalid " + param + " timestamp",
+						"details": err.Error(),
+					})
+				}
+				query = query.Where(condition, t)
+			}
+		}
+
+		query, err := activityPage(c, query)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid query",
+				"details": err.Error(),
+			})
+		}
+		var activities []models.Activity
+		if err := query.Find(&activities).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching activity", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch activity",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(activities)
+	})
+
+}
+
+// activityPage orders activities newest first and applies the ?limit= and
+// ?before= (an activity ID to page back from) parameters.
+func activityPage(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	limit := c.QueryInt("limit", defaultActivityLimit)
+	if limit <= 0 {
+		limit = defaultActivityLimit
+	}
+	if limit > maxActivityLimit {
+		limit = maxActivityLimit
+	}
+	if before := c.Query("before"); before != "" {
+		id, err := strconv.ParseUint(before, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("id < ?", id)
+	}
+	return query.Order("id DESC").Limit(limit), nil
+}
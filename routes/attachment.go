@@ -0,0 +1,369 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"my-go-project/database"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/storage"
+	"my-go-project/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// thumbnailSize is the bounding box in pixels of generated image thumbnails.
+const thumbnailSize = 256
+
+// AttachmentLimits bounds the size of uploads. A zero value disables a limit.
+type AttachmentLimits struct {
+	MaxFileSize int64 // Largest single upload in bytes
+	UserQuota   int64 // Total bytes a single user may have stored
+}
+
+func RegisterAttachmentRoutes(app *fiber.App, db *gorm.DB, store storage.BlobStore, limits AttachmentLimits) {
+
+	app.Get("/todos/:id/attachments", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		id := c.Params("id")
+		var attachments []models.Attachment
+		if err := db.Where("todo_id = ?", id).Order("id").Find(&attachments).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching attachments for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch attachments",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(attachments)
+	})
+	app.Post("/todos/:id/attachments", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		id := c.Params("id")
+		todoID, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid TodoID",
+				"details": err.Error(),
+			})
+		}
+		if err := db.First(&models.Todo{}, todoID).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Todo not found",
+				"details": err.Error(),
+			})
+		}
+
+		user, err := currentUser(c, db)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error resolving user", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to resolve user",
+				"details": err.Error(),
+			})
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Missing file",
+				"details": err.Error(),
+			})
+		}
+		if limits.MaxFileSize > 0 && header.Size > limits.MaxFileSize {
+			return c.Status(413).JSON(fiber.Map{
+				"error":   "File too large",
+				"details": fmt.Sprintf("file is %d bytes, maximum is %d", header.Size, limits.MaxFileSize),
+			})
+		}
+		if limits.UserQuota > 0 {
+			used, err := storedBytes(db, user)
+			if err != nil {
+				slog.ErrorContext(c.UserContext(), "Error computing attachment quota", "error", err) // Log the error
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to check quota",
+					"details": err.Error(),
+				})
+			}
+			if used+header.Size > limits.UserQuota {
+				return c.Status(413).JSON(fiber.Map{
+					"error":   "Attachment quota exceeded",
+					"details": fmt.Sprintf("%d of %d bytes used, upload is %d bytes", used, limits.UserQuota, header.Size),
+				})
+			}
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Failed to read file",
+				"details": err.Error(),
+			})
+		}
+		defer file.Close()
+
+		// Sniff the content type rather than trusting the client
+		sniff := make([]byte, 512)
+		n, _ := io.ReadFull(file, sniff)
+		contentType := http.DetectContentType(sniff[:n])
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		attachment := models.Attachment{
+			TodoID:      uint(todoID),
+			Filename:    sanitizeFilename(header.Filename),
+			ContentType: contentType,
+			Size:        header.Size,
+			StorageKey:  newBlobKey(uint(todoID)),
+		}
+		if user != nil {
+			attachment.UploaderID = &user.ID
+		}
+
+		hash := sha256.New()
+		if err := store.Put(c.UserContext(), attachment.StorageKey, io.TeeReader(file, hash), header.Size, contentType); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error storing attachment for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to store attachment",
+				"details": err.Error(),
+			})
+		}
+		attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+		if isThumbnailable(contentType) {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			// A missing thumbnail is not worth failing the upload for
+			if thumb, err := utils.Thumbnail(file, thumbnailSize); err != nil {
+				slog.ErrorContext(c.UserContext(), "Error generating thumbnail", "todo_id", id, "error", err)
+			} else {
+				key := attachment.StorageKey + ".thumb.png"
+				if err := store.Put(c.UserContext(), key, bytes.NewReader(thumb), int64(len(thumb)), "image/png"); err != nil {
+					slog.ErrorContext(c.UserContext(), "Error storing thumbnail", "todo_id", id, "error", err)
+				} else {
+					attachment.ThumbnailKey = key
+					attachment.HasThumbnail = true
+				}
+			}
+		}
+
+		if err := db.Create(&attachment).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error creating attachment for todo", "todo_id", id, "error", err) // Log the error
+			store.Delete(c.UserContext(), attachment.StorageKey)
+			if attachment.ThumbnailKey != "" {
+				store.Delete(c.UserContext(), attachment.ThumbnailKey)
+			}
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create attachment",
+				"details": err.Error(),
+			})
+		}
+		return c.Status(201).JSON(attachment)
+	})
+	app.Get("/todos/:todoId/attachments/:attachmentId", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		attachment, err := findAttachment(c, db)
+		if attachment == nil {
+			return err
+		}
+		blob, err := openBlob(c, store, attachment.StorageKey)
+		if blob == nil {
+			return err
+		}
+
+		disposition := "attachment"
+		if strings.HasPrefix(attachment.ContentType, "image/") || attachment.ContentType == "application/pdf" {
+			disposition = "inline"
+		}
+		c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+		c.Set(fiber.HeaderContentType, attachment.ContentType)
+		c.Set(fiber.HeaderETag, `"`+attachment.SHA256+`"`)
+		return sendBlob(c, blob)
+	})
+	app.Get("/todos/:todoId/attachments/:attachmentId/thumbnail", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		attachment, err := findAttachment(c, db)
+		if attachment == nil {
+			return err
+		}
+		if attachment.ThumbnailKey == "" {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Attachment has no thumbnail",
+			})
+		}
+		blob, err := openBlob(c, store, attachment.ThumbnailKey)
+		if blob == nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, "image/png")
+		return sendBlob(c, blob)
+	})
+	app.Delete("/todos/:todoId/attachments/:attachmentId", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		attachment, err := findAttachment(c, db)
+		if attachment == nil {
+			return err
+		}
+
+		err = database.Transaction(db, func(tx *gorm.DB) error {
+			if err := repository.QueueBlobDeletions(tx, []models.Attachment{*attachment}); err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(attachment).Error
+		})
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error deleting attachment", "attachment_id", attachment.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete attachment",
+				"details": err.Error(),
+			})
+		}
+
+		// Remove the blobs right away; anything left over is retried by the sweeper
+		if err := storage.Sweep(c.UserContext(), db, store); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error sweeping deleted blobs", "error", err)
+		}
+		return c.SendStatus(204)
+	})
+
+}
+
+// storedBytes returns the total size of attachments uploaded by user, with
+// anonymous uploads sharing a single allowance.
+func storedBytes(db *gorm.DB, user *models.User) (int64, error) {
+	query := db.Model(&models.Attachment{})
+	if user != nil {
+		query = query.Where("uploader_id = ?", user.ID)
+	} else {
+		query = query.Where("uploader_id IS NULL")
+	}
+	var used int64
+	err := query.Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// findAttachment loads the attachment addressed by the :todoId and
+// :attachmentId parameters. If it does not exist a 404 response is written and
+// the attachment is nil.
+func findAttachment(c *fiber.Ctx, db *gorm.DB) (*models.Attachment, error) {
+	todoId := c.Params("todoId")
+	attachmentId := c.Params("attachmentId")
+
+	var attachment models.Attachment
+	if err := db.Where("todo_id = ? AND id = ?", todoId, attachmentId).First(&attachment).Error; err != nil {
+		slog.ErrorContext(c.UserContext(), "Error fetching attachment", "attachment_id", attachmentId, "todo_id", todoId, "error", err) // Log the error
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error":   "Attachment not found",
+			"details": err.Error(),
+		})
+	}
+	return &attachment, nil
+}
+
+// openBlob opens a blob from the store. On failure an error response is
+// written and the blob is nil.
+func openBlob(c *fiber.Ctx, store storage.BlobStore, key string) (storage.Blob, error) {
+	// The blob is streamed after the handler returns and the request context is
+	// cancelled, so only its values are kept
+	blob, err := store.Open(context.WithoutCancel(c.UserContext()), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error":   "Attachment content missing",
+			"details": err.Error(),
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "Error opening blob", "key", key, "error", err) // Log the error
+		return nil, c.Status(500).JSON(fiber.Map{
+			"error":   "Failed to read attachment",
+			"details": err.Error(),
+		})
+	}
+	return blob, nil
+}
+
+// sendBlob streams a blob to the client, honouring a single byte range from
+// the Range header. The blob is closed once the response has been written.
+func sendBlob(c *fiber.Ctx, blob storage.Blob) error {
+	size := blob.Size()
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+
+	if c.Get(fiber.HeaderRange) == "" {
+		return c.SendStream(blob, int(size))
+	}
+	ranges, err := c.Range(int(size))
+	if errors.Is(err, fiber.ErrRangeUnsatisfiable) {
+		blob.Close()
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+		return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+	}
+	// Malformed, non-byte and multi-range requests get the whole blob
+	if err != nil || ranges.Type != "bytes" || len(ranges.Ranges) != 1 {
+		return c.SendStream(blob, int(size))
+	}
+
+	start, end := int64(ranges.Ranges[0].Start), int64(ranges.Ranges[0].End)
+	if _, err := blob.Seek(start, io.SeekStart); err != nil {
+		blob.Close()
+		return err
+	}
+	length := end - start + 1
+	c.Status(fiber.StatusPartialContent)
+	c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	return c.SendStream(struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(blob, length), blob}, int(length))
+}
+
+// newBlobKey returns a fresh, unguessable storage key for an attachment of a todo.
+func newBlobKey(todoID uint) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("todos/%d/%s", todoID, hex.EncodeToString(b))
+}
+
+// sanitizeFilename strips any directory components and control characters
+// from a client-supplied file name.
+func sanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+// isThumbnailable reports whether utils.Thumbnail can decode the content type.
+func isThumbnailable(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"my-go-project/ical"
+	"my-go-project/models"
+	"my-go-project/service"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// calendarContentType is the media type of iCalendar responses.
+const calendarContentType = "text/calendar; charset=utf-8"
+
+func RegisterCalendarRoutes(app *fiber.App, db *gorm.DB, todos *service.TodoService) {
+
+	// Issue or rotate the secret feed URL of the current user
+	app.Post("/calendar/token", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create calendar token",
+				"details": err.Error(),
+			})
+		}
+		token := hex.EncodeToString(secret)
+		if err := db.Model(user).Update("calendar_token", token).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error saving calendar token", "user", user.Username, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create calendar token",
+				"details": err.Error(),
+			})
+		}
+		return c.Status(201).JSON(fiber.Map{
+			"token": token,
+			"url":   c.BaseURL() + "/calendar/" + token + ".ics",
+		})
+	})
+	app.Delete("/calendar/token", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+		if err := db.Model(user).Update("calendar_token", nil).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error revoking calendar token", "user", user.Username, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to revoke calendar token",
+				"details": err.Error(),
+			})
+		}
+		return c.SendStatus(204)
+	})
+
+	// The feed is authenticated by its token alone, so calendar apps can subscribe to it
+	app.Get("/calendar/:token.ics", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		token := c.Params("token")
+
+		var user models.User
+		if err := db.Where("calendar_token = ?", token).First(&user).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Calendar not found",
+			})
+		}
+
+		var todos []models.Todo
+		if err := db.Preload("Notes").Order("id").Find(&todos).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching todos for calendar", "user", user.Username, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch todos",
+				"details": err.Error(),
+			})
+		}
+
+		cal := ical.NewCalendar("Todos")
+		events := c.QueryBool("events")
+		for i := range todos {
+			cal.Children = append(cal.Children, ical.TodoComponent(&todos[i]))
+			if event := ical.EventComponent(&todos[i]); events && event != nil {
+				cal.Children = append(cal.Children, event)
+			}
+		}
+
+		var body bytes.Buffer
+		if err := ical.Encode(&body, cal); err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, calendarContentType)
+		c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+		return c.Send(body.Bytes())
+	})
+
+	app.Post("/import/ics", func(c *fiber.Ctx) error {
+		cal, err := ical.Decode(bytes.NewReader(c.Body()))
+		if err == nil && cal.Name != "VCALENDAR" {
+			err = fmt.Errorf("expected VCALENDAR, got %s", cal.Name)
+		}
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid iCalendar data",
+				"details": err.Error(),
+			})
+		}
+
+		created, updated := 0, 0
+		failures := []fiber.Map{}
+		for _, component := range cal.Components("VTODO") {
+			_, isNew, err := todos.SaveVTodo(c.UserContext(), component, nil)
+			if err != nil {
+				slog.ErrorContext(c.UserContext(), "Error importing VTODO", "uid", component.Text("UID"), "error", err) // Log the error
+				failures = append(failures, fiber.Map{
+					"uid":   component.Text("UID"),
+					"error": err.Error(),
+				})
+			} else if isNew {
+				created++
+			} else {
+				updated++
+			}
+		}
+		return c.JSON(fiber.Map{
+			"created": created,
+			"updated": updated,
+			"errors":  failures,
+		})
+	})
+
+}
+
+// requireUser returns the current user. Anonymous requests get a 401
+// response and a nil user.
+func requireUser(c *fiber.Ctx) (*models.User, error) {
+	user := actingUser(c)
+	if user == nil {
+		return nil, c.Status(401).JSON(fiber.Map{
+			"error": "The " + UserHeader + " header is required",
+		})
+	}
+	return user, nil
+}
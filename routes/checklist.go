@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"my-go-project/database"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func RegisterChecklistRoutes(app *fiber.App, db *gorm.DB) {
+
+	app.Get("/todos/:id/checklist", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		id := c.Params("id")
+		var items []models.ChecklistItem
+		if err := repository.OrderedChecklist(db).Where("todo_id = ?", id).Find(&items).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching checklist for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch checklist",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(items)
+	})
+	app.Post("/todos/:id/checklist", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		id := c.Params("id")
+		todoID, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid TodoID",
+				"details": err.Error(),
+			})
+		}
+
+		var item models.ChecklistItem
+		if err := c.BodyParser(&item); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body for checklist item", "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		if item.Text == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "Checklist item text is required",
+			})
+		}
+		item.TodoID = uint(todoID)
+
+		err = database.Transaction(db, func(tx *gorm.DB) error {
+			if err := tx.First(&models.Todo{}, todoID).Error; err != nil {
+				return err
+			}
+			// New items go to the end of the list
+			var last struct{ Position *int }
+			if err := tx.Model(&models.ChecklistItem{}).Select("MAX(position) AS position").
+				Where("todo_id = ?", todoID).Scan(&last).Error; err != nil {
+				return err
+			}
+			item.Position = 0
+			if last.Position != nil {
+				item.Position = *last.Position + 1
+			}
+			return tx.Create(&item).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Todo not found",
+				"details": err.Error(),
+			})
+		}
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error creating checklist item for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create checklist item",
+				"details": err.Error(),
+			})
+		}
+		return c.Status(201).JSON(item)
+	})
+	app.Patch("/todos/:todoId/checklist/:itemId", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		item, err := findChecklistItem(c, db)
+		if item == nil {
+			return err
+		}
+
+		var body struct {
+			Text *string `json:"text"`
+			Done *bool   `json:"done"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body for checklist item", "item_id", item.ID, "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		if body.Text != nil {
+			if *body.Text == "" {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "Checklist item text is required",
+				})
+			}
+			item.Text = *body.Text
+		}
+		if body.Done != nil {
+			item.Done = *body.Done
+		}
+
+		if err := db.Save(item).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error updating checklist item", "item_id", item.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update checklist item",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(item)
+	})
+	app.Delete("/todos/:todoId/checklist/:itemId", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		todoId := c.Params("todoId")
+		itemId := c.Params("itemId")
+
+		if err := db.Where("todo_id = ? AND id = ?", todoId, itemId).Delete(&models.ChecklistItem{}).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error deleting checklist item", "item_id", itemId, "todo_id", todoId, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete checklist item",
+				"details": err.Error(),
+			})
+		}
+		return c.SendStatus(204)
+	})
+	app.Put("/todos/:id/checklist/order", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		id := c.Params("id")
+		var body struct {
+			IDs []uint `json:"ids"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body for checklist order", "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+
+		var items []models.ChecklistItem
+		if err := db.Where("todo_id = ?", id).Find(&items).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching checklist for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch checklist",
+				"details": err.Error(),
+			})
+		}
+		if err := validateOrder(items, body.IDs); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid checklist order",
+				"details": err.Error(),
+			})
+		}
+
+		err := database.Transaction(db, func(tx *gorm.DB) error {
+			for position, itemID := range body.IDs {
+				if err := tx.Model(&models.ChecklistItem{}).Where("id = ?", itemID).
+					Update("position", position).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error reordering checklist for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to reorder checklist",
+				"details": err.Error(),
+			})
+		}
+
+		if err := repository.OrderedChecklist(db).Where("todo_id = ?", id).Find(&items).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch checklist",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(items)
+	})
+	app.Post("/todos/:todoId/checklist/:itemId/convert", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		item, err := findChecklistItem(c, db)
+		if item == nil {
+			return err
+		}
+
+		// Promote the item to a todo of its own and remove it from the checklist
+		todo := models.Todo{Subject: item.Text, Completed: item.Done}
+		err = database.Transaction(db, func(tx *gorm.DB) error {
+			if err := tx.Create(&todo).Error; err != nil {
+				return err
+			}
+			return tx.Delete(item).Error
+		})
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error converting checklist item", "item_id", item.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to convert checklist item",
+				"details": err.Error(),
+			})
+		}
+		return c.Status(201).JSON(todo)
+	})
+
+}
+
+// findChecklistItem loads the checklist item addressed by the :todoId and
+// :itemId parameters. If it does not exist a 404 response is written and the
+// item is nil.
+func findChecklistItem(c *fiber.Ctx, db *gorm.DB) (*models.ChecklistItem, error) {
+	todoId := c.Params("todoId")
+	itemId := c.Params("itemId")
+
+	var item models.ChecklistItem
+	if err := db.Where("todo_id = ? AND id = ?", todoId, itemId).First(&item).Error; err != nil {
+		slog.ErrorContext(c.UserContext(), "Error fetching checklist item", "item_id", itemId, "todo_id", todoId, "error", err) // Log the error
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error":   "Checklist item not found",
+			"details": err.Error(),
+		})
+	}
+	return &item, nil
+}
+
+// validateOrder checks that ids lists every checklist item exactly once.
+func validateOrder(items []models.ChecklistItem, ids []uint) error {
+	if len(ids) != len(items) {
+		return fmt.Errorf("expected %d item IDs, got %d", len(items), len(ids))
+	}
+	known := make(map[uint]bool, len(items))
+	for _, item := range items {
+		known[item.ID] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			return fmt.Errorf("item %d is not in this checklist or is listed twice", id)
+		}
+		delete(known, id)
+	}
+	return nil
+}
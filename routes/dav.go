@@ -0,0 +1,724 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"my-go-project/caldav"
+	"my-go-project/ical"
+	"my-go-project/models"
+	"my-go-project/service"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// DAVMethods are the HTTP methods the CalDAV endpoint needs beyond Fiber's
+// defaults. Apps serving it must be created with RequestMethods().
+var DAVMethods = []string{"PROPFIND", "PROPPATCH", "REPORT"}
+
+// RequestMethods returns Fiber's default methods plus DAVMethods, for fiber.Config.
+func RequestMethods() []string {
+	return append(append([]string{}, fiber.DefaultMethods...), DAVMethods...)
+}
+
+// The DAV tree has one principal whose calendar home holds a VTODO
+// collection per list, each todo stored in its list's collection as
+// <uid>.ics. Todos without a list are in /dav/calendars/todos/, those filed
+// under a list in /dav/calendars/list-<name>/.
+const (
+	davRoot       = "/dav/"
+	davPrincipal  = "/dav/principal/"
+	davHome       = "/dav/calendars/"
+	davCollection = "/dav/calendars/todos/"
+	davListPrefix = "list-"
+
+	davSyncTokenPrefix = "urn:my-go-project:sync:"
+	davAllow           = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, PROPPATCH, REPORT"
+)
+
+type davKind int
+
+const (
+	davKindRoot davKind = iota
+	davKindPrincipal
+	davKindHome
+	davKindCollection
+	davKindTodo
+)
+
+// davTarget is the resource a request path addresses.
+type davTarget struct {
+	kind davKind
+	list string // The list of a collection or todo; empty for the todos without one
+	uid  string // Only for davKindTodo
+}
+
+func (t davTarget) href() string {
+	switch t.kind {
+	case davKindPrincipal:
+		return davPrincipal
+	case davKindHome:
+		return davHome
+	case davKindCollection:
+		return collectionHref(t.list)
+	case davKindTodo:
+		return collectionHref(t.list) + url.PathEscape(t.uid) + ".ics"
+	}
+	return davRoot
+}
+
+func RegisterDAVRoutes(app *fiber.App, db *gorm.DB, todos *service.TodoService) {
+
+	// Clients discover the endpoint through the well-known URI (RFC 6764)
+	for _, method := range []string{fiber.MethodGet, "PROPFIND"} {
+		app.Add(method, "/.well-known/caldav", func(c *fiber.Ctx) error {
+			return c.Redirect(davRoot, fiber.StatusMovedPermanently)
+		})
+	}
+
+	handler := func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		c.Set("DAV", "1, 3, calendar-access")
+
+		target, ok := resolveDAVPath(c.Path())
+		if !ok {
+			return c.SendStatus(404)
+		}
+
+		switch c.Method() {
+		case fiber.MethodOptions:
+			c.Set(fiber.HeaderAllow, davAllow)
+			return c.SendStatus(200)
+		case "PROPFIND":
+			return davPropfind(c, db, target)
+		case "PROPPATCH":
+			return davProppatch(c, target)
+		case "REPORT":
+			if target.kind != davKindCollection {
+				c.Set(fiber.HeaderAllow, "OPTIONS, PROPFIND, PROPPATCH")
+				return c.SendStatus(405)
+			}
+			return davReport(c, db, target.list)
+		}
+
+		if target.kind != davKindTodo {
+			c.Set(fiber.HeaderAllow, "OPTIONS, PROPFIND, PROPPATCH")
+			if target.kind == davKindCollection {
+				c.Set(fiber.HeaderAllow, "OPTIONS, PROPFIND, PROPPATCH, REPORT")
+			}
+			return c.SendStatus(405)
+		}
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead:
+			return davGet(c, db, target)
+		case fiber.MethodPut:
+			return davPut(c, db, todos, target)
+		case fiber.MethodDelete:
+			return davDelete(c, db, todos, target)
+		}
+		return c.SendStatus(405)
+	}
+	for _, method := range []string{fiber.MethodOptions, fiber.MethodGet, fiber.MethodHead, fiber.MethodPut, fiber.MethodDelete, "PROPFIND", "PROPPATCH", "REPORT"} {
+		app.Add(method, "/dav", handler)
+		app.Add(method, "/dav/*", handler)
+	}
+
+}
+
+// resolveDAVPath maps a raw request path onto the DAV tree.
+func resolveDAVPath(path string) (davTarget, bool) {
+	switch strings.TrimSuffix(path, "/") + "/" {
+	case davRoot:
+		return davTarget{kind: davKindRoot}, true
+	case davPrincipal:
+		return davTarget{kind: davKindPrincipal}, true
+	case davHome:
+		return davTarget{kind: davKindHome}, true
+	}
+
+	rest, ok := strings.CutPrefix(path, davHome)
+	if !ok {
+		return davTarget{}, false
+	}
+	segment, name, _ := strings.Cut(rest, "/")
+	list, ok := collectionList(segment)
+	if !ok {
+		return davTarget{}, false
+	}
+	if name == "" {
+		return davTarget{kind: davKindCollection, list: list}, true
+	}
+	if strings.Contains(name, "/") || !strings.HasSuffix(name, ".ics") {
+		return davTarget{}, false
+	}
+	uid, err := url.PathUnescape(strings.TrimSuffix(name, ".ics"))
+	if err != nil || uid == "" {
+		return davTarget{}, false
+	}
+	return davTarget{kind: davKindTodo, list: list, uid: uid}, true
+}
+
+// collectionList returns the list whose collection has the path segment
+// segment, as collectionHref names them.
+func collectionList(segment string) (string, bool) {
+	if segment == strings.Trim(strings.TrimPrefix(davCollection, davHome), "/") {
+		return "", true
+	}
+	escaped, ok := strings.CutPrefix(segment, davListPrefix)
+	if !ok {
+		return "", false
+	}
+	list, err := url.PathUnescape(escaped)
+	if err != nil || list == "" || len(list) > 100 {
+		return "", false
+	}
+	return list, true
+}
+
+func collectionHref(list string) string {
+	if list == "" {
+		return davCollection
+	}
+	return davHome + davListPrefix + url.PathEscape(list) + "/"
+}
+
+func todoHref(todo *models.Todo) string {
+	return davTarget{kind: davKindTodo, list: todo.List, uid: todo.UID}.href()
+}
+
+// davLists returns the lists that have todos, each of which is a collection
+// besides the one of the todos without a list.
+func davLists(db *gorm.DB) ([]string, error) {
+	var lists []string
+	err := db.Model(&models.Todo{}).Where("list <> ''").Distinct().Order("list").Pluck("list", &lists).Error
+	return lists, err
+}
+
+// inList selects the todos in the collection of list. Rows from before lists
+// were added have no list at all.
+func inList(list string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("COALESCE(list, '') = ?", list)
+	}
+}
+
+// davFindTodo loads the todo that target addresses, which must be in the
+// target's collection.
+func davFindTodo(db *gorm.DB, target davTarget) (*models.Todo, error) {
+	var todo models.Todo
+	if err := db.Preload("Notes").Where("uid = ?", target.uid).Scopes(inList(target.list)).First(&todo).Error; err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+func davPropfind(c *fiber.Ctx, db *gorm.DB, target davTarget) error {
+	propfind, err := caldav.ReadPropFind(c.Body())
+	if err != nil {
+		return c.Status(400).SendString("Invalid PROPFIND body: " + err.Error())
+	}
+	names := propfind.Prop.PropNames()
+	nameOnly := propfind.PropName != nil
+
+	if target.kind == davKindTodo {
+		todo, err := davFindTodo(db, target)
+		if err != nil {
+			return c.SendStatus(404)
+		}
+		versions, err := davVersions(db, []models.Todo{*todo})
+		if err != nil {
+			return davError(c, err)
+		}
+		return davMultistatus(c, &caldav.Multistatus{Responses: []caldav.Response{
+			todoResponse(todo, versions, names, nameOnly),
+		}})
+	}
+
+	token, err := davSyncToken(db)
+	if err != nil {
+		return davError(c, err)
+	}
+	targets := []davTarget{target}
+	if c.Get("Depth", "infinity") != "0" {
+		switch target.kind {
+		case davKindRoot:
+			targets = append(targets, davTarget{kind: davKindPrincipal}, davTarget{kind: davKindHome})
+		case davKindHome:
+			lists, err := davLists(db)
+			if err != nil {
+				return davError(c, err)
+			}
+			targets = append(targets, davTarget{kind: davKindCollection})
+			for _, list := range lists {
+				targets = append(targets, davTarget{kind: davKindCollection, list: list})
+			}
+		}
+	}
+	var responses []caldav.Response
+	for _, t := range targets {
+		responses = append(responses, davResponse(t.href(), collectionProps(t, token), names, nameOnly))
+	}
+
+	if target.kind == davKindCollection && c.Get("Depth", "infinity") != "0" {
+		var todos []models.Todo
+		if err := db.Preload("Notes").Scopes(inList(target.list)).Order("id").Find(&todos).Error; err != nil {
+			return davError(c, err)
+		}
+		versions, err := davVersions(db, todos)
+		if err != nil {
+			return davError(c, err)
+		}
+		for i := range todos {
+			responses = append(responses, todoResponse(&todos[i], versions, names, nameOnly))
+		}
+	}
+	return davMultistatus(c, &caldav.Multistatus{Responses: responses})
+}
+
+// davProppatch refuses every change; the tree's properties are all computed.
+func davProppatch(c *fiber.Ctx, target davTarget) error {
+	var update caldav.PropertyUpdate
+	if err := xml.Unmarshal(c.Body(), &update); err != nil {
+		return c.Status(400).SendString("Invalid PROPPATCH body: " + err.Error())
+	}
+	response := caldav.Response{Href: target.href()}
+	for _, props := range append(update.Set, update.Remove...) {
+		response.Forbidden = append(response.Forbidden, props.PropNames()...)
+	}
+	return davMultistatus(c, &caldav.Multistatus{Responses: []caldav.Response{response}})
+}
+
+func davReport(c *fiber.Ctx, db *gorm.DB, list string) error {
+	report, err := caldav.ReadReport(c.Body())
+	if err != nil {
+		return c.Status(400).SendString("Invalid REPORT body: " + err.Error())
+	}
+
+	switch report := report.(type) {
+	case *caldav.CalendarQuery:
+		var todos []models.Todo
+		if err := db.Preload("Notes").Scopes(inList(list)).Order("id").Find(&todos).Error; err != nil {
+			return davError(c, err)
+		}
+		versions, err := davVersions(db, todos)
+		if err != nil {
+			return davError(c, err)
+		}
+		var responses []caldav.Response
+		for i := range todos {
+			match, err := caldav.Match(report.Filter.CompFilter, todoCalendar(&todos[i]))
+			if err != nil {
+				return c.Status(400).SendString("Invalid filter: " + err.Error())
+			}
+			if match {
+				responses = append(responses, todoResponse(&todos[i], versions, report.Prop.PropNames(), false))
+			}
+		}
+		return davMultistatus(c, &caldav.Multistatus{Responses: responses})
+
+	case *caldav.CalendarMultiget:
+		uids := make([]string, 0, len(report.Hrefs))
+		for _, href := range report.Hrefs {
+			if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+				if target, ok := resolveDAVPath(u.EscapedPath()); ok && target.kind == davKindTodo && target.list == list {
+					uids = append(uids, target.uid)
+					continue
+				}
+			}
+			uids = append(uids, "")
+		}
+		var todos []models.Todo
+		if err := db.Preload("Notes").Where("uid IN ?", uids).Scopes(inList(list)).Find(&todos).Error; err != nil {
+			return davError(c, err)
+		}
+		versions, err := davVersions(db, todos)
+		if err != nil {
+			return davError(c, err)
+		}
+		byUID := make(map[string]*models.Todo, len(todos))
+		for i := range todos {
+			byUID[todos[i].UID] = &todos[i]
+		}
+		var responses []caldav.Response
+		for i, href := range report.Hrefs {
+			if todo, ok := byUID[uids[i]]; ok {
+				responses = append(responses, todoResponse(todo, versions, report.Prop.PropNames(), false))
+			} else {
+				responses = append(responses, caldav.Response{Href: strings.TrimSpace(href), Status: 404})
+			}
+		}
+		return davMultistatus(c, &caldav.Multistatus{Responses: responses})
+
+	case *caldav.SyncCollection:
+		return davSyncCollection(c, db, list, report)
+	}
+	return c.SendStatus(400)
+}
+
+// davSyncCollection reports the todos of list changed since the client's
+// sync token. The token is the ID of the newest activity seen, so anything
+// logged after it is a change; todos deleted or moved to another list are
+// reported with a 404 status.
+func davSyncCollection(c *fiber.Ctx, db *gorm.DB, list string, report *caldav.SyncCollection) error {
+	var current, oldest uint
+	if err := db.Model(&models.Activity{}).Select("COALESCE(MAX(id), 0)").Scan(&current).Error; err != nil {
+		return davError(c, err)
+	}
+	if err := db.Model(&models.Activity{}).Select("COALESCE(MIN(id), 0)").Scan(&oldest).Error; err != nil {
+		return davError(c, err)
+	}
+
+	var since uint64
+	if report.SyncToken != "" {
+		var err error
+		since, err = strconv.ParseUint(strings.TrimPrefix(report.SyncToken, davSyncTokenPrefix), 10, 64)
+		// Changes may have been pruned from the log, forcing a full resync
+		if err != nil || !strings.HasPrefix(report.SyncToken, davSyncTokenPrefix) ||
+			uint(since) > current || (oldest > 0 && uint(since)+1 < oldest) {
+			return davPrecondition(c, caldav.ValidSyncToken)
+		}
+	}
+
+	names := report.Prop.PropNames()
+	multistatus := caldav.Multistatus{SyncToken: davSyncTokenPrefix + strconv.FormatUint(uint64(current), 10)}
+	if since == 0 {
+		var todos []models.Todo
+		if err := db.Preload("Notes").Scopes(inList(list)).Order("id").Find(&todos).Error; err != nil {
+			return davError(c, err)
+		}
+		versions, err := davVersions(db, todos)
+		if err != nil {
+			return davError(c, err)
+		}
+		for i := range todos {
+			multistatus.Responses = append(multistatus.Responses, todoResponse(&todos[i], versions, names, false))
+		}
+		return davMultistatus(c, &multistatus)
+	}
+
+	var ids []uint
+	if err := db.Model(&models.Activity{}).Where("id > ? AND id <= ? AND todo_id IS NOT NULL", since, current).
+		Distinct().Pluck("todo_id", &ids).Error; err != nil {
+		return davError(c, err)
+	}
+	var todos []models.Todo
+	if err := db.Unscoped().Preload("Notes").Where("id IN ?", ids).Order("id").Find(&todos).Error; err != nil {
+		return davError(c, err)
+	}
+	versions, err := davVersions(db, todos)
+	if err != nil {
+		return davError(c, err)
+	}
+	found := make(map[uint]bool, len(todos))
+	for i := range todos {
+		found[todos[i].ID] = true
+		if todos[i].DeletedAt.Valid || todos[i].List != list {
+			href := davTarget{kind: davKindTodo, list: list, uid: todos[i].UID}.href()
+			multistatus.Responses = append(multistatus.Responses, caldav.Response{Href: href, Status: 404})
+		} else {
+			multistatus.Responses = append(multistatus.Responses, todoResponse(&todos[i], versions, names, false))
+		}
+	}
+
+	// Hard-deleted todos only live on in the activity log
+	for _, id := range ids {
+		if found[id] {
+			continue
+		}
+		var activity models.Activity
+		err := db.Where("entity_type = ? AND entity_id = ? AND action = ?", "Todo", id, models.ActionDelete).
+			Order("id DESC").First(&activity).Error
+		if err != nil {
+			continue
+		}
+		if uid, ok := activity.Changes["uid"].Before.(string); ok && uid != "" {
+			href := davTarget{kind: davKindTodo, list: list, uid: uid}.href()
+			multistatus.Responses = append(multistatus.Responses, caldav.Response{Href: href, Status: 404})
+		}
+	}
+	return davMultistatus(c, &multistatus)
+}
+
+func davGet(c *fiber.Ctx, db *gorm.DB, target davTarget) error {
+	todo, err := davFindTodo(db, target)
+	if err != nil {
+		return c.SendStatus(404)
+	}
+	versions, err := davVersions(db, []models.Todo{*todo})
+	if err != nil {
+		return davError(c, err)
+	}
+	etag := davETag(todo, versions)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, todo.UpdatedAt.UTC().Format(http.TimeFormat))
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(304)
+	}
+
+	var body bytes.Buffer
+	if err := ical.Encode(&body, todoCalendar(todo)); err != nil {
+		return davError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, calendarContentType)
+	return c.Send(body.Bytes())
+}
+
+// davPut stores a VTODO in the target's collection. A todo with the UID in
+// another collection is moved into this one.
+func davPut(c *fiber.Ctx, db *gorm.DB, todos *service.TodoService, target davTarget) error {
+	uid := target.uid
+	cal, err := ical.Decode(bytes.NewReader(c.Body()))
+	if err != nil || cal.Name != "VCALENDAR" {
+		return davPrecondition(c, caldav.ValidCalendarData)
+	}
+	var component *ical.Component
+	for _, vtodo := range cal.Components("VTODO") {
+		if vtodo.Get("RECURRENCE-ID") == nil { // Overrides of single occurrences are not stored
+			component = vtodo
+			break
+		}
+	}
+	if component == nil {
+		return davPrecondition(c, caldav.SupportedCalendarComponent)
+	}
+	if component.Text("UID") != uid {
+		return c.Status(400).SendString("The UID of the VTODO must match the resource name")
+	}
+	if _, err := ical.ApplyTodo(component, &models.Todo{}); err != nil {
+		return davPrecondition(c, caldav.ValidCalendarData)
+	}
+
+	existing, err := davFindTodo(db, target)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return davError(c, err)
+	}
+	exists := err == nil
+	etag := ""
+	if exists {
+		versions, err := davVersions(db, []models.Todo{*existing})
+		if err != nil {
+			return davError(c, err)
+		}
+		etag = davETag(existing, versions)
+	}
+	if !davPreconditionsHold(c, exists, etag) {
+		return c.SendStatus(412)
+	}
+
+	todo, _, err := todos.SaveVTodo(c.UserContext(), component, &target.list)
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "Error storing VTODO", "uid", uid, "error", err) // Log the error
+		return davError(c, err)
+	}
+
+	versions, err := davVersions(db, []models.Todo{*todo})
+	if err != nil {
+		return davError(c, err)
+	}
+	c.Set(fiber.HeaderETag, davETag(todo, versions))
+	if exists {
+		return c.SendStatus(204)
+	}
+	return c.SendStatus(201)
+}
+
+func davDelete(c *fiber.Ctx, db *gorm.DB, todos *service.TodoService, target davTarget) error {
+	todo, err := davFindTodo(db, target)
+	if err != nil {
+		return c.SendStatus(404)
+	}
+	versions, err := davVersions(db, []models.Todo{*todo})
+	if err != nil {
+		return davError(c, err)
+	}
+	if !davPreconditionsHold(c, true, davETag(todo, versions)) {
+		return c.SendStatus(412)
+	}
+	if _, err := todos.Delete(c.UserContext(), todo.ID); err != nil {
+		slog.ErrorContext(c.UserContext(), "Error deleting todo", "uid", target.uid, "error", err) // Log the error
+		return davError(c, err)
+	}
+	return c.SendStatus(204)
+}
+
+// davPreconditionsHold evaluates If-Match and If-None-Match against the
+// current ETag of a resource.
+func davPreconditionsHold(c *fiber.Ctx, exists bool, etag string) bool {
+	matches := func(header string) bool {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || candidate == etag {
+				return exists
+			}
+		}
+		return false
+	}
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" && !matches(ifMatch) {
+		return false
+	}
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" && matches(ifNoneMatch) {
+		return false
+	}
+	return true
+}
+
+// collectionProps returns the live properties of the non-todo resources.
+func collectionProps(target davTarget, syncToken string) map[xml.Name]string {
+	collection := caldav.Tag(caldav.NSDAV, "collection")
+	props := map[xml.Name]string{
+		caldav.CurrentUserPrincipal: caldav.Href(davPrincipal),
+	}
+	switch target.kind {
+	case davKindRoot:
+		props[caldav.ResourceType] = collection
+		props[caldav.CalendarHomeSet] = caldav.Href(davHome)
+	case davKindPrincipal:
+		props[caldav.ResourceType] = caldav.Tag(caldav.NSDAV, "principal")
+		props[caldav.DisplayName] = "Todos"
+		props[caldav.PrincipalURL] = caldav.Href(davPrincipal)
+		props[caldav.CalendarHomeSet] = caldav.Href(davHome)
+	case davKindHome:
+		props[caldav.ResourceType] = collection
+		props[caldav.CurrentUserPrivilegeSet] = davPrivileges("read")
+	case davKindCollection:
+		props[caldav.ResourceType] = collection + caldav.Tag(caldav.NSCalDAV, "calendar")
+		props[caldav.DisplayName] = "Todos"
+		if target.list != "" {
+			props[caldav.DisplayName] = caldav.Text(target.list)
+		}
+		props[caldav.SupportedCalendarComponentSet] = `<C:comp name="VTODO"/>`
+		props[caldav.SupportedCalendarData] = `<C:calendar-data content-type="text/calendar" version="2.0"/>`
+		props[caldav.SupportedReportSet] = davReports(
+			caldav.Tag(caldav.NSCalDAV, "calendar-query"),
+			caldav.Tag(caldav.NSCalDAV, "calendar-multiget"),
+			caldav.Tag(caldav.NSDAV, "sync-collection"),
+		)
+		props[caldav.CurrentUserPrivilegeSet] = davPrivileges("read", "write", "write-content", "bind", "unbind")
+		props[caldav.GetCTag] = caldav.Text(syncToken)
+		props[caldav.SyncToken] = caldav.Text(syncToken)
+	}
+	return props
+}
+
+func davPrivileges(names ...string) string {
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString("<D:privilege>" + caldav.Tag(caldav.NSDAV, name) + "</D:privilege>")
+	}
+	return b.String()
+}
+
+func davReports(reports ...string) string {
+	var b strings.Builder
+	for _, report := range reports {
+		b.WriteString("<D:supported-report><D:report>" + report + "</D:report></D:supported-report>")
+	}
+	return b.String()
+}
+
+// todoResponse describes a todo resource. calendar-data is only included on request.
+func todoResponse(todo *models.Todo, versions map[uint]uint, names []xml.Name, nameOnly bool) caldav.Response {
+	props := map[xml.Name]string{
+		caldav.ResourceType:    "",
+		caldav.GetETag:         caldav.Text(davETag(todo, versions)),
+		caldav.GetContentType:  "text/calendar; charset=utf-8; component=vtodo",
+		caldav.GetLastModified: todo.UpdatedAt.UTC().Format(http.TimeFormat),
+	}
+	for _, name := range names {
+		if name == caldav.CalendarData {
+			var body bytes.Buffer
+			if err := ical.Encode(&body, todoCalendar(todo)); err == nil {
+				props[caldav.CalendarData] = caldav.Text(body.String())
+			}
+		}
+	}
+	return davResponse(todoHref(todo), props, names, nameOnly)
+}
+
+// davResponse selects the requested properties; nil names means all of them.
+func davResponse(href string, props map[xml.Name]string, names []xml.Name, nameOnly bool) caldav.Response {
+	response := caldav.Response{Href: href, Found: map[xml.Name]string{}}
+	if names == nil {
+		for name, value := range props {
+			if nameOnly {
+				value = ""
+			}
+			response.Found[name] = value
+		}
+		return response
+	}
+	for _, name := range names {
+		if value, ok := props[name]; ok {
+			response.Found[name] = value
+		} else {
+			response.NotFound = append(response.NotFound, name)
+		}
+	}
+	return response
+}
+
+func todoCalendar(todo *models.Todo) *ical.Component {
+	cal := ical.NewCalendar("")
+	cal.Children = append(cal.Children, ical.TodoComponent(todo))
+	return cal
+}
+
+// davVersions returns the newest activity ID of each todo. Every change to a
+// todo or its notes is logged, so this serves as the row version behind ETags.
+func davVersions(db *gorm.DB, todos []models.Todo) (map[uint]uint, error) {
+	ids := make([]uint, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	var rows []struct {
+		TodoID  uint
+		Version uint
+	}
+	if err := db.Model(&models.Activity{}).Select("todo_id, MAX(id) AS version").
+		Where("todo_id IN ?", ids).Group("todo_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	versions := make(map[uint]uint, len(rows))
+	for _, row := range rows {
+		versions[row.TodoID] = row.Version
+	}
+	return versions, nil
+}
+
+func davETag(todo *models.Todo, versions map[uint]uint) string {
+	return fmt.Sprintf(`"%d-%d"`, todo.ID, versions[todo.ID])
+}
+
+// davSyncToken returns the collection's current sync token, which doubles as its CTag.
+func davSyncToken(db *gorm.DB) (string, error) {
+	var current uint
+	err := db.Model(&models.Activity{}).Select("COALESCE(MAX(id), 0)").Scan(&current).Error
+	return davSyncTokenPrefix + strconv.FormatUint(uint64(current), 10), err
+}
+
+func davMultistatus(c *fiber.Ctx, multistatus *caldav.Multistatus) error {
+	var body bytes.Buffer
+	if err := multistatus.Encode(&body); err != nil {
+		return davError(c, err)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+	return c.Status(207).Send(body.Bytes())
+}
+
+// davPrecondition rejects a request with a CalDAV precondition error.
+func davPrecondition(c *fiber.Ctx, precondition xml.Name) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+	return c.Status(403).SendString(caldav.Error(precondition))
+}
+
+func davError(c *fiber.Ctx, err error) error {
+	slog.ErrorContext(c.UserContext(), "Error serving CalDAV request", "method", c.Method(), "path", c.Path(), "error", err) // Log the error
+	return c.Status(500).SendString(err.Error())
+}
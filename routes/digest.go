@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"log/slog"
+	"my-go-project/digest"
+	"my-go-project/models"
+	"my-go-project/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func RegisterDigestRoutes(app *fiber.App, db *gorm.DB) {
+
+	// Render the digest ?user= (default the acting user) gets on ?date=
+	// (default today in their zone) as HTML, or with ?format=text or json.
+	// ?kind=daily or weekly overrides the user's schedule.
+	app.Get("/digest/preview", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		var user *models.User
+		if username := c.Query("user"); username != "" {
+			user = &models.User{}
+			if err := db.Where("username = ?", username).First(user).Error; err != nil {
+				slog.ErrorContext(c.UserContext(), "Error fetching user", "user", username, "error", err) // Log the error
+				return c.Status(404).JSON(fiber.Map{
+					"error":   "User not found",
+					"details": err.Error(),
+				})
+			}
+		} else {
+			var err error
+			if user, err = requireUser(c); user == nil {
+				return err
+			}
+		}
+
+		day := models.CivilDate(time.Now(), user.Location())
+		if date := c.Query("date"); date != "" {
+			var err error
+			if day, err = utils.ParseDate(date); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error":   "Invalid date",
+					"details": err.Error(),
+				})
+			}
+		}
+		kind := c.Query("kind", digest.KindFor(user, day))
+		switch kind {
+		case "":
+			kind = digest.Daily // Previews are shown even to users who opted out
+		case digest.Daily, digest.Weekly:
+		default:
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid kind",
+				"details": "kind must be daily or weekly",
+			})
+		}
+
+		d, err := digest.Build(db, user, kind, day)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error building the digest", "user_id", user.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to build digest",
+				"details": err.Error(),
+			})
+		}
+		msg, err := digest.Render(d)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error rendering the digest", "user_id", user.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to render digest",
+				"details": err.Error(),
+			})
+		}
+
+		switch c.Query("format", "html") {
+		case "text":
+			return c.SendString(msg.Text)
+		case "json":
+			return c.JSON(fiber.Map{
+				"kind":    kind,
+				"to":      msg.To,
+				"subject": msg.Subject,
+				"text":    msg.Text,
+				"html":    msg.HTML,
+				"empty":   d.Empty(), // Empty digests are not sent
+			})
+		}
+		c.Type("html", "utf-8")
+		return c.SendString(msg.HTML)
+	})
+}
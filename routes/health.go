@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"my-go-project/health"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterHealthRoutes serves the probes. It must be called before
+// RegisterMiddleware, so that probes skip user resolution and are not
+// logged.
+//
+// /healthz answers whenever the process can serve at all; /startupz once
+// startup has finished; /readyz while the database answers, no migration is
+// pending, the background workers keep beating and no shutdown has begun.
+// Failing probes return 503 with the same JSON report.
+func RegisterHealthRoutes(app *fiber.App, checker *health.Checker) {
+	app.Get("/healthz", func(c *fiber.Ctx) error {
+		return sendReport(c, checker.Live())
+	})
+
+	app.Get("/startupz", func(c *fiber.Ctx) error {
+		return sendReport(c, checker.Startup())
+	})
+
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		return sendReport(c, checker.Ready(c.UserContext()))
+	})
+}
+
+// sendReport sends a probe report, uncached.
+func sendReport(c *fiber.Ctx, report health.Report) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	status := fiber.StatusOK
+	if !report.OK() {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(report)
+}
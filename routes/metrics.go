@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"my-go-project/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterMetricsRoutes serves GET /metrics for Prometheus. On the main app it
+// must be called before RegisterMiddleware, so that scrapes are not counted
+// as requests; it can also be served on a separate admin app.
+func RegisterMetricsRoutes(app *fiber.App) {
+	app.Get("/metrics", metrics.Handler())
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"my-go-project/audit"
+	"my-go-project/database"
+	"my-go-project/logging"
+	"my-go-project/metrics"
+	"my-go-project/tracing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// requestIDPattern is what an incoming X-Request-ID must look like to be
+// kept; anything else is replaced, so that clients cannot forge log lines.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// QueryTimeout bounds how long the statements of a request, made with
+// db.WithContext(c.UserContext()), may take in all; zero is no limit. Bodies
+// streamed after the handler returns get a QueryTimeout of their own.
+var QueryTimeout time.Duration
+
+// withQueryTimeout bounds ctx by QueryTimeout, when there is one.
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if QueryTimeout > 0 {
+		return context.WithTimeout(ctx, QueryTimeout)
+	}
+	return ctx, func() {}
+}
+
+// RegisterMiddleware installs the middleware shared by all routes. It must be
+// called before any route is registered.
+//
+// Every request is counted in the metrics, traced, gets an X-Request-ID (a
+// well-formed incoming one is kept) and is logged. Its user context carries
+// the trace, the request ID and the acting user, so that GORM calls made with
+// db.WithContext(c.UserContext()) are attributed in the activity log and the
+// logs. It also carries the QueryTimeout deadline and, for GET and HEAD
+// requests, permission to read from a replica.
+func RegisterMiddleware(app *fiber.App, db *gorm.DB) {
+	app.Use(metrics.Middleware())
+	app.Use(tracing.Middleware())
+	app.Use(func(c *fiber.Ctx) error {
+		requestID := c.Get(fiber.HeaderXRequestID)
+		if requestIDPattern.MatchString(requestID) {
+			requestID = strings.Clone(requestID) // Fiber reuses the request's memory
+		} else {
+			requestID = uuid.NewString()
+		}
+		c.Set(fiber.HeaderXRequestID, requestID)
+		c.SetUserContext(audit.WithRequestID(c.UserContext(), requestID))
+		return c.Next()
+	})
+	app.Use(logging.AccessLog())
+	app.Use(func(c *fiber.Ctx) error {
+		ctx, cancel := withQueryTimeout(c.UserContext())
+		defer cancel()
+		// What is read for a GET may lag a little behind the last write
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			ctx = database.WithReplicaReads(ctx)
+		}
+		c.SetUserContext(ctx)
+		return c.Next()
+	})
+	app.Use(func(c *fiber.Ctx) error {
+		user, err := currentUser(c, db.WithContext(c.UserContext()))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to resolve user",
+				"details": err.Error(),
+			})
+		}
+		if user != nil {
+			c.SetUserContext(audit.WithActor(c.UserContext(), audit.Actor{ID: user.ID, Name: user.Username}))
+		}
+		return c.Next()
+	})
+}
@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"log/slog"
+	"my-go-project/models"
+	"my-go-project/notify"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// UnreadCountHeader carries the number of unread notifications of the user.
+const UnreadCountHeader = "X-Unread-Count"
+
+func RegisterNotificationRoutes(app *fiber.App, db *gorm.DB) {
+
+	// The acting user's inbox, newest first; ?unread=true leaves out what was
+	// read. Pages with ?limit= and ?before= as /activity does.
+	app.Get("/notifications", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+
+		var unread int64
+		if err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Count(&unread).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error counting notifications", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch notifications",
+				"details": err.Error(),
+			})
+		}
+		query := db.Where("user_id = ?", user.ID)
+		if c.QueryBool("unread") {
+			query = query.Where("read_at IS NULL")
+		}
+		query, err = activityPage(c, query)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid query",
+				"details": err.Error(),
+			})
+		}
+
+		notifications := []models.Notification{}
+		if err := query.Find(&notifications).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching notifications", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch notifications",
+				"details": err.Error(),
+			})
+		}
+		c.Set(UnreadCountHeader, strconv.FormatInt(unread, 10))
+		return c.JSON(notifications)
+	})
+	// Mark one notification read or unread with {"read": true|false}
+	app.Patch("/notifications/:id", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+
+		var body struct {
+			Read *bool `json:"read"`
+		}
+		if err := c.BodyParser(&body); err != nil || body.Read == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": "expected {\"read\": true} or {\"read\": false}",
+			})
+		}
+
+		var notification models.Notification
+		id := c.Params("id")
+		if err := db.Where("id = ? AND user_id = ?", id, user.ID).First(&notification).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching notification", "notification_id", id, "error", err) // Log the error
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Notification not found",
+				"details": err.Error(),
+			})
+		}
+		switch {
+		case *body.Read && notification.ReadAt == nil:
+			now := time.Now()
+			notification.ReadAt = &now
+		case !*body.Read:
+			notification.ReadAt = nil
+		}
+		if err := db.Model(&notification).Update("read_at", notification.ReadAt).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error updating notification", "notification_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update notification",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(notification)
+	})
+	// Mark every notification of the user read
+	app.Post("/notifications/read", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+
+		result := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", user.ID).Update("read_at", time.Now())
+		if err := result.Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error marking notifications read", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update notifications",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{"marked": result.RowsAffected})
+	})
+
+	app.Get("/todos/:id/watchers", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		todo, err := findTodo(c, db)
+		if todo == nil {
+			return err
+		}
+		watchers := []models.User{}
+		if err := db.Model(todo).Order("users.username").Association("Watchers").Find(&watchers); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching watchers of todo", "todo_id", todo.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch watchers",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(watchers)
+	})
+	// Watch or stop watching a todo as the acting user
+	app.Put("/todos/:id/watchers/me", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+		todo, err := findTodo(c, db)
+		if todo == nil {
+			return err
+		}
+		if err := notify.Watch(db, todo.ID, user.ID); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error watching todo", "todo_id", todo.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to watch todo",
+				"details": err.Error(),
+			})
+		}
+		return c.SendStatus(204)
+	})
+	app.Delete("/todos/:id/watchers/me", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+		todo, err := findTodo(c, db)
+		if todo == nil {
+			return err
+		}
+		if err := notify.Unwatch(db, todo.ID, user.ID); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error unwatching todo", "todo_id", todo.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to unwatch todo",
+				"details": err.Error(),
+			})
+		}
+		return c.SendStatus(204)
+	})
+}
+
+// findTodo fetches the todo named by the :id parameter, or writes a 404.
+func findTodo(c *fiber.Ctx, db *gorm.DB) (*models.Todo, error) {
+	var todo models.Todo
+	id, err := paramID(c, "id")
+	if err == nil {
+		err = db.First(&todo, id).Error
+	}
+	if err != nil {
+		slog.ErrorContext(c.UserContext(), "Error fetching todo", "todo_id", c.Params("id"), "error", err) // Log the error
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error":   "Todo not found",
+			"details": err.Error(),
+		})
+	}
+	return &todo, nil
+}
@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"my-go-project/models"
+	"my-go-project/quickadd"
+	"my-go-project/service"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// quickAddRequest is the body of POST /todos/quick.
+type quickAddRequest struct {
+	Text   string `json:"text"`
+	Locale string `json:"locale"` // Optional, e.g. "sv-SE"
+}
+
+func RegisterQuickAddRoutes(app *fiber.App, todos *service.TodoService) {
+
+	// Create a todo from a line such as "Pay rent every 1st of month !high #home"
+	app.Post("/todos/quick", func(c *fiber.Ctx) error {
+		var req quickAddRequest
+		if err := c.BodyParser(&req); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body", "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		if strings.TrimSpace(req.Text) == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": "text is required",
+			})
+		}
+
+		result := quickadd.Parse(req.Text, quickadd.Options{
+			Locale:   quickAddLocale(c, req.Locale),
+			Location: viewerLocation(c), // Relative dates follow the user's zone
+		})
+		var todo models.Todo
+		result.Apply(&todo)
+		change, err := todos.Create(c.UserContext(), &todo, viewerLocation(c))
+		var invalid *service.ValidationError
+		if errors.As(err, &invalid) {
+			return invalidInput(c, invalid)
+		}
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error creating todo", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create todo",
+				"details": err.Error(),
+			})
+		}
+		setUndo(c, change.Undo)
+		setDueStatus(c, &todo)
+		return c.Status(201).JSON(fiber.Map{
+			"todo":  todo,
+			"spans": result.Spans,
+		})
+	})
+}
+
+// DefaultQuickAddLocale is the quick-add language of requests that name none
+// of the supported ones; English when it is not one either.
+var DefaultQuickAddLocale string
+
+// quickAddLocale picks the parser locale from the request body, then the
+// Accept-Language header, then DefaultQuickAddLocale.
+func quickAddLocale(c *fiber.Ctx, requested string) *quickadd.Locale {
+	for _, tag := range []string{requested, c.Get(fiber.HeaderAcceptLanguage), DefaultQuickAddLocale} {
+		if locale, ok := quickadd.LookupLocale(tag); ok {
+			return locale
+		}
+	}
+	return quickadd.English
+}
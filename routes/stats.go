@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"log/slog"
+	"my-go-project/stats"
+	"my-go-project/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func RegisterStatsRoutes(app *fiber.App, db *gorm.DB) {
+
+	// Counts, completion rates and burndown series over ?from= to ?to= (dates,
+	// both included, default the last 30 days), by ?interval=day or week and
+	// optionally ?group_by=assignee, list or tag. Days are the viewer's days.
+	app.Get("/stats", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		query := stats.Query{
+			Interval: c.Query("interval"),
+			GroupBy:  c.Query("group_by"),
+			Now:      time.Now(),
+			Location: viewerLocation(c),
+		}
+		for param, date := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+			if value := c.Query(param); value != "" {
+				t, err := utils.ParseDate(value)
+				if err != nil {
+					return c.Status(400).JSON(fiber.Map{
+						"error":   "Invalid query",
+						"details": param + " must be a date such as 2025-03-01",
+					})
+				}
+				*date = t
+			}
+		}
+		if err := query.Validate(); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid query",
+				"details": err.Error(),
+			})
+		}
+
+		report, err := stats.Compute(db, query)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error computing statistics", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to compute statistics",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(report)
+	})
+}
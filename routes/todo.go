@@ -1,153 +1,383 @@
 package routes
 
 import (
-	"log" // Added for logging
+	"errors"
+	"log/slog"
+	"my-go-project/markdown"
 	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/service"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"gorm.io/gorm"
 )
 
-func RegisterTodoRoutes(app *fiber.App, db *gorm.DB) {
+// RegisterTodoRoutes serves todos and their notes from the services, which
+// also take care of undo and notifications. Who is asking is the user the
+// middleware resolved.
+func RegisterTodoRoutes(app *fiber.App, todos *service.TodoService, notes *service.NoteService) {
 
 	app.Get("/todos", func(c *fiber.Ctx) error {
-		var todos []models.Todo
+		// ?due=overdue, today or week, in the viewer's time zone; ?assignee=me,
+		// none or a username; ?filter= takes an expression as saved views do
+		query := repository.TodoQuery{
+			Due:      c.Query("due"),
+			Assignee: c.Query("assignee"),
+			Filter:   c.Query("filter"),
+			Options:  filterOptions(c),
+		}
+		if query.Assignee == "me" {
+			if user, err := requireUser(c); user == nil {
+				return err
+			}
+		}
 
 		// Attempt to fetch todos with their corresponding notes
-		if err := db.Preload("Notes").Find(&todos).Error; err != nil {
-			log.Printf("Error fetching todos with notes in transaction: %v", err) // Log the error
+		list, err := todos.List(c.UserContext(), query)
+		var invalid *service.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			return invalidInput(c, invalid)
+		case errors.Is(err, repository.ErrUnsupported):
+			return c.Status(501).JSON(fiber.Map{
+				"error":   "Query not supported",
+				"details": err.Error(),
+			})
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "Error fetching todos with notes", "error", err) // Log the error
 			return c.Status(500).JSON(fiber.Map{
 				"error":   "Failed to fetch todos with notes",
 				"details": err.Error(),
 			})
 		}
-		return c.JSON(todos)
+		if err := renderTodos(c, list); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error rendering notes", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to render notes",
+				"details": err.Error(),
+			})
+		}
+		for i := range list {
+			setDueStatus(c, &list[i])
+		}
+		return c.JSON(list)
 	})
 	app.Get("/todos/:id", func(c *fiber.Ctx) error {
-		var todo models.Todo
-		id := c.Params("id")
-		if err := db.Preload("Notes").First(&todo, id).Error; err != nil {
-			log.Printf("Error fetching todo with ID %s: %v", id, err) // Log the error
-			return c.Status(404).JSON(fiber.Map{
-				"error":   "Todo not found",
+		id, err := paramID(c, "id")
+		if err != nil {
+			return todoNotFound(c, err)
+		}
+		todo, err := todos.Get(c.UserContext(), id)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching todo", "todo_id", id, "error", err) // Log the error
+			return todoNotFound(c, err)
+		}
+		if err := renderTodo(c, todo); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error rendering notes for todo", "todo_id", id, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to render notes",
 				"details": err.Error(),
 			})
 		}
+		setDueStatus(c, todo)
 		return c.JSON(todo)
 	})
 	app.Delete("/todos/:id", func(c *fiber.Ctx) error {
-		var todo models.Todo
-		id := c.Params("id")
-		if err := db.Delete(&todo, id).Error; err != nil {
-			log.Printf("Error deleting todo with ID %s: %v", id, err) // Log the error
-			return c.Status(404).JSON(fiber.Map{
-				"error":   "Todo not found",
-				"details": err.Error(),
-			})
+		id, err := paramID(c, "id")
+		if err != nil {
+			return todoNotFound(c, err)
+		}
+		if c.QueryBool("hard") {
+			// Permanently delete the todo with its notes, checklist and attachments
+			if err := todos.Purge(c.UserContext(), id); err != nil {
+				slog.ErrorContext(c.UserContext(), "Error permanently deleting todo", "todo_id", id, "error", err) // Log the error
+				return c.Status(500).JSON(fiber.Map{
+					"error":   "Failed to delete todo",
+					"details": err.Error(),
+				})
+			}
+			return c.SendStatus(204)
+		}
+		change, err := todos.Delete(c.UserContext(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return c.SendStatus(204) // Already gone
+		}
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error deleting todo", "todo_id", id, "error", err) // Log the error
+			return todoNotFound(c, err)
 		}
+		setUndo(c, change.Undo)
 		return c.SendStatus(204)
 	})
 	app.Post("/todos", func(c *fiber.Ctx) error {
 		var todo models.Todo
 		if err := c.BodyParser(&todo); err != nil {
-			log.Printf("Error parsing request body: %v", err) // Log the error
+			slog.WarnContext(c.UserContext(), "Error parsing request body", "error", err) // Log the error
 			return c.Status(400).JSON(fiber.Map{
 				"error":   "Invalid request body",
 				"details": err.Error(),
 			})
 		}
-		if err := db.Create(&todo).Error; err != nil {
-			log.Printf("Error creating todo: %v", err) // Log the error
+		// Times without a zone are the user's
+		change, err := todos.Create(c.UserContext(), &todo, viewerLocation(c))
+		var invalid *service.ValidationError
+		if errors.As(err, &invalid) {
+			return invalidInput(c, invalid)
+		}
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error creating todo", "error", err) // Log the error
 			return c.Status(500).JSON(fiber.Map{
 				"error":   "Failed to create todo",
 				"details": err.Error(),
 			})
 		}
+		setUndo(c, change.Undo)
+		setDueStatus(c, &todo)
 		return c.Status(201).JSON(todo) // Return 201 Created on success
 	})
 	app.Post("/todos/:id/notes", func(c *fiber.Ctx) error {
 		var note models.Note
-		id := c.Params("id")
 
 		// Parse the request body into the note struct
 		if err := c.BodyParser(&note); err != nil {
-			log.Printf("Error parsing request body for note: %v", err) // Log the error
+			slog.WarnContext(c.UserContext(), "Error parsing request body for note", "error", err) // Log the error
 			return c.Status(400).JSON(fiber.Map{
 				"error":   "Invalid request body",
 				"details": err.Error(),
 			})
 		}
-
-		// Set the TodoID of the note to associate it with the correct todo
-		todoID, err := strconv.ParseUint(id, 10, 32)
+		todoID, err := paramID(c, "id")
 		if err != nil {
-			log.Printf("Error converting TodoID to uint: %v", err) // Log the error
+			slog.ErrorContext(c.UserContext(), "Error converting TodoID to uint", "error", err) // Log the error
 			return c.Status(400).JSON(fiber.Map{
 				"error":   "Invalid TodoID",
 				"details": err.Error(),
 			})
 		}
-		note.TodoID = uint(todoID)
 
-		// Save the note to the database
-		if err := db.Create(&note).Error; err != nil {
-			log.Printf("Error creating note for todo with ID %s: %v", id, err) // Log the error
+		// Save the note on the todo
+		change, err := notes.Add(c.UserContext(), todoID, &note)
+		var invalid *service.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			return invalidInput(c, invalid)
+		case errors.Is(err, repository.ErrNotFound):
+			return todoNotFound(c, err)
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "Error creating note for todo", "todo_id", todoID, "error", err) // Log the error
 			return c.Status(500).JSON(fiber.Map{
 				"error":   "Failed to create note",
 				"details": err.Error(),
 			})
 		}
+		setUndo(c, change.Undo)
 
+		if err := renderNote(c, &note); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error rendering note", "note_id", note.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to render note",
+				"details": err.Error(),
+			})
+		}
 		return c.Status(201).JSON(note) // Return 201 Created on success
 	})
+	app.Patch("/todos/:todoId/notes/:noteId/tasks/:index", func(c *fiber.Ctx) error {
+		index, err := strconv.Atoi(c.Params("index"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid task index",
+				"details": err.Error(),
+			})
+		}
+		var body struct {
+			Checked bool `json:"checked"`
+		}
+		if err := c.BodyParser(&body); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body for task toggle", "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		todoID, err := paramID(c, "todoId")
+		if err != nil {
+			return noteNotFound(c, err)
+		}
+		noteID, err := paramID(c, "noteId")
+		if err != nil {
+			return noteNotFound(c, err)
+		}
+
+		change, err := notes.SetTask(c.UserContext(), todoID, noteID, index, body.Checked)
+		var invalid *service.ValidationError
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			slog.ErrorContext(c.UserContext(), "Error fetching note", "note_id", noteID, "todo_id", todoID, "error", err) // Log the error
+			return noteNotFound(c, err)
+		case errors.Is(err, markdown.ErrTaskNotFound):
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Task not found",
+				"details": err.Error(),
+			})
+		case errors.As(err, &invalid):
+			return invalidInput(c, invalid)
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "Error updating note", "note_id", noteID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update note",
+				"details": err.Error(),
+			})
+		}
+		note := change.After
+		setUndo(c, change.Undo)
+		if err := renderNote(c, note); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error rendering note", "note_id", note.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to render note",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(note)
+	})
 	app.Delete("/todos/:todoId/notes/:noteId", func(c *fiber.Ctx) error {
-		todoId := c.Params("todoId")
-		noteId := c.Params("noteId")
+		todoID, err := paramID(c, "todoId")
+		if err != nil {
+			return noteNotFound(c, err)
+		}
+		noteID, err := paramID(c, "noteId")
+		if err != nil {
+			return noteNotFound(c, err)
+		}
 
 		// Delete the note with the specified ID that belongs to the given TodoID
-		if err := db.Where("todo_id = ? AND id = ?", todoId, noteId).Delete(&models.Note{}).Error; err != nil {
-			log.Printf("Error deleting note with ID %s for todo with ID %s: %v", noteId, todoId, err) // Log the error
+		change, err := notes.Delete(c.UserContext(), todoID, noteID)
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error deleting note", "note_id", noteID, "todo_id", todoID, "error", err) // Log the error
 			return c.Status(500).JSON(fiber.Map{
 				"error":   "Failed to delete note",
 				"details": err.Error(),
 			})
 		}
+		if change != nil {
+			setUndo(c, change.Undo)
+		}
 
 		return c.SendStatus(204) // Return 204 No Content on success
 	})
 	app.Patch("/todos/:id", func(c *fiber.Ctx) error {
-		id := c.Params("id")
-		var todo models.Todo
-
-		// Find the todo by ID
-		if err := db.First(&todo, id).Error; err != nil {
-			log.Printf("Error fetching todo with ID %s: %v", id, err) // Log the error
-			return c.Status(404).JSON(fiber.Map{
-				"error":   "Todo not found",
-				"details": err.Error(),
-			})
-		}
-
-		// Parse the request body and update the todo
-		if err := c.BodyParser(&todo); err != nil {
-			log.Printf("Error parsing request body for todo with ID %s: %v", id, err) // Log the error
-			return c.Status(400).JSON(fiber.Map{
-				"error":   "Invalid request body",
-				"details": err.Error(),
-			})
+		id, err := paramID(c, "id")
+		if err != nil {
+			return todoNotFound(c, err)
 		}
 
-		// Save the updated todo to the database
-		if err := db.Save(&todo).Error; err != nil {
-			log.Printf("Error updating todo with ID %s: %v", id, err) // Log the error
+		// Decode the request body onto the todo, times without a zone being
+		// the user's
+		change, err := todos.Update(c.UserContext(), id, viewerLocation(c), func(todo *models.Todo) error {
+			if err := c.BodyParser(todo); err != nil {
+				slog.WarnContext(c.UserContext(), "Error parsing request body for todo", "todo_id", id, "error", err) // Log the error
+				return &service.ValidationError{Field: "body", Err: err}
+			}
+			return nil
+		})
+		var invalid *service.ValidationError
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			slog.ErrorContext(c.UserContext(), "Error fetching todo", "todo_id", id, "error", err) // Log the error
+			return todoNotFound(c, err)
+		case errors.As(err, &invalid):
+			return invalidInput(c, invalid)
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "Error updating todo", "todo_id", id, "error", err) // Log the error
 			return c.Status(500).JSON(fiber.Map{
 				"error":   "Failed to update todo",
 				"details": err.Error(),
 			})
 		}
 
+		todo := change.After
+		setUndo(c, change.Undo)
+		setDueStatus(c, todo)
 		return c.JSON(todo) // Return the updated todo
 	})
 
 }
+
+// paramID reads the route parameter name as an ID. Anything but a number
+// names nothing, and must never reach the database, where GORM would take a
+// string for a condition.
+func paramID(c *fiber.Ctx, name string) (uint, error) {
+	id, err := strconv.ParseUint(c.Params(name), 10, 32)
+	return uint(id), err
+}
+
+// todoNotFound writes the 404 for a missing todo.
+func todoNotFound(c *fiber.Ctx, err error) error {
+	return c.Status(404).JSON(fiber.Map{
+		"error":   "Todo not found",
+		"details": err.Error(),
+	})
+}
+
+// noteNotFound writes the 404 for a missing note.
+func noteNotFound(c *fiber.Ctx, err error) error {
+	return c.Status(404).JSON(fiber.Map{
+		"error":   "Note not found",
+		"details": err.Error(),
+	})
+}
+
+// invalidInput writes the response for input the services rejected.
+func invalidInput(c *fiber.Ctx, err *service.ValidationError) error {
+	if err.Field == "filter" {
+		return filterError(c, err.Err)
+	}
+	messages := map[string]string{
+		"body":     "Invalid request body",
+		"due":      "Invalid due filter",
+		"note":     "Invalid note",
+		"assignee": "Invalid assignee",
+		"task":     "Failed to update task",
+	}
+	return c.Status(400).JSON(fiber.Map{
+		"error":   messages[err.Field],
+		"details": err.Error(),
+	})
+}
+
+// wantsHTML reports whether the client asked for rendered notes with ?render=html.
+func wantsHTML(c *fiber.Ctx) bool {
+	return c.Query("render") == "html"
+}
+
+// renderNote fills in the sanitized HTML of a note when the client asked for it.
+func renderNote(c *fiber.Ctx, note *models.Note) error {
+	if !wantsHTML(c) {
+		return nil
+	}
+	html, err := markdown.Render(note.Note)
+	if err != nil {
+		return err
+	}
+	note.HTML = html
+	return nil
+}
+
+// renderTodo renders the notes of a todo in place when the client asked for it.
+func renderTodo(c *fiber.Ctx, todo *models.Todo) error {
+	for i := range todo.Notes {
+		if err := renderNote(c, &todo.Notes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderTodos renders the notes of every todo in place when the client asked for it.
+func renderTodos(c *fiber.Ctx, todos []models.Todo) error {
+	for i := range todos {
+		if err := renderTodo(c, &todos[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/service"
+	"my-go-project/transfer"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many todos are loaded at a time while streaming an export.
+const exportBatchSize = 100
+
+func RegisterTransferRoutes(app *fiber.App, db *gorm.DB, todos *service.TodoService) {
+
+	app.Get("/export", func(c *fiber.Ctx) error {
+		format, err := transfer.ParseFormat(c.Query("format", string(transfer.FormatJSON)))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid format",
+				"details": err.Error(),
+			})
+		}
+
+		c.Set(fiber.HeaderContentType, format.ContentType())
+		c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": format.Filename()}))
+		// The body is written after the handler returns and c has gone back
+		// to Fiber's pool, so the writer keeps the request's values but not
+		// its deadline, starting one of its own, and errors can only be logged
+		requestCtx := context.WithoutCancel(c.UserContext())
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ctx, cancel := withQueryTimeout(requestCtx)
+			defer cancel()
+			db := db.WithContext(ctx)
+			encoder, err := transfer.NewEncoder(w, format)
+			if err != nil {
+				slog.ErrorContext(ctx, "Error starting export", "format", format, "error", err) // Log the error
+				return
+			}
+			var todos []models.Todo
+			err = db.Preload("Notes").Preload("Checklist", repository.OrderedChecklist).Order("id").
+				FindInBatches(&todos, exportBatchSize, func(tx *gorm.DB, batch int) error {
+					for i := range todos {
+						if err := encoder.Encode(&todos[i]); err != nil {
+							return err
+						}
+					}
+					return w.Flush()
+				}).Error
+			if err == nil {
+				err = encoder.Close()
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "Error writing export", "format", format, "error", err) // Log the error
+			}
+		})
+		return nil
+	})
+
+	app.Post("/import", func(c *fiber.Ctx) error {
+		var body io.Reader = bytes.NewReader(c.Body())
+		formatName := c.Query("format")
+
+		// Accept a multipart upload as well as a raw body
+		if file, err := c.FormFile("file"); err == nil {
+			f, err := file.Open()
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error":   "Failed to read upload",
+					"details": err.Error(),
+				})
+			}
+			defer f.Close()
+			body = f
+			if formatName == "" {
+				if format, err := transfer.FormatFromFilename(file.Filename); err == nil {
+					formatName = string(format)
+				}
+			}
+		}
+		if formatName == "" {
+			formatName = formatFromContentType(c.Get(fiber.HeaderContentType))
+		}
+		format, err := transfer.ParseFormat(formatName)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid format",
+				"details": err.Error(),
+			})
+		}
+
+		records, err := transfer.Decode(body, format)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid import file",
+				"details": err.Error(),
+			})
+		}
+		// Times without a zone are the importing user's
+		report, err := todos.Import(c.UserContext(), records, viewerLocation(c), c.QueryBool("dry_run"))
+		if err != nil {
+			slog.ErrorContext(c.UserContext(), "Error importing file", "format", format, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to import todos",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(report)
+	})
+
+}
+
+// formatFromContentType maps a request's media type onto an import format name.
+func formatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return string(transfer.FormatCSV)
+	case fiber.MIMEApplicationJSON:
+		return string(transfer.FormatJSON)
+	case fiber.MIMETextPlain:
+		return string(transfer.FormatTodoTxt)
+	}
+	return ""
+}
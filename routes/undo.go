@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/undo"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Response headers carrying the undo token of a mutating request.
+const (
+	UndoTokenHeader   = "X-Undo-Token"
+	UndoExpiresHeader = "X-Undo-Expires"
+)
+
+func RegisterUndoRoutes(app *fiber.App, db *gorm.DB) {
+
+	app.Post("/undo/:token", func(c *fiber.Ctx) error {
+		token := c.Params("token")
+		entry, err := undo.Apply(c.UserContext(), db, token)
+		switch {
+		case errors.Is(err, undo.ErrNotFound):
+			return c.Status(404).JSON(fiber.Map{
+				"error":   "Undo token not found",
+				"details": err.Error(),
+			})
+		case errors.Is(err, undo.ErrExpired):
+			return c.Status(410).JSON(fiber.Map{
+				"error":   "Undo no longer possible",
+				"details": err.Error(),
+			})
+		case errors.Is(err, undo.ErrConflict):
+			return c.Status(409).JSON(fiber.Map{
+				"error":   "Undo conflicts with a later change",
+				"details": err.Error(),
+			})
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "Error applying undo token", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to undo",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(entry)
+	})
+
+}
+
+// setUndo hands the client the token of a change it can undo in the
+// X-Undo-Token header; entry is nil for changes that cannot be undone.
+func setUndo(c *fiber.Ctx, entry *models.UndoEntry) {
+	if entry == nil {
+		return
+	}
+	c.Set(UndoTokenHeader, entry.Token)
+	c.Set(UndoExpiresHeader, entry.ExpiresAt.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,242 @@
+package routes
+
+import (
+	"errors"
+	"log/slog"
+	"my-go-project/filter"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/service"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// viewRequest is the body of POST /views and PATCH /views/:id. Fields left
+// out of a PATCH are kept.
+type viewRequest struct {
+	Name       *string `json:"name"`
+	Expression *string `json:"expression"`
+	Shared     *bool   `json:"shared"`
+}
+
+func RegisterViewRoutes(app *fiber.App, db *gorm.DB, todos *service.TodoService) {
+
+	// The user's own views followed by those shared by others
+	app.Get("/views", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+
+		var views []models.SavedFilter
+		if err := db.Preload("Owner").Where("owner_id = ? OR shared = ?", user.ID, true).
+			Order(gorm.Expr("owner_id = ? DESC", user.ID)).Order("name").Find(&views).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error fetching views", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch views",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(views)
+	})
+	app.Post("/views", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		user, err := requireUser(c)
+		if user == nil {
+			return err
+		}
+
+		var req viewRequest
+		if err := c.BodyParser(&req); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body", "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		if req.Name == nil || req.Expression == nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": "name and expression are required",
+			})
+		}
+		view := models.SavedFilter{OwnerID: user.ID}
+		if ok, err := applyViewRequest(c, &view, &req); !ok {
+			return err
+		}
+		if err := db.Create(&view).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error creating view", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to create view",
+				"details": err.Error(),
+			})
+		}
+		view.Owner = user
+		return c.Status(201).JSON(view)
+	})
+	app.Get("/views/:id", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		view, err := findView(c, db, false)
+		if view == nil {
+			return err
+		}
+		return c.JSON(view)
+	})
+	app.Patch("/views/:id", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		view, err := findView(c, db, true)
+		if view == nil {
+			return err
+		}
+
+		var req viewRequest
+		if err := c.BodyParser(&req); err != nil {
+			slog.WarnContext(c.UserContext(), "Error parsing request body", "error", err) // Log the error
+			return c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+		}
+		if ok, err := applyViewRequest(c, view, &req); !ok {
+			return err
+		}
+		if err := db.Select("name", "expression", "shared").Save(view).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error updating view", "view_id", view.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to update view",
+				"details": err.Error(),
+			})
+		}
+		return c.JSON(view)
+	})
+	app.Delete("/views/:id", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		view, err := findView(c, db, true)
+		if view == nil {
+			return err
+		}
+		if err := db.Delete(view).Error; err != nil {
+			slog.ErrorContext(c.UserContext(), "Error deleting view", "view_id", view.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to delete view",
+				"details": err.Error(),
+			})
+		}
+		return c.SendStatus(204)
+	})
+
+	// The todos matching a view, read relative to the viewer's day
+	app.Get("/views/:id/todos", func(c *fiber.Ctx) error {
+		db := db.WithContext(c.UserContext())
+		view, err := findView(c, db, false)
+		if view == nil {
+			return err
+		}
+
+		list, err := todos.List(c.UserContext(), repository.TodoQuery{Filter: view.Expression, Options: filterOptions(c)})
+		var invalid *service.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			// Saved expressions were valid when saved, but fields may change
+			return invalidInput(c, invalid)
+		case err != nil:
+			slog.ErrorContext(c.UserContext(), "Error fetching todos of view", "view_id", view.ID, "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to fetch todos",
+				"details": err.Error(),
+			})
+		}
+		if err := renderTodos(c, list); err != nil {
+			slog.ErrorContext(c.UserContext(), "Error rendering notes", "error", err) // Log the error
+			return c.Status(500).JSON(fiber.Map{
+				"error":   "Failed to render notes",
+				"details": err.Error(),
+			})
+		}
+		for i := range list {
+			setDueStatus(c, &list[i])
+		}
+		return c.JSON(list)
+	})
+}
+
+// findView loads the view addressed by the :id parameter if the current user
+// can see it, or, with owned set, if the user owns it. Otherwise an error
+// response is written and the view is nil.
+func findView(c *fiber.Ctx, db *gorm.DB, owned bool) (*models.SavedFilter, error) {
+	user, err := requireUser(c)
+	if user == nil {
+		return nil, err
+	}
+
+	id := c.Params("id")
+	var view models.SavedFilter
+	if err := db.Preload("Owner").Where("owner_id = ? OR shared = ?", user.ID, true).First(&view, "id = ?", id).Error; err != nil {
+		slog.ErrorContext(c.UserContext(), "Error fetching view", "view_id", id, "error", err) // Log the error
+		return nil, c.Status(404).JSON(fiber.Map{
+			"error":   "View not found",
+			"details": err.Error(),
+		})
+	}
+	if owned && view.OwnerID != user.ID {
+		return nil, c.Status(403).JSON(fiber.Map{
+			"error": "Only the owner can change a view",
+		})
+	}
+	return &view, nil
+}
+
+// applyViewRequest copies the fields sent onto view, checking the expression
+// compiles. On invalid input an error response is written and ok is false.
+func applyViewRequest(c *fiber.Ctx, view *models.SavedFilter, req *viewRequest) (bool, error) {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return false, c.Status(400).JSON(fiber.Map{
+				"error":   "Invalid view",
+				"details": "name must be 1 to 100 bytes",
+			})
+		}
+		view.Name = name
+	}
+	if req.Expression != nil {
+		if _, err := filter.Compile(*req.Expression, filter.Options{}); err != nil {
+			return false, filterError(c, err)
+		}
+		view.Expression = *req.Expression
+	}
+	if req.Shared != nil {
+		view.Shared = *req.Shared
+	}
+	return true, nil
+}
+
+// filterError writes the 422 response for an invalid filter expression,
+// pointing at the offending character.
+func filterError(c *fiber.Ctx, err error) error {
+	var filterErr *filter.Error
+	if !errors.As(err, &filterErr) {
+		return c.Status(422).JSON(fiber.Map{
+			"error":   "Invalid filter",
+			"details": err.Error(),
+		})
+	}
+	return c.Status(422).JSON(fiber.Map{
+		"error":    "Invalid filter",
+		"details":  filterErr.Msg,
+		"position": filterErr.Pos,
+	})
+}
+
+// filterOptions reads filter expressions as the acting user sees them.
+func filterOptions(c *fiber.Ctx) filter.Options {
+	opts := filter.Options{Now: time.Now(), Location: viewerLocation(c)}
+	if user := actingUser(c); user != nil {
+		opts.UserID = user.ID
+	}
+	return opts
+}
@@ -0,0 +1,139 @@
+// Package server runs the app until it is told to stop and then shuts it
+// down in order: readiness fails first, so that load balancers stop sending
+// requests, then the HTTP server stops, letting in-flight requests finish,
+// then the background workers.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"my-go-project/health"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ErrTimeout is returned when a shutdown did not finish within its deadline.
+var ErrTimeout = errors.New("shutdown deadline exceeded")
+
+// Shutdown says how Serve stops.
+type Shutdown struct {
+	// Drain is called first, to fail readiness checks
+	Drain func()
+	// Delay is how long to keep serving after Drain, for load balancers to
+	// notice and stop routing requests here
+	Delay time.Duration
+	// Timeout is how long in-flight requests then get to finish
+	Timeout time.Duration
+}
+
+// Run listens on addr and serves app until ctx is done; see Serve.
+func Run(ctx context.Context, app *fiber.App, addr string, shutdown Shutdown) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, app, ln, shutdown)
+}
+
+// Serve serves app on ln until ctx is done. It then calls shutdown.Drain and
+// keeps serving for shutdown.Delay, after which it stops accepting
+// connections, closes idle keep-alive connections and waits up to
+// shutdown.Timeout for in-flight requests to finish. It returns nil after a
+// clean shutdown, the error that stopped the server, or ErrTimeout when
+// requests were still running.
+func Serve(ctx context.Context, app *fiber.App, ln net.Listener, shutdown Shutdown) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Listener(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return err // The server stopped by itself
+	case <-ctx.Done():
+	}
+
+	if shutdown.Drain != nil {
+		shutdown.Drain()
+	}
+	if shutdown.Delay > 0 {
+		slog.Info("Shutting down: failing readiness before closing the listener", "delay", shutdown.Delay)
+		select {
+		case <-time.After(shutdown.Delay):
+		case err := <-served:
+			return err
+		}
+	}
+
+	slog.Info("Shutting down: draining in-flight requests", "timeout", shutdown.Timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdown.Timeout)
+	defer cancel()
+	err := app.ShutdownWithContext(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("draining requests: %w", ErrTimeout)
+	}
+	if serveErr := <-served; err == nil {
+		err = serveErr
+	}
+	return err
+}
+
+// Workers runs background goroutines that stop when their context is
+// cancelled.
+type Workers struct {
+	health *health.Checker
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWorkers returns an empty group of workers whose heartbeats are
+// registered with checker, if it is not nil.
+func NewWorkers(checker *health.Checker) *Workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Workers{health: checker, ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine. fn must return soon after its context is
+// cancelled, and should call health.Beat with it at least every interval;
+// an interval of 0 registers no heartbeat.
+func (w *Workers) Go(name string, interval time.Duration, fn func(ctx context.Context)) {
+	ctx := w.ctx
+	var heartbeat *health.Heartbeat
+	if w.health != nil && interval > 0 {
+		heartbeat = w.health.Heartbeat(name, interval)
+		ctx = health.WithHeartbeat(ctx, heartbeat)
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fn(ctx)
+		if heartbeat != nil {
+			heartbeat.Stop()
+		}
+		slog.Info("Stopped worker", "worker", name)
+	}()
+}
+
+// Stop cancels the workers and waits up to timeout for them to return. It
+// returns ErrTimeout if some did not.
+func (w *Workers) Stop(timeout time.Duration) error {
+	w.cancel()
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("stopping workers: %w", ErrTimeout)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"my-go-project/markdown"
+	"my-go-project/models"
+	"my-go-project/repository"
+)
+
+// NoteService adds, edits and deletes the notes of todos.
+type NoteService struct {
+	repo  repository.TodoRepository
+	ports Ports
+}
+
+// NewNoteService returns a service storing notes in repo.
+func NewNoteService(repo repository.TodoRepository, ports Ports) *NoteService {
+	return &NoteService{repo: repo, ports: ports}
+}
+
+// NoteChange is what a change did to a note. Before is nil for a new note
+// and After for a deleted one.
+type NoteChange struct {
+	Before, After *models.Note
+	Undo          *models.UndoEntry // How to revert the change, nil if it cannot be
+}
+
+// Add stores note on the todo with todoID, or returns repository.ErrNotFound
+// for a missing todo. The users @mentioned in it and the other watchers of
+// the todo are told.
+func (s *NoteService) Add(ctx context.Context, todoID uint, note *models.Note) (*NoteChange, error) {
+	if err := ValidateNote(note); err != nil {
+		return nil, err
+	}
+	note.TodoID = todoID
+	if err := s.repo.AddNote(ctx, note); err != nil {
+		return nil, err
+	}
+	change := &NoteChange{After: note}
+	change.Undo = s.ports.recordUndo(ctx, models.ActionCreate, note, nil)
+	if s.ports.Notifier != nil {
+		todo, err := s.repo.Get(ctx, todoID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error fetching todo to notify", "todo_id", todoID, "error", err)
+			return change, nil
+		}
+		s.ports.notifyNote(ctx, todo, note)
+	}
+	return change, nil
+}
+
+// SetTask checks or unchecks the task at index in a note's task lists by
+// rewriting its Markdown source, so that the source stays canonical. It
+// returns repository.ErrNotFound for a missing note and
+// markdown.ErrTaskNotFound for a missing task; a note whose source cannot be
+// rewritten is a ValidationError for the field task.
+func (s *NoteService) SetTask(ctx context.Context, todoID, noteID uint, index int, checked bool) (*NoteChange, error) {
+	note, err := s.repo.Note(ctx, todoID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := markdown.SetTask(note.Note, index, checked)
+	if errors.Is(err, markdown.ErrTaskNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &ValidationError{Field: "task", Err: err}
+	}
+
+	previous := *note
+	note.Note = source
+	if err := s.repo.UpdateNote(ctx, note); err != nil {
+		return nil, err
+	}
+	change := &NoteChange{Before: &previous, After: note}
+	change.Undo = s.ports.recordUndo(ctx, models.ActionUpdate, note, &previous, "Note")
+	return change, nil
+}
+
+// Delete deletes the note with noteID from the todo with todoID. The change
+// is nil when there was no such note.
+func (s *NoteService) Delete(ctx context.Context, todoID, noteID uint) (*NoteChange, error) {
+	deleted, err := s.repo.DeleteNote(ctx, todoID, noteID)
+	if err != nil || !deleted {
+		return nil, err
+	}
+	note := &models.Note{TodoID: todoID}
+	note.ID = noteID
+	return &NoteChange{Before: note, Undo: s.ports.recordUndo(ctx, models.ActionDelete, note, nil)}, nil
+}
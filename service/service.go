@@ -0,0 +1,136 @@
+// Package service holds the rules for changing todos and notes, on top of a
+// repository.TodoRepository. Its methods take a context and plain models, so
+// they serve the HTTP handlers, CLIs and jobs alike. What lies beyond the
+// repository, undo, notifications and users, is reached through Ports, and
+// the actor is the one in the context, see audit.WithActor.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"my-go-project/models"
+)
+
+// Undoer records how to revert a change and returns the entry holding its
+// token, as undo.Record does; undo.Recorder is the one on the database.
+type Undoer interface {
+	Record(ctx context.Context, action string, entity, before interface{}, fields ...string) (*models.UndoEntry, error)
+}
+
+// Notifier fills the users' inboxes as package notify does, on behalf of the
+// actor in ctx; notify.Notifier is the one on the database.
+type Notifier interface {
+	// Assigned notifies the assignee of todo.
+	Assigned(ctx context.Context, todo *models.Todo) error
+	// Mentioned notifies the users @mentioned in note and returns their IDs.
+	Mentioned(ctx context.Context, todo *models.Todo, note *models.Note) ([]uint, error)
+	// Changed notifies the watchers of todo but the users in skip.
+	Changed(ctx context.Context, todo *models.Todo, action string, skip ...uint) error
+}
+
+// Users knows which users exist; repository.GormRepository is one.
+type Users interface {
+	UserExists(ctx context.Context, id uint) (bool, error)
+}
+
+// Ports connect the services to what lies beyond the repository. Each may be
+// nil: without Undo no change can be undone, without Notifier nobody is
+// notified and without Users todos are assigned to whatever ID they carry.
+type Ports struct {
+	Undo     Undoer
+	Notifier Notifier
+	Users    Users
+}
+
+// recordUndo records how to revert a change. The change was made, so failing
+// to record only costs the ability to undo it: the error is logged and the
+// entry is nil.
+func (p Ports) recordUndo(ctx context.Context, action string, entity, before interface{}, fields ...string) *models.UndoEntry {
+	if p.Undo == nil {
+		return nil
+	}
+	entry, err := p.Undo.Record(ctx, action, entity, before, fields...)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording undo", "action", action, "error", err)
+		return nil
+	}
+	return entry
+}
+
+// notifyAssigned tells the assignee of todo it was assigned to them. As with
+// undo, failures are logged rather than returned; the same holds for
+// notifyChanged and notifyNote.
+func (p Ports) notifyAssigned(ctx context.Context, todo *models.Todo) {
+	if p.Notifier == nil || todo.AssigneeID == nil {
+		return
+	}
+	if err := p.Notifier.Assigned(ctx, todo); err != nil {
+		slog.ErrorContext(ctx, "Error notifying the assignee of todo", "todo_id", todo.ID, "error", err)
+	}
+}
+
+// notifyChanged tells the watchers of todo, but the users in skip, what the
+// actor did to it.
+func (p Ports) notifyChanged(ctx context.Context, todo *models.Todo, action string, skip ...uint) {
+	if p.Notifier == nil {
+		return
+	}
+	if err := p.Notifier.Changed(ctx, todo, action, skip...); err != nil {
+		slog.ErrorContext(ctx, "Error notifying the watchers of todo", "todo_id", todo.ID, "error", err)
+	}
+}
+
+// notifyNote tells the users @mentioned in a new note on todo that they
+// were, and the other watchers of todo that the note was added.
+func (p Ports) notifyNote(ctx context.Context, todo *models.Todo, note *models.Note) {
+	if p.Notifier == nil {
+		return
+	}
+	mentioned, err := p.Notifier.Mentioned(ctx, todo, note)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error notifying the users mentioned in note", "note_id", note.ID, "error", err)
+	}
+	p.notifyChanged(ctx, todo, "added a note to", mentioned...)
+}
+
+// checkAssignee checks that the user a todo is assigned to exists; if not,
+// it returns a ValidationError for the field assignee.
+func (p Ports) checkAssignee(ctx context.Context, todo *models.Todo) error {
+	if p.Users == nil || todo.AssigneeID == nil {
+		return nil
+	}
+	exists, err := p.Users.UserExists(ctx, *todo.AssigneeID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &ValidationError{Field: "assignee", Err: errors.New("no user has ID " + strconv.FormatUint(uint64(*todo.AssigneeID), 10))}
+	}
+	return nil
+}
+
+// ValidationError rejects input before anything is stored.
+type ValidationError struct {
+	Field string // What was invalid, e.g. due, filter, note or assignee
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateNote checks a note body against the length limit.
+func ValidateNote(note *models.Note) error {
+	if len(note.Note) > models.MaxNoteLength {
+		return &ValidationError{Field: "note", Err: fmt.Errorf("note is %d bytes, maximum is %d", len(note.Note), models.MaxNoteLength)}
+	}
+	return nil
+}
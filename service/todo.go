@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"my-go-project/filter"
+	"my-go-project/ical"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/transfer"
+)
+
+// TodoService lists, creates, updates and deletes todos.
+type TodoService struct {
+	repo  repository.TodoRepository
+	ports Ports
+}
+
+// NewTodoService returns a service storing todos in repo.
+func NewTodoService(repo repository.TodoRepository, ports Ports) *TodoService {
+	return &TodoService{repo: repo, ports: ports}
+}
+
+// List returns the todos matching query. An unknown due filter or an
+// invalid filter expression is a ValidationError for the field due or
+// filter, the latter wrapping a *filter.Error. Without a time and time zone
+// in its options, query is run at the current time in UTC.
+func (s *TodoService) List(ctx context.Context, query repository.TodoQuery) ([]models.Todo, error) {
+	if query.Options.Now.IsZero() {
+		query.Options.Now = time.Now()
+	}
+	if query.Options.Location == nil {
+		query.Options.Location = time.UTC
+	}
+	if query.Due != "" {
+		if _, err := models.DueFilter(query.Due, query.Options.Now, query.Options.Location); err != nil {
+			return nil, &ValidationError{Field: "due", Err: err}
+		}
+	}
+	if query.Filter != "" {
+		if _, err := filter.Compile(query.Filter, query.Options); err != nil {
+			return nil, &ValidationError{Field: "filter", Err: err}
+		}
+	}
+	return s.repo.List(ctx, query)
+}
+
+// Get returns the todo with id, or repository.ErrNotFound.
+func (s *TodoService) Get(ctx context.Context, id uint) (*models.Todo, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Create stores a new todo with its notes and tells its assignee. A due
+// date without a time zone is read in loc, the creator's.
+func (s *TodoService) Create(ctx context.Context, todo *models.Todo, loc *time.Location) (*Change, error) {
+	for i := range todo.Notes {
+		if err := ValidateNote(&todo.Notes[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.ports.checkAssignee(ctx, todo); err != nil {
+		return nil, err
+	}
+	todo.DueDate.Localize(loc)
+	if err := s.repo.Create(ctx, todo); err != nil {
+		return nil, err
+	}
+	change := &Change{After: todo}
+	change.Undo = s.ports.recordUndo(ctx, models.ActionCreate, todo, nil)
+	s.ports.notifyAssigned(ctx, todo)
+	return change, nil
+}
+
+// Change is what a change did to a todo. Before is nil for a new todo and
+// After for a deleted one.
+type Change struct {
+	Before, After *models.Todo
+	Fields        []string          // The struct fields that changed, as undo.Record takes them
+	Undo          *models.UndoEntry // How to revert the change, nil if it cannot be
+}
+
+// Update applies patch to the todo with id and stores the result. patch
+// typically decodes a request body onto the todo; its errors are returned
+// as they are, and nothing is stored. The UID is kept, so that calendar
+// clients can follow the todo, and CompletedAt is the service's: kept while
+// the todo stays completed, stamped when it is completed and cleared when it
+// is reopened. A due date without a time zone is read in loc. A new assignee
+// is told the todo is theirs, the other watchers what changed.
+func (s *TodoService) Update(ctx context.Context, id uint, loc *time.Location, patch func(*models.Todo) error) (*Change, error) {
+	todo, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	before := copyTodo(todo)
+	// Only the notes in the patch are added; the rest stays as it is
+	todo.Notes, todo.Attachments, todo.Checklist = nil, nil, nil
+	if err := patch(todo); err != nil {
+		return nil, err
+	}
+
+	todo.ID = before.ID
+	todo.UID = before.UID
+	todo.CompletedAt = before.CompletedAt
+	if todo.Completed && !before.Completed {
+		now := time.Now()
+		todo.CompletedAt = &now
+	}
+	todo.DueDate.Localize(loc)
+	for i := range todo.Notes {
+		if err := ValidateNote(&todo.Notes[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.ports.checkAssignee(ctx, todo); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Update(ctx, todo); err != nil {
+		return nil, err
+	}
+	change := &Change{Before: before, After: todo, Fields: ChangedFields(before, todo)}
+	if len(change.Fields) == 0 {
+		return change, nil
+	}
+	change.Undo = s.ports.recordUndo(ctx, models.ActionUpdate, todo, before, change.Fields...)
+
+	// A new assignee is told so, and not also that the todo changed
+	var skip []uint
+	if todo.AssigneeID != nil && slices.Contains(change.Fields, "AssigneeID") {
+		s.ports.notifyAssigned(ctx, todo)
+		skip = append(skip, *todo.AssigneeID)
+	}
+	s.ports.notifyChanged(ctx, todo, describeChange(before, todo, change.Fields), skip...)
+	return change, nil
+}
+
+// Delete moves the todo with id to the trash and tells its watchers, or
+// returns repository.ErrNotFound.
+func (s *TodoService) Delete(ctx context.Context, id uint) (*Change, error) {
+	todo, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	change := &Change{Before: todo}
+	change.Undo = s.ports.recordUndo(ctx, models.ActionDelete, todo, nil)
+	s.ports.notifyChanged(ctx, todo, "deleted")
+	return change, nil
+}
+
+// Purge permanently deletes the todo with id and everything attached to it.
+func (s *TodoService) Purge(ctx context.Context, id uint) error {
+	return s.repo.Purge(ctx, id)
+}
+
+// SaveVTodo creates or updates the todo with the UID of a VTODO from a
+// calendar client, restoring it from the trash. When the DESCRIPTION differs
+// from the todo's notes, the notes are replaced by a single note holding it.
+// The todo is filed under list unless it is nil; otherwise it keeps its list.
+// It reports whether the todo was created.
+func (s *TodoService) SaveVTodo(ctx context.Context, component *ical.Component, list *string) (*models.Todo, bool, error) {
+	return s.repo.SaveUID(ctx, component.Text("UID"), func(todo *models.Todo) error {
+		description, err := ical.ApplyTodo(component, todo)
+		if err != nil {
+			return err
+		}
+		if description != ical.Description(todo) {
+			note := models.Note{Note: description}
+			if err := ValidateNote(&note); err != nil {
+				return err
+			}
+			todo.Notes = nil
+			if description != "" {
+				todo.Notes = []models.Note{note}
+			}
+		}
+		if list != nil {
+			todo.List = *list
+		}
+		return nil
+	})
+}
+
+// Import stores records decoded by package transfer as transfer.Import does.
+// Due dates without a time zone are read in loc, the importing user's.
+func (s *TodoService) Import(ctx context.Context, records []transfer.Record, loc *time.Location, dryRun bool) (*transfer.Report, error) {
+	for i := range records {
+		records[i].Todo.DueDate.Localize(loc)
+	}
+	return s.repo.Import(ctx, records, dryRun)
+}
+
+// ChangedFields lists the editable fields that differ between two versions
+// of a todo.
+func ChangedFields(before, after *models.Todo) []string {
+	var fields []string
+	if before.Subject != after.Subject {
+		fields = append(fields, "Subject")
+	}
+	if !models.DueDatesEqual(before.DueDate, after.DueDate) {
+		fields = append(fields, "DueOn", "DueAt")
+	}
+	if before.Completed != after.Completed {
+		fields = append(fields, "Completed", "CompletedAt")
+	}
+	if before.RRule != after.RRule {
+		fields = append(fields, "RRule")
+	}
+	if before.Priority != after.Priority {
+		fields = append(fields, "Priority")
+	}
+	if before.List != after.List {
+		fields = append(fields, "List")
+	}
+	if !slices.Equal(before.Tags, after.Tags) {
+		fields = append(fields, "Tags")
+	}
+	if !equalIDs(before.AssigneeID, after.AssigneeID) {
+		fields = append(fields, "AssigneeID")
+	}
+	return fields
+}
+
+// equalIDs reports whether two optional IDs are the same.
+func equalIDs(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// copyTodo copies the fields of todo that a patch may change in place.
+func copyTodo(todo *models.Todo) *models.Todo {
+	copied := *todo
+	copied.Tags = slices.Clone(todo.Tags)
+	if todo.DueDate != nil {
+		dueDate := *todo.DueDate
+		copied.DueDate = &dueDate
+	}
+	if todo.AssigneeID != nil {
+		assigneeID := *todo.AssigneeID
+		copied.AssigneeID = &assigneeID
+	}
+	return &copied
+}
+
+// describeChange says what an update did to a todo, for its watchers, e.g.
+// "completed" or "changed the due date and priority of".
+func describeChange(before, after *models.Todo, fields []string) string {
+	names := map[string]string{
+		"Subject": "subject", "DueOn": "due date", "RRule": "recurrence", "Priority": "priority",
+		"List": "list", "Tags": "tags", "AssigneeID": "assignee",
+	}
+	var changed []string
+	for _, field := range fields {
+		if name, ok := names[field]; ok {
+			changed = append(changed, name)
+		}
+	}
+	completion := ""
+	if before.Completed != after.Completed {
+		completion = "reopened"
+		if after.Completed {
+			completion = "completed"
+		}
+	}
+	switch {
+	case len(changed) == 0:
+		return completion
+	case completion != "":
+		return completion + " and changed the " + joinWords(changed) + " of"
+	}
+	return "changed the " + joinWords(changed) + " of"
+}
+
+// joinWords joins words as in "a, b and c".
+func joinWords(words []string) string {
+	if len(words) == 1 {
+		return words[0]
+	}
+	result := words[0]
+	for _, word := range words[1 : len(words)-1] {
+		result += ", " + word
+	}
+	return result + " and " + words[len(words)-1]
+}
@@ -5,12 +5,49 @@ document.addEventListener("DOMContentLoaded", () => {
     const todoSubjectInput = document.getElementById("todo-subject");
     const todoNotesInput = document.getElementById("todo-notes");
     const addTodoButton = document.getElementById("add-todo");
+    const quickAddSpans = document.getElementById("quick-add-spans");
+    const undoToast = document.getElementById("undo-toast");
+    let undoTimer = null;
+
+    // Whole-day due dates arrive as "2006-01-02", timed ones as RFC 3339
+    const isDateOnly = (dueDate) => /^\d{4}-\d{2}-\d{2}$/.test(dueDate);
+
+    const formatDueDate = (dueDate) => {
+        if (isDateOnly(dueDate)) {
+            const [year, month, day] = dueDate.split("-").map(Number);
+            return new Date(year, month - 1, day).toLocaleDateString();
+        }
+        return new Date(dueDate).toLocaleString();
+    };
+
+    // Offer to undo a change if the server handed out an undo token
+    const offerUndo = (response, message) => {
+        const token = response.headers.get("X-Undo-Token");
+        if (!token) return;
+
+        undoToast.querySelector(".undo-message").textContent = message;
+        undoToast.querySelector(".undo-error").textContent = "";
+        undoToast.querySelector("button").onclick = async () => {
+            const undoResponse = await fetch(`/undo/${token}`, { method: "POST" });
+            if (undoResponse.ok) {
+                undoToast.style.display = "none";
+            } else {
+                const body = await undoResponse.json().catch(() => ({}));
+                undoToast.querySelector(".undo-error").textContent = body.error || "Undo failed";
+            }
+            fetchTodos();
+        };
+
+        undoToast.style.display = "flex";
+        clearTimeout(undoTimer);
+        undoTimer = setTimeout(() => { undoToast.style.display = "none"; }, 10000);
+    };
 
     // Fetch and display todos
     const fetchTodos = async () => {
         console.log("Fetching todos...");
         try {
-            const response = await fetch(apiBase);
+            const response = await fetch(`${apiBase}?render=html`);
             if (!response.ok) {
                 console.error("Failed to fetch todos:", response.statusText);
                 return;
@@ -30,30 +67,15 @@ document.addEventListener("DOMContentLoaded", () => {
             todos.forEach(todo => {
                 const li = document.createElement("li");
                 li.className = todo.completed ? "completed" : "";
+                if (todo.due_status) li.classList.add(`due-${todo.due_status}`); // Computed in the user's time zone
                 li.dataset.id = todo.ID; // Set the data-id attribute
+                li.dataset.dueDate = todo.due_date && isDateOnly(todo.due_date) ? todo.due_date : "";
 
-                // Add debug logging to check the notes structure
-                console.log('Todo notes:', todo.notes);
-
-                const notesSection = Array.isArray(todo.notes) && todo.notes.length > 0
-                    ? `<div class="notes-section">
-                        <small>Notes:</small>
-                        <ul class="notes-list">
-                            ${todo.notes.map(note => `<li>${note?.note || 'No content'} <button onclick="removeNote(${todo.ID}, '${note.ID}')">Remove</button></li>`).join('')}
-                        </ul>
-                      </div>`
-                    : '';
-
-                const dueDateSection = todo.due_date
-                    ? `<div class="todo-due-date">
-                        <small>Due: ${new Date(todo.due_date).toLocaleDateString()}</small>
-                      </div>`
-                    : '';
-
+                // Build the markup from trusted templates only; user content is
+                // inserted as text, except note HTML which is sanitized server-side
                 li.innerHTML = `
                     <div class="todo-main">
-                        <span class="todo-subject">${todo.subject}</span>
-                        ${dueDateSection}
+                        <span class="todo-subject"></span>
                         <div class="todo-actions">
                             <button onclick="toggleTodo(${todo.ID}, ${todo.completed})">
                                 ${todo.completed ? "Unmark" : "Complete"}
@@ -62,8 +84,32 @@ document.addEventListener("DOMContentLoaded", () => {
                             <button onclick="editTodo(${todo.ID})">Edit</button>
                         </div>
                     </div>
-                    ${notesSection}
                 `;
+                li.querySelector(".todo-subject").textContent = todo.subject;
+
+                const labels = [];
+                if (todo.priority) labels.push(["", "!low", "!medium", "!high"][todo.priority]);
+                if (todo.list) labels.push(`@${todo.list}`);
+                (todo.tags || []).forEach(tag => labels.push(`#${tag}`));
+                if (labels.length > 0) {
+                    const meta = document.createElement("small");
+                    meta.className = "todo-labels";
+                    meta.textContent = labels.join(" ");
+                    li.querySelector(".todo-subject").after(meta);
+                }
+
+                if (todo.due_date) {
+                    const dueDate = document.createElement("div");
+                    dueDate.className = "todo-due-date";
+                    const small = document.createElement("small");
+                    small.textContent = `Due: ${formatDueDate(todo.due_date)}`;
+                    dueDate.appendChild(small);
+                    li.querySelector(".todo-subject").after(dueDate);
+                }
+
+                if (Array.isArray(todo.notes) && todo.notes.length > 0) {
+                    li.appendChild(renderNotes(todo));
+                }
                 todoList.appendChild(li);
             });
         } catch (error) {
@@ -71,41 +117,103 @@ document.addEventListener("DOMContentLoaded", () => {
         }
     };
 
-    // Add a new todo
+    // Render the notes section of a todo
+    const renderNotes = (todo) => {
+        const section = document.createElement("div");
+        section.className = "notes-section";
+        section.innerHTML = `<small>Notes:</small><ul class="notes-list"></ul>`;
+        const list = section.querySelector(".notes-list");
+
+        todo.notes.forEach(note => {
+            const item = document.createElement("li");
+            const body = document.createElement("div");
+            body.className = "note-body";
+            body.innerHTML = note.html || ""; // Sanitized by the server
+
+            // Task-list checkboxes update the Markdown source on the server
+            body.querySelectorAll('input[type="checkbox"]').forEach((checkbox, index) => {
+                checkbox.disabled = false;
+                checkbox.addEventListener("change", () => toggleTask(todo.ID, note.ID, index, checkbox.checked));
+            });
+
+            const removeButton = document.createElement("button");
+            removeButton.textContent = "Remove";
+            removeButton.addEventListener("click", () => removeNote(todo.ID, note.ID));
+
+            item.append(body, removeButton);
+            list.appendChild(item);
+        });
+        return section;
+    };
+
+    // Check or uncheck a task-list item inside a note
+    const toggleTask = async (id, noteId, index, checked) => {
+        const response = await fetch(`${apiBase}/${id}/notes/${noteId}/tasks/${index}`, {
+            method: "PATCH",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ checked }),
+        });
+        if (!response.ok) {
+            console.error("Failed to update task:", response.statusText);
+        } else {
+            offerUndo(response, checked ? "Task checked." : "Task unchecked.");
+        }
+        fetchTodos();
+    };
+
+    // Show what the server recognised in the quick-add text
+    const showSpans = (spans) => {
+        quickAddSpans.innerHTML = "";
+        spans.forEach(span => {
+            const chip = document.createElement("span");
+            chip.className = `quick-add-span ${span.kind}`;
+            chip.textContent = `${span.text} → ${span.value}`;
+            quickAddSpans.appendChild(chip);
+        });
+    };
+
+    // Add a new todo; dates, recurrence, priority, #tags and @list are
+    // parsed from the text by the server
     addTodoButton.addEventListener("click", async () => {
-        const subject = todoSubjectInput.value.trim();
+        const text = todoSubjectInput.value.trim();
         const noteText = todoNotesInput ? todoNotesInput.value.trim() : '';
-        const dueDateInput = document.getElementById("todo-due-date"); // Get the due date input
-        const dueDate = dueDateInput ? new Date(dueDateInput.value.trim()).toISOString() : null; // Format as ISO string
-
-        if (!subject) return alert("Please enter a todo subject.");
 
-        const todoData = {
-            subject,
-            completed: false,
-            due_date: dueDate, // Include due_date in ISO format
-            notes: noteText ? [{ content: noteText }] : []
-        };
+        if (!text) return alert("Please enter a todo subject.");
 
-        await fetch(apiBase, {
+        const response = await fetch(`${apiBase}/quick`, {
             method: "POST",
             headers: { "Content-Type": "application/json" },
-            body: JSON.stringify(todoData),
+            body: JSON.stringify({ text, locale: navigator.language }),
         });
+        if (!response.ok) {
+            console.error("Failed to add todo:", response.statusText);
+            return;
+        }
+        const { todo, spans } = await response.json();
+        showSpans(spans);
+        offerUndo(response, "Todo added.");
+
+        if (noteText) {
+            await fetch(`${apiBase}/${todo.ID}/notes`, {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ note: noteText }),
+            });
+        }
 
         todoSubjectInput.value = "";
         if (todoNotesInput) todoNotesInput.value = "";
-        if (dueDateInput) dueDateInput.value = ""; // Clear the due date input
         fetchTodos();
     });
 
     // Toggle todo completion
     window.toggleTodo = async (id, completed) => {
-        await fetch(`${apiBase}/${id}`, {
+        const response = await fetch(`${apiBase}/${id}`, {
             method: "PATCH",
             headers: { "Content-Type": "application/json" },
             body: JSON.stringify({ completed: !completed }),
         });
+        offerUndo(response, completed ? "Todo reopened." : "Todo completed.");
         fetchTodos();
     };
 
@@ -117,6 +225,7 @@ document.addEventListener("DOMContentLoaded", () => {
                 console.error(`Failed to delete todo with id ${id}:`, response.statusText);
                 return;
             }
+            offerUndo(response, "Todo deleted.");
             fetchTodos();
         } catch (error) {
             console.error(`Error deleting todo with id ${id}:`, error);
@@ -151,15 +260,20 @@ document.addEventListener("DOMContentLoaded", () => {
         saveEditButton.onclick = async () => {
             const updatedTodo = {
                 subject: editSubjectInput.value.trim(),
-                due_date: editDueDateInput.value.trim() ? new Date(editDueDateInput.value.trim()).toISOString() : null, // Format as ISO string
                 notes: editNoteInput.value.trim() ? [{ note: editNoteInput.value.trim() }] : []
             };
+            // Only send the due date if it was changed, so a timed due date
+            // the date picker cannot show is kept
+            if (editDueDateInput.value !== (todo.dataset.dueDate || "")) {
+                updatedTodo.due_date = editDueDateInput.value || null; // The server understands plain dates
+            }
 
-            await fetch(`${apiBase}/${editModal.dataset.id}`, {
+            const response = await fetch(`${apiBase}/${editModal.dataset.id}`, {
                 method: "PATCH",
                 headers: { "Content-Type": "application/json" },
                 body: JSON.stringify(updatedTodo),
             });
+            offerUndo(response, "Todo updated.");
 
             editModal.style.display = "none";
             fetchTodos();
@@ -174,6 +288,7 @@ document.addEventListener("DOMContentLoaded", () => {
         });
 
         if (response.ok) {
+            offerUndo(response, "Note removed.");
             fetchTodos();
         } else {
             console.error("Failed to remove note:", response.statusText);
@@ -0,0 +1,87 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"my-go-project/models"
+
+	"gorm.io/gorm"
+)
+
+// dialect writes the few SQL expressions that differ between databases.
+// PostgreSQL is the production database; SQLite is supported well enough to
+// run the tests without a server, with days in a fixed UTC offset.
+type dialect struct {
+	postgres bool
+	loc      *time.Location
+}
+
+func dialectOf(db *gorm.DB, loc *time.Location) dialect {
+	return dialect{postgres: db.Dialector.Name() == "postgres", loc: loc}
+}
+
+// day returns the civil date, as "2006-01-02", of a timestamp column in the
+// report's zone.
+func (d dialect) day(column string) (string, []interface{}) {
+	if d.postgres {
+		if name := d.loc.String(); name != "Local" {
+			return "to_char(" + column + " AT TIME ZONE ?, 'YYYY-MM-DD')", []interface{}{name}
+		}
+		return "to_char(" + column + " AT TIME ZONE INTERVAL '" + d.offset(":") + "', 'YYYY-MM-DD')", nil
+	}
+	return "date(" + column + ", ?)", []interface{}{d.offset(" minutes")}
+}
+
+// offset is the zone's current UTC offset, "+01:00" or "+60 minutes".
+func (d dialect) offset(unit string) string {
+	_, seconds := time.Now().In(d.loc).Zone()
+	minutes := seconds / 60
+	if unit == ":" {
+		sign := "+"
+		if minutes < 0 {
+			sign, minutes = "-", -minutes
+		}
+		return fmt.Sprintf("%s%02d:%02d", sign, minutes/60, minutes%60)
+	}
+	return fmt.Sprintf("%+d%s", minutes, unit)
+}
+
+// seconds returns the number of seconds from one timestamp column to another.
+func (d dialect) seconds(to, from string) string {
+	if d.postgres {
+		return "EXTRACT(EPOCH FROM " + to + " - " + from + ")::float8"
+	}
+	return "(julianday(" + to + ") - julianday(" + from + ")) * 86400"
+}
+
+// grouped starts a query on todos, joined with their tags when grouping by
+// tag and with their assignee when grouping by assignee.
+func (d dialect) grouped(db *gorm.DB, groupBy string) *gorm.DB {
+	query := db.Model(&models.Todo{})
+	switch {
+	case groupBy == "assignee":
+		return query.Joins("LEFT JOIN users AS assignee ON assignee.id = todos.assignee_id")
+	case groupBy != "tag":
+		return query
+	case d.postgres:
+		return query.Joins("CROSS JOIN LATERAL jsonb_array_elements_text(todos.tags::jsonb) AS tag(name)")
+	}
+	return query.Joins("CROSS JOIN json_each(todos.tags) AS tag")
+}
+
+// key returns the expression the rows are grouped by.
+func (d dialect) key(groupBy string) string {
+	switch groupBy {
+	case "list":
+		return "COALESCE(todos.list, '')"
+	case "assignee":
+		return "COALESCE(assignee.username, '')"
+	case "tag":
+		if d.postgres {
+			return "tag.name"
+		}
+		return "tag.value"
+	}
+	return "''"
+}
@@ -0,0 +1,330 @@
+// Package stats computes productivity statistics over todos: how many are
+// open, completed and overdue, how quickly they get done, and burndown
+// series over a date range. All counting is done by the database with a
+// handful of aggregate queries, so the cost does not grow with the number of
+// todos sent back over the wire.
+package stats
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/utils"
+
+	"gorm.io/gorm"
+)
+
+// Intervals are the period lengths Query accepts.
+var Intervals = []string{"day", "week"}
+
+// GroupBys are the fields a report can be broken down by.
+var GroupBys = []string{"assignee", "list", "tag"}
+
+// MaxDays is the longest date range a report may cover.
+const MaxDays = 1000
+
+// Query selects what a report covers.
+type Query struct {
+	From, To time.Time      // Civil dates, both included
+	Interval string         // "day" or "week"; weeks start on Monday
+	GroupBy  string         // "", "assignee", "list" or "tag"
+	Now      time.Time      // Default time.Now()
+	Location *time.Location // Zone in which days begin, default utils.DefaultLocation
+}
+
+// Report is the result of Compute.
+type Report struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Interval string  `json:"interval"`
+	GroupBy  string  `json:"group_by,omitempty"`
+	Summary          // Over all todos
+	Groups   []Group `json:"groups,omitempty"`
+}
+
+// Group is the summary of the todos with one assignee, list or tag. A todo with
+// several tags counts in each of their groups.
+type Group struct {
+	Key string `json:"key"`
+	Summary
+}
+
+// Summary holds the statistics of a set of todos.
+type Summary struct {
+	Open      int64 `json:"open"`
+	Completed int64 `json:"completed"`
+	Overdue   int64 `json:"overdue"`
+
+	// Mean time from creation to completion of the todos completed in the
+	// range, or nil if none were
+	AverageCompletionSeconds *float64 `json:"average_completion_seconds"`
+
+	Periods  []Period `json:"periods"`
+	Burndown []Point  `json:"burndown"`
+}
+
+// Period counts the todos created and completed in one day or week.
+type Period struct {
+	Start     string `json:"start"`
+	Created   int64  `json:"created"`
+	Completed int64  `json:"completed"`
+
+	// Share of the todos open during the period that got completed: those
+	// open when it began plus those created in it
+	CompletionRate *float64 `json:"completion_rate"`
+
+	AverageCompletionSeconds *float64 `json:"average_completion_seconds"`
+}
+
+// Point is the state at the end of a day. Scope and Completed are the
+// burnup lines, Open is the burndown line.
+type Point struct {
+	Date      string `json:"date"`
+	Scope     int64  `json:"scope"` // Todos created so far
+	Completed int64  `json:"completed"`
+	Open      int64  `json:"open"`
+}
+
+// Validate fills in defaults and checks the query.
+func (q *Query) Validate() error {
+	if q.Now.IsZero() {
+		q.Now = time.Now()
+	}
+	if q.Location == nil {
+		q.Location = utils.DefaultLocation
+	}
+	if q.Interval == "" {
+		q.Interval = "day"
+	}
+	if !slices.Contains(Intervals, q.Interval) {
+		return fmt.Errorf("unknown interval %q, expected one of %s", q.Interval, strings.Join(Intervals, ", "))
+	}
+	if q.GroupBy != "" && !slices.Contains(GroupBys, q.GroupBy) {
+		return fmt.Errorf("unknown group_by %q, expected one of %s", q.GroupBy, strings.Join(GroupBys, ", "))
+	}
+	if q.To.IsZero() {
+		q.To = models.CivilDate(q.Now, q.Location)
+	}
+	if q.From.IsZero() {
+		q.From = q.To.AddDate(0, 0, -29)
+	}
+	if q.Interval == "week" {
+		q.From = models.StartOfWeek(q.From)
+	}
+	if q.To.Before(q.From) {
+		return fmt.Errorf("from must not be after to")
+	}
+	if days(q.From, q.To) > MaxDays {
+		return fmt.Errorf("the range is limited to %d days", MaxDays)
+	}
+	return nil
+}
+
+// Compute runs the query against the todos in db.
+func Compute(db *gorm.DB, q Query) (*Report, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	report := &Report{
+		From:     q.From.Format(utils.DateLayout),
+		To:       q.To.Format(utils.DateLayout),
+		Interval: q.Interval,
+		GroupBy:  q.GroupBy,
+	}
+
+	all, err := summarize(db, q, "")
+	if err != nil {
+		return nil, err
+	}
+	report.Summary = *all[""]
+	if q.GroupBy == "" {
+		return report, nil
+	}
+
+	groups, err := summarize(db, q, q.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	report.Groups = []Group{}
+	for key, summary := range groups {
+		report.Groups = append(report.Groups, Group{Key: key, Summary: *summary})
+	}
+	slices.SortFunc(report.Groups, func(a, b Group) int { return strings.Compare(a.Key, b.Key) })
+	return report, nil
+}
+
+// totalsRow is a row of the totals query.
+type totalsRow struct {
+	GroupKey    string
+	Open        int64
+	Completed   int64
+	Overdue     int64
+	ScopeBefore int64 // Created before the range
+	DoneBefore  int64 // Completed before the range
+}
+
+// dayRow is a row of the per-day queries.
+type dayRow struct {
+	GroupKey string
+	Day      string
+	Count    int64
+	Seconds  float64 // Total time to complete, for completions
+}
+
+// summarize computes a summary per value of groupBy, or a single summary
+// under "" when groupBy is empty.
+func summarize(db *gorm.DB, q Query, groupBy string) (map[string]*Summary, error) {
+	d := dialectOf(db, q.Location)
+	start := time.Date(q.From.Year(), q.From.Month(), q.From.Day(), 0, 0, 0, 0, q.Location)
+	end := time.Date(q.To.Year(), q.To.Month(), q.To.Day()+1, 0, 0, 0, 0, q.Location)
+	overdue := models.OverdueCondition(q.Now, q.Location)
+
+	var totals []totalsRow
+	vars := append(append([]interface{}{}, overdue.Vars...), start, start)
+	if err := d.grouped(db, groupBy).
+		Select(d.key(groupBy)+` AS group_key,
+			COALESCE(SUM(CASE WHEN todos.completed THEN 0 ELSE 1 END), 0) AS open,
+			COALESCE(SUM(CASE WHEN todos.completed THEN 1 ELSE 0 END), 0) AS completed,
+			COALESCE(SUM(CASE WHEN `+overdue.SQL+` THEN 1 ELSE 0 END), 0) AS overdue,
+			COALESCE(SUM(CASE WHEN todos.created_at < ? THEN 1 ELSE 0 END), 0) AS scope_before,
+			COALESCE(SUM(CASE WHEN todos.completed AND todos.completed_at < ? THEN 1 ELSE 0 END), 0) AS done_before`, vars...).
+		Scopes(groupedBy(groupBy)).Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+
+	var created, completed []dayRow
+	day, dayVars := d.day("todos.created_at")
+	if err := d.grouped(db, groupBy).
+		Select(d.key(groupBy)+" AS group_key, "+day+" AS day, COUNT(*) AS count", dayVars...).
+		Where("todos.created_at >= ? AND todos.created_at < ?", start, end).
+		Scopes(groupedBy(groupBy, "day")).Scan(&created).Error; err != nil {
+		return nil, err
+	}
+	day, dayVars = d.day("todos.completed_at")
+	if err := d.grouped(db, groupBy).
+		Select(d.key(groupBy)+" AS group_key, "+day+" AS day, COUNT(*) AS count, COALESCE(SUM("+d.seconds("todos.completed_at", "todos.created_at")+"), 0) AS seconds", dayVars...).
+		Where("todos.completed = ? AND todos.completed_at >= ? AND todos.completed_at < ?", true, start, end).
+		Scopes(groupedBy(groupBy, "day")).Scan(&completed).Error; err != nil {
+		return nil, err
+	}
+
+	builders := map[string]*series{}
+	builder := func(key string) *series {
+		if builders[key] == nil {
+			builders[key] = &series{created: map[string]int64{}, completed: map[string]int64{}, seconds: map[string]float64{}}
+		}
+		return builders[key]
+	}
+	if groupBy == "" {
+		builder("")
+	}
+	for _, row := range totals {
+		builder(row.GroupKey).totals = row
+	}
+	for _, row := range created {
+		builder(row.GroupKey).created[row.Day] += row.Count
+	}
+	for _, row := range completed {
+		s := builder(row.GroupKey)
+		s.completed[row.Day] += row.Count
+		s.seconds[row.Day] += row.Seconds
+	}
+	summaries := map[string]*Summary{}
+	for key, s := range builders {
+		summaries[key] = s.summary(q)
+	}
+	return summaries, nil
+}
+
+// groupedBy groups the rows by group_key, unless there is no grouping, and
+// by the other output columns given.
+func groupedBy(groupBy string, columns ...string) func(*gorm.DB) *gorm.DB {
+	if groupBy != "" {
+		columns = append([]string{"group_key"}, columns...)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		if len(columns) == 0 {
+			return db
+		}
+		return db.Group(strings.Join(columns, ", "))
+	}
+}
+
+// series collects the query results of one group.
+type series struct {
+	totals    totalsRow
+	created   map[string]int64 // By day
+	completed map[string]int64
+	seconds   map[string]float64
+}
+
+// summary walks the range day by day, accumulating the burndown and the
+// periods.
+func (s *series) summary(q Query) *Summary {
+	summary := &Summary{
+		Open:      s.totals.Open,
+		Completed: s.totals.Completed,
+		Overdue:   s.totals.Overdue,
+		Periods:   []Period{},
+		Burndown:  []Point{},
+	}
+	scope, done := s.totals.ScopeBefore, s.totals.DoneBefore
+	var totalCompleted int64
+	var totalSeconds float64
+
+	var period *Period
+	var periodSeconds float64
+	var openAtStart int64
+	closePeriod := func() {
+		if period == nil {
+			return
+		}
+		if workload := openAtStart + period.Created; workload > 0 {
+			rate := float64(period.Completed) / float64(workload)
+			period.CompletionRate = &rate
+		}
+		period.AverageCompletionSeconds = average(periodSeconds, period.Completed)
+		summary.Periods = append(summary.Periods, *period)
+	}
+
+	for day := q.From; !day.After(q.To); day = day.AddDate(0, 0, 1) {
+		start := day
+		if q.Interval == "week" {
+			start = models.StartOfWeek(day)
+		}
+		if period == nil || period.Start != start.Format(utils.DateLayout) {
+			closePeriod()
+			period = &Period{Start: start.Format(utils.DateLayout)}
+			periodSeconds, openAtStart = 0, scope-done
+		}
+
+		key := day.Format(utils.DateLayout)
+		created, completed, seconds := s.created[key], s.completed[key], s.seconds[key]
+		scope += created
+		done += completed
+		period.Created += created
+		period.Completed += completed
+		periodSeconds += seconds
+		totalCompleted += completed
+		totalSeconds += seconds
+		summary.Burndown = append(summary.Burndown, Point{Date: key, Scope: scope, Completed: done, Open: scope - done})
+	}
+	closePeriod()
+	summary.AverageCompletionSeconds = average(totalSeconds, totalCompleted)
+	return summary
+}
+
+func average(total float64, count int64) *float64 {
+	if count == 0 {
+		return nil
+	}
+	mean := total / float64(count)
+	return &mean
+}
+
+func days(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24) + 1
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"my-go-project/config"
+	"my-go-project/logging"
+)
+
+// ErrNotFound is returned when a blob does not exist in the store.
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is an open, seekable blob. Callers must close it.
+type Blob interface {
+	io.ReadSeekCloser
+	Size() int64
+}
+
+// BlobStore stores opaque blobs addressed by slash-separated keys.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the blob stored under key, or ErrNotFound.
+	Open(ctx context.Context, key string) (Blob, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+var Store BlobStore
+
+// Init opens the blob store selected by the configuration
+func Init(cfg config.Storage) {
+	var err error
+	switch cfg.Backend {
+	case "local":
+		Store, err = NewLocalStore(cfg.LocalPath)
+	case "s3":
+		Store, err = NewS3Store(S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			UseSSL:    cfg.S3.UseSSL,
+		})
+	default:
+		logging.Fatal("Unknown storage backend", "backend", cfg.Backend)
+	}
+	if err != nil {
+		logging.Fatal("Failed to open blob storage", "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"my-go-project/health"
+	"my-go-project/models"
+	"my-go-project/tracing"
+
+	"gorm.io/gorm"
+)
+
+// Sweep removes every blob queued in models.BlobDeletion from the store and
+// drops the queue entries that were handled.
+func Sweep(ctx context.Context, db *gorm.DB, store BlobStore) error {
+	var pending []models.BlobDeletion
+	if err := db.WithContext(ctx).Order("id").Limit(500).Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, deletion := range pending {
+		if err := store.Delete(ctx, deletion.Key); err != nil {
+			slog.ErrorContext(ctx, "Error deleting blob", "key", deletion.Key, "error", err)
+			continue // Retried on the next sweep
+		}
+		if err := db.WithContext(ctx).Delete(&deletion).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunSweeper sweeps queued blob deletions every interval until ctx is cancelled.
+func RunSweeper(ctx context.Context, db *gorm.DB, store BlobStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		health.Beat(ctx)
+		err := tracing.Job(ctx, "storage.sweep", func(ctx context.Context) error {
+			return Sweep(ctx, db, store)
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Error sweeping deleted blobs", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"my-go-project/backup"
+	"my-go-project/models"
+	"my-go-project/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedBackup fills db with a user, a watched and soft-deleted todo and an
+// attachment whose blob is in store.
+func seedBackup(t *testing.T, db *gorm.DB, store storage.BlobStore) {
+	ctx := context.Background()
+	user := models.User{Username: "alice"}
+	require.NoError(t, db.Create(&user).Error)
+	// Off, which GORM would turn back on if it created the row from the model
+	require.NoError(t, db.Model(&user).Update("digest_daily", false).Error)
+
+	kept := models.Todo{Subject: "Kept", Tags: []string{"home"}, Watchers: []models.User{user}}
+	deleted := models.Todo{Subject: "Deleted"}
+	require.NoError(t, db.Create(&kept).Error)
+	require.NoError(t, db.Create(&deleted).Error)
+	require.NoError(t, db.Delete(&deleted).Error)
+
+	content := "hello"
+	require.NoError(t, store.Put(ctx, "todos/1/hello", strings.NewReader(content), int64(len(content)), "text/plain"))
+	require.NoError(t, db.Create(&models.Attachment{TodoID: kept.ID, Filename: "hello.txt", ContentType: "text/plain", Size: 5, SHA256: "x", StorageKey: "todos/1/hello"}).Error)
+}
+
+func writeBackup(t *testing.T, db *gorm.DB, store storage.BlobStore) string {
+	path := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = backup.Write(context.Background(), db, store, f)
+	require.NoError(t, err)
+	return path
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source, _ := openSQLite(t)
+	sourceStore, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	seedBackup(t, source, sourceStore)
+	path := writeBackup(t, source, sourceStore)
+
+	manifest, err := backup.Verify(path)
+	require.NoError(t, err)
+	assert.Equal(t, backup.Version, manifest.Version)
+	assert.Equal(t, "sqlite", manifest.Dialect)
+	require.Len(t, manifest.Blobs, 1)
+	assert.Equal(t, "todos/1/hello", manifest.Blobs[0].Key)
+
+	target, _ := openSQLite(t)
+	targetStore, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	_, err = backup.Restore(ctx, target, targetStore, path, backup.Options{})
+	require.NoError(t, err)
+
+	var user models.User
+	require.NoError(t, target.First(&user, "username = ?", "alice").Error)
+	assert.False(t, user.DigestDaily)
+	assert.True(t, user.DigestWeekly)
+
+	var todo models.Todo
+	require.NoError(t, target.Preload("Watchers").First(&todo, "subject = ?", "Kept").Error)
+	assert.Equal(t, models.StringList{"home"}, todo.Tags)
+	require.Len(t, todo.Watchers, 1)
+	assert.Equal(t, user.ID, todo.Watchers[0].ID)
+
+	// Soft-deleted rows come back deleted
+	var deleted models.Todo
+	assert.ErrorIs(t, target.First(&deleted, "subject = ?", "Deleted").Error, gorm.ErrRecordNotFound)
+	require.NoError(t, target.Unscoped().First(&deleted, "subject = ?", "Deleted").Error)
+	assert.True(t, deleted.DeletedAt.Valid)
+
+	blob, err := targetStore.Open(ctx, "todos/1/hello")
+	require.NoError(t, err)
+	content, _ := io.ReadAll(blob)
+	blob.Close()
+	assert.Equal(t, "hello", string(content))
+
+	// New rows are numbered after the restored ones
+	created := models.Todo{Subject: "New"}
+	require.NoError(t, target.Create(&created).Error)
+	assert.Greater(t, created.ID, deleted.ID)
+}
+
+func TestRestoreNotEmpty(t *testing.T) {
+	ctx := context.Background()
+	db, _ := openSQLite(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	seedBackup(t, db, store)
+	path := writeBackup(t, db, store)
+
+	_, err = backup.Restore(ctx, db, store, path, backup.Options{})
+	assert.ErrorIs(t, err, backup.ErrNotEmpty)
+
+	// Merging skips the rows that are there already
+	var before, after int64
+	db.Unscoped().Model(&models.Todo{}).Count(&before)
+	_, err = backup.Restore(ctx, db, store, path, backup.Options{Merge: true})
+	require.NoError(t, err)
+	db.Unscoped().Model(&models.Todo{}).Count(&after)
+	assert.Equal(t, before, after)
+}
+
+func TestRestoreMergeConflict(t *testing.T) {
+	ctx := context.Background()
+	source, _ := openSQLite(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	seedBackup(t, source, store)
+	path := writeBackup(t, source, nil)
+
+	counts := func(db *gorm.DB) (users, todos int64) {
+		db.Unscoped().Model(&models.User{}).Count(&users)
+		db.Unscoped().Model(&models.Todo{}).Count(&todos)
+		return users, todos
+	}
+
+	// Other rows under the IDs of the archive: its todos would be restored
+	// with the watchers and attachments of these
+	target, _ := openSQLite(t)
+	require.NoError(t, target.Create(&models.User{Username: "bob"}).Error)
+	require.NoError(t, target.Create(&models.Todo{Subject: "Bob's"}).Error)
+	users, todos := counts(target)
+	_, err = backup.Restore(ctx, target, nil, path, backup.Options{Merge: true})
+	assert.ErrorIs(t, err, backup.ErrConflict)
+	assert.ErrorContains(t, err, "table users")
+	afterUsers, afterTodos := counts(target)
+	assert.Equal(t, users, afterUsers)
+	assert.Equal(t, todos, afterTodos)
+
+	// The username of the archive's user under another ID
+	target, _ = openSQLite(t)
+	alice := models.User{Username: "alice"}
+	alice.ID = 5
+	require.NoError(t, target.Create(&alice).Error)
+	_, err = backup.Restore(ctx, target, nil, path, backup.Options{Merge: true})
+	assert.ErrorIs(t, err, backup.ErrConflict)
+
+	// Rows of the archive that are there as they are merge
+	target, _ = openSQLite(t)
+	_, err = backup.Restore(ctx, target, nil, path, backup.Options{})
+	require.NoError(t, err)
+	require.NoError(t, target.Create(&models.Todo{Subject: "Added since"}).Error)
+	_, err = backup.Restore(ctx, target, nil, path, backup.Options{Merge: true})
+	require.NoError(t, err)
+	_, todos = counts(target)
+	assert.EqualValues(t, 3, todos)
+}
+
+// rewriteBackup copies the archive at path, passing the content of each
+// entry through change.
+func rewriteBackup(t *testing.T, path string, change func(name string, content []byte) []byte) string {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var out bytes.Buffer
+	gzOut := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gzOut)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		content = change(header.Name, content)
+		header.Size = int64(len(content))
+		require.NoError(t, tw.WriteHeader(header))
+		_, err = tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gzOut.Close())
+
+	changed := filepath.Join(t.TempDir(), "changed.tar.gz")
+	require.NoError(t, os.WriteFile(changed, out.Bytes(), 0o600))
+	return changed
+}
+
+func TestVerifyBackup(t *testing.T) {
+	db, _ := openSQLite(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	seedBackup(t, db, store)
+	path := writeBackup(t, db, store)
+
+	tampered := rewriteBackup(t, path, func(name string, content []byte) []byte {
+		if name == "tables/todos.jsonl" {
+			return bytes.Replace(content, []byte("Kept"), []byte("Lost"), 1)
+		}
+		return content
+	})
+	_, err = backup.Verify(tampered)
+	assert.ErrorIs(t, err, backup.ErrCorrupt)
+	assert.ErrorContains(t, err, "tables/todos.jsonl")
+
+	// Nothing is restored from an archive that fails verification
+	target, _ := openSQLite(t)
+	_, err = backup.Restore(context.Background(), target, nil, tampered, backup.Options{})
+	assert.ErrorIs(t, err, backup.ErrCorrupt)
+	var count int64
+	target.Unscoped().Model(&models.Todo{}).Count(&count)
+	assert.Zero(t, count)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	truncated := filepath.Join(t.TempDir(), "truncated.tar.gz")
+	require.NoError(t, os.WriteFile(truncated, content[:len(content)/2], 0o600))
+	_, err = backup.Verify(truncated)
+	assert.ErrorIs(t, err, backup.ErrCorrupt)
+
+	newer := rewriteBackup(t, path, func(name string, content []byte) []byte {
+		if name != "manifest.json" {
+			return content
+		}
+		var manifest map[string]interface{}
+		require.NoError(t, json.Unmarshal(content, &manifest))
+		manifest["version"] = backup.Version + 1
+		content, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		return content
+	})
+	_, err = backup.Verify(newer)
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestBackupRetention(t *testing.T) {
+	db, _ := openSQLite(t)
+	dir := t.TempDir()
+	for _, name := range []string{"backup-20240101T000000Z.tar.gz", "backup-20240102T000000Z.tar.gz", "backup-20240103T000000Z.tar.gz", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	path, manifest, err := backup.WriteFile(context.Background(), db, nil, dir, 2)
+	require.NoError(t, err)
+	assert.NotEmpty(t, manifest.Tables)
+
+	paths, err := backup.List(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "backup-20240103T000000Z.tar.gz"), path}, paths)
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+}
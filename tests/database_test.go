@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"my-go-project/config"
+	"my-go-project/database"
+	"my-go-project/models"
+	"my-go-project/routes"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// openSQLite returns a migrated SQLite database in a file of its own.
+func openSQLite(t *testing.T) (*gorm.DB, string) {
+	path := filepath.Join(t.TempDir(), "todos.db")
+	sqliteDB, err := database.Open(config.Database{Driver: "sqlite", Path: path, LogLevel: "silent"})
+	require.NoError(t, err)
+	sqlDB, err := sqliteDB.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, database.Migrate(sqliteDB))
+	return sqliteDB, path
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "todos.db")
+	sqliteDB, err := database.Open(config.Database{Driver: "sqlite", Path: path, LogLevel: "silent"})
+	require.NoError(t, err)
+	sqlDB, err := sqliteDB.DB()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	assert.FileExists(t, path)
+
+	require.NoError(t, database.Migrate(sqliteDB))
+	pending, err := database.PendingMigrations(sqliteDB)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Todos from before UIDs and completion times get them on the next start
+	todo := models.Todo{Subject: "Old", Completed: true}
+	require.NoError(t, sqliteDB.Create(&todo).Error)
+	require.NoError(t, sqliteDB.Model(&todo).UpdateColumns(map[string]any{"uid": "", "completed_at": nil}).Error)
+	require.NoError(t, database.Migrate(sqliteDB))
+	var migrated models.Todo
+	require.NoError(t, sqliteDB.First(&migrated, todo.ID).Error)
+	assert.Len(t, migrated.UID, 36)
+	assert.NotNil(t, migrated.CompletedAt)
+
+	// Foreign keys are enforced, as they are in PostgreSQL
+	assert.ErrorContains(t, sqliteDB.Create(&models.Note{TodoID: todo.ID + 100, Note: "Orphan"}).Error, "FOREIGN KEY")
+}
+
+func TestConnectRetries(t *testing.T) {
+	// Nothing listens on port 1
+	cfg := config.Database{Driver: "postgres", Host: "127.0.0.1", Port: 1, Name: "todos", SSLMode: "disable", LogLevel: "silent", ConnectTimeoutSeconds: 1}
+	start := time.Now()
+	_, err := database.Connect(context.Background(), cfg)
+	assert.ErrorContains(t, err, "database not reachable after")
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// Startup stops waiting when it is cancelled
+	cfg.ConnectTimeoutSeconds = 60
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = database.Connect(ctx, cfg)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A database that answers is returned at once
+	sqliteDB, err := database.Connect(context.Background(), config.Database{Driver: "sqlite", Path: filepath.Join(t.TempDir(), "todos.db"), LogLevel: "silent", MaxOpenConns: 3})
+	require.NoError(t, err)
+	sqlDB, err := sqliteDB.DB()
+	require.NoError(t, err)
+	defer sqlDB.Close()
+	assert.Equal(t, 3, sqlDB.Stats().MaxOpenConnections)
+}
+
+func TestTransactionRetries(t *testing.T) {
+	sqliteDB, _ := openSQLite(t)
+	serialization := &pgconn.PgError{Code: "40001"}
+	assert.True(t, database.Retryable(serialization))
+	assert.True(t, database.Retryable(&pgconn.PgError{Code: "40P01"}))
+	assert.False(t, database.Retryable(&pgconn.PgError{Code: "23505"}))
+
+	// Serialization failures are retried, and the last attempt counts
+	calls := 0
+	err := database.Transaction(sqliteDB, func(tx *gorm.DB) error {
+		calls++
+		if calls < 3 {
+			return serialization
+		}
+		return tx.Create(&models.Todo{Subject: "Serialized"}).Error
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	var count int64
+	sqliteDB.Model(&models.Todo{}).Where("subject = ?", "Serialized").Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Up to a limit
+	calls = 0
+	err = database.Transaction(sqliteDB, func(*gorm.DB) error { calls++; return serialization })
+	assert.ErrorIs(t, err, serialization)
+	assert.Equal(t, 4, calls)
+
+	// Other errors are not retried, and neither are nested transactions
+	calls = 0
+	failed := errors.New("failed")
+	err = database.Transaction(sqliteDB, func(*gorm.DB) error { calls++; return failed })
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 1, calls)
+	calls = 0
+	err = database.Transaction(sqliteDB, func(tx *gorm.DB) error {
+		return database.Transaction(tx, func(*gorm.DB) error { calls++; return serialization })
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 4, calls) // The outer transaction was retried
+}
+
+func TestReplicaReads(t *testing.T) {
+	primary, _ := openSQLite(t)
+	replica, replicaPath := openSQLite(t)
+	require.NoError(t, primary.Create(&models.Todo{Subject: "On the primary"}).Error)
+	require.NoError(t, replica.Create(&models.Todo{Subject: "On the replica"}).Error)
+	require.NoError(t, database.UseReplicas(primary, config.Database{}, sqlite.Open(database.SQLiteDSN(replicaPath))))
+
+	subject := func(db *gorm.DB) string {
+		var todo models.Todo
+		require.NoError(t, db.First(&todo).Error)
+		return todo.Subject
+	}
+	replicaCtx := database.WithReplicaReads(context.Background())
+	assert.Equal(t, "On the primary", subject(primary))
+	assert.Equal(t, "On the replica", subject(primary.WithContext(replicaCtx)))
+	var raw string
+	require.NoError(t, primary.WithContext(replicaCtx).Raw("SELECT subject FROM todos LIMIT 1").Scan(&raw).Error)
+	assert.Equal(t, "On the replica", raw)
+	require.NoError(t, primary.Raw("SELECT subject FROM todos LIMIT 1").Scan(&raw).Error)
+	assert.Equal(t, "On the primary", raw)
+
+	// Writes, and reads in transactions, go to the primary
+	require.NoError(t, primary.WithContext(replicaCtx).Create(&models.Todo{Subject: "Written"}).Error)
+	var count int64
+	require.NoError(t, primary.Model(&models.Todo{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+	require.NoError(t, primary.WithContext(replicaCtx).Transaction(func(tx *gorm.DB) error {
+		assert.Equal(t, "On the primary", subject(tx))
+		return nil
+	}))
+
+	// Requests read from the replica only for GET
+	app := fiber.New()
+	routes.RegisterMiddleware(app, primary)
+	handler := func(c *fiber.Ctx) error {
+		return c.SendString(subject(primary.WithContext(c.UserContext())))
+	}
+	app.Get("/subject", handler)
+	app.Post("/subject", handler)
+	for method, want := range map[string]string{"GET": "On the replica", "POST": "On the primary"} {
+		resp, err := app.Test(httptest.NewRequest(method, "/subject", nil))
+		require.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, want, string(body), method)
+	}
+}
+
+func TestCurrentUserOnPrimary(t *testing.T) {
+	primary, _ := openSQLite(t)
+	replica, replicaPath := openSQLite(t)
+	require.NoError(t, database.UseReplicas(primary, config.Database{}, sqlite.Open(database.SQLiteDSN(replicaPath))))
+	// Created on the primary, but not replicated yet
+	require.NoError(t, primary.Create(&models.User{Username: "alice"}).Error)
+
+	app := fiber.New()
+	routes.RegisterMiddleware(app, primary)
+	routes.RegisterUserRoutes(app, primary)
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set(routes.UserHeader, "alice")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var count int64
+	require.NoError(t, primary.Model(&models.User{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, replica.Model(&models.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { routes.QueryTimeout = timeout }(routes.QueryTimeout)
+	routes.QueryTimeout = time.Second
+	app := fiber.New()
+	routes.RegisterMiddleware(app, db)
+	app.Get("/deadline", func(c *fiber.Ctx) error {
+		deadline, ok := c.UserContext().Deadline()
+		if !ok {
+			return c.SendString("none")
+		}
+		return c.SendString(time.Until(deadline).Round(time.Second).String())
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/deadline", nil))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "1s", string(body))
+
+	routes.QueryTimeout = 0
+	resp, err = app.Test(httptest.NewRequest("GET", "/deadline", nil))
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Equal(t, "none", string(body))
+}
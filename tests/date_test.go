@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDateTime(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+
+	tests := []struct {
+		input string
+		want  time.Time
+		kind  utils.DateTimeKind
+	}{
+		{"2025-03-01T09:30:00+02:00", time.Date(2025, 3, 1, 7, 30, 0, 0, time.UTC), utils.KindInstant},
+		{"2025-03-01T09:30:00.5Z", time.Date(2025, 3, 1, 9, 30, 0, 5e8, time.UTC), utils.KindInstant},
+		{"2025-03-01", time.Date(2025, 3, 1, 0, 0, 0, 0, stockholm), utils.KindDate},
+		{"2025-03-01T09:30", time.Date(2025, 3, 1, 9, 30, 0, 0, stockholm), utils.KindLocal},
+		{"2025-03-01 09:30:15", time.Date(2025, 3, 1, 9, 30, 15, 0, stockholm), utils.KindLocal},
+		{"1740821400", time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC), utils.KindInstant},
+		{"1740821400000", time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC), utils.KindInstant},
+	}
+	for _, tt := range tests {
+		got, kind, err := utils.ParseDateTime(tt.input, stockholm)
+		require.NoError(t, err, tt.input)
+		assert.True(t, tt.want.Equal(got), "%s: got %s", tt.input, got)
+		assert.Equal(t, tt.kind, kind, tt.input)
+	}
+
+	for _, input := range []string{"", "tomorrow", "2025-02-30", "20250301", "01/03/2025"} {
+		_, _, err := utils.ParseDateTime(input, stockholm)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestDueDateJSON(t *testing.T) {
+	var todo models.Todo
+	require.NoError(t, json.Unmarshal([]byte(`{"due_date":"2025-03-01"}`), &todo))
+	assert.True(t, todo.DueDate.DateOnly)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), todo.DueDate.Time)
+
+	out, err := json.Marshal(todo.DueDate)
+	require.NoError(t, err)
+	assert.JSONEq(t, `"2025-03-01"`, string(out))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"due_date":"2025-03-01T09:30:00+01:00"}`), &todo))
+	assert.False(t, todo.DueDate.DateOnly)
+	out, err = json.Marshal(todo.DueDate)
+	require.NoError(t, err)
+	assert.JSONEq(t, `"2025-03-01T08:30:00Z"`, string(out))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"due_date":1740821400}`), &todo))
+	assert.Equal(t, "2025-03-01T09:30:00Z", todo.DueDate.String())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"due_date":"next week"}`), &todo))
+}
+
+func TestDueDateLocalize(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	defaultLocation := utils.DefaultLocation
+	utils.DefaultLocation = time.UTC
+	defer func() { utils.DefaultLocation = defaultLocation }()
+
+	zoneless, err := models.ParseDueDate("2025-03-01T09:30", utils.DefaultLocation)
+	require.NoError(t, err)
+	zoneless.Localize(newYork)
+	assert.Equal(t, "2025-03-01T14:30:00Z", zoneless.String())
+
+	// Dates and instants are the same wherever they are read
+	for _, input := range []string{"2025-03-01", "2025-03-01T09:30:00Z"} {
+		due, err := models.ParseDueDate(input, utils.DefaultLocation)
+		require.NoError(t, err)
+		due.Localize(newYork)
+		assert.Equal(t, input, due.String())
+	}
+
+	on, at := models.MustParseDueDate("2025-03-01").Columns()
+	assert.NotNil(t, on)
+	assert.Nil(t, at)
+
+	assert.True(t, models.DueDatesEqual(nil, nil))
+	assert.False(t, models.DueDatesEqual(models.MustParseDueDate("2025-03-01"), nil))
+	assert.True(t, models.DueDatesEqual(models.MustParseDueDate("2025-03-01"), models.NewDueDate(time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC), true)))
+}
+
+func TestTodoDueStatus(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	// Wednesday 5 March, 00:30 in Stockholm and still Tuesday evening in New York
+	now := time.Date(2025, 3, 4, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		due       string
+		completed bool
+		stockholm string
+		newYork   string
+	}{
+		{"2025-03-05", false, models.DueToday, models.DueThisWeek},
+		{"2025-03-04", false, models.DueOverdue, models.DueToday},
+		{"2025-03-04", true, "", ""},
+		{"2025-03-09", false, models.DueThisWeek, models.DueThisWeek},
+		{"2025-03-10", false, models.DueLater, models.DueLater},
+		{"2025-03-05T08:00:00Z", false, models.DueToday, models.DueThisWeek},
+		{"2025-03-04T23:00:00Z", false, models.DueOverdue, models.DueOverdue},
+	}
+	for _, tt := range tests {
+		due, err := models.ParseDueDate(tt.due, time.UTC)
+		require.NoError(t, err)
+		todo := models.Todo{DueDate: due, Completed: tt.completed}
+
+		todo.SetDueStatus(now, stockholm)
+		assert.Equal(t, tt.stockholm, todo.DueStatus, "%s in Stockholm", tt.due)
+		todo.SetDueStatus(now, newYork)
+		assert.Equal(t, tt.newYork, todo.DueStatus, "%s in New York", tt.due)
+	}
+
+	_, err = models.DueFilter("someday", now, stockholm)
+	assert.Error(t, err)
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"my-go-project/digest"
+	"my-go-project/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpCapture is a minimal SMTP server that keeps the messages it receives.
+type smtpCapture struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []capturedMail
+}
+
+type capturedMail struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+func newSMTPCapture(t *testing.T) *smtpCapture {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &smtpCapture{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+// mailer returns a mailer delivering to the capture server.
+func (s *smtpCapture) mailer() *digest.SMTPMailer {
+	return &digest.SMTPMailer{Addr: s.listener.Addr().String(), From: "Todo App <todo@example.com>"}
+}
+
+func (s *smtpCapture) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost capture")
+	var current capturedMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		address := func() string {
+			start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+			if start < 0 || end < start {
+				return ""
+			}
+			return arg[start+1 : end]
+		}
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO", "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "MAIL":
+			current = capturedMail{From: address()}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.To = append(current.To, address())
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			if current.Data, err = tp.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// take returns the messages received so far and forgets them.
+func (s *smtpCapture) take() []capturedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := s.messages
+	s.messages = nil
+	return messages
+}
+
+// parseDigestMail reads a captured digest into its subject and its text and
+// HTML parts.
+func parseDigestMail(t *testing.T, data []byte) (subject, text, html string) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	subject, err = new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		require.NoError(t, err)
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(body)
+		}
+	}
+	return subject, text, html
+}
+
+func TestDigestKindFor(t *testing.T) {
+	user := &models.User{DigestDaily: true, DigestWeekly: true}
+	monday := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, digest.Weekly, digest.KindFor(user, monday))
+	assert.Equal(t, digest.Daily, digest.KindFor(user, monday.AddDate(0, 0, 1)))
+
+	user.DigestWeekly = false
+	assert.Equal(t, "", digest.KindFor(user, monday))
+	user.DigestDaily, user.DigestWeekly = false, true
+	assert.Equal(t, "", digest.KindFor(user, monday.AddDate(0, 0, 6)))
+}
+
+func TestDigestRenderAndSend(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	user := &models.User{Username: "ada", Email: "ada@example.com", TimeZone: "America/New_York", DigestHour: 8}
+	d := &digest.Digest{
+		Kind:      digest.Daily,
+		User:      user,
+		Date:      time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC),
+		SendTime:  time.Date(2025, 3, 4, 8, 0, 0, 0, newYork),
+		BaseURL:   "https://todo.example.com",
+		Overdue:   []models.Todo{{Subject: "File <taxes> & forms", DueDate: models.MustParseDueDate("2025-03-01"), Priority: models.PriorityHigh}},
+		DueToday:  []models.Todo{{Subject: "Standup", DueDate: models.NewDueDate(time.Date(2025, 3, 4, 14, 30, 0, 0, time.UTC), false)}},
+		Completed: []models.Todo{{Subject: "Book hotel", Completed: true}},
+	}
+	msg, err := digest.Render(d)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", msg.To)
+	assert.Equal(t, "Tuesday 4 March: 1 due today, 1 overdue", msg.Subject)
+
+	// Times are shown in the user's zone, and HTML is escaped
+	assert.Contains(t, msg.Text, "- File <taxes> & forms (Sat 1 Mar) !high\n")
+	assert.Contains(t, msg.Text, "- Standup (Tue 4 Mar 09:30)\n")
+	assert.Contains(t, msg.Text, "Completed since yesterday (1)")
+	assert.Contains(t, msg.HTML, "File &lt;taxes&gt; &amp; forms")
+	assert.Contains(t, msg.HTML, `href="https://todo.example.com/"`)
+
+	capture := newSMTPCapture(t)
+	require.NoError(t, capture.mailer().Send(context.Background(), msg))
+	messages := capture.take()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "todo@example.com", messages[0].From)
+	assert.Equal(t, []string{"ada@example.com"}, messages[0].To)
+
+	subject, text, html := parseDigestMail(t, messages[0].Data)
+	assert.Equal(t, msg.Subject, subject)
+	assert.Equal(t, msg.Text, text)
+	assert.Equal(t, msg.HTML, html)
+}
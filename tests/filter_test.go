@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"my-go-project/filter"
+	"my-go-project/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterParse(t *testing.T) {
+	node, err := filter.Parse(`due:overdue priority>=medium or not #home`)
+	require.NoError(t, err)
+	or, ok := node.(*filter.Or)
+	require.True(t, ok)
+	and, ok := or.Left.(*filter.And)
+	require.True(t, ok)
+	assert.Equal(t, &filter.Term{Field: "due", Op: ":", Value: "overdue", FieldPos: 0, ValuePos: 4}, and.Left)
+	assert.Equal(t, &filter.Term{Field: "priority", Op: ">=", Value: "medium", FieldPos: 12, ValuePos: 22}, and.Right)
+	assert.Equal(t, &filter.Not{X: &filter.Term{Field: "tag", Op: ":", Value: "home", FieldPos: 36, ValuePos: 37}}, or.Right)
+
+	node, err = filter.Parse(`text:"lawn \"mower\"" @garden`)
+	require.NoError(t, err)
+	and, ok = node.(*filter.And)
+	require.True(t, ok)
+	assert.Equal(t, `lawn "mower"`, and.Left.(*filter.Term).Value)
+	assert.Equal(t, "list", and.Right.(*filter.Term).Field)
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{"", 0},
+		{"due:overdue and", 15},
+		{"(completed:true", 15},
+		{"completed:true)", 14},
+		{`text:"open`, 5},
+		{"priority=>high", 8},
+		{"priority:urgent", 9},
+		{"completed:maybe", 10},
+		{"due:someday", 4},
+		{"colour:red", 0},
+		{"tag<home", 0},
+		{"due:", 4},
+		{"or due:today", 0},
+		{strings.Repeat("(", 60) + "x" + strings.Repeat(")", 60), 50},
+		{strings.Repeat("x", filter.MaxLength+1), filter.MaxLength},
+	}
+	for _, tt := range tests {
+		_, err := filter.Compile(tt.input, filter.Options{})
+		var filterErr *filter.Error
+		require.True(t, errors.As(err, &filterErr), "%q: got %v", tt.input, err)
+		assert.Equal(t, tt.pos, filterErr.Pos, "%q: %s", tt.input, filterErr.Msg)
+	}
+}
+
+func TestFilterCompile(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+	// Late Sunday evening in Stockholm is already Monday in UTC
+	opts := filter.Options{Now: time.Date(2025, 3, 9, 23, 30, 0, 0, stockholm), Location: stockholm}
+
+	condition, err := filter.Compile("due:today", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"2025-03-09", "2025-03-10", time.Date(2025, 3, 8, 23, 0, 0, 0, time.UTC), time.Date(2025, 3, 9, 23, 0, 0, 0, time.UTC)}, condition.Vars)
+
+	condition, err = filter.Compile("due<+1w", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"2025-03-16", time.Date(2025, 3, 15, 23, 0, 0, 0, time.UTC)}, condition.Vars)
+
+	condition, err = filter.Compile("priority!=high", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "priority <> ?", condition.SQL)
+
+	// Values are always bound, never spliced into the SQL
+	condition, err = filter.Compile(`"'; DROP TABLE todos; --" or tag:"50%_off" or list:"x' OR 1=1"`, opts)
+	require.NoError(t, err)
+	assert.NotContains(t, condition.SQL, "DROP")
+	assert.NotContains(t, condition.SQL, "1=1")
+	assert.Contains(t, condition.Vars, `%"50\%\_off"%`)
+	assert.Contains(t, condition.Vars, "x' OR 1=1")
+
+	condition, err = filter.Compile("not completed:true", opts)
+	require.NoError(t, err)
+	assert.Equal(t, "NOT COALESCE(completed = ?, FALSE)", condition.SQL)
+	assert.Equal(t, []interface{}{true}, condition.Vars)
+}
+
+func TestFilterNegation(t *testing.T) {
+	db, _ := openSQLite(t)
+	alice, bob := models.User{Username: "alice"}, models.User{Username: "bob"}
+	require.NoError(t, db.Create(&alice).Error)
+	require.NoError(t, db.Create(&bob).Error)
+	require.NoError(t, db.Create(&[]models.Todo{
+		{Subject: "Unassigned"},
+		{Subject: "Alice's", AssigneeID: &alice.ID, List: "Home"},
+		{Subject: "Bob's", AssigneeID: &bob.ID},
+	}).Error)
+
+	// Negated terms keep the todos whose column is NULL
+	subjects := func(expression string) []string {
+		scope, err := filter.Scope(expression, filter.Options{UserID: alice.ID})
+		require.NoError(t, err)
+		var subjects []string
+		require.NoError(t, db.Model(&models.Todo{}).Scopes(scope).Order("id").Pluck("subject", &subjects).Error)
+		return subjects
+	}
+	assert.Equal(t, []string{"Unassigned", "Bob's"}, subjects("assignee!=me"))
+	assert.Equal(t, []string{"Unassigned", "Alice's"}, subjects("assignee!=bob"))
+	assert.Equal(t, []string{"Unassigned", "Bob's"}, subjects("not assignee:alice"))
+	assert.Equal(t, []string{"Unassigned"}, subjects(`assignee!=me text:unassigned`))
+	require.NoError(t, db.Exec("UPDATE todos SET list = NULL WHERE list = ''").Error)
+	assert.Equal(t, []string{"Unassigned", "Bob's"}, subjects("list!=Home"))
+}
@@ -8,10 +8,18 @@ import (
 	"testing"
 	"time"
 
+	"my-go-project/audit"
+	"my-go-project/config"
 	"my-go-project/database"
+	"my-go-project/health"
+	"my-go-project/metrics"
 	"my-go-project/models"
+	"my-go-project/notify"
+	"my-go-project/repository"
 	"my-go-project/routes"
-	"my-go-project/utils"
+	"my-go-project/service"
+	"my-go-project/tracing"
+	"my-go-project/undo"
 
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
@@ -30,17 +38,24 @@ var (
 	db                *gorm.DB
 	app               *fiber.App
 	client            *http.Client
+	memoryClient      *http.Client // Serves the todo routes from a repository.MemoryRepository
 )
 
 func TestMain(m *testing.M) {
-	if os.Getenv("RUN_TESTCONTAINER") == "" {
-		fmt.Println("Skipping tests as RUN_TESTCONTAINER is not set")
-		return
-	}
 	ctx := context.Background()
-	// Setup PostgreSQL container
-	postgresContainer, db = setupPostgresContainer(ctx, nil)
-	defer postgresContainer.Terminate(ctx)
+	if os.Getenv("RUN_TESTCONTAINER") != "" {
+		// Setup PostgreSQL container
+		postgresContainer, db = setupPostgresContainer(ctx, nil)
+		defer postgresContainer.Terminate(ctx)
+	} else {
+		// Without Docker, run against SQLite in memory
+		var err error
+		db, err = database.Open(config.Database{Driver: "sqlite", Path: ":memory:", LogLevel: "silent"})
+		if err != nil {
+			fmt.Printf("Failed to open SQLite: %s\n", err)
+			os.Exit(1)
+		}
+	}
 	sqlDb, _ := db.DB()
 	defer sqlDb.Close()
 	// Run migrations
@@ -51,17 +66,74 @@ func TestMain(m *testing.M) {
 		}
 	}
 
+	// Record mutations in the activity log
+	if err := audit.Register(db); err != nil {
+		fmt.Printf("Failed to register audit callbacks: %s\n", err)
+		os.Exit(1)
+	}
+	if err := metrics.RegisterDB(db, "test"); err != nil {
+		fmt.Printf("Failed to register database metrics: %s\n", err)
+		os.Exit(1)
+	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		fmt.Printf("Failed to register database tracing: %s\n", err)
+		os.Exit(1)
+	}
+
 	// Populate the database with test data
-	database.PopulateDatabase(db)
+	if err := database.PopulateDatabase(db); err != nil {
+		fmt.Printf("Failed to populate the database: %s\n", err)
+		os.Exit(1)
+	}
 
 	// Setup Fiber app and register routes
-	app = fiber.New()
+	app = fiber.New(fiber.Config{RequestMethods: routes.RequestMethods()})
+	checker := health.New(2 * time.Second)
+	checker.Add("database", func(ctx context.Context) error { return database.Ping(ctx, db) })
+	checker.Add("migrations", func(ctx context.Context) error {
+		pending, err := database.PendingMigrations(db.WithContext(ctx))
+		if err == nil && len(pending) > 0 {
+			err = fmt.Errorf("pending: %v", pending)
+		}
+		return err
+	})
+	checker.MarkStarted()
+	routes.RegisterHealthRoutes(app, checker)
+	routes.RegisterMetricsRoutes(app)
+	routes.RegisterMiddleware(app, db)
 	routes.RegisterExampleRoute(app)
-	routes.RegisterTodoRoutes(app, db)
+	todoRepo := repository.NewGormRepository(db)
+	todoService := service.NewTodoService(todoRepo, gormPorts(todoRepo))
+	routes.RegisterTodoRoutes(app, todoService, service.NewNoteService(todoRepo, gormPorts(todoRepo)))
+	routes.RegisterQuickAddRoutes(app, todoService)
+	routes.RegisterUserRoutes(app, db)
+	routes.RegisterViewRoutes(app, db, todoService)
+	routes.RegisterNotificationRoutes(app, db)
+	routes.RegisterStatsRoutes(app, db)
+	routes.RegisterDigestRoutes(app, db)
+	routes.RegisterChecklistRoutes(app, db)
+	routes.RegisterActivityRoutes(app, db)
+	routes.RegisterUndoRoutes(app, db)
+	routes.RegisterCalendarRoutes(app, db, todoService)
+	routes.RegisterDAVRoutes(app, db, todoService)
+	routes.RegisterTransferRoutes(app, db, todoService)
 	client = &http.Client{
 		Transport: &fiberTransport{app: app}, // Use custom transport
 	}
 
+	// The todo routes again on an in-memory repository holding the same
+	// todos, without ports, so that nothing of it reaches the database
+	seeded, err := todoRepo.List(ctx, repository.TodoQuery{})
+	if err != nil {
+		fmt.Printf("Failed to seed the in-memory repository: %s\n", err)
+		os.Exit(1)
+	}
+	memoryRepo := repository.NewMemoryRepository(seeded...)
+	memoryApp := fiber.New()
+	routes.RegisterMiddleware(memoryApp, db)
+	routes.RegisterTodoRoutes(memoryApp, service.NewTodoService(memoryRepo, service.Ports{}), service.NewNoteService(memoryRepo, service.Ports{}))
+	memoryClient = &http.Client{Transport: &fiberTransport{app: memoryApp}}
+
 	// Run tests
 	code := m.Run()
 	os.Exit(code)
@@ -135,6 +207,19 @@ func (ft *fiberTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
+// gormPorts connects the services on repo to undo and notifications in the
+// test database, as main does.
+func gormPorts(repo *repository.GormRepository) service.Ports {
+	return service.Ports{Undo: undo.NewRecorder(db), Notifier: notify.NewNotifier(db), Users: repo}
+}
+
+// forEachRepository runs test against the todo routes on the database and on
+// an in-memory repository.
+func forEachRepository(t *testing.T, test func(t *testing.T, client *http.Client)) {
+	t.Run("gorm", func(t *testing.T) { test(t, client) })
+	t.Run("memory", func(t *testing.T) { test(t, memoryClient) })
+}
+
 func TestExampleRouteFunctional(t *testing.T) {
 	server := httpexpect.WithConfig(httpexpect.Config{
 		Client: &http.Client{
@@ -150,287 +235,374 @@ func TestExampleRouteFunctional(t *testing.T) {
 }
 
 func TestAllTodosRouteFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
-	})
-
-	// Define the expected todos using the Todo struct
-	expectedTodos := []models.Todo{
-		{Subject: "Buy groceries", Completed: false},
-		{Subject: "Read a book", Completed: true},
-		{Subject: "Write some code", Completed: false},
-		{Subject: "Due tomorrow", Completed: false, DueDate: utils.ParseDate("2023-10-01")},
-		{Subject: "Some notes", Completed: false,
-			Notes: []models.Note{
-				{Note: "Note 1"},
-				{Note: "Note 2"}},
-		},
-	}
-	var todos []models.Todo
-	result := server.GET("/todos").
-		Expect().
-		Status(200).
-		JSON().Array()
-
-	result.Length().IsEqual(len(expectedTodos))
-	result.Decode(&todos)
-	for index, todo := range todos {
-		assert.Equal(t, todo.Subject, expectedTodos[index].Subject)
-		assert.Equal(t, todo.Completed, expectedTodos[index].Completed)
-		if expectedTodos[index].DueDate != nil {
-			assert.Equal(t, *todo.DueDate, *expectedTodos[index].DueDate)
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Define the expected todos using the Todo struct
+		expectedTodos := []models.Todo{
+			{Subject: "Buy groceries", Completed: false},
+			{Subject: "Read a book", Completed: true},
+			{Subject: "Write some code", Completed: false},
+			{Subject: "Due tomorrow", Completed: false, DueDate: models.MustParseDueDate("2023-10-01")},
+			{Subject: "Some notes", Completed: false,
+				Notes: []models.Note{
+					{Note: "Note 1"},
+					{Note: "Note 2"}},
+			},
+			{Subject: "Pack for the trip", Completed: false,
+				Checklist: []models.ChecklistItem{
+					{Text: "Charger", Done: true, Position: 0},
+					{Text: "Passport", Position: 1},
+					{Text: "Adapter", Position: 2}},
+			},
 		}
-		if expectedTodos[index].Notes != nil {
-			assert.Len(t, todo.Notes, len(expectedTodos[index].Notes))
-			for i, note := range todo.Notes {
-				assert.Equal(t, note.Note, expectedTodos[index].Notes[i].Note)
+		var todos []models.Todo
+		result := server.GET("/todos").
+			Expect().
+			Status(200).
+			JSON().Array()
+
+		result.Length().IsEqual(len(expectedTodos))
+		result.Decode(&todos)
+		for index, todo := range todos {
+			assert.Equal(t, todo.Subject, expectedTodos[index].Subject)
+			assert.Equal(t, todo.Completed, expectedTodos[index].Completed)
+			if expectedTodos[index].DueDate != nil {
+				assert.Equal(t, *todo.DueDate, *expectedTodos[index].DueDate)
+			}
+			if expectedTodos[index].Notes != nil {
+				assert.Len(t, todo.Notes, len(expectedTodos[index].Notes))
+				for i, note := range todo.Notes {
+					assert.Equal(t, note.Note, expectedTodos[index].Notes[i].Note)
+				}
+			}
+			if expectedTodos[index].Checklist != nil {
+				assert.Len(t, todo.Checklist, len(expectedTodos[index].Checklist))
+				for i, item := range todo.Checklist {
+					assert.Equal(t, item.Text, expectedTodos[index].Checklist[i].Text)
+					assert.Equal(t, item.Done, expectedTodos[index].Checklist[i].Done)
+				}
 			}
 		}
-	}
 
-	t.Log("TestTodoRouteFunctional passed")
+		t.Log("TestTodoRouteFunctional passed")
+	})
 }
 
 func TestSingleTodoRouteFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
-	})
-
-	// Define the expected todo using the Todo struct
-	expectedTodo := models.Todo{
-		Subject:   "Buy groceries",
-		Completed: false,
-	}
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Define the expected todo using the Todo struct
+		expectedTodo := models.Todo{
+			Subject:   "Buy groceries",
+			Completed: false,
+		}
 
-	var todo models.Todo
-	result := server.GET("/todos/1").
-		Expect().
-		Status(200).
-		JSON().Object()
+		var todo models.Todo
+		result := server.GET("/todos/1").
+			Expect().
+			Status(200).
+			JSON().Object()
 
-	result.Decode(&todo)
-	assert.Equal(t, todo.Subject, expectedTodo.Subject)
-	assert.Equal(t, todo.Completed, expectedTodo.Completed)
+		result.Decode(&todo)
+		assert.Equal(t, todo.Subject, expectedTodo.Subject)
+		assert.Equal(t, todo.Completed, expectedTodo.Completed)
 
-	t.Log("TestSingleTodoRouteFunctional passed")
+		t.Log("TestSingleTodoRouteFunctional passed")
+	})
 }
 
 func TestDeleteTodoRouteFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Ensure the todo exists before deletion
+		server.GET("/todos/3").
+			Expect().
+			Status(200)
+
+		// Perform the delete operation
+		server.DELETE("/todos/3").
+			Expect().
+			Status(204)
+
+		// Verify the todo no longer exists
+		server.GET("/todos/3").
+			Expect().
+			Status(404)
+
+		t.Log("TestDeleteTodoRouteFunctional passed")
 	})
-
-	// Ensure the todo exists before deletion
-	server.GET("/todos/3").
-		Expect().
-		Status(200)
-
-	// Perform the delete operation
-	server.DELETE("/todos/3").
-		Expect().
-		Status(204)
-
-	// Verify the todo no longer exists
-	server.GET("/todos/3").
-		Expect().
-		Status(404)
-
-	t.Log("TestDeleteTodoRouteFunctional passed")
 }
 func TestCreateTodoRouteFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
-	})
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Define the new todo to be created
+		newTodo := models.Todo{
+			Subject:   "New Task",
+			Completed: false,
+		}
 
-	// Define the new todo to be created
-	newTodo := models.Todo{
-		Subject:   "New Task",
-		Completed: false,
-	}
+		// Perform the POST operation
+		response := server.POST("/todos").
+			WithJSON(newTodo).
+			Expect().
+			Status(201).
+			JSON().Object()
 
-	// Perform the POST operation
-	response := server.POST("/todos").
-		WithJSON(newTodo).
-		Expect().
-		Status(201).
-		JSON().Object()
+		// Verify the response contains the created todo
+		response.Value("subject").IsEqual(newTodo.Subject)
+		response.Value("completed").IsEqual(newTodo.Completed)
 
-	// Verify the response contains the created todo
-	response.Value("subject").IsEqual(newTodo.Subject)
-	response.Value("completed").IsEqual(newTodo.Completed)
+		// Verify the todo exists in the database
+		var createdTodo models.Todo
+		response.Value("ID").Number().Gt(0) // Ensure ID is valid
+		todoID := int(response.Value("ID").Raw().(float64))
 
-	// Verify the todo exists in the database
-	var createdTodo models.Todo
-	response.Value("ID").Number().Gt(0) // Ensure ID is valid
-	todoID := int(response.Value("ID").Raw().(float64))
-
-	server.GET(fmt.Sprintf("/todos/%d", todoID)).
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&createdTodo)
+		server.GET(fmt.Sprintf("/todos/%d", todoID)).
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&createdTodo)
 
-	assert.Equal(t, createdTodo.Subject, newTodo.Subject)
-	assert.Equal(t, createdTodo.Completed, newTodo.Completed)
+		assert.Equal(t, createdTodo.Subject, newTodo.Subject)
+		assert.Equal(t, createdTodo.Completed, newTodo.Completed)
 
-	t.Log("TestCreateTodoRouteFunctional passed")
+		t.Log("TestCreateTodoRouteFunctional passed")
+	})
 }
 
 func TestAddNoteToTodoFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
-	})
-
-	// Define the new note to be added
-	newNote := models.Note{
-		Note: "This is a new note",
-	}
-
-	// Perform the POST operation to add the note
-	response := server.POST("/todos/2/notes").
-		WithJSON(newNote).
-		Expect().
-		Status(201).
-		JSON().Object()
-
-	// Verify the response contains the created note
-	response.Value("note").IsEqual(newNote.Note)
-
-	// Verify the note exists in the database for todo/2
-	var updatedTodo models.Todo
-	server.GET("/todos/2").
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&updatedTodo)
-
-	assert.NotNil(t, updatedTodo.Notes)
-	assert.GreaterOrEqual(t, len(updatedTodo.Notes), 1)
-	assert.Equal(t, updatedTodo.Notes[len(updatedTodo.Notes)-1].Note, newNote.Note)
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Define the new note to be added
+		newNote := models.Note{
+			Note: "This is a new note",
+		}
 
-	t.Log("TestAddNoteToTodoFunctional passed")
+		// Perform the POST operation to add the note
+		response := server.POST("/todos/2/notes").
+			WithJSON(newNote).
+			Expect().
+			Status(201).
+			JSON().Object()
+
+		// Verify the response contains the created note
+		response.Value("note").IsEqual(newNote.Note)
+
+		// Verify the note exists in the database for todo/2
+		var updatedTodo models.Todo
+		server.GET("/todos/2").
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&updatedTodo)
+
+		assert.NotNil(t, updatedTodo.Notes)
+		assert.GreaterOrEqual(t, len(updatedTodo.Notes), 1)
+		assert.Equal(t, updatedTodo.Notes[len(updatedTodo.Notes)-1].Note, newNote.Note)
+
+		t.Log("TestAddNoteToTodoFunctional passed")
+	})
 }
 
-func TestRemoveNoteFromTodoFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
+func TestAddNoteToMissingTodoFunctional(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		server.POST("/todos/999999/notes").
+			WithJSON(models.Note{Note: "Nowhere to go"}).
+			Expect().
+			Status(404).
+			JSON().Object().Value("error").IsEqual("Todo not found")
 	})
+}
 
-	// Ensure the note exists before deletion
-	var todoBefore models.Todo
-	server.GET("/todos/2").
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&todoBefore)
-
-	assert.NotNil(t, todoBefore.Notes)
-	assert.GreaterOrEqual(t, len(todoBefore.Notes), 1)
-
-	noteID := todoBefore.Notes[0].ID
-
-	// Perform the DELETE operation to remove the note
-	server.DELETE(fmt.Sprintf("/todos/2/notes/%d", noteID)).
-		Expect().
-		Status(204)
-
-	// Verify the note no longer exists in the database for todo/2
-	var todoAfter models.Todo
-	server.GET("/todos/2").
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&todoAfter)
-
-	assert.NotNil(t, todoAfter.Notes)
-	for _, note := range todoAfter.Notes {
-		assert.NotEqual(t, note.ID, noteID)
-	}
+func TestRemoveNoteFromTodoFunctional(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Ensure the note exists before deletion
+		var todoBefore models.Todo
+		server.GET("/todos/2").
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&todoBefore)
+
+		assert.NotNil(t, todoBefore.Notes)
+		assert.GreaterOrEqual(t, len(todoBefore.Notes), 1)
+
+		noteID := todoBefore.Notes[0].ID
+
+		// Perform the DELETE operation to remove the note
+		server.DELETE(fmt.Sprintf("/todos/2/notes/%d", noteID)).
+			Expect().
+			Status(204)
+
+		// Verify the note no longer exists in the database for todo/2
+		var todoAfter models.Todo
+		server.GET("/todos/2").
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&todoAfter)
+
+		assert.NotNil(t, todoAfter.Notes)
+		for _, note := range todoAfter.Notes {
+			assert.NotEqual(t, note.ID, noteID)
+		}
 
-	t.Log("TestRemoveNoteFromTodoFunctional passed")
+		t.Log("TestRemoveNoteFromTodoFunctional passed")
+	})
 }
 
 func TestAddTodoWithDueDateFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
-	})
-
-	// Define the new todo with a due date
-	newTodo := models.Todo{
-		Subject:   "Task with due date",
-		Completed: false,
-		DueDate:   utils.ParseDate("2023-12-31"),
-	}
-
-	// Perform the POST operation
-	response := server.POST("/todos").
-		WithJSON(newTodo).
-		Expect().
-		Status(201).
-		JSON().Object()
-
-	// Verify the response contains the created todo
-	response.Value("subject").IsEqual(newTodo.Subject)
-	response.Value("completed").IsEqual(newTodo.Completed)
-	response.Value("due_date").IsEqual("2023-12-31T00:00:00Z")
-
-	// Verify the todo exists in the database
-	var createdTodo models.Todo
-	response.Value("ID").Number().Gt(0) // Ensure ID is valid
-	todoID := int(response.Value("ID").Raw().(float64))
-
-	server.GET(fmt.Sprintf("/todos/%d", todoID)).
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&createdTodo)
-
-	assert.Equal(t, createdTodo.Subject, newTodo.Subject)
-	assert.Equal(t, createdTodo.Completed, newTodo.Completed)
-	assert.NotNil(t, createdTodo.DueDate)
-	assert.Equal(t, *createdTodo.DueDate, *newTodo.DueDate)
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Define the new todo with a due date
+		newTodo := models.Todo{
+			Subject:   "Task with due date",
+			Completed: false,
+			DueDate:   models.MustParseDueDate("2023-12-31"),
+		}
 
-	t.Log("TestAddTodoWithDueDateFunctional passed")
+		// Perform the POST operation
+		response := server.POST("/todos").
+			WithJSON(newTodo).
+			Expect().
+			Status(201).
+			JSON().Object()
+
+		// Verify the response contains the created todo
+		response.Value("subject").IsEqual(newTodo.Subject)
+		response.Value("completed").IsEqual(newTodo.Completed)
+		response.Value("due_date").IsEqual("2023-12-31")
+
+		// Verify the todo exists in the database
+		var createdTodo models.Todo
+		response.Value("ID").Number().Gt(0) // Ensure ID is valid
+		todoID := int(response.Value("ID").Raw().(float64))
+
+		server.GET(fmt.Sprintf("/todos/%d", todoID)).
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&createdTodo)
+
+		assert.Equal(t, createdTodo.Subject, newTodo.Subject)
+		assert.Equal(t, createdTodo.Completed, newTodo.Completed)
+		assert.NotNil(t, createdTodo.DueDate)
+		assert.Equal(t, *createdTodo.DueDate, *newTodo.DueDate)
+
+		t.Log("TestAddTodoWithDueDateFunctional passed")
+	})
 }
 
 func TestMarkTodoAsCompletedFunctional(t *testing.T) {
-	server := httpexpect.WithConfig(httpexpect.Config{
-		Client:   client,
-		Reporter: httpexpect.NewRequireReporter(t),
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Ensure the todo exists and is not completed
+		var todoBefore models.Todo
+		server.GET("/todos/4").
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&todoBefore)
+
+		assert.False(t, todoBefore.Completed)
+
+		// Perform the PATCH operation to mark the todo as completed
+		server.PATCH("/todos/4").
+			WithJSON(map[string]interface{}{"completed": true}).
+			Expect().
+			Status(200)
+
+		// Verify the todo is now marked as completed
+		var todoAfter models.Todo
+		server.GET("/todos/4").
+			Expect().
+			Status(200).
+			JSON().Object().
+			Decode(&todoAfter)
+
+		assert.True(t, todoAfter.Completed)
+
+		t.Log("TestMarkTodoAsCompletedFunctional passed")
 	})
+}
 
-	// Ensure the todo exists and is not completed
-	var todoBefore models.Todo
-	server.GET("/todos/4").
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&todoBefore)
-
-	assert.False(t, todoBefore.Completed)
-
-	// Perform the PATCH operation to mark the todo as completed
-	server.PATCH("/todos/4").
-		WithJSON(map[string]interface{}{"completed": true}).
-		Expect().
-		Status(200)
-
-	// Verify the todo is now marked as completed
-	var todoAfter models.Todo
-	server.GET("/todos/4").
-		Expect().
-		Status(200).
-		JSON().Object().
-		Decode(&todoAfter)
-
-	assert.True(t, todoAfter.Completed)
-
-	t.Log("TestMarkTodoAsCompletedFunctional passed")
+func TestRenderedNoteTaskListFunctional(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+
+		// Add a note containing a task list
+		note := server.POST("/todos/5/notes").
+			WithQuery("render", "html").
+			WithJSON(models.Note{Note: "- [ ] charger\n- [ ] passport\n<script>alert(1)</script>"}).
+			Expect().
+			Status(201).
+			JSON().Object()
+
+		note.Value("html").String().Contains(`<input disabled="" type="checkbox"> charger`)
+		note.Value("html").String().NotContains("<script")
+		noteID := int(note.Value("ID").Raw().(float64))
+
+		// Check the second task through the rendered-HTML endpoint
+		server.PATCH(fmt.Sprintf("/todos/5/notes/%d/tasks/1", noteID)).
+			WithJSON(map[string]interface{}{"checked": true}).
+			Expect().
+			Status(200).
+			JSON().Object().
+			Value("note").String().Contains("- [x] passport")
+
+		server.PATCH(fmt.Sprintf("/todos/5/notes/%d/tasks/7", noteID)).
+			WithJSON(map[string]interface{}{"checked": true}).
+			Expect().
+			Status(404)
+
+		// Notes are only rendered on request
+		server.GET("/todos/5").
+			Expect().
+			Status(200).
+			JSON().Object().
+			Value("notes").Array().Value(0).Object().NotContainsKey("html")
+
+		t.Log("TestRenderedNoteTaskListFunctional passed")
+	})
 }
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"my-go-project/health"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadinessChecks(t *testing.T) {
+	checker := health.New(50 * time.Millisecond)
+	var broken atomic.Bool
+	checker.Add("database", func(ctx context.Context) error {
+		if broken.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	report := checker.Ready(context.Background())
+	require.True(t, report.OK())
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+	assert.Equal(t, health.StatusOK, report.Checks["shutdown"].Status)
+
+	broken.Store(true)
+	report = checker.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, health.StatusFailing, report.Checks["database"].Status)
+	assert.Equal(t, "connection refused", report.Checks["database"].Error)
+
+	// A check that hangs, even ignoring its context, times out
+	broken.Store(false)
+	release := make(chan struct{})
+	defer close(release)
+	checker.Add("stuck", func(context.Context) error { <-release; return nil })
+	start := time.Now()
+	report = checker.Ready(context.Background())
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Contains(t, report.Checks["stuck"].Error, "timed out")
+	assert.Equal(t, health.StatusOK, report.Checks["database"].Status)
+}
+
+func TestReadinessDrainAndStartup(t *testing.T) {
+	checker := health.New(time.Second)
+	assert.True(t, checker.Live().OK())
+	assert.False(t, checker.Startup().OK())
+	checker.MarkStarted()
+	assert.True(t, checker.Startup().OK())
+
+	require.True(t, checker.Ready(context.Background()).OK())
+	checker.Drain()
+	report := checker.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, health.ErrDraining.Error(), report.Checks["shutdown"].Error)
+	assert.True(t, checker.Live().OK())
+}
+
+func TestReadinessHeartbeats(t *testing.T) {
+	checker := health.New(time.Second)
+	ctx := health.WithHeartbeat(context.Background(), checker.Heartbeat("sweeper", 20*time.Millisecond))
+	require.True(t, checker.Ready(context.Background()).OK())
+
+	// Two missed beats fail readiness, a beat restores it
+	time.Sleep(50 * time.Millisecond)
+	report := checker.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Contains(t, report.Checks["sweeper"].Error, "no heartbeat")
+	health.Beat(ctx)
+	assert.True(t, checker.Ready(context.Background()).OK())
+
+	// Beat without a heartbeat does nothing
+	health.Beat(context.Background())
+
+	stopped := checker.Heartbeat("scheduler", time.Hour)
+	stopped.Stop()
+	report = checker.Ready(context.Background())
+	assert.Equal(t, health.ErrStopped.Error(), report.Checks["scheduler"].Error)
+}
+
+func TestCachedCheck(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	check := health.Cached(time.Hour, func(context.Context) error {
+		calls.Add(1)
+		if fail.Load() {
+			return errors.New("pending")
+		}
+		return nil
+	})
+
+	// Failures are not remembered
+	fail.Store(true)
+	assert.Error(t, check(context.Background()))
+	assert.Error(t, check(context.Background()))
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Passes are
+	fail.Store(false)
+	assert.NoError(t, check(context.Background()))
+	fail.Store(true)
+	assert.NoError(t, check(context.Background()))
+	assert.Equal(t, int32(3), calls.Load())
+}
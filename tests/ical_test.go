@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"my-go-project/ical"
+	"my-go-project/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestICalRoundTrip(t *testing.T) {
+	due := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	todo := models.Todo{
+		UID:       "abc-123",
+		Subject:   "Water plants; the big ones, too",
+		DueDate:   models.NewDueDate(due, true),
+		Completed: true,
+		RRule:     "FREQ=WEEKLY;BYDAY=MO",
+		Notes:     []models.Note{{Note: strings.Repeat("Long note ", 20)}, {Note: "Second"}},
+	}
+	cal := ical.NewCalendar("Todos")
+	cal.Children = append(cal.Children, ical.TodoComponent(&todo), ical.EventComponent(&todo))
+
+	var buf bytes.Buffer
+	require.NoError(t, ical.Encode(&buf, cal))
+	out := buf.String()
+	assert.Contains(t, out, "DUE;VALUE=DATE:20240301\r\n")
+	assert.Contains(t, out, `SUMMARY:Water plants\; the big ones\, too`+"\r\n")
+	assert.Contains(t, out, "STATUS:COMPLETED\r\n")
+	assert.Contains(t, out, "DTEND;VALUE=DATE:20240302\r\n")
+	for _, line := range strings.Split(out, "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, "line not folded: %q", line)
+	}
+
+	decoded, err := ical.Decode(&buf)
+	require.NoError(t, err)
+	vtodos := decoded.Components("VTODO")
+	require.Len(t, vtodos, 1)
+	assert.Len(t, decoded.Components("VEVENT"), 1)
+
+	var imported models.Todo
+	description, err := ical.ApplyTodo(vtodos[0], &imported)
+	require.NoError(t, err)
+	assert.Equal(t, todo.UID, imported.UID)
+	assert.Equal(t, todo.Subject, imported.Subject)
+	assert.True(t, imported.DueDate.Equal(due))
+	assert.True(t, imported.Completed)
+	assert.Equal(t, todo.RRule, imported.RRule)
+	assert.Equal(t, ical.Description(&todo), description)
+}
+
+func TestICalParseTime(t *testing.T) {
+	input := "BEGIN:VTODO\nUID:x\nSUMMARY:Call\nDUE;TZID=Europe/Stockholm:20240601T090000\nEND:VTODO\n"
+	c, err := ical.Decode(strings.NewReader(input))
+	require.NoError(t, err)
+
+	var todo models.Todo
+	_, err = ical.ApplyTodo(c, &todo)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC), todo.DueDate.Time)
+	assert.False(t, todo.DueDate.DateOnly)
+	assert.False(t, todo.Completed)
+}
+
+func TestICalDecodeErrors(t *testing.T) {
+	for name, input := range map[string]string{
+		"unterminated": "BEGIN:VCALENDAR\nBEGIN:VTODO\nEND:VCALENDAR\n",
+		"no component": "SUMMARY:Orphan\n",
+		"malformed":    "BEGIN:VCALENDAR\nnonsense\nEND:VCALENDAR\n",
+	} {
+		_, err := ical.Decode(strings.NewReader(input))
+		assert.Error(t, err, name)
+	}
+
+	c, err := ical.Decode(strings.NewReader("BEGIN:VTODO\nSUMMARY:No UID\nEND:VTODO\n"))
+	require.NoError(t, err)
+	_, err = ical.ApplyTodo(c, &models.Todo{})
+	assert.Error(t, err)
+}
+
+func TestICalApplyCompletion(t *testing.T) {
+	apply := func(todo *models.Todo, properties string) {
+		c, err := ical.Decode(strings.NewReader("BEGIN:VTODO\nUID:x\nSUMMARY:Call\n" + properties + "END:VTODO\n"))
+		require.NoError(t, err)
+		_, err = ical.ApplyTodo(c, todo)
+		require.NoError(t, err)
+	}
+
+	// Completed without a COMPLETED time is stamped now, and keeps its stamp
+	var todo models.Todo
+	apply(&todo, "STATUS:COMPLETED\n")
+	require.NotNil(t, todo.CompletedAt)
+	assert.WithinDuration(t, time.Now(), *todo.CompletedAt, time.Minute)
+	stamped := *todo.CompletedAt
+	apply(&todo, "STATUS:COMPLETED\n")
+	assert.Equal(t, stamped, *todo.CompletedAt)
+
+	apply(&todo, "COMPLETED:20240601T090000Z\n")
+	assert.Equal(t, time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC), *todo.CompletedAt)
+
+	// Reopening clears it
+	apply(&todo, "STATUS:NEEDS-ACTION\n")
+	assert.False(t, todo.Completed)
+	assert.Nil(t, todo.CompletedAt)
+}
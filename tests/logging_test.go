@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"my-go-project/audit"
+	"my-go-project/config"
+	"my-go-project/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// logBuffer collects log lines written from any goroutine, the server's
+// included.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *logBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// captureLogs makes a JSON logger writing to the returned buffer the default
+// for the rest of the test.
+func captureLogs(t *testing.T, level string) *logBuffer {
+	buf := &logBuffer{}
+	previous := slog.Default()
+	logging.Init(config.Logging{Format: "json", Level: level}, buf)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return buf
+}
+
+// logLines decodes the JSON lines in buf.
+func logLines(t *testing.T, buf *logBuffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestParseLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelDebug, logging.ParseLevel("debug"))
+	assert.Equal(t, slog.LevelWarn, logging.ParseLevel("WARN"))
+	assert.Equal(t, slog.LevelError, logging.ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, logging.ParseLevel("info"))
+	assert.Equal(t, slog.LevelInfo, logging.ParseLevel(""))
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "mail a***@example.com now", logging.Redact("mail alice.smith@example.com now"))
+	assert.Equal(t, "postgres://app:[redacted]@db:5432/todos", logging.Redact("postgres://app:hunter2@db:5432/todos"))
+	assert.Equal(t, "nothing to hide", logging.Redact("nothing to hide"))
+}
+
+func TestLoggingRedactsAttributes(t *testing.T) {
+	buf := captureLogs(t, "info")
+
+	slog.Info("Signed up bob@example.com",
+		"password", "hunter2",
+		"api_token", "abc123",
+		"Authorization", "Bearer xyz",
+		"email", "bob@example.com",
+		"error", errors.New("dial postgres://app:hunter2@db/todos failed"),
+	)
+
+	lines := logLines(t, buf)
+	require.Len(t, lines, 1)
+	entry := lines[0]
+	assert.Equal(t, "Signed up b***@example.com", entry["msg"])
+	assert.Equal(t, config.Redacted, entry["password"])
+	assert.Equal(t, config.Redacted, entry["api_token"])
+	assert.Equal(t, config.Redacted, entry["Authorization"])
+	assert.Equal(t, "b***@example.com", entry["email"])
+	assert.Equal(t, "dial postgres://app:[redacted]@db/todos failed", entry["error"])
+	assert.NotContains(t, buf.String(), "hunter2")
+}
+
+func TestLoggingAddsContext(t *testing.T) {
+	buf := captureLogs(t, "info")
+
+	ctx := audit.WithRequestID(context.Background(), "req-42")
+	ctx = audit.WithActor(ctx, audit.Actor{ID: 1, Name: "Alice"})
+	slog.InfoContext(ctx, "Did something")
+	slog.Debug("Hidden below the level")
+
+	lines := logLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "req-42", lines[0]["request_id"])
+	assert.Equal(t, "Alice", lines[0]["user"])
+	assert.Equal(t, "INFO", lines[0]["level"])
+}
+
+func TestLoggingTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	log := logging.New(config.Logging{Format: "text", Level: "debug"}, &buf)
+
+	log.Debug("Plain text", "todo_id", 3)
+
+	assert.Contains(t, buf.String(), `level=DEBUG msg="Plain text" todo_id=3`)
+}
+
+func TestGormLogger(t *testing.T) {
+	buf := captureLogs(t, "debug")
+	ctx := audit.WithRequestID(context.Background(), "req-sql")
+	statement := func() (string, int64) { return `SELECT * FROM "users" WHERE email = $1`, 1 }
+
+	gormLogger := logging.NewGormLogger("warn", 100*time.Millisecond)
+	gormLogger.Trace(ctx, time.Now(), statement, nil)
+	gormLogger.Trace(ctx, time.Now().Add(-time.Second), statement, nil)
+	gormLogger.Trace(ctx, time.Now(), statement, errors.New("relation does not exist"))
+	gormLogger.Trace(ctx, time.Now(), statement, gorm.ErrRecordNotFound)
+
+	lines := logLines(t, buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "Slow statement", lines[0]["msg"])
+	assert.Equal(t, "WARN", lines[0]["level"])
+	assert.Equal(t, "req-sql", lines[0]["request_id"])
+	assert.Equal(t, "Statement failed", lines[1]["msg"])
+	assert.Equal(t, "relation does not exist", lines[1]["error"])
+
+	// Placeholders are logged, never the values
+	sql, params := gormLogger.ParamsFilter(ctx, `SELECT * FROM "users" WHERE email = $1`, "bob@example.com")
+	assert.Equal(t, `SELECT * FROM "users" WHERE email = $1`, sql)
+	assert.Nil(t, params)
+
+	// Every statement at info
+	buf.Reset()
+	gormLogger.LogMode(logger.Info).Trace(ctx, time.Now(), statement, nil)
+	lines = logLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "Statement", lines[0]["msg"])
+	assert.Equal(t, "DEBUG", lines[0]["level"])
+
+	// And none when silent
+	buf.Reset()
+	logging.NewGormLogger("silent", time.Millisecond).Trace(ctx, time.Now().Add(-time.Second), statement, errors.New("ignored"))
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"testing"
+
+	"my-go-project/markdown"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	html, err := markdown.Render("**bold** and `code`\n\n- [ ] open\n- [x] done\n")
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<strong>bold</strong>")
+	assert.Contains(t, html, "<code>code</code>")
+	assert.Contains(t, html, `<input disabled="" type="checkbox"> open`)
+	assert.Contains(t, html, `<input checked="" disabled="" type="checkbox"> done`)
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	html, err := markdown.Render("<b onclick=\"x()\">hi</b> <img src=x onerror=alert(1)> [link](javascript:alert(1)) [ok](https://example.com)\n\n<script>alert(1)</script>\n")
+	assert.NoError(t, err)
+	assert.NotContains(t, html, "<script")
+	assert.NotContains(t, html, "onclick")
+	assert.NotContains(t, html, "onerror")
+	assert.NotContains(t, html, "javascript:")
+	assert.Contains(t, html, `href="https://example.com"`)
+}
+
+func TestSetTask(t *testing.T) {
+	source := "Packing:\n\n- [ ] charger\n- [x] passport\n\n```\n- [ ] not a task\n```\n\n1. [ ] adapter\n"
+
+	updated, err := markdown.SetTask(source, 0, true)
+	assert.NoError(t, err)
+	assert.Contains(t, updated, "- [x] charger")
+
+	updated, err = markdown.SetTask(updated, 1, false)
+	assert.NoError(t, err)
+	assert.Contains(t, updated, "- [ ] passport")
+
+	// Checkboxes inside code blocks are not tasks
+	updated, err = markdown.SetTask(updated, 2, true)
+	assert.NoError(t, err)
+	assert.Contains(t, updated, "1. [x] adapter")
+	assert.Contains(t, updated, "- [ ] not a task")
+
+	_, err = markdown.SetTask(source, 3, true)
+	assert.ErrorIs(t, err, markdown.ErrTaskNotFound)
+}
+
+func TestMentions(t *testing.T) {
+	source := "@ada can you check this with @grace.hopper and @ada?\n\n" +
+		"Mail bob@example.com, not `@inline`:\n\n```\n@fenced\n```\n\n- ask @linus_t.\n"
+	assert.Equal(t, []string{"ada", "grace.hopper", "linus_t"}, markdown.Mentions(source))
+	assert.Empty(t, markdown.Mentions("no one here"))
+}
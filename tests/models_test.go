@@ -15,7 +15,7 @@ func TestTodoStruct(t *testing.T) {
 
 	todo := models.Todo{
 		Subject:   "Test Todo",
-		DueDate:   &dueDate,
+		DueDate:   models.NewDueDate(dueDate, true),
 		Completed: false,
 		Notes: []models.Note{
 			{Note: "First note"},
@@ -30,7 +30,7 @@ func TestTodoStruct(t *testing.T) {
 func assertTodo(t *testing.T, todo models.Todo, dueDate time.Time) {
 	assert.Equal(t, uint(0), todo.ID)
 	assert.Equal(t, "Test Todo", todo.Subject)
-	assert.Equal(t, dueDate, *todo.DueDate)
+	assert.Equal(t, dueDate, todo.DueDate.Time)
 	assert.Equal(t, false, todo.Completed)
 }
 
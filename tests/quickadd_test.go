@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/quickadd"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuickAddParse(t *testing.T) {
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	require.NoError(t, err)
+	// Wednesday morning
+	now := time.Date(2025, 3, 5, 10, 0, 0, 0, stockholm)
+
+	tests := []struct {
+		input    string
+		locale   *quickadd.Locale
+		subject  string
+		due      string // Date, or RFC 3339 in UTC when timed
+		rrule    string
+		priority int
+		tags     []string
+		list     string
+	}{
+		{input: "Pay rent every 1st of month !high #home", subject: "Pay rent", due: "2025-04-01", rrule: "FREQ=MONTHLY;BYMONTHDAY=1", priority: models.PriorityHigh, tags: []string{"home"}},
+		{input: "Call mom tomorrow 9am", subject: "Call mom", due: "2025-03-06T08:00:00Z"},
+		{input: "Send report next friday @work", subject: "Send report", due: "2025-03-07", list: "work"},
+		{input: "Book dentist in 3 days", subject: "Book dentist", due: "2025-03-08"},
+		{input: "Yoga every monday and thursday at 18", subject: "Yoga", due: "2025-03-06T17:00:00Z", rrule: "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{input: "Water plants every 2 weeks", subject: "Water plants", due: "2025-03-05", rrule: "FREQ=WEEKLY;INTERVAL=2"},
+		{input: "Lunch with Anna at noon", subject: "Lunch with Anna", due: "2025-03-05T11:00:00Z"},
+		{input: "Team call 9:30 am", subject: "Team call", due: "2025-03-06T08:30:00Z"},
+		{input: "Invoice on the 15th !!", subject: "Invoice", due: "2025-03-15", priority: models.PriorityMedium},
+		{input: "Tax return april 30 2026 #admin #money", subject: "Tax return", due: "2026-04-30", tags: []string{"admin", "money"}},
+		{input: "Review 2025-03-10", subject: "Review", due: "2025-03-10"},
+		{input: "Buy sun cream and 2 towels", subject: "Buy sun cream and 2 towels"},
+		{input: "tomorrow", subject: "tomorrow", due: "2025-03-06"},
+		{input: "Betala hyran varje månad den 25:e !hög #hem", locale: quickadd.Swedish, subject: "Betala hyran", due: "2025-03-25", rrule: "FREQ=MONTHLY;BYMONTHDAY=25", priority: models.PriorityHigh, tags: []string{"hem"}},
+		{input: "Ring mamma imorgon kl 9", locale: quickadd.Swedish, subject: "Ring mamma", due: "2025-03-06T08:00:00Z"},
+		{input: "Städa om 2 veckor @hemma", locale: quickadd.Swedish, subject: "Städa", due: "2025-03-19", list: "hemma"},
+	}
+	for _, tt := range tests {
+		result := quickadd.Parse(tt.input, quickadd.Options{Locale: tt.locale, Location: stockholm, Now: now})
+		assert.Equal(t, tt.subject, result.Subject, tt.input)
+		assert.Equal(t, tt.rrule, result.RRule, tt.input)
+		assert.Equal(t, tt.priority, result.Priority, tt.input)
+		assert.Equal(t, tt.list, result.List, tt.input)
+		if tt.tags == nil {
+			tt.tags = []string{}
+		}
+		assert.Equal(t, tt.tags, result.Tags, tt.input)
+
+		if tt.due == "" {
+			assert.Nil(t, result.DueDate, tt.input)
+			continue
+		}
+		require.NotNil(t, result.DueDate, tt.input)
+		assert.Equal(t, tt.due, result.DueDate.String(), tt.input)
+	}
+}
+
+func TestQuickAddSpans(t *testing.T) {
+	input := "Pay rent every 1st of month !high #home"
+	result := quickadd.Parse(input, quickadd.Options{Location: time.UTC, Now: time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC)})
+
+	require.Len(t, result.Spans, 3)
+	assert.Equal(t, quickadd.Span{Start: 9, End: 27, Kind: quickadd.KindRecurrence, Text: "every 1st of month", Value: "FREQ=MONTHLY;BYMONTHDAY=1"}, result.Spans[0])
+	assert.Equal(t, quickadd.Span{Start: 28, End: 33, Kind: quickadd.KindPriority, Text: "!high", Value: "high"}, result.Spans[1])
+	assert.Equal(t, quickadd.Span{Start: 34, End: 39, Kind: quickadd.KindTag, Text: "#home", Value: "home"}, result.Spans[2])
+
+	// Offsets count characters, and a filler word belongs to its span
+	result = quickadd.Parse("Fika på fredag", quickadd.Options{Locale: quickadd.Swedish, Location: time.UTC, Now: time.Date(2025, 3, 5, 10, 0, 0, 0, time.UTC)})
+	require.Len(t, result.Spans, 1)
+	assert.Equal(t, quickadd.Span{Start: 5, End: 14, Kind: quickadd.KindDate, Text: "på fredag", Value: "2025-03-07"}, result.Spans[0])
+}
+
+func TestQuickAddLookupLocale(t *testing.T) {
+	locale, ok := quickadd.LookupLocale("sv-SE,sv;q=0.9,en;q=0.8")
+	assert.True(t, ok)
+	assert.Equal(t, quickadd.Swedish, locale)
+
+	locale, ok = quickadd.LookupLocale("fr-FR, en-GB;q=0.5")
+	assert.True(t, ok)
+	assert.Equal(t, quickadd.English, locale)
+
+	_, ok = quickadd.LookupLocale("fr")
+	assert.False(t, ok)
+}
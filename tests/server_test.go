@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"my-go-project/health"
+	"my-go-project/routes"
+	"my-go-project/server"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowApp serves GET /slow, which takes delay; started is closed when the
+// request arrives and finished is set when it returns.
+func slowApp(delay time.Duration, started chan struct{}, finished *atomic.Bool) *fiber.App {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		close(started)
+		time.Sleep(delay)
+		finished.Store(true)
+		return c.SendString("done")
+	})
+	return app
+}
+
+func TestGracefulShutdownOnSignal(t *testing.T) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	started, finished := make(chan struct{}), &atomic.Bool{}
+	app := slowApp(300*time.Millisecond, started, finished)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	url := "http://" + ln.Addr().String() + "/slow"
+
+	workers := server.NewWorkers(nil)
+	workerStopped := make(chan struct{})
+	workers.Go("test worker", time.Second, func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, app, ln, server.Shutdown{Timeout: 5 * time.Second})
+	}()
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{resp.StatusCode, string(body), err}
+	}()
+
+	// Signal the process while the request is in flight
+	<-started
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(syscall.SIGTERM))
+
+	// The request finishes before the server returns, and nothing new is accepted
+	require.NoError(t, <-served)
+	assert.True(t, finished.Load())
+	r := <-response
+	require.NoError(t, r.err)
+	assert.Equal(t, 200, r.status)
+	assert.Equal(t, "done", r.body)
+	_, err = http.Get(url)
+	assert.Error(t, err)
+
+	// Workers are stopped after the server
+	select {
+	case <-workerStopped:
+		t.Fatal("worker stopped before the workers were")
+	default:
+	}
+	require.NoError(t, workers.Stop(time.Second))
+	<-workerStopped
+}
+
+func TestShutdownDeadlines(t *testing.T) {
+	started, finished := make(chan struct{}), &atomic.Bool{}
+	app := slowApp(2*time.Second, started, finished)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, app, ln, server.Shutdown{Timeout: 100 * time.Millisecond})
+	}()
+	go http.Get("http://" + ln.Addr().String() + "/slow")
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-served, server.ErrTimeout)
+	assert.False(t, finished.Load())
+
+	// A worker that ignores its context is given up on
+	workers := server.NewWorkers(nil)
+	release := make(chan struct{})
+	defer close(release)
+	workers.Go("stuck worker", time.Second, func(context.Context) { <-release })
+	assert.ErrorIs(t, workers.Stop(50*time.Millisecond), server.ErrTimeout)
+}
+
+func TestReadinessFailsBeforeListenerCloses(t *testing.T) {
+	checker := health.New(time.Second)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	routes.RegisterHealthRoutes(app, checker)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	base := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, app, ln, server.Shutdown{
+			Drain:   checker.Drain,
+			Delay:   300 * time.Millisecond,
+			Timeout: time.Second,
+		})
+	}()
+	probe := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	status := func(path string) int {
+		resp, err := probe.Get(base + path)
+		if err != nil {
+			return 0
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Eventually(t, func() bool { return status("/readyz") == 200 }, time.Second, 10*time.Millisecond)
+
+	// During the delay readiness fails but requests are still served
+	cancel()
+	require.Eventually(t, func() bool { return status("/readyz") == 503 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 200, status("/healthz"))
+
+	require.NoError(t, <-served)
+	_, err = probe.Get(base + "/healthz")
+	assert.Error(t, err)
+}
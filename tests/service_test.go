@@ -0,0 +1,297 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"my-go-project/filter"
+	"my-go-project/ical"
+	"my-go-project/markdown"
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTodoServiceOnMemory(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	todos := service.NewTodoService(repo, service.Ports{})
+
+	todo := models.Todo{Subject: "Write tests", Notes: []models.Note{{Note: "First"}}}
+	_, err := todos.Create(ctx, &todo, time.UTC)
+	require.NoError(t, err)
+	assert.NotZero(t, todo.ID)
+	assert.NotEmpty(t, todo.UID)
+	assert.NotZero(t, todo.Notes[0].ID)
+
+	// Copies are returned, so changing one leaves the repository alone
+	got, err := todos.Get(ctx, todo.ID)
+	require.NoError(t, err)
+	got.Subject = "Changed in place"
+	got, err = todos.Get(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Write tests", got.Subject)
+	assert.Len(t, got.Notes, 1)
+
+	// Completing stamps CompletedAt, keeps the UID and reports what changed
+	change, err := todos.Update(ctx, todo.ID, time.UTC, func(todo *models.Todo) error {
+		todo.Completed = true
+		todo.UID = "replaced"
+		todo.Notes = []models.Note{{Note: "Second"}}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Completed", "CompletedAt"}, change.Fields)
+	assert.False(t, change.Before.Completed)
+	assert.NotNil(t, change.After.CompletedAt)
+	got, err = todos.Get(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, todo.UID, got.UID)
+	assert.True(t, got.Completed)
+	assert.Len(t, got.Notes, 2)
+
+	// A failing patch stores nothing
+	_, err = todos.Update(ctx, todo.ID, time.UTC, func(todo *models.Todo) error {
+		todo.Subject = "Never stored"
+		return errors.New("bad body")
+	})
+	assert.EqualError(t, err, "bad body")
+	got, _ = todos.Get(ctx, todo.ID)
+	assert.Equal(t, "Write tests", got.Subject)
+
+	// Deleted todos are gone, and deleting them again finds nothing
+	deleted, err := todos.Delete(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, todo.ID, deleted.Before.ID)
+	_, err = todos.Get(ctx, todo.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = todos.Delete(ctx, todo.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = todos.Update(ctx, todo.ID, time.UTC, func(*models.Todo) error { return nil })
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestTodoServiceValidation(t *testing.T) {
+	ctx := context.Background()
+	todos := service.NewTodoService(repository.NewMemoryRepository(), service.Ports{})
+	var invalid *service.ValidationError
+
+	_, err := todos.Create(ctx, &models.Todo{Subject: "Long", Notes: []models.Note{{Note: strings.Repeat("x", models.MaxNoteLength+1)}}}, time.UTC)
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "note", invalid.Field)
+
+	_, err = todos.List(ctx, repository.TodoQuery{Due: "someday"})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "due", invalid.Field)
+
+	_, err = todos.List(ctx, repository.TodoQuery{Filter: "priority:"})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "filter", invalid.Field)
+	var filterErr *filter.Error
+	assert.ErrorAs(t, err, &filterErr)
+
+	// Queries that need the database
+	_, err = todos.List(ctx, repository.TodoQuery{Filter: "priority:high"})
+	assert.ErrorIs(t, err, repository.ErrUnsupported)
+	_, err = todos.List(ctx, repository.TodoQuery{Assignee: "alice"})
+	assert.ErrorIs(t, err, repository.ErrUnsupported)
+}
+
+func TestMemoryRepositoryQueries(t *testing.T) {
+	ctx := context.Background()
+	// A Wednesday
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	assignee := uint(7)
+	repo := repository.NewMemoryRepository(
+		models.Todo{Subject: "Overdue", DueDate: models.MustParseDueDate("2024-05-14")},
+		models.Todo{Subject: "Done late", Completed: true, DueDate: models.MustParseDueDate("2024-05-13")},
+		models.Todo{Subject: "Today", DueDate: models.MustParseDueDate("2024-05-15"), AssigneeID: &assignee},
+		models.Todo{Subject: "Due an hour ago", DueDate: models.NewDueDate(now.Add(-time.Hour), false)},
+		models.Todo{Subject: "Sunday", DueDate: models.MustParseDueDate("2024-05-19")},
+		models.Todo{Subject: "Next week", DueDate: models.MustParseDueDate("2024-05-20")},
+		models.Todo{Subject: "Someday"},
+	)
+	// Fixtures without IDs are numbered as they are created
+	require.NoError(t, repo.Create(ctx, &models.Todo{Subject: "Created"}))
+
+	subjects := func(query repository.TodoQuery) []string {
+		query.Options = filter.Options{Now: now, Location: time.UTC, UserID: assignee}
+		todos, err := repo.List(ctx, query)
+		require.NoError(t, err)
+		var subjects []string
+		for _, todo := range todos {
+			subjects = append(subjects, todo.Subject)
+		}
+		return subjects
+	}
+	assert.Equal(t, []string{"Overdue", "Due an hour ago"}, subjects(repository.TodoQuery{Due: "overdue"}))
+	assert.Equal(t, []string{"Today", "Due an hour ago"}, subjects(repository.TodoQuery{Due: "today"}))
+	assert.Equal(t, []string{"Overdue", "Done late", "Today", "Due an hour ago", "Sunday"}, subjects(repository.TodoQuery{Due: "week"}))
+	assert.Equal(t, []string{"Today"}, subjects(repository.TodoQuery{Assignee: "me"}))
+	assert.Len(t, subjects(repository.TodoQuery{Assignee: "none"}), 7)
+	assert.Len(t, subjects(repository.TodoQuery{}), 8)
+}
+
+func TestNoteServiceOnMemory(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	todo := models.Todo{Subject: "Pack"}
+	_, err := service.NewTodoService(repo, service.Ports{}).Create(ctx, &todo, time.UTC)
+	require.NoError(t, err)
+	notes := service.NewNoteService(repo, service.Ports{})
+
+	note := models.Note{Note: "- [ ] charger\n- [ ] passport"}
+	_, err = notes.Add(ctx, todo.ID, &note)
+	require.NoError(t, err)
+	assert.Equal(t, todo.ID, note.TodoID)
+	_, err = notes.Add(ctx, todo.ID+1, &models.Note{Note: "Nowhere"})
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	change, err := notes.SetTask(ctx, todo.ID, note.ID, 1, true)
+	require.NoError(t, err)
+	assert.Equal(t, note.Note, change.Before.Note)
+	assert.Equal(t, "- [ ] charger\n- [x] passport", change.After.Note)
+	stored, err := repo.Note(ctx, todo.ID, note.ID)
+	require.NoError(t, err)
+	assert.Equal(t, change.After.Note, stored.Note)
+
+	_, err = notes.SetTask(ctx, todo.ID, note.ID, 5, true)
+	assert.ErrorIs(t, err, markdown.ErrTaskNotFound)
+	_, err = notes.SetTask(ctx, todo.ID+1, note.ID, 0, true)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	deleted, err := notes.Delete(ctx, todo.ID, note.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, deleted)
+	deleted, err = notes.Delete(ctx, todo.ID, note.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deleted)
+}
+
+// recordingPorts stands in for every service port, noting what the services
+// asked of it. Users in users exist.
+type recordingPorts struct {
+	users    map[uint]bool
+	undone   []string
+	notified []string
+}
+
+func (p *recordingPorts) Record(ctx context.Context, action string, entity, before interface{}, fields ...string) (*models.UndoEntry, error) {
+	p.undone = append(p.undone, action)
+	return &models.UndoEntry{Token: action}, nil
+}
+
+func (p *recordingPorts) Assigned(ctx context.Context, todo *models.Todo) error {
+	p.notified = append(p.notified, fmt.Sprintf("assigned %d", *todo.AssigneeID))
+	return nil
+}
+
+func (p *recordingPorts) Mentioned(ctx context.Context, todo *models.Todo, note *models.Note) ([]uint, error) {
+	p.notified = append(p.notified, "mentioned")
+	return nil, nil
+}
+
+func (p *recordingPorts) Changed(ctx context.Context, todo *models.Todo, action string, skip ...uint) error {
+	p.notified = append(p.notified, action)
+	return nil
+}
+
+func (p *recordingPorts) UserExists(ctx context.Context, id uint) (bool, error) {
+	return p.users[id], nil
+}
+
+func TestServicePorts(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryRepository()
+	fake := &recordingPorts{users: map[uint]bool{7: true}}
+	ports := service.Ports{Undo: fake, Notifier: fake, Users: fake}
+	todos := service.NewTodoService(repo, ports)
+	notes := service.NewNoteService(repo, ports)
+	var invalid *service.ValidationError
+
+	nobody, assignee := uint(8), uint(7)
+	_, err := todos.Create(ctx, &models.Todo{Subject: "Nobody's", AssigneeID: &nobody}, time.UTC)
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "assignee", invalid.Field)
+
+	todo := models.Todo{Subject: "Assigned", AssigneeID: &assignee}
+	change, err := todos.Create(ctx, &todo, time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, models.ActionCreate, change.Undo.Token)
+
+	change, err = todos.Update(ctx, todo.ID, time.UTC, func(todo *models.Todo) error {
+		todo.Completed = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.ActionUpdate, change.Undo.Token)
+
+	// Updates that change nothing are neither undoable nor news
+	change, err = todos.Update(ctx, todo.ID, time.UTC, func(*models.Todo) error { return nil })
+	require.NoError(t, err)
+	assert.Nil(t, change.Undo)
+
+	_, err = todos.Update(ctx, todo.ID, time.UTC, func(todo *models.Todo) error {
+		todo.AssigneeID = &nobody
+		return nil
+	})
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "assignee", invalid.Field)
+
+	_, err = notes.Add(ctx, todo.ID, &models.Note{Note: "Done"})
+	require.NoError(t, err)
+	_, err = todos.Delete(ctx, todo.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{models.ActionCreate, models.ActionUpdate, models.ActionCreate, models.ActionDelete}, fake.undone)
+	assert.Equal(t, []string{"assigned 7", "completed", "mentioned", "added a note to", "deleted"}, fake.notified)
+}
+
+func TestSaveVTodoOnMemory(t *testing.T) {
+	ctx := context.Background()
+	todos := service.NewTodoService(repository.NewMemoryRepository(), service.Ports{})
+	vtodo := func(summary, description string) *ical.Component {
+		cal, err := ical.Decode(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Tests//EN\r\n" +
+			"BEGIN:VTODO\r\nUID:synced@example.com\r\nSUMMARY:" + summary + "\r\nDESCRIPTION:" + description + "\r\n" +
+			"END:VTODO\r\nEND:VCALENDAR\r\n"))
+		require.NoError(t, err)
+		return cal.Components("VTODO")[0]
+	}
+
+	list := "Home"
+	todo, created, err := todos.SaveVTodo(ctx, vtodo("Sync me", "First"), &list)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "synced@example.com", todo.UID)
+	assert.Equal(t, "Home", todo.List)
+
+	// A deleted todo comes back, its notes replaced by the new description
+	_, err = todos.Delete(ctx, todo.ID)
+	require.NoError(t, err)
+	again, created, err := todos.SaveVTodo(ctx, vtodo("Synced", "Second"), nil)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, todo.ID, again.ID)
+	got, err := todos.Get(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Synced", got.Subject)
+	assert.Equal(t, "Home", got.List)
+	require.Len(t, got.Notes, 1)
+	assert.Equal(t, "Second", got.Notes[0].Note)
+
+	// Too long a description stores nothing
+	_, _, err = todos.SaveVTodo(ctx, vtodo("Too long", strings.Repeat("x", models.MaxNoteLength+1)), nil)
+	var invalid *service.ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "note", invalid.Field)
+	got, err = todos.Get(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Synced", got.Subject)
+}
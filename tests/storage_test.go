@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"my-go-project/storage"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	assertBlobStore(t, store)
+
+	err = store.Put(context.Background(), "../escape", strings.NewReader("x"), 1, "text/plain")
+	assert.Error(t, err)
+}
+
+func TestS3BlobStore(t *testing.T) {
+	// An in-process S3 stand-in, so no MinIO server is needed
+	server := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	defer server.Close()
+
+	store, err := storage.NewS3Store(storage.S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    "attachments",
+		AccessKey: "test",
+		SecretKey: "test",
+	})
+	require.NoError(t, err)
+	assertBlobStore(t, store)
+}
+
+func assertBlobStore(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+	content := "hello, attachment"
+
+	err := store.Put(ctx, "todos/1/blob", strings.NewReader(content), int64(len(content)), "text/plain")
+	require.NoError(t, err)
+
+	blob, err := store.Open(ctx, "todos/1/blob")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), blob.Size())
+
+	// Blobs are seekable so downloads can serve byte ranges
+	_, err = blob.Seek(7, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	assert.Equal(t, "attachment", string(rest))
+	require.NoError(t, blob.Close())
+
+	require.NoError(t, store.Delete(ctx, "todos/1/blob"))
+	_, err = store.Open(ctx, "todos/1/blob")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Deleting a missing blob is not an error
+	assert.NoError(t, store.Delete(ctx, "todos/1/blob"))
+}
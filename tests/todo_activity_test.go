@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"my-go-project/audit"
+	"my-go-project/models"
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityLogFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	todoID := int(server.POST("/todos").
+		WithHeader(routes.UserHeader, "alice").
+		WithHeader("X-Request-ID", "req-create").
+		WithJSON(models.Todo{Subject: "Audited"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+
+	server.PATCH(fmt.Sprintf("/todos/%d", todoID)).
+		WithHeader(routes.UserHeader, "bob").
+		WithJSON(map[string]interface{}{"subject": "Audited and renamed", "completed": true}).
+		Expect().
+		Status(200)
+
+	noteID := int(server.POST(fmt.Sprintf("/todos/%d/notes", todoID)).
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(models.Note{Note: "A note"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+
+	server.DELETE(fmt.Sprintf("/todos/%d/notes/%d", todoID, noteID)).
+		WithHeader(routes.UserHeader, "bob").
+		Expect().
+		Status(204)
+
+	server.DELETE(fmt.Sprintf("/todos/%d", todoID)).
+		WithHeader(routes.UserHeader, "bob").
+		WithHeader("X-Request-ID", "req-delete").
+		Expect().
+		Status(204)
+
+	var activities []models.Activity
+	server.GET(fmt.Sprintf("/todos/%d/activity", todoID)).
+		Expect().
+		Status(200).
+		JSON().Decode(&activities)
+
+	// Newest first
+	require.Len(t, activities, 5)
+	expected := []struct{ action, entity, actor string }{
+		{models.ActionDelete, "Todo", "bob"},
+		{models.ActionDelete, "Note", "bob"},
+		{models.ActionCreate, "Note", "alice"},
+		{models.ActionUpdate, "Todo", "bob"},
+		{models.ActionCreate, "Todo", "alice"},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.action, activities[i].Action)
+		assert.Equal(t, e.entity, activities[i].EntityType)
+		assert.Equal(t, e.actor, activities[i].Actor)
+		assert.Equal(t, uint(todoID), *activities[i].TodoID)
+	}
+
+	assert.Equal(t, "req-create", activities[4].RequestID)
+	assert.Equal(t, "Audited", activities[4].Changes["subject"].After)
+	assert.Equal(t, "req-delete", activities[0].RequestID)
+
+	// Updates record only the fields that changed
+	update := activities[3].Changes
+	assert.Len(t, update, 3)
+	assert.Equal(t, "Audited", update["subject"].Before)
+	assert.Equal(t, "Audited and renamed", update["subject"].After)
+	assert.Contains(t, update, "completed")
+	assert.Contains(t, update, "completed_at")
+
+	server.GET("/activity").
+		WithQuery("actor", "bob").
+		WithQuery("action", "delete").
+		WithQuery("entity_type", "Note").
+		Expect().
+		Status(200).
+		JSON().Array().Value(0).Object().Value("entity_id").IsEqual(noteID)
+
+	server.GET("/activity").
+		WithQuery("since", "not a time").
+		Expect().
+		Status(400)
+
+	t.Log("TestActivityLogFunctional passed")
+}
+
+func TestActivityRetention(t *testing.T) {
+	old := models.Activity{Action: models.ActionCreate, EntityType: "Todo", EntityID: 1, CreatedAt: time.Now().AddDate(-2, 0, 0)}
+	require.NoError(t, db.Create(&old).Error)
+
+	removed, err := audit.Prune(context.Background(), db, time.Now().AddDate(-1, 0, 0))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, removed, int64(1))
+	assert.Error(t, db.First(&models.Activity{}, old.ID).Error)
+}
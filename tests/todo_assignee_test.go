@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"testing"
+
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssigneesAndNotificationsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	userID := func(username string) int {
+		return int(server.GET("/me").
+			WithHeader(routes.UserHeader, username).
+			Expect().
+			Status(200).
+			JSON().Object().Value("ID").Raw().(float64))
+	}
+	type notification struct {
+		ID      int     `json:"id"`
+		Kind    string  `json:"kind"`
+		TodoID  int     `json:"todo_id"`
+		Actor   string  `json:"actor"`
+		Message string  `json:"message"`
+		ReadAt  *string `json:"read_at"`
+	}
+	inbox := func(username string) []notification {
+		var notifications []notification
+		server.GET("/notifications").
+			WithHeader(routes.UserHeader, username).
+			Expect().
+			Status(200).
+			JSON().Decode(&notifications)
+		return notifications
+	}
+	ada, grace := userID("ada"), userID("grace")
+	userID("linus")
+
+	// Assigning a todo notifies the assignee, but not the user who assigned it
+	todo := server.POST("/todos").
+		WithHeader(routes.UserHeader, "ada").
+		WithJSON(map[string]interface{}{"subject": "Write the release notes", "assignee_id": grace}).
+		Expect().
+		Status(201).
+		JSON().Object()
+	todo.HasValue("assignee_id", grace)
+	id := int(todo.Value("ID").Raw().(float64))
+
+	notifications := inbox("grace")
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "assigned", notifications[0].Kind)
+	assert.Equal(t, id, notifications[0].TodoID)
+	assert.Equal(t, "ada", notifications[0].Actor)
+	assert.Equal(t, "ada assigned you “Write the release notes”", notifications[0].Message)
+	assert.Empty(t, inbox("ada"))
+
+	server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Nobody's", "assignee_id": 999999}).
+		Expect().
+		Status(400).
+		JSON().Object().HasValue("error", "Invalid assignee")
+
+	// ?assignee= and the filter language select by assignee
+	var todos []struct {
+		ID int `json:"ID"`
+	}
+	server.GET("/todos").
+		WithQuery("assignee", "me").
+		WithHeader(routes.UserHeader, "grace").
+		Expect().
+		Status(200).
+		JSON().Decode(&todos)
+	require.Len(t, todos, 1)
+	assert.Equal(t, id, todos[0].ID)
+	server.GET("/todos").
+		WithQuery("assignee", "grace").
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(1)
+	server.GET("/todos").
+		WithQuery("filter", "assignee:me").
+		WithHeader(routes.UserHeader, "ada").
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(0)
+	server.GET("/todos").
+		WithQuery("assignee", "me").
+		Expect().
+		Status(401)
+
+	// Mentions notify the users mentioned, who start watching the todo; the
+	// assignee, already watching, hears that a note was added
+	server.POST("/todos/{id}/notes", id).
+		WithHeader(routes.UserHeader, "ada").
+		WithJSON(map[string]string{"note": "@linus can you review? cc @nobody, not `@grace`"}).
+		Expect().
+		Status(201)
+	notifications = inbox("linus")
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "mentioned", notifications[0].Kind)
+	assert.Equal(t, "ada mentioned you on “Write the release notes”", notifications[0].Message)
+	notifications = inbox("grace")
+	require.Len(t, notifications, 2)
+	assert.Equal(t, "changed", notifications[0].Kind)
+	assert.Equal(t, "ada added a note to “Write the release notes”", notifications[0].Message)
+
+	var watchers []struct {
+		Username string `json:"username"`
+	}
+	server.GET("/todos/{id}/watchers", id).
+		Expect().
+		Status(200).
+		JSON().Decode(&watchers)
+	require.Len(t, watchers, 2)
+	assert.Equal(t, "grace", watchers[0].Username)
+	assert.Equal(t, "linus", watchers[1].Username)
+
+	// Changes notify the watchers but the user who made them
+	server.PUT("/todos/{id}/watchers/me", id).
+		WithHeader(routes.UserHeader, "ada").
+		Expect().
+		Status(204)
+	server.DELETE("/todos/{id}/watchers/me", id).
+		WithHeader(routes.UserHeader, "linus").
+		Expect().
+		Status(204)
+	server.PATCH("/todos/{id}", id).
+		WithHeader(routes.UserHeader, "grace").
+		WithJSON(map[string]interface{}{"completed": true, "priority": 2}).
+		Expect().
+		Status(200)
+	notifications = inbox("ada")
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "grace completed and changed the priority of “Write the release notes”", notifications[0].Message)
+	assert.Len(t, inbox("linus"), 1)
+	assert.Len(t, inbox("grace"), 2)
+
+	// Reassigning tells the new assignee, who is not also told of the change
+	server.PATCH("/todos/{id}", id).
+		WithHeader(routes.UserHeader, "grace").
+		WithJSON(map[string]interface{}{"assignee_id": ada}).
+		Expect().
+		Status(200).
+		JSON().Object().HasValue("assignee_id", ada)
+	notifications = inbox("ada")
+	require.Len(t, notifications, 2)
+	assert.Equal(t, "assigned", notifications[0].Kind)
+
+	// Read and unread
+	server.GET("/notifications").
+		WithHeader(routes.UserHeader, "ada").
+		Expect().
+		Header(routes.UnreadCountHeader).IsEqual("2")
+	server.PATCH("/notifications/{id}", notifications[0].ID).
+		WithHeader(routes.UserHeader, "ada").
+		WithJSON(map[string]bool{"read": true}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("read_at").NotNull()
+	server.PATCH("/notifications/{id}", notifications[0].ID).
+		WithHeader(routes.UserHeader, "grace").
+		WithJSON(map[string]bool{"read": true}).
+		Expect().
+		Status(404)
+	server.GET("/notifications").
+		WithQuery("unread", "true").
+		WithHeader(routes.UserHeader, "ada").
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(1)
+	server.PATCH("/notifications/{id}", notifications[0].ID).
+		WithHeader(routes.UserHeader, "ada").
+		WithJSON(map[string]bool{"read": false}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("read_at").IsNull()
+	server.POST("/notifications/read").
+		WithHeader(routes.UserHeader, "ada").
+		Expect().
+		Status(200).
+		JSON().Object().HasValue("marked", 2)
+	server.GET("/notifications").
+		WithHeader(routes.UserHeader, "ada").
+		Expect().
+		Header(routes.UnreadCountHeader).IsEqual("0")
+	server.GET("/notifications").Expect().Status(401)
+
+	// Statistics break down by assignee
+	server.GET("/stats").
+		WithQuery("group_by", "assignee").
+		Expect().
+		Status(200).
+		JSON().Object().Value("groups").Array().Filter(func(_ int, group *httpexpect.Value) bool {
+		return group.Object().Value("key").Raw() == "ada"
+	}).Length().IsEqual(1)
+}
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"my-go-project/models"
+	"my-go-project/repository"
+	"my-go-project/routes"
+	"my-go-project/service"
+	"my-go-project/storage"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newAttachmentServer(t *testing.T, limits routes.AttachmentLimits) (*httpexpect.Expect, storage.BlobStore) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+
+	attachmentApp := fiber.New()
+	todoRepo := repository.NewGormRepository(db)
+	routes.RegisterTodoRoutes(attachmentApp, service.NewTodoService(todoRepo, gormPorts(todoRepo)), service.NewNoteService(todoRepo, gormPorts(todoRepo)))
+	routes.RegisterAttachmentRoutes(attachmentApp, db, store, limits)
+
+	return httpexpect.WithConfig(httpexpect.Config{
+		Client:   &http.Client{Transport: &fiberTransport{app: attachmentApp}},
+		Reporter: httpexpect.NewRequireReporter(t),
+	}), store
+}
+
+func pngBytes(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, x%height, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestAttachmentUploadAndDownloadFunctional(t *testing.T) {
+	server, _ := newAttachmentServer(t, routes.AttachmentLimits{MaxFileSize: 1 << 20})
+
+	content := []byte("%PDF-1.4\nnot really a pdf, but it sniffs like one\n")
+	attachment := server.POST("/todos/1/attachments").
+		WithMultipart().
+		WithFileBytes("file", "../../report.pdf", content).
+		Expect().
+		Status(201).
+		JSON().Object()
+
+	attachment.Value("filename").IsEqual("report.pdf")
+	attachment.Value("content_type").IsEqual("application/pdf")
+	attachment.Value("size").IsEqual(len(content))
+	attachment.Value("sha256").String().Length().IsEqual(64)
+	attachment.Value("has_thumbnail").IsEqual(false)
+	attachmentID := int(attachment.Value("ID").Raw().(float64))
+	url := fmt.Sprintf("/todos/1/attachments/%d", attachmentID)
+
+	server.GET(url).
+		Expect().
+		Status(200).
+		Header("Accept-Ranges").IsEqual("bytes")
+	server.GET(url).
+		Expect().
+		Body().IsEqual(string(content))
+
+	// Range requests return only the requested bytes
+	response := server.GET(url).
+		WithHeader("Range", "bytes=0-7").
+		Expect().
+		Status(206)
+	response.Header("Content-Range").IsEqual(fmt.Sprintf("bytes 0-7/%d", len(content)))
+	response.Body().IsEqual("%PDF-1.4")
+
+	server.GET(url).
+		WithHeader("Range", "bytes=9999-").
+		Expect().
+		Status(416)
+
+	server.GET("/todos/1/attachments").
+		Expect().
+		Status(200).
+		JSON().Array().NotEmpty()
+
+	server.DELETE(url).
+		Expect().
+		Status(204)
+	server.GET(url).
+		Expect().
+		Status(404)
+
+	t.Log("TestAttachmentUploadAndDownloadFunctional passed")
+}
+
+func TestAttachmentThumbnailFunctional(t *testing.T) {
+	server, _ := newAttachmentServer(t, routes.AttachmentLimits{})
+
+	attachment := server.POST("/todos/1/attachments").
+		WithMultipart().
+		WithFileBytes("file", "screenshot.png", pngBytes(t, 1024, 512)).
+		Expect().
+		Status(201).
+		JSON().Object()
+	attachment.Value("content_type").IsEqual("image/png")
+	attachment.Value("has_thumbnail").IsEqual(true)
+	attachmentID := int(attachment.Value("ID").Raw().(float64))
+
+	body := server.GET(fmt.Sprintf("/todos/1/attachments/%d/thumbnail", attachmentID)).
+		Expect().
+		Status(200).
+		Body().Raw()
+	thumb, err := png.Decode(bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(256, 128), thumb.Bounds().Size())
+
+	t.Log("TestAttachmentThumbnailFunctional passed")
+}
+
+func TestAttachmentQuotaFunctional(t *testing.T) {
+	server, _ := newAttachmentServer(t, routes.AttachmentLimits{MaxFileSize: 64, UserQuota: 100})
+
+	server.POST("/todos/1/attachments").
+		WithHeader(routes.UserHeader, "quota-user").
+		WithMultipart().
+		WithFileBytes("file", "big.txt", bytes.Repeat([]byte("x"), 65)).
+		Expect().
+		Status(413)
+
+	server.POST("/todos/1/attachments").
+		WithHeader(routes.UserHeader, "quota-user").
+		WithMultipart().
+		WithFileBytes("file", "first.txt", bytes.Repeat([]byte("x"), 60)).
+		Expect().
+		Status(201).
+		JSON().Object().Value("uploader_id").Number().Gt(0)
+
+	// The second upload would take the user over their quota
+	server.POST("/todos/1/attachments").
+		WithHeader(routes.UserHeader, "quota-user").
+		WithMultipart().
+		WithFileBytes("file", "second.txt", bytes.Repeat([]byte("x"), 60)).
+		Expect().
+		Status(413)
+
+	// Other users have their own allowance
+	server.POST("/todos/1/attachments").
+		WithHeader(routes.UserHeader, "other-user").
+		WithMultipart().
+		WithFileBytes("file", "second.txt", bytes.Repeat([]byte("x"), 60)).
+		Expect().
+		Status(201)
+
+	t.Log("TestAttachmentQuotaFunctional passed")
+}
+
+func TestHardDeleteTodoRemovesBlobsFunctional(t *testing.T) {
+	server, store := newAttachmentServer(t, routes.AttachmentLimits{})
+
+	todoID := int(server.POST("/todos").
+		WithJSON(models.Todo{Subject: "Todo with attachment"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+
+	attachmentID := int(server.POST(fmt.Sprintf("/todos/%d/attachments", todoID)).
+		WithMultipart().
+		WithFileBytes("file", "photo.png", pngBytes(t, 16, 16)).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+
+	var attachment models.Attachment
+	require.NoError(t, db.First(&attachment, attachmentID).Error)
+
+	server.DELETE(fmt.Sprintf("/todos/%d", todoID)).
+		WithQuery("hard", "true").
+		Expect().
+		Status(204)
+	require.NoError(t, storage.Sweep(context.Background(), db, store))
+
+	assert.ErrorIs(t, db.Unscoped().First(&models.Todo{}, todoID).Error, gorm.ErrRecordNotFound)
+	_, err := store.Open(context.Background(), attachment.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = store.Open(context.Background(), attachment.ThumbnailKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	t.Log("TestHardDeleteTodoRemovesBlobsFunctional passed")
+}
@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"my-go-project/models"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// davStep replays one recorded client request from testdata/caldav and
+// checks the response.
+type davStep struct {
+	file        string
+	status      int
+	contains    []string
+	notContains []string
+	headers     map[string]string
+}
+
+var syncTokenPattern = regexp.MustCompile(`<D:sync-token>([^<]*)</D:sync-token>`)
+
+// readRecordedRequest parses a request recorded as plain HTTP/1.1 text,
+// replacing {{name}} placeholders with values captured from earlier responses.
+func readRecordedRequest(t *testing.T, file string, vars map[string]string) *http.Request {
+	raw, err := os.ReadFile(filepath.Join("testdata", "caldav", file))
+	require.NoError(t, err)
+	text := string(raw)
+	for name, value := range vars {
+		text = strings.ReplaceAll(text, "{{"+name+"}}", value)
+	}
+
+	head, body, _ := strings.Cut(strings.TrimRight(text, "\n")+"\n", "\n\n")
+	head = strings.TrimRight(head, "\n")
+	lines := strings.Split(head, "\n")
+	requestLine := strings.Fields(lines[0])
+	require.Len(t, requestLine, 3, "request line of %s", file)
+
+	// iCalendar bodies need CRLF line endings
+	if strings.HasPrefix(body, "BEGIN:") {
+		body = strings.ReplaceAll(body, "\n", "\r\n")
+	}
+	req, err := http.NewRequest(requestLine[0], "http://localhost"+requestLine[1], strings.NewReader(body))
+	require.NoError(t, err)
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		require.True(t, ok, "header line %q of %s", line, file)
+		req.Header.Set(name, strings.TrimSpace(value))
+	}
+	return req
+}
+
+func TestCalDAVRecordedClientsFunctional(t *testing.T) {
+	href := "/dav/calendars/todos/0b7c5e9a-tb-0001.ics"
+	steps := []davStep{
+		{file: "01-options.http", status: 200, headers: map[string]string{"DAV": "1, 3, calendar-access"}},
+		{file: "02-well-known.http", status: 301, headers: map[string]string{"Location": "/dav/"}},
+		{file: "03-propfind-root.http", status: 207, contains: []string{
+			"<D:current-user-principal><D:href>/dav/principal/</D:href></D:current-user-principal>",
+			"<C:calendar-home-set><D:href>/dav/calendars/</D:href></C:calendar-home-set>",
+		}},
+		{file: "04-propfind-principal.http", status: 207, contains: []string{
+			"<C:calendar-home-set><D:href>/dav/calendars/</D:href></C:calendar-home-set>",
+			"<C:calendar-user-address-set/></D:prop><D:status>HTTP/1.1 404 Not Found</D:status>",
+		}},
+		{file: "05-propfind-home.http", status: 207, contains: []string{
+			"<D:href>/dav/calendars/todos/</D:href>",
+			"<D:resourcetype><D:collection/><C:calendar/></D:resourcetype>",
+			`<C:supported-calendar-component-set><C:comp name="VTODO"/></C:supported-calendar-component-set>`,
+			"<CS:getctag>urn:my-go-project:sync:",
+			"<D:privilege><D:write/></D:privilege>",
+		}},
+		{file: "06-sync-initial.http", status: 207, contains: []string{"<D:getetag>"}},
+		{file: "07-put-new.http", status: 201},
+		{file: "08-put-new-again.http", status: 412},
+		{file: "09-get.http", status: 200, contains: []string{
+			"UID:0b7c5e9a-tb-0001\r\n",
+			"SUMMARY:Buy milk\r\n",
+			"DUE:20250115T170000Z\r\n",
+			`DESCRIPTION:Two litres\, organic`,
+		}, headers: map[string]string{"ETag": "{{etag}}"}},
+		{file: "10-multiget.http", status: 207, contains: []string{
+			"<D:href>" + href + "</D:href>",
+			"<C:calendar-data>BEGIN:VCALENDAR&#xD;\n",
+			"SUMMARY:Buy milk",
+			"<D:href>/dav/calendars/todos/missing.ics</D:href><D:status>HTTP/1.1 404 Not Found</D:status>",
+		}},
+		{file: "11-query-open.http", status: 207, contains: []string{href}},
+		{file: "12-sync-changes.http", status: 207, contains: []string{href}, notContains: []string{"404 Not Found"}},
+		{file: "13-put-stale.http", status: 412},
+		{file: "14-put-complete.http", status: 204},
+		{file: "15-query-open-again.http", status: 207, notContains: []string{href}},
+		{file: "16-delete.http", status: 204},
+		{file: "17-get-deleted.http", status: 404},
+		{file: "18-sync-deletion.http", status: 207, contains: []string{
+			"<D:href>" + href + "</D:href><D:status>HTTP/1.1 404 Not Found</D:status>",
+		}},
+		{file: "19-sync-invalid-token.http", status: 403, contains: []string{"<D:valid-sync-token/>"}},
+		{file: "20-proppatch.http", status: 207, contains: []string{
+			"<D:displayname/></D:prop><D:status>HTTP/1.1 403 Forbidden</D:status>",
+		}},
+		{file: "21-put-event.http", status: 403, contains: []string{"<C:supported-calendar-component/>"}},
+	}
+
+	vars := map[string]string{}
+	for _, step := range steps {
+		resp, err := client.Transport.RoundTrip(readRecordedRequest(t, step.file, vars)) // Redirects are checked, not followed
+		require.NoError(t, err, step.file)
+		raw, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, step.file)
+		body := string(raw)
+
+		require.Equal(t, step.status, resp.StatusCode, "%s: %s", step.file, body)
+		for _, s := range step.contains {
+			assert.Contains(t, body, s, step.file)
+		}
+		for _, s := range step.notContains {
+			assert.NotContains(t, body, s, step.file)
+		}
+		for name, value := range step.headers {
+			assert.Equal(t, strings.ReplaceAll(value, "{{etag}}", vars["etag"]), resp.Header.Get(name), step.file)
+		}
+
+		// Clients remember the latest ETag and sync token they were given
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			vars["etag"] = etag
+		}
+		if strings.Contains(step.file, "sync") {
+			if tokens := syncTokenPattern.FindAllStringSubmatch(body, -1); len(tokens) > 0 {
+				vars["sync-token"] = tokens[len(tokens)-1][1]
+			}
+		}
+	}
+
+	t.Log("TestCalDAVRecordedClientsFunctional passed")
+}
+
+func TestCalDAVListCollectionsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	vtodo := func(uid, summary string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VTODO\r\nUID:" + uid +
+			"\r\nSUMMARY:" + summary + "\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	}
+
+	todo := server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Repot the fern", "list": "Garden & Yard"}).
+		Expect().
+		Status(201).
+		JSON().Object()
+	uid := todo.Value("uid").String().Raw()
+	collection := "/dav/calendars/list-Garden%20&amp;%20Yard/" // As it appears in XML
+	path := "/dav/calendars/list-Garden & Yard/"               // httpexpect escapes paths itself
+
+	// Every list is a collection of its own in the calendar home
+	home := server.Request("PROPFIND", "/dav/calendars/").
+		WithHeader("Depth", "1").
+		Expect().
+		Status(207).
+		Body().Raw()
+	assert.Contains(t, home, "<D:href>/dav/calendars/todos/</D:href>")
+	assert.Contains(t, home, "<D:href>"+collection+"</D:href>")
+	assert.Contains(t, home, "<D:displayname>Garden &amp; Yard</D:displayname>")
+
+	listing := server.Request("PROPFIND", path).
+		WithHeader("Depth", "1").
+		Expect().
+		Status(207).
+		Body().Raw()
+	assert.Contains(t, listing, collection+uid+".ics")
+	assert.NotContains(t, server.Request("PROPFIND", "/dav/calendars/todos/").
+		WithHeader("Depth", "1").
+		Expect().
+		Status(207).
+		Body().Raw(), uid)
+
+	// Todos are only found in their own list's collection
+	server.GET(path + uid + ".ics").
+		Expect().
+		Status(200).
+		Body().Contains("SUMMARY:Repot the fern")
+	server.GET("/dav/calendars/todos/" + uid + ".ics").
+		Expect().
+		Status(404)
+
+	// A PUT files the todo under the collection's list, moving it there
+	server.PUT("/dav/calendars/list-Errands/errand-0001.ics").
+		WithHeader("Content-Type", "text/calendar").
+		WithText(vtodo("errand-0001", "Post the parcel")).
+		Expect().
+		Status(201)
+	var errand models.Todo
+	assert.NoError(t, db.Where("uid = ?", "errand-0001").First(&errand).Error)
+	assert.Equal(t, "Errands", errand.List)
+
+	server.PUT("/dav/calendars/todos/"+uid+".ics").
+		WithHeader("Content-Type", "text/calendar").
+		WithText(vtodo(uid, "Repot the fern")).
+		Expect().
+		Status(201)
+	server.GET(path + uid + ".ics").
+		Expect().
+		Status(404)
+	server.GET("/todos/" + fmt.Sprint(todo.Value("ID").Number().Raw())).
+		Expect().
+		Status(200).
+		JSON().Object().NotContainsKey("list")
+
+	server.GET("/dav/calendars/elsewhere/").
+		Expect().
+		Status(404)
+}
+
+func TestCalDAVCompletionFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	put := func(status string, code int) {
+		server.PUT("/dav/calendars/todos/completion-0001.ics").
+			WithHeader("Content-Type", "text/calendar").
+			WithText("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\nBEGIN:VTODO\r\nUID:completion-0001\r\n" +
+				"SUMMARY:Renew the passport\r\nSTATUS:" + status + "\r\nEND:VTODO\r\nEND:VCALENDAR\r\n").
+			Expect().
+			Status(code)
+	}
+	stored := func() models.Todo {
+		var todo models.Todo
+		require.NoError(t, db.Where("uid = ?", "completion-0001").First(&todo).Error)
+		return todo
+	}
+
+	// Completion times are kept for the stats, however the todo was completed
+	put("COMPLETED", http.StatusCreated)
+	todo := stored()
+	assert.True(t, todo.Completed)
+	assert.NotNil(t, todo.CompletedAt)
+
+	put("NEEDS-ACTION", http.StatusNoContent)
+	todo = stored()
+	assert.False(t, todo.Completed)
+	assert.Nil(t, todo.CompletedAt)
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"my-go-project/models"
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarFeedFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	server.POST("/calendar/token").
+		Expect().
+		Status(401)
+
+	url := server.POST("/calendar/token").
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(201).
+		JSON().Object().Value("url").String().Raw()
+	path := url[strings.Index(url, "/calendar/"):]
+
+	feed := server.GET(path).
+		Expect().
+		Status(200).
+		HasContentType("text/calendar").
+		Body().Raw()
+	assert.Contains(t, feed, "BEGIN:VCALENDAR\r\n")
+	assert.Contains(t, feed, "SUMMARY:Due tomorrow\r\n")
+	assert.Contains(t, feed, "DUE;VALUE=DATE:20231001\r\n")
+	assert.Contains(t, feed, "DESCRIPTION:Note 1\\n\\nNote 2")
+	assert.NotContains(t, feed, "BEGIN:VEVENT")
+
+	server.GET(path).
+		WithQuery("events", "true").
+		Expect().
+		Status(200).
+		Body().Contains("BEGIN:VEVENT")
+
+	// Rotating the token invalidates the old URL
+	server.POST("/calendar/token").
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(201)
+	server.GET(path).
+		Expect().
+		Status(404)
+
+	t.Log("TestCalendarFeedFunctional passed")
+}
+
+func TestCalendarImportFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	ics := func(summary, status string) string {
+		return strings.Join([]string{
+			"BEGIN:VCALENDAR",
+			"VERSION:2.0",
+			"PRODID:-//Other//App//EN",
+			"BEGIN:VTODO",
+			"UID:imported-1@example.com",
+			"SUMMARY:" + summary,
+			"DUE:20250102T150000Z",
+			"STATUS:" + status,
+			"RRULE:FREQ=MONTHLY",
+			"DESCRIPTION:From the other app",
+			"END:VTODO",
+			"BEGIN:VTODO",
+			"SUMMARY:Missing UID",
+			"END:VTODO",
+			"END:VCALENDAR",
+		}, "\r\n") + "\r\n"
+	}
+
+	result := server.POST("/import/ics").
+		WithHeader("Content-Type", "text/calendar").
+		WithText(ics("Renew passport", "NEEDS-ACTION")).
+		Expect().
+		Status(200).
+		JSON().Object()
+	result.Value("created").IsEqual(1)
+	result.Value("updated").IsEqual(0)
+	result.Value("errors").Array().Length().IsEqual(1)
+
+	var todo models.Todo
+	assert.NoError(t, db.Preload("Notes").Where("uid = ?", "imported-1@example.com").First(&todo).Error)
+	assert.Equal(t, "Renew passport", todo.Subject)
+	assert.Equal(t, "FREQ=MONTHLY", todo.RRule)
+	assert.Equal(t, 15, todo.DueDate.Hour())
+	assert.Len(t, todo.Notes, 1)
+
+	// Importing again updates the same todo
+	result = server.POST("/import/ics").
+		WithHeader("Content-Type", "text/calendar").
+		WithText(ics("Renew passport today", "COMPLETED")).
+		Expect().
+		Status(200).
+		JSON().Object()
+	result.Value("created").IsEqual(0)
+	result.Value("updated").IsEqual(1)
+
+	server.GET(fmt.Sprintf("/todos/%d", todo.ID)).
+		Expect().
+		Status(200).
+		JSON().Object().
+		HasValue("subject", "Renew passport today").
+		HasValue("completed", true).
+		HasValue("uid", "imported-1@example.com").
+		Value("notes").Array().Length().IsEqual(1)
+
+	// The UID cannot be changed through the API
+	server.PATCH(fmt.Sprintf("/todos/%d", todo.ID)).
+		WithJSON(map[string]interface{}{"uid": "other"}).
+		Expect().
+		Status(200).
+		JSON().Object().HasValue("uid", "imported-1@example.com")
+
+	server.POST("/import/ics").
+		WithText("not a calendar").
+		Expect().
+		Status(400)
+
+	t.Log("TestCalendarImportFunctional passed")
+}
+
+func TestCalendarTokenNotInActivityFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	token := server.POST("/calendar/token").
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(201).
+		JSON().Object().Value("token").String().Raw()
+
+	activity := server.GET("/activity").
+		WithQuery("entity_type", "User").
+		Expect().
+		Status(200).
+		Body().Raw()
+	assert.Contains(t, activity, `"calendar_token"`) // Rotations are still recorded
+	assert.Contains(t, activity, "[redacted]")
+	assert.NotContains(t, activity, token)
+
+	t.Log("TestCalendarTokenNotInActivityFunctional passed")
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"my-go-project/models"
+
+	"github.com/gavv/httpexpect/v2"
+)
+
+func TestChecklistFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	todoID := int(server.POST("/todos").
+		WithJSON(models.Todo{Subject: "Pack"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+	base := fmt.Sprintf("/todos/%d/checklist", todoID)
+
+	var ids []int
+	for _, text := range []string{"charger", "passport", "adapter"} {
+		item := server.POST(base).
+			WithJSON(map[string]interface{}{"text": text}).
+			Expect().
+			Status(201).
+			JSON().Object()
+		item.Value("position").IsEqual(len(ids))
+		ids = append(ids, int(item.Value("ID").Raw().(float64)))
+	}
+	server.POST(base).
+		WithJSON(map[string]interface{}{"text": ""}).
+		Expect().
+		Status(400)
+
+	server.PATCH(fmt.Sprintf("%s/%d", base, ids[1])).
+		WithJSON(map[string]interface{}{"done": true}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("done").IsEqual(true)
+
+	// Progress is computed into the todo JSON
+	todo := server.GET(fmt.Sprintf("/todos/%d", todoID)).
+		Expect().
+		Status(200).
+		JSON().Object()
+	todo.Value("checklist").Array().Length().IsEqual(3)
+	todo.Value("checklist_progress").Object().IsEqual(map[string]interface{}{"done": 1, "total": 3})
+
+	// Reorder: adapter, charger, passport
+	server.PUT(base + "/order").
+		WithJSON(map[string]interface{}{"ids": []int{ids[2], ids[0], ids[1]}}).
+		Expect().
+		Status(200).
+		JSON().Array().Value(0).Object().Value("text").IsEqual("adapter")
+	server.PUT(base + "/order").
+		WithJSON(map[string]interface{}{"ids": []int{ids[2], ids[2], ids[1]}}).
+		Expect().
+		Status(400)
+
+	// Converting an item moves it out of the checklist into a new todo
+	server.POST(fmt.Sprintf("%s/%d/convert", base, ids[0])).
+		Expect().
+		Status(201).
+		JSON().Object().Value("subject").IsEqual("charger")
+
+	server.DELETE(fmt.Sprintf("%s/%d", base, ids[2])).
+		Expect().
+		Status(204)
+
+	server.GET(base).
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(1)
+
+	t.Log("TestChecklistFunctional passed")
+}
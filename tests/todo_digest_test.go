@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"my-go-project/digest"
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingMailer fails every delivery.
+type failingMailer struct{}
+
+func (failingMailer) Send(context.Context, *digest.Message) error {
+	return errors.New("connection refused")
+}
+
+func TestDigestSchedulerFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	me := server.GET("/me").
+		WithHeader(routes.UserHeader, "digest-reader").
+		Expect().
+		Status(200).
+		JSON().Object()
+	me.HasValue("digest_daily", true).HasValue("digest_weekly", true).HasValue("digest_hour", 7)
+
+	server.PATCH("/me").
+		WithHeader(routes.UserHeader, "digest-reader").
+		WithJSON(map[string]interface{}{"email": "Not an address"}).
+		Expect().
+		Status(400)
+	server.PATCH("/me").
+		WithHeader(routes.UserHeader, "digest-reader").
+		WithJSON(map[string]interface{}{"digest_hour": 24}).
+		Expect().
+		Status(400)
+	server.PATCH("/me").
+		WithHeader(routes.UserHeader, "digest-reader").
+		WithJSON(map[string]interface{}{"email": "reader@example.com", "timezone": "America/New_York", "digest_hour": 8}).
+		Expect().
+		Status(200).
+		JSON().Object().HasValue("email", "reader@example.com").HasValue("digest_hour", 8)
+
+	server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Digest due on Tuesday", "due_date": "2030-03-05"}).
+		Expect().
+		Status(201)
+	server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Digest due on Friday", "due_date": "2030-03-15"}).
+		Expect().
+		Status(201)
+
+	capture := newSMTPCapture(t)
+	ctx := context.Background()
+	// 07:00 in New York is before the user's hour
+	sent, err := digest.SendDue(ctx, db, capture.mailer(), time.Date(2030, 3, 5, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	// A failed delivery is retried on the next run
+	sent, err = digest.SendDue(ctx, db, failingMailer{}, time.Date(2030, 3, 5, 13, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	sent, err = digest.SendDue(ctx, db, capture.mailer(), time.Date(2030, 3, 5, 13, 31, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	messages := capture.take()
+	require.Len(t, messages, 1)
+	assert.Equal(t, []string{"reader@example.com"}, messages[0].To)
+	subject, text, html := parseDigestMail(t, messages[0].Data)
+	assert.Contains(t, subject, "Tuesday 5 March: 1 due today")
+	assert.Contains(t, text, "- Digest due on Tuesday (Tue 5 Mar)")
+	assert.Contains(t, html, "Digest due on Tuesday")
+	assert.NotContains(t, text, "Digest due on Friday")
+
+	// One digest a day
+	sent, err = digest.SendDue(ctx, db, capture.mailer(), time.Date(2030, 3, 5, 20, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	// Mondays bring the week ahead instead, unless opted out
+	server.PATCH("/me").
+		WithHeader(routes.UserHeader, "digest-reader").
+		WithJSON(map[string]interface{}{"digest_daily": false}).
+		Expect().
+		Status(200)
+	sent, err = digest.SendDue(ctx, db, capture.mailer(), time.Date(2030, 3, 6, 14, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+	sent, err = digest.SendDue(ctx, db, capture.mailer(), time.Date(2030, 3, 11, 14, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	messages = capture.take()
+	require.Len(t, messages, 1)
+	subject, text, _ = parseDigestMail(t, messages[0].Data)
+	assert.Contains(t, subject, "Week of 11 March")
+	assert.Contains(t, text, "- Digest due on Friday (Fri 15 Mar)")
+
+	// Previews render any user's digest for any day
+	preview := server.GET("/digest/preview").
+		WithQuery("user", "digest-reader").
+		WithQuery("date", "2030-03-05").
+		WithQuery("kind", "daily").
+		WithQuery("format", "json").
+		Expect().
+		Status(200).
+		JSON().Object()
+	preview.HasValue("to", "reader@example.com").HasValue("kind", "daily").HasValue("empty", false)
+	preview.Value("text").String().Contains("Digest due on Tuesday")
+	server.GET("/digest/preview").
+		WithHeader(routes.UserHeader, "digest-reader").
+		WithQuery("date", "2030-03-11").
+		Expect().
+		Status(200).
+		ContentType("text/html").
+		Body().Contains("Week of 11 March")
+	server.GET("/digest/preview").
+		WithHeader(routes.UserHeader, "digest-reader").
+		WithQuery("date", "2030-03-11").
+		WithQuery("format", "text").
+		Expect().
+		Status(200).
+		Body().Contains("Later this week")
+	server.GET("/digest/preview").WithQuery("user", "nobody-at-all").Expect().Status(404)
+	server.GET("/digest/preview").WithHeader(routes.UserHeader, "digest-reader").WithQuery("kind", "monthly").Expect().Status(400)
+	server.GET("/digest/preview").Expect().Status(401)
+}
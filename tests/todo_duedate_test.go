@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"my-go-project/utils"
+
+	"github.com/gavv/httpexpect/v2"
+)
+
+func TestTodoDueDateFormatsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	stockholm, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultLocation := utils.DefaultLocation
+	utils.DefaultLocation = stockholm
+	defer func() { utils.DefaultLocation = defaultLocation }()
+
+	// A time without a zone is read in the configured zone
+	todo := server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Zoneless", "due_date": "2025-03-01T09:30"}).
+		Expect().
+		Status(201).
+		JSON().Object()
+	todo.Value("due_date").IsEqual("2025-03-01T08:30:00Z")
+	url := fmt.Sprintf("/todos/%d", int(todo.Value("ID").Raw().(float64)))
+
+	server.GET(url).
+		Expect().
+		Status(200).
+		JSON().Object().Value("due_date").IsEqual("2025-03-01T08:30:00Z")
+
+	// Switching to a whole day
+	server.PATCH(url).
+		WithJSON(map[string]interface{}{"due_date": "2025-04-01"}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("due_date").IsEqual("2025-04-01")
+	server.GET(url).
+		Expect().
+		Status(200).
+		JSON().Object().Value("due_date").IsEqual("2025-04-01")
+
+	// Unix timestamps
+	server.PATCH(url).
+		WithJSON(map[string]interface{}{"due_date": 1740821400}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("due_date").IsEqual("2025-03-01T09:30:00Z")
+
+	// null clears the due date
+	server.PATCH(url).
+		WithJSON(map[string]interface{}{"due_date": nil}).
+		Expect().
+		Status(200).
+		JSON().Object().NotContainsKey("due_date")
+
+	// Bad input is a client error, not a crash
+	server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Bad date", "due_date": "31/12/2025"}).
+		Expect().
+		Status(400).
+		JSON().Object().Value("details").String().Contains("invalid date")
+	server.PATCH(url).
+		WithJSON(map[string]interface{}{"due_date": "soon"}).
+		Expect().
+		Status(400)
+}
@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"testing"
+
+	"my-go-project/models"
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthProbes(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	server.GET("/healthz").Expect().Status(200).
+		JSON().Object().HasValue("status", "ok")
+	server.GET("/startupz").Expect().Status(200).
+		JSON().Object().HasValue("status", "ok")
+
+	resp := server.GET("/readyz").Expect().Status(200)
+	resp.Header("Cache-Control").IsEqual("no-store")
+	checks := resp.JSON().Object().HasValue("status", "ok").Value("checks").Object()
+	checks.Value("database").Object().HasValue("status", "ok")
+	checks.Value("migrations").Object().HasValue("status", "ok")
+	checks.Value("shutdown").Object().HasValue("status", "ok")
+
+	// Probes skip the middleware, which would create the user
+	server.GET("/readyz").WithHeader(routes.UserHeader, "probe-user").Expect().Status(200)
+	var count int64
+	db.Model(&models.User{}).Where("username = ?", "probe-user").Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,30 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gavv/httpexpect/v2"
+)
+
+func TestNonNumericIDsFunctional(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, client *http.Client) {
+		server := httpexpect.WithConfig(httpexpect.Config{
+			Client:   client,
+			Reporter: httpexpect.NewRequireReporter(t),
+		})
+		count := server.GET("/todos").Expect().Status(200).JSON().Array().Length().Raw()
+
+		// An ID that is not a number names no todo, and never becomes a
+		// condition that matches them all
+		condition := "/todos/" + url.PathEscape("0 OR 1=1")
+		server.GET(condition).Expect().Status(404)
+		server.PATCH(condition).WithJSON(map[string]interface{}{"subject": "Everything"}).Expect().Status(404)
+		server.DELETE(condition).Expect().Status(404)
+		server.DELETE("/todos/abc/notes/" + url.PathEscape("0 OR 1=1")).Expect().Status(404)
+		server.POST("/todos/abc/notes").WithJSON(map[string]interface{}{"note": "Lost"}).Expect().Status(400)
+
+		server.GET("/todos").Expect().Status(200).JSON().Array().Length().IsEqual(count)
+	})
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"testing"
+
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accessLine returns the access log line of the request with requestID.
+func accessLine(t *testing.T, buf *logBuffer, requestID string) map[string]interface{} {
+	for _, line := range logLines(t, buf) {
+		if line["msg"] == "request" && line["request_id"] == requestID {
+			return line
+		}
+	}
+	require.Failf(t, "no access log line", "request %s in %s", requestID, buf.String())
+	return nil
+}
+
+func TestLoggingFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	buf := captureLogs(t, "info")
+
+	// The caller's request ID is kept, and the line names the route and user
+	server.GET("/todos/999999").
+		WithQuery("search", "alice@example.com").
+		WithHeader("X-Request-ID", "req-logged").
+		WithHeader(routes.UserHeader, "logger").
+		Expect().
+		Status(404).
+		Header("X-Request-ID").IsEqual("req-logged")
+	line := accessLine(t, buf, "req-logged")
+	assert.Equal(t, "GET", line["method"])
+	assert.Equal(t, "/todos/:id", line["route"])
+	assert.Equal(t, "/todos/999999", line["path"])
+	assert.Equal(t, float64(404), line["status"])
+	assert.Equal(t, "logger", line["user"])
+	assert.Contains(t, line, "latency_ms")
+	assert.Equal(t, "INFO", line["level"])
+	assert.NotContains(t, buf.String(), "alice")
+
+	// An unusable request ID is replaced
+	requestID := server.GET("/todos").
+		WithHeader("X-Request-ID", "bad id\twith spaces").
+		Expect().
+		Status(200).
+		Header("X-Request-ID").NotEqual("bad id\twith spaces").Raw()
+	assert.NotEmpty(t, requestID)
+	line = accessLine(t, buf, requestID)
+	assert.NotContains(t, line, "user")
+}
@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"my-go-project/metrics"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	created := testutil.ToFloat64(metrics.TodosCreated)
+	completed := testutil.ToFloat64(metrics.TodosCompleted)
+	notes := testutil.ToFloat64(metrics.NotesAdded)
+	deleted := testutil.ToFloat64(metrics.TodosDeleted)
+
+	id := int(server.POST("/todos").
+		WithJSON(map[string]interface{}{"subject": "Count me"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Number().Raw())
+	path := fmt.Sprintf("/todos/%d", id)
+	server.POST(path + "/notes").
+		WithJSON(map[string]interface{}{"note": "Counted"}).
+		Expect().
+		Status(201)
+	server.PATCH(path).
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200)
+	// Completing it again is not another completion
+	server.PATCH(path).
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200)
+	server.DELETE(path).Expect().Status(204)
+
+	assert.Equal(t, created+1, testutil.ToFloat64(metrics.TodosCreated))
+	assert.Equal(t, notes+1, testutil.ToFloat64(metrics.NotesAdded))
+	assert.Equal(t, completed+1, testutil.ToFloat64(metrics.TodosCompleted))
+	assert.Equal(t, deleted+1, testutil.ToFloat64(metrics.TodosDeleted))
+
+	// Requests are labelled with the route template, never the raw path
+	server.GET("/todos/999999").Expect().Status(404)
+	body := server.GET("/metrics").Expect().Status(200).Body()
+	body.Contains(`http_requests_total{method="PATCH",route="/todos/:id",status="200"}`)
+	body.Contains(`http_requests_total{method="GET",route="/todos/:id",status="404"}`)
+	body.NotContains(`route="` + path + `"`)
+	body.NotContains(`route="/todos/999999"`)
+	body.Contains(`http_request_duration_seconds_bucket{method="POST",route="/todos",le="0.005"}`)
+	body.Contains(`http_requests_in_flight{method="PATCH"} 0`)
+
+	// Statements per table and operation, and the connection pool
+	body.Contains(`db_query_duration_seconds_count{operation="create",table="todos"}`)
+	body.Contains(`db_query_duration_seconds_count{operation="query",table="notes"}`)
+	body.Contains(`go_sql_open_connections{db_name="test"}`)
+	body.Contains("todos_created_total")
+
+	// Scrapes are not requests
+	body.NotContains(`route="/metrics"`)
+}
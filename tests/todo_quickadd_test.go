@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"testing"
+
+	"my-go-project/models"
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+)
+
+func TestQuickAddFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	result := server.POST("/todos/quick").
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(map[string]string{"text": "Pay rent every 1st of month !high #home @bills"}).
+		Expect().
+		Status(201)
+	result.Header(routes.UndoTokenHeader).NotEmpty()
+	body := result.JSON().Object()
+
+	todo := body.Value("todo").Object()
+	todo.Value("subject").IsEqual("Pay rent")
+	todo.Value("rrule").IsEqual("FREQ=MONTHLY;BYMONTHDAY=1")
+	todo.Value("priority").IsEqual(models.PriorityHigh)
+	todo.Value("tags").IsEqual([]string{"home"})
+	todo.Value("list").IsEqual("bills")
+	todo.Value("due_date").String().Match(`^\d{4}-\d{2}-01$`)
+
+	spans := body.Value("spans").Array()
+	spans.Length().IsEqual(4)
+	spans.Value(0).Object().Value("kind").IsEqual("recurrence")
+	spans.Value(0).Object().Value("text").IsEqual("every 1st of month")
+
+	// The stored todo has the parsed fields
+	server.GET("/todos/{id}", todo.Value("ID").Raw()).
+		Expect().
+		Status(200).
+		JSON().Object().Value("tags").IsEqual([]string{"home"})
+
+	// The locale comes from the body or Accept-Language
+	server.POST("/todos/quick").
+		WithHeader("Accept-Language", "sv-SE,sv;q=0.9").
+		WithJSON(map[string]string{"text": "Handla imorgon #mat"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("todo").Object().Value("subject").IsEqual("Handla")
+
+	server.POST("/todos/quick").
+		WithJSON(map[string]string{"text": "  "}).
+		Expect().
+		Status(400)
+}
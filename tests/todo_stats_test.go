@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"my-go-project/utils"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	create := func(todo map[string]interface{}) int {
+		todo["list"] = "stats-sprint"
+		return int(server.POST("/todos").
+			WithJSON(todo).
+			Expect().
+			Status(201).
+			JSON().Object().Value("ID").Raw().(float64))
+	}
+	done := create(map[string]interface{}{"subject": "Write the plan", "tags": []string{"stats-a"}})
+	create(map[string]interface{}{"subject": "Review the plan", "due_date": "2020-01-01", "tags": []string{"stats-a", "stats-b"}})
+	reopened := create(map[string]interface{}{"subject": "Ship the plan"})
+
+	// Completing stamps completed_at, reopening clears it
+	server.PATCH("/todos/{id}", done).
+		WithJSON(map[string]interface{}{"completed": true, "completed_at": "2001-01-01T00:00:00Z"}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("completed_at").String().NotEqual("2001-01-01T00:00:00Z")
+	server.PATCH("/todos/{id}", reopened).
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200).
+		JSON().Object().ContainsKey("completed_at")
+	server.PATCH("/todos/{id}", reopened).
+		WithJSON(map[string]interface{}{"completed": false}).
+		Expect().
+		Status(200).
+		JSON().Object().NotContainsKey("completed_at")
+	// Only completed todos count as completions, even with a completed_at
+	// left behind, as rows synced from calendar clients once had
+	require.NoError(t, db.Exec("UPDATE todos SET completed_at = ? WHERE id = ?", time.Now(), reopened).Error)
+
+	type summary struct {
+		Key                      string   `json:"key"`
+		Open                     int64    `json:"open"`
+		Completed                int64    `json:"completed"`
+		Overdue                  int64    `json:"overdue"`
+		AverageCompletionSeconds *float64 `json:"average_completion_seconds"`
+		Periods                  []struct {
+			Start          string   `json:"start"`
+			Created        int64    `json:"created"`
+			Completed      int64    `json:"completed"`
+			CompletionRate *float64 `json:"completion_rate"`
+		} `json:"periods"`
+		Burndown []struct {
+			Date      string `json:"date"`
+			Scope     int64  `json:"scope"`
+			Completed int64  `json:"completed"`
+			Open      int64  `json:"open"`
+		} `json:"burndown"`
+	}
+	var report struct {
+		From   string    `json:"from"`
+		To     string    `json:"to"`
+		Groups []summary `json:"groups"`
+	}
+	today := time.Now().In(utils.DefaultLocation)
+	server.GET("/stats").
+		WithQuery("from", today.AddDate(0, 0, -6).Format("2006-01-02")).
+		WithQuery("to", today.Format("2006-01-02")).
+		WithQuery("group_by", "list").
+		Expect().
+		Status(200).
+		JSON().Decode(&report)
+	assert.Equal(t, today.Format("2006-01-02"), report.To)
+
+	var sprint *summary
+	for i := range report.Groups {
+		if report.Groups[i].Key == "stats-sprint" {
+			sprint = &report.Groups[i]
+		}
+	}
+	require.NotNil(t, sprint)
+	assert.Equal(t, int64(2), sprint.Open)
+	assert.Equal(t, int64(1), sprint.Completed)
+	assert.Equal(t, int64(1), sprint.Overdue)
+	require.NotNil(t, sprint.AverageCompletionSeconds)
+	assert.GreaterOrEqual(t, *sprint.AverageCompletionSeconds, 0.0)
+
+	require.Len(t, sprint.Periods, 7)
+	last := sprint.Periods[6]
+	assert.Equal(t, today.Format("2006-01-02"), last.Start)
+	assert.Equal(t, int64(3), last.Created)
+	assert.Equal(t, int64(1), last.Completed)
+	require.NotNil(t, last.CompletionRate)
+	assert.InDelta(t, 1.0/3, *last.CompletionRate, 1e-9)
+	assert.Nil(t, sprint.Periods[0].CompletionRate)
+
+	require.Len(t, sprint.Burndown, 7)
+	assert.Equal(t, int64(0), sprint.Burndown[0].Scope)
+	point := sprint.Burndown[6]
+	assert.Equal(t, [3]int64{3, 1, 2}, [3]int64{point.Scope, point.Completed, point.Open})
+
+	// Tags split todos across groups; a todo counts once per tag
+	server.GET("/stats").
+		WithQuery("group_by", "tag").
+		WithQuery("interval", "week").
+		Expect().
+		Status(200).
+		JSON().Decode(&report)
+	counts := map[string]int64{}
+	for _, group := range report.Groups {
+		counts[group.Key] = group.Open + group.Completed
+	}
+	assert.Equal(t, int64(2), counts["stats-a"])
+	assert.Equal(t, int64(1), counts["stats-b"])
+	from, err := time.Parse("2006-01-02", report.From)
+	require.NoError(t, err)
+	assert.Equal(t, time.Monday, from.Weekday())
+
+	server.GET("/stats").WithQuery("group_by", "colour").Expect().Status(400)
+	server.GET("/stats").WithQuery("interval", "hour").Expect().Status(400)
+	server.GET("/stats").WithQuery("from", "2025-03-02").WithQuery("to", "2025-03-01").Expect().Status(400)
+	server.GET("/stats").WithQuery("from", "last week").Expect().Status(400)
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserTimeZoneFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.PATCH("/me").
+		WithHeader(routes.UserHeader, "nyc").
+		WithJSON(map[string]string{"timezone": "Mars/Olympus_Mons"}).
+		Expect().
+		Status(400)
+	server.PATCH("/me").
+		WithHeader(routes.UserHeader, "nyc").
+		WithJSON(map[string]string{"timezone": "America/New_York"}).
+		Expect().
+		Status(200).
+		JSON().Object().Value("timezone").IsEqual("America/New_York")
+	server.GET("/me").
+		WithHeader(routes.UserHeader, "nyc").
+		Expect().
+		Status(200).
+		JSON().Object().Value("timezone").IsEqual("America/New_York")
+	server.GET("/me").Expect().Status(401)
+
+	// A time without a zone is read in the user's zone
+	server.POST("/todos").
+		WithHeader(routes.UserHeader, "nyc").
+		WithJSON(map[string]interface{}{"subject": "Standup", "due_date": "2030-03-01T09:30"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("due_date").IsEqual("2030-03-01T14:30:00Z")
+
+	// "Today" is the viewer's today
+	today := time.Now().In(newYork).Format("2006-01-02")
+	dueToday := int(server.POST("/todos").
+		WithHeader(routes.UserHeader, "nyc").
+		WithJSON(map[string]interface{}{"subject": "Due today in New York", "due_date": today}).
+		Expect().
+		Status(201).
+		JSON().Object().
+		HasValue("due_status", "today").
+		Value("ID").Raw().(float64))
+	overdue := int(server.POST("/todos").
+		WithHeader(routes.UserHeader, "nyc").
+		WithJSON(map[string]interface{}{"subject": "Long overdue", "due_date": "2020-01-01"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+
+	ids := func(due string) []int {
+		var todos []struct {
+			ID        int    `json:"ID"`
+			DueStatus string `json:"due_status"`
+		}
+		server.GET("/todos").
+			WithHeader(routes.UserHeader, "nyc").
+			WithQuery("due", due).
+			Expect().
+			Status(200).
+			JSON().Decode(&todos)
+		var result []int
+		for _, todo := range todos {
+			result = append(result, todo.ID)
+		}
+		return result
+	}
+	assert.Contains(t, ids("today"), dueToday)
+	assert.NotContains(t, ids("today"), overdue)
+	assert.Contains(t, ids("week"), dueToday)
+	assert.Contains(t, ids("overdue"), overdue)
+	assert.NotContains(t, ids("overdue"), dueToday)
+
+	server.GET(fmt.Sprintf("/todos/%d", overdue)).
+		WithHeader(routes.UserHeader, "nyc").
+		Expect().
+		Status(200).
+		JSON().Object().HasValue("due_status", "overdue")
+
+	// Completing a todo takes it out of the overdue list
+	server.PATCH(fmt.Sprintf("/todos/%d", overdue)).
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200).
+		JSON().Object().NotContainsKey("due_status")
+	assert.NotContains(t, ids("overdue"), overdue)
+
+	server.GET("/todos").WithQuery("due", "someday").Expect().Status(400)
+}
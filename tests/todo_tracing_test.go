@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"testing"
+
+	"my-go-project/tracing"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	exporter := recordSpans(t)
+
+	// The caller's trace is continued
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+	server.GET("/todos/1").
+		WithHeader("traceparent", "00-"+traceID+"-"+parentID+"-01").
+		Expect().
+		Status(200).
+		Header(tracing.TraceIDHeader).IsEqual(traceID)
+
+	spans := exporter.GetSpans()
+	request := spanNamed(t, spans, "GET /todos/:id")
+	assert.Equal(t, trace.SpanKindServer, request.SpanKind)
+	assert.Equal(t, traceID, request.SpanContext.TraceID().String())
+	assert.Equal(t, parentID, request.Parent.SpanID().String())
+	assert.True(t, request.Parent.IsRemote())
+	assert.Contains(t, request.Attributes, attribute.String("http.route", "/todos/:id"))
+	assert.Contains(t, request.Attributes, attribute.Int("http.response.status_code", 200))
+
+	// Every statement is a child of the request
+	query := spanNamed(t, spans, "gorm.query todos")
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+	assert.Equal(t, request.SpanContext.SpanID(), query.Parent.SpanID())
+	assert.Contains(t, query.Attributes, attribute.String("db.collection.name", "todos"))
+	for _, span := range spans {
+		if span.SpanKind == trace.SpanKindClient {
+			assert.Equal(t, request.SpanContext.SpanID(), span.Parent.SpanID(), span.Name)
+		}
+	}
+
+	// Errors carry the trace ID in the body too; a missing record is not a
+	// failed statement
+	exporter.Reset()
+	body := server.GET("/todos/999999").
+		Expect().
+		Status(404).
+		JSON().Object()
+	body.ContainsKey("error")
+	spans = exporter.GetSpans()
+	request = spanNamed(t, spans, "GET /todos/:id")
+	body.HasValue("trace_id", request.SpanContext.TraceID().String())
+	assert.Equal(t, codes.Unset, request.Status.Code)
+	assert.Equal(t, codes.Unset, spanNamed(t, spans, "gorm.query todos").Status.Code)
+
+	// A new trace starts without a traceparent
+	assert.NotEqual(t, traceID, request.SpanContext.TraceID().String())
+	assert.False(t, request.Parent.IsValid())
+}
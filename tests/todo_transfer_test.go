@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/routes"
+	"my-go-project/transfer"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	body := server.GET("/export").
+		WithQuery("format", "csv").
+		Expect().
+		Status(200).
+		HasContentType("text/csv").
+		Body().Raw()
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"uid", "subject", "completed", "due_date", "rrule", "priority", "list", "tags", "created_at", "notes"}, rows[0])
+	var count int64
+	db.Model(&models.Todo{}).Count(&count)
+	assert.Len(t, rows, int(count)+1)
+
+	server.GET("/export").
+		Expect().
+		Status(200).
+		JSON().Object().
+		HasValue("version", 1).
+		Value("todos").Array().Length().IsEqual(count)
+
+	server.GET("/export").
+		WithQuery("format", "todotxt").
+		Expect().
+		Status(200).
+		Header("Content-Disposition").Contains("todo.txt")
+
+	server.GET("/export").
+		WithQuery("format", "xlsx").
+		Expect().
+		Status(400)
+
+	t.Log("TestExportFunctional passed")
+}
+
+func TestExportWithQueryTimeoutFunctional(t *testing.T) {
+	defer func(timeout time.Duration) { routes.QueryTimeout = timeout }(routes.QueryTimeout)
+	routes.QueryTimeout = 30 * time.Second
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	// The body is streamed after the request's own deadline has been cancelled
+	body := server.GET("/export").
+		WithQuery("format", "csv").
+		Expect().
+		Status(200).
+		Body().Raw()
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	require.NoError(t, err)
+	var count int64
+	db.Model(&models.Todo{}).Count(&count)
+	assert.Len(t, rows, int(count)+1)
+}
+
+func TestImportFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+
+	input := strings.Join([]string{
+		"uid,subject,completed,due_date,notes",
+		"import-csv-1,Order toner,false,2025-03-01,Black and cyan",
+		"import-csv-1,Order toner again,false,,",
+		",Buy groceries,false,,",
+		",,false,,",
+		"import-csv-2,Renew domain,true,not a date,",
+	}, "\n")
+
+	var before int64
+	db.Model(&models.Todo{}).Count(&before)
+
+	report := server.POST("/import").
+		WithQuery("format", "csv").
+		WithQuery("dry_run", "true").
+		WithText(input).
+		Expect().
+		Status(200).
+		JSON().Object()
+	report.HasValue("dry_run", true).
+		HasValue("created", 1).
+		HasValue("skipped", 2).
+		HasValue("errors", 2)
+	rows := report.Value("rows").Array()
+	rows.Value(0).Object().HasValue("action", "created").HasValue("row", 1)
+	rows.Value(1).Object().HasValue("action", "skipped").HasValue("reason", "duplicate of row 1")
+	rows.Value(2).Object().HasValue("action", "skipped").Value("reason").String().HasPrefix("duplicate of todo")
+	rows.Value(3).Object().HasValue("action", "error").HasValue("reason", "subject is required")
+	rows.Value(4).Object().HasValue("action", "error").Value("reason").String().Contains("not a date")
+
+	var after int64
+	db.Model(&models.Todo{}).Count(&after)
+	assert.Equal(t, before, after, "a dry run changes nothing")
+
+	server.POST("/import").
+		WithHeader("Content-Type", "text/csv").
+		WithText(input).
+		Expect().
+		Status(200).
+		JSON().Object().
+		HasValue("dry_run", false).
+		HasValue("created", 1)
+
+	var todo models.Todo
+	require.NoError(t, db.Preload("Notes").Where("uid = ?", "import-csv-1").First(&todo).Error)
+	assert.Equal(t, "Order toner", todo.Subject)
+	require.Len(t, todo.Notes, 1)
+	assert.Equal(t, "Black and cyan", todo.Notes[0].Note)
+
+	// A JSON backup of the todo updates it in place
+	server.POST("/import").
+		WithMultipart().
+		WithFileBytes("file", "backup.json", []byte(`{"version":1,"todos":[
+			{"uid":"import-csv-1","subject":"Order toner","completed":true,"due_date":"2025-03-01T00:00:00Z",
+			 "notes":[{"note":"Black and cyan"}],"checklist":[{"text":"Black"},{"text":"Cyan"}]}]}`)).
+		Expect().
+		Status(200).
+		JSON().Object().
+		HasValue("updated", 1)
+
+	require.NoError(t, db.Preload("Checklist").Where("uid = ?", "import-csv-1").First(&todo).Error)
+	assert.True(t, todo.Completed)
+	assert.Len(t, todo.Checklist, 2)
+
+	server.POST("/import").
+		WithQuery("format", "json").
+		WithText("{not json").
+		Expect().
+		Status(400)
+
+	t.Log("TestImportFunctional passed")
+}
+
+func TestPopulateFromFileFunctional(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.txt")
+	require.NoError(t, os.WriteFile(path, []byte("2025-01-01 Water the plants uid:populate-1\n"), 0o644))
+
+	require.NoError(t, transfer.PopulateFromFile(db, path))
+	var todo models.Todo
+	require.NoError(t, db.Where("uid = ?", "populate-1").First(&todo).Error)
+	assert.Equal(t, "Water the plants", todo.Subject)
+
+	assert.Error(t, transfer.PopulateFromFile(db, filepath.Join(t.TempDir(), "todos.xlsx")))
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/routes"
+	"my-go-project/undo"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUndoServer(t *testing.T) *httpexpect.Expect {
+	return httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+}
+
+func createUndoTodo(server *httpexpect.Expect, subject string) int {
+	return int(server.POST("/todos").
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(models.Todo{Subject: subject}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+}
+
+func TestUndoCompleteAndDeleteFunctional(t *testing.T) {
+	server := newUndoServer(t)
+	todoID := createUndoTodo(server, "Undoable")
+	url := fmt.Sprintf("/todos/%d", todoID)
+
+	token := server.PATCH(url).
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200).
+		Header(routes.UndoTokenHeader).NotEmpty().Raw()
+
+	server.POST("/undo/"+token).
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(200).
+		JSON().Object().Value("action").IsEqual(models.ActionUpdate)
+	server.GET(url).
+		Expect().
+		JSON().Object().Value("completed").IsEqual(false)
+
+	// A token can only be used once
+	server.POST("/undo/" + token).
+		Expect().
+		Status(410)
+
+	token = server.DELETE(url).
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(204).
+		Header(routes.UndoTokenHeader).NotEmpty().Raw()
+	server.GET(url).Expect().Status(404)
+
+	server.POST("/undo/"+token).
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(200)
+	server.GET(url).
+		Expect().
+		Status(200).
+		JSON().Object().Value("subject").IsEqual("Undoable")
+
+	server.POST("/undo/does-not-exist").
+		Expect().
+		Status(404)
+
+	t.Log("TestUndoCompleteAndDeleteFunctional passed")
+}
+
+func TestUndoNoteRemovalFunctional(t *testing.T) {
+	server := newUndoServer(t)
+	todoID := createUndoTodo(server, "Undo note removal")
+
+	noteID := int(server.POST(fmt.Sprintf("/todos/%d/notes", todoID)).
+		WithJSON(models.Note{Note: "Keep me"}).
+		Expect().
+		Status(201).
+		JSON().Object().Value("ID").Raw().(float64))
+
+	token := server.DELETE(fmt.Sprintf("/todos/%d/notes/%d", todoID, noteID)).
+		Expect().
+		Status(204).
+		Header(routes.UndoTokenHeader).NotEmpty().Raw()
+
+	server.POST("/undo/" + token).
+		Expect().
+		Status(200)
+	server.GET(fmt.Sprintf("/todos/%d", todoID)).
+		Expect().
+		JSON().Object().Value("notes").Array().Value(0).Object().Value("note").IsEqual("Keep me")
+
+	t.Log("TestUndoNoteRemovalFunctional passed")
+}
+
+func TestUndoConflictFunctional(t *testing.T) {
+	server := newUndoServer(t)
+	todoID := createUndoTodo(server, "Contested")
+	url := fmt.Sprintf("/todos/%d", todoID)
+
+	token := server.PATCH(url).
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(map[string]interface{}{"subject": "Alice's edit"}).
+		Expect().
+		Status(200).
+		Header(routes.UndoTokenHeader).Raw()
+
+	server.PATCH(url).
+		WithHeader(routes.UserHeader, "bob").
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200)
+
+	server.POST("/undo/"+token).
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(409)
+	server.GET(url).
+		Expect().
+		JSON().Object().Value("subject").IsEqual("Alice's edit")
+
+	t.Log("TestUndoConflictFunctional passed")
+}
+
+func TestUndoExpiredFunctional(t *testing.T) {
+	server := newUndoServer(t)
+
+	window := undo.Window
+	undo.Window = -time.Second
+	defer func() { undo.Window = window }()
+
+	todoID := createUndoTodo(server, "Too late")
+	token := server.DELETE(fmt.Sprintf("/todos/%d", todoID)).
+		Expect().
+		Status(204).
+		Header(routes.UndoTokenHeader).Raw()
+
+	server.POST("/undo/" + token).
+		Expect().
+		Status(410)
+
+	t.Log("TestUndoExpiredFunctional passed")
+}
+
+func TestMemoryRepositoryWithoutPortsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   memoryClient,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	counts := func() (undos, notifications int64) {
+		db.Model(&models.UndoEntry{}).Count(&undos)
+		db.Model(&models.Notification{}).Count(&notifications)
+		return undos, notifications
+	}
+	undosBefore, notificationsBefore := counts()
+
+	// Bob would be notified of all of it, were the todo in the database
+	bob := models.User{Username: "bob"}
+	require.NoError(t, db.Where(bob).FirstOrCreate(&bob).Error)
+	created := server.POST("/todos").
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(map[string]interface{}{"subject": "Kept in memory", "assignee_id": bob.ID}).
+		Expect().
+		Status(201)
+	created.Header(routes.UndoTokenHeader).IsEmpty()
+	url := fmt.Sprintf("/todos/%d", int(created.JSON().Object().Value("ID").Raw().(float64)))
+
+	server.PATCH(url).
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(map[string]interface{}{"completed": true}).
+		Expect().
+		Status(200).
+		Header(routes.UndoTokenHeader).IsEmpty()
+	server.POST(url+"/notes").
+		WithHeader(routes.UserHeader, "alice").
+		WithJSON(map[string]interface{}{"note": "@bob have a look"}).
+		Expect().
+		Status(201).
+		Header(routes.UndoTokenHeader).IsEmpty()
+	server.DELETE(url).
+		WithHeader(routes.UserHeader, "alice").
+		Expect().
+		Status(204).
+		Header(routes.UndoTokenHeader).IsEmpty()
+
+	undos, notifications := counts()
+	assert.Equal(t, undosBefore, undos)
+	assert.Equal(t, notificationsBefore, notifications)
+}
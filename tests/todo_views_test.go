@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"my-go-project/routes"
+
+	"github.com/gavv/httpexpect/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedViewsFunctional(t *testing.T) {
+	server := httpexpect.WithConfig(httpexpect.Config{
+		Client:   client,
+		Reporter: httpexpect.NewRequireReporter(t),
+	})
+	create := func(todo map[string]interface{}) int {
+		return int(server.POST("/todos").
+			WithJSON(todo).
+			Expect().
+			Status(201).
+			JSON().Object().Value("ID").Raw().(float64))
+	}
+	urgent := create(map[string]interface{}{"subject": "Renew passport", "due_date": "2020-01-01", "priority": 3, "tags": []string{"admin"}})
+	create(map[string]interface{}{"subject": "Sort receipts", "due_date": "2020-01-01", "priority": 1})
+	create(map[string]interface{}{"subject": "Book flights", "due_date": "2020-01-01", "priority": 3, "completed": true})
+	create(map[string]interface{}{"subject": "Plan trip", "due_date": time.Now().AddDate(1, 0, 0).Format("2006-01-02"), "priority": 3})
+
+	// Invalid expressions are rejected with the position of the error
+	server.POST("/views").
+		WithHeader(routes.UserHeader, "viewer").
+		WithJSON(map[string]string{"name": "Broken", "expression": "due:overdue and priority:urgent"}).
+		Expect().
+		Status(422).
+		JSON().Object().
+		HasValue("error", "Invalid filter").
+		HasValue("position", 25)
+	server.POST("/views").
+		WithJSON(map[string]string{"name": "Anonymous", "expression": "due:overdue"}).
+		Expect().
+		Status(401)
+
+	view := server.POST("/views").
+		WithHeader(routes.UserHeader, "viewer").
+		WithJSON(map[string]string{"name": "Urgent", "expression": "due:overdue and priority:high"}).
+		Expect().
+		Status(201).
+		JSON().Object()
+	view.HasValue("shared", false)
+	id := int(view.Value("ID").Raw().(float64))
+
+	var todos []struct {
+		ID        int    `json:"ID"`
+		DueStatus string `json:"due_status"`
+	}
+	server.GET("/views/{id}/todos", id).
+		WithHeader(routes.UserHeader, "viewer").
+		Expect().
+		Status(200).
+		JSON().Decode(&todos)
+	if assert.Len(t, todos, 1) {
+		assert.Equal(t, urgent, todos[0].ID)
+		assert.Equal(t, "overdue", todos[0].DueStatus)
+	}
+
+	// The same expressions filter /todos directly
+	server.GET("/todos").
+		WithQuery("filter", `#admin "passport"`).
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(1)
+	server.GET("/todos").
+		WithQuery("filter", "priority>").
+		Expect().
+		Status(422).
+		JSON().Object().HasValue("position", 9)
+
+	// Private views are hidden from others until shared, and only the owner
+	// may change them
+	server.GET("/views/{id}/todos", id).
+		WithHeader(routes.UserHeader, "colleague").
+		Expect().
+		Status(404)
+	server.PATCH("/views/{id}", id).
+		WithHeader(routes.UserHeader, "viewer").
+		WithJSON(map[string]bool{"shared": true}).
+		Expect().
+		Status(200).
+		JSON().Object().HasValue("shared", true)
+	server.GET("/views").
+		WithHeader(routes.UserHeader, "colleague").
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(1)
+	server.GET("/views/{id}/todos", id).
+		WithHeader(routes.UserHeader, "colleague").
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(1)
+	server.PATCH("/views/{id}", id).
+		WithHeader(routes.UserHeader, "colleague").
+		WithJSON(map[string]string{"name": "Mine now"}).
+		Expect().
+		Status(403)
+	server.DELETE("/views/{id}", id).
+		WithHeader(routes.UserHeader, "colleague").
+		Expect().
+		Status(403)
+
+	server.PATCH("/views/{id}", id).
+		WithHeader(routes.UserHeader, "viewer").
+		WithJSON(map[string]string{"expression": "due:overdue and not completed:false"}).
+		Expect().
+		Status(200)
+	server.GET("/views/{id}/todos", id).
+		WithHeader(routes.UserHeader, "viewer").
+		Expect().
+		Status(200).
+		JSON().Array().Length().IsEqual(0)
+
+	server.DELETE("/views/{id}", id).
+		WithHeader(routes.UserHeader, "viewer").
+		Expect().
+		Status(204)
+	server.GET("/views/{id}", id).
+		WithHeader(routes.UserHeader, "viewer").
+		Expect().
+		Status(404)
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"my-go-project/digest"
+	"my-go-project/tracing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans collects the spans ended during the test in memory.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		provider.Shutdown(context.Background())
+	})
+	return exporter
+}
+
+// spanNamed returns the first span called name.
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	require.Failf(t, "span not found", "no span %q in %v", name, names)
+	return tracetest.SpanStub{}
+}
+
+func TestJobSpans(t *testing.T) {
+	exporter := recordSpans(t)
+
+	err := tracing.Job(context.Background(), "storage.sweep", func(ctx context.Context) error {
+		_, child := tracing.Tracer().Start(ctx, "child")
+		child.End()
+		return errors.New("bucket unreachable")
+	})
+	assert.EqualError(t, err, "bucket unreachable")
+	err = tracing.Job(context.Background(), "audit.prune", func(context.Context) error {
+		return context.Canceled // Stopping is not a failure
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	spans := exporter.GetSpans()
+	job := spanNamed(t, spans, "storage.sweep")
+	assert.Equal(t, codes.Error, job.Status.Code)
+	assert.Equal(t, "bucket unreachable", job.Status.Description)
+	require.Len(t, job.Events, 1) // The recorded error
+	child := spanNamed(t, spans, "child")
+	assert.Equal(t, job.SpanContext.SpanID(), child.Parent.SpanID())
+	assert.Equal(t, codes.Unset, spanNamed(t, spans, "audit.prune").Status.Code)
+}
+
+func TestTraceID(t *testing.T) {
+	assert.Empty(t, tracing.TraceID(context.Background()))
+	recordSpans(t)
+	ctx, span := tracing.Tracer().Start(context.Background(), "request")
+	defer span.End()
+	assert.Equal(t, span.SpanContext().TraceID().String(), tracing.TraceID(ctx))
+}
+
+func TestSMTPSpans(t *testing.T) {
+	exporter := recordSpans(t)
+	msg := &digest.Message{To: "ada@example.com", Subject: "Digest", Text: "Nothing due", HTML: "<p>Nothing due</p>"}
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "digest.send_due")
+	capture := newSMTPCapture(t)
+	require.NoError(t, capture.mailer().Send(ctx, msg))
+	unreachable := &digest.SMTPMailer{Addr: "127.0.0.1:1", From: "todo@example.com"}
+	assert.Error(t, unreachable.Send(ctx, msg))
+	parent.End()
+
+	var sends []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "smtp.send" {
+			sends = append(sends, span)
+		}
+	}
+	require.Len(t, sends, 2)
+	for _, span := range sends {
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+	}
+	assert.Equal(t, codes.Unset, sends[0].Status.Code)
+	assert.Equal(t, codes.Error, sends[1].Status.Code)
+}
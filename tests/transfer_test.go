@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"my-go-project/models"
+	"my-go-project/transfer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferRoundTrip(t *testing.T) {
+	due := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	todo := models.Todo{
+		UID:       "round-trip-1",
+		Subject:   "Plan the offsite, with \"quotes\"",
+		DueDate:   models.NewDueDate(due, true),
+		Completed: true,
+		RRule:     "FREQ=YEARLY",
+		Priority:  models.PriorityMedium,
+		List:      "work",
+		Tags:      models.StringList{"planning", "team"},
+		Notes:     []models.Note{{Note: "Book a venue\nand catering"}, {Note: "Invite everyone"}},
+		Checklist: []models.ChecklistItem{{Text: "Budget", Done: true}},
+	}
+	todo.CreatedAt = time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, format := range []transfer.Format{transfer.FormatCSV, transfer.FormatJSON, transfer.FormatTodoTxt} {
+		var buf bytes.Buffer
+		encoder, err := transfer.NewEncoder(&buf, format)
+		require.NoError(t, err)
+		require.NoError(t, encoder.Encode(&todo))
+		require.NoError(t, encoder.Close())
+
+		records, err := transfer.Decode(&buf, format)
+		require.NoError(t, err, format)
+		require.Len(t, records, 1, format)
+		got := records[0].Todo
+		assert.NoError(t, records[0].Err, format)
+		assert.Equal(t, todo.UID, got.UID, format)
+		assert.Equal(t, todo.Subject, got.Subject, format)
+		assert.True(t, got.DueDate.Equal(due), format)
+		assert.True(t, got.Completed, format)
+		assert.Equal(t, todo.RRule, got.RRule, format)
+		assert.Equal(t, todo.Priority, got.Priority, format)
+		assert.Equal(t, todo.List, got.List, format)
+		assert.Equal(t, todo.Tags, got.Tags, format)
+		assert.True(t, got.CreatedAt.Equal(todo.CreatedAt), format)
+
+		if format == transfer.FormatTodoTxt {
+			assert.Nil(t, got.Notes, "todo.txt leaves notes alone")
+			continue
+		}
+		require.Len(t, got.Notes, 2, format)
+		assert.Equal(t, "Book a venue\nand catering", got.Notes[0].Note, format)
+	}
+}
+
+func TestTransferDecodeTodoTxt(t *testing.T) {
+	input := strings.Join([]string{
+		"(A) 2025-01-05 Call mom +family @phone due:2025-01-07",
+		"x 2025-01-06 2025-01-01 Pay rent see http://bank.example uid:rent-1",
+		"",
+		"Broken due:tomorrow",
+	}, "\n")
+	records, err := transfer.Decode(strings.NewReader(input), transfer.FormatTodoTxt)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, "Call mom +family @phone", records[0].Todo.Subject)
+	assert.Equal(t, "2025-01-07", records[0].Todo.DueDate.Format(time.DateOnly))
+	assert.False(t, records[0].Todo.Completed)
+	assert.Equal(t, models.PriorityHigh, records[0].Todo.Priority)
+
+	assert.Equal(t, "Pay rent see http://bank.example", records[1].Todo.Subject)
+	assert.Equal(t, "rent-1", records[1].Todo.UID)
+	assert.True(t, records[1].Todo.Completed)
+
+	assert.Equal(t, 4, records[2].Row)
+	assert.Error(t, records[2].Err)
+}
+
+func TestTransferDecodeCSVErrors(t *testing.T) {
+	_, err := transfer.Decode(strings.NewReader("title,done\nx,true\n"), transfer.FormatCSV)
+	assert.Error(t, err, "subject column is required")
+
+	records, err := transfer.Decode(strings.NewReader("\uFEFFSubject,Completed\nOk,true\nBad,maybe\n"), transfer.FormatCSV)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.NoError(t, records[0].Err)
+	assert.True(t, records[0].Todo.Completed)
+	assert.Error(t, records[1].Err)
+	assert.Equal(t, 2, records[1].Row)
+}
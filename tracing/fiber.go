@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDHeader carries the trace ID of every response, so that a failed
+// request can be found in the traces.
+const TraceIDHeader = "X-Trace-ID"
+
+// headerCarrier reads the propagation headers of a request.
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Middleware starts a server span for every request that reaches it,
+// continuing the trace of an incoming traceparent header, and puts it in
+// the request's user context so that database statements made with it
+// become its children. The span is named after the route template, such as
+// GET /todos/:id. Responses carry the trace ID in X-Trace-ID, and JSON error
+// responses also as trace_id.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		method := strings.Clone(c.Method()) // Fiber reuses the request's memory
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c})
+		ctx, span := Tracer().Start(ctx, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(c.Path()),
+			))
+		defer span.End()
+		traceID := TraceID(ctx)
+		c.SetUserContext(ctx)
+
+		if err := c.Next(); err != nil {
+			// Let the error handler write the response now, so that its
+			// status is the one recorded
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		route := c.Route().Path
+		status := c.Response().StatusCode()
+		span.SetName(method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if traceID != "" {
+			c.Set(TraceIDHeader, traceID)
+			if status >= fiber.StatusBadRequest {
+				addTraceID(c, traceID)
+			}
+		}
+		return nil
+	}
+}
+
+// addTraceID adds trace_id to a JSON object response.
+func addTraceID(c *fiber.Ctx, traceID string) {
+	if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Response().Body(), &body); err != nil || body == nil {
+		return
+	}
+	body["trace_id"], _ = json.Marshal(traceID)
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return
+	}
+	c.Response().SetBodyRaw(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,89 @@
+// Package tracing emits OpenTelemetry traces: a span per HTTP request,
+// continuing the caller's trace from its traceparent header, child spans for
+// database statements, and spans for background jobs and outgoing SMTP calls.
+// Spans are exported over OTLP/HTTP when an endpoint is configured.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"my-go-project/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer of the app's own spans.
+const instrumentation = "my-go-project"
+
+func init() {
+	// Trace context travels in W3C traceparent and baggage headers, whether or
+	// not spans are exported
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+}
+
+// Tracer starts the app's spans, using the global tracer provider; spans
+// are discarded until Init installs one.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Init exports spans to the endpoint in cfg. It returns a function that
+// flushes the spans not yet exported and stops; without an endpoint it does
+// nothing.
+func Init(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(cfg.Endpoint, "/")+"/v1/traces"))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(cfg.SamplePercent)/100))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// TraceID returns the ID of the trace in ctx, or "" when there is none.
+func TraceID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// Job runs fn in a span named name, for one round of a background job.
+func Job(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ctx, span := Tracer().Start(ctx, name)
+	err := fn(ctx)
+	End(span, err)
+	return err
+}
+
+// End records err, unless it is nil or a cancellation, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
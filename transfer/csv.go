@@ -0,0 +1,112 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-go-project/models"
+)
+
+var csvHeader = []string{"uid", "subject", "completed", "due_date", "rrule", "priority", "list", "tags", "created_at", "notes"}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) (*csvEncoder, error) {
+	e := &csvEncoder{w: csv.NewWriter(w)}
+	return e, e.w.Write(csvHeader)
+}
+
+func (e *csvEncoder) Encode(todo *models.Todo) error {
+	return e.w.Write([]string{
+		todo.UID,
+		todo.Subject,
+		strconv.FormatBool(todo.Completed),
+		formatDueDate(todo.DueDate),
+		todo.RRule,
+		strconv.Itoa(todo.Priority),
+		todo.List,
+		joinTags(todo.Tags),
+		todo.CreatedAt.UTC().Format(time.RFC3339),
+		joinNotes(todo.Notes),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// decodeCSV reads a CSV file with a header row. Columns are matched by name,
+// so spreadsheets may reorder or drop them; only subject is required.
+func decodeCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	// Spreadsheets often start UTF-8 files with a byte order mark
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))] = i
+	}
+	if _, ok := columns["subject"]; !ok {
+		return nil, errors.New("CSV header has no subject column")
+	}
+
+	var records []Record
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		record := Record{Row: row}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			record.Err = err
+			records = append(records, record)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		get := func(column string) (string, bool) {
+			i, ok := columns[column]
+			if !ok || i >= len(fields) {
+				return "", false
+			}
+			return strings.TrimSpace(fields[i]), true
+		}
+		record.Todo.Subject, _ = get("subject")
+		record.Todo.UID, _ = get("uid")
+		record.Todo.RRule, _ = get("rrule")
+		record.Todo.List, _ = get("list")
+		if tags, ok := get("tags"); ok {
+			record.Todo.Tags = splitTags(tags)
+		}
+		if completed, ok := get("completed"); ok && completed != "" {
+			record.Todo.Completed, record.Err = strconv.ParseBool(completed)
+		}
+		if priority, ok := get("priority"); ok && priority != "" && record.Err == nil {
+			record.Todo.Priority, record.Err = parsePriority(priority)
+		}
+		if due, ok := get("due_date"); ok && record.Err == nil {
+			record.Todo.DueDate, record.Err = parseDueDate(due)
+		}
+		if created, ok := get("created_at"); ok && created != "" && record.Err == nil {
+			record.Todo.CreatedAt, record.Err = time.Parse(time.RFC3339, created)
+		}
+		if i, ok := columns["notes"]; ok && i < len(fields) {
+			record.Todo.Notes = splitNotes(fields[i])
+		}
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,263 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"my-go-project/database"
+	"my-go-project/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Row outcomes
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionSkipped = "skipped"
+	ActionError   = "error"
+)
+
+// RowResult is what happened, or would happen, to one record.
+type RowResult struct {
+	Row     int    `json:"row"`
+	Action  string `json:"action"`
+	TodoID  uint   `json:"todo_id,omitempty"`
+	UID     string `json:"uid,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Reason  string `json:"reason,omitempty"` // Why a row was skipped or failed
+}
+
+// Report summarizes an import.
+type Report struct {
+	DryRun  bool        `json:"dry_run"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Skipped int         `json:"skipped"`
+	Errors  int         `json:"errors"`
+	Rows    []RowResult `json:"rows"`
+}
+
+var errDryRun = errors.New("dry run")
+
+// Import stores records in one transaction, run again if it fails to
+// serialize. A record with a UID updates the todo with that UID, restoring it
+// if it was deleted; one without is skipped if a todo with the same subject
+// and due date exists. Rows that fail are reported and do not affect the
+// others. With dryRun, the transaction is rolled back so the report shows
+// what would happen.
+func Import(ctx context.Context, db *gorm.DB, records []Record, dryRun bool) (*Report, error) {
+	var report *Report
+	err := database.Transaction(db.WithContext(ctx), func(tx *gorm.DB) error {
+		report = &Report{DryRun: dryRun, Rows: []RowResult{}} // Afresh for each attempt
+		seen := map[string]int{}
+		for _, record := range records {
+			result := RowResult{Row: record.Row, UID: record.Todo.UID, Subject: record.Todo.Subject}
+			if err := record.Err; err != nil {
+				result.Action, result.Reason = ActionError, err.Error()
+			} else if err := validate(&record.Todo); err != nil {
+				result.Action, result.Reason = ActionError, err.Error()
+			} else if row, ok := seen[duplicateKey(&record.Todo)]; ok {
+				result.Action, result.Reason = ActionSkipped, fmt.Sprintf("duplicate of row %d", row)
+			} else {
+				seen[duplicateKey(&record.Todo)] = record.Row
+				// A savepoint keeps the transaction usable after a failed row
+				if err := tx.SavePoint("import_row").Error; err != nil {
+					return err
+				}
+				if err := importRecord(tx, &record.Todo, &result); err != nil {
+					if err := tx.RollbackTo("import_row").Error; err != nil {
+						return err
+					}
+					result.Action, result.Reason = ActionError, err.Error()
+				}
+			}
+
+			switch result.Action {
+			case ActionCreated:
+				report.Created++
+			case ActionUpdated:
+				report.Updated++
+			case ActionSkipped:
+				report.Skipped++
+			case ActionError:
+				report.Errors++
+			}
+			report.Rows = append(report.Rows, result)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+func validate(todo *models.Todo) error {
+	if strings.TrimSpace(todo.Subject) == "" {
+		return errors.New("subject is required")
+	}
+	if len(todo.Subject) > 255 || len(todo.UID) > 255 || len(todo.RRule) > 255 {
+		return errors.New("subject, uid and rrule are limited to 255 bytes")
+	}
+	if len(todo.List) > 100 {
+		return errors.New("list is limited to 100 bytes")
+	}
+	for _, note := range todo.Notes {
+		if len(note.Note) > models.MaxNoteLength {
+			return fmt.Errorf("note is %d bytes, maximum is %d", len(note.Note), models.MaxNoteLength)
+		}
+	}
+	for _, item := range todo.Checklist {
+		if item.Text == "" || len(item.Text) > 500 {
+			return errors.New("checklist items need a text of at most 500 bytes")
+		}
+	}
+	return nil
+}
+
+// duplicateKey identifies a record within one file.
+func duplicateKey(todo *models.Todo) string {
+	if todo.UID != "" {
+		return "uid:" + todo.UID
+	}
+	return "subject:" + todo.Subject + "\x00" + formatDueDate(todo.DueDate)
+}
+
+func importRecord(tx *gorm.DB, record *models.Todo, result *RowResult) error {
+	var existing models.Todo
+	var err error
+	if record.UID != "" {
+		err = tx.Unscoped().Preload("Notes").Preload("Checklist", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position, id")
+		}).Where("uid = ?", record.UID).First(&existing).Error
+	} else {
+		err = tx.Where("subject = ?", record.Subject).Scopes(models.DueOn(record.DueDate)).First(&existing).Error
+		if err == nil {
+			result.Action, result.TodoID = ActionSkipped, existing.ID
+			result.Reason = fmt.Sprintf("duplicate of todo %d", existing.ID)
+			return nil
+		}
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		todo := *record
+		for i := range todo.Checklist {
+			todo.Checklist[i].Position = i
+		}
+		if err := tx.Omit("Attachments").Create(&todo).Error; err != nil {
+			return err
+		}
+		result.Action, result.TodoID, result.UID = ActionCreated, todo.ID, todo.UID
+		return nil
+	}
+
+	result.TodoID = existing.ID
+	changed := existing.DeletedAt.Valid ||
+		existing.Subject != record.Subject ||
+		existing.Completed != record.Completed ||
+		existing.RRule != record.RRule ||
+		existing.Priority != record.Priority ||
+		existing.List != record.List ||
+		joinTags(existing.Tags) != joinTags(record.Tags) ||
+		formatDueDate(existing.DueDate) != formatDueDate(record.DueDate)
+	if changed {
+		existing.Subject = record.Subject
+		if existing.Completed != record.Completed {
+			existing.CompletedAt = record.CompletedAt
+		}
+		existing.Completed = record.Completed
+		existing.RRule = record.RRule
+		existing.Priority = record.Priority
+		existing.List = record.List
+		existing.Tags = record.Tags
+		existing.DueDate = record.DueDate
+		existing.DeletedAt = gorm.DeletedAt{}
+		if err := tx.Unscoped().Omit(clause.Associations).Save(&existing).Error; err != nil {
+			return err
+		}
+	}
+
+	if record.Notes != nil && joinNotes(record.Notes) != joinNotes(existing.Notes) {
+		if err := tx.Where("todo_id = ?", existing.ID).Delete(&models.Note{}).Error; err != nil {
+			return err
+		}
+		for _, note := range record.Notes {
+			note.TodoID = existing.ID
+			if err := tx.Create(&note).Error; err != nil {
+				return err
+			}
+		}
+		changed = true
+	}
+	if record.Checklist != nil && checklistKey(record.Checklist) != checklistKey(existing.Checklist) {
+		if err := tx.Where("todo_id = ?", existing.ID).Delete(&models.ChecklistItem{}).Error; err != nil {
+			return err
+		}
+		for i, item := range record.Checklist {
+			item.TodoID, item.Position = existing.ID, i
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+		changed = true
+	}
+
+	if changed {
+		result.Action = ActionUpdated
+	} else {
+		result.Action, result.Reason = ActionSkipped, "unchanged"
+	}
+	return nil
+}
+
+func checklistKey(items []models.ChecklistItem) string {
+	var b strings.Builder
+	for _, item := range items {
+		fmt.Fprintf(&b, "%t\x00%s\x00", item.Done, item.Text)
+	}
+	return b.String()
+}
+
+// PopulateFromFile loads todos from a CSV, JSON or todo.txt file, chosen by
+// its extension, instead of the built-in fixtures. Rows that fail are logged
+// and skipped.
+func PopulateFromFile(db *gorm.DB, path string) error {
+	format, err := FormatFromFilename(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	records, err := Decode(file, format)
+	if err != nil {
+		return err
+	}
+	report, err := Import(context.Background(), db, records, false)
+	if err != nil {
+		return err
+	}
+	for _, row := range report.Rows {
+		if row.Action == ActionError {
+			slog.Warn("Skipping row", "file", path, "row", row.Row, "reason", row.Reason)
+		}
+	}
+	slog.Info("Database populated", "file", path, "created", report.Created, "updated", report.Updated,
+		"skipped", report.Skipped, "failed", report.Errors)
+	return nil
+}
@@ -0,0 +1,102 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"my-go-project/models"
+)
+
+// jsonVersion is the version of the JSON export document.
+const jsonVersion = 1
+
+// jsonEncoder writes {"version":1,"todos":[...]} one todo at a time.
+type jsonEncoder struct {
+	w     *bufio.Writer
+	count int
+}
+
+func newJSONEncoder(w io.Writer) (*jsonEncoder, error) {
+	e := &jsonEncoder{w: bufio.NewWriter(w)}
+	_, err := fmt.Fprintf(e.w, "{\"version\":%d,\"todos\":[", jsonVersion)
+	return e, err
+}
+
+func (e *jsonEncoder) Encode(todo *models.Todo) error {
+	b, err := json.Marshal(todo)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		e.w.WriteByte(',')
+	}
+	e.count++
+	e.w.WriteString("\n")
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	e.w.WriteString("\n]}\n")
+	return e.w.Flush()
+}
+
+// decodeJSON reads an export document or a bare array of todos. IDs,
+// attachments and other server-managed fields are ignored.
+func decodeJSON(r io.Reader) ([]Record, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &items)
+	} else {
+		var doc struct {
+			Version int               `json:"version"`
+			Todos   []json.RawMessage `json:"todos"`
+		}
+		err = json.Unmarshal(data, &doc)
+		if err == nil && doc.Version > jsonVersion {
+			err = fmt.Errorf("export version %d is newer than the supported version %d", doc.Version, jsonVersion)
+		}
+		items = doc.Todos
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, len(items))
+	for i, item := range items {
+		records[i].Row = i + 1
+		var todo models.Todo
+		if err := json.Unmarshal(item, &todo); err != nil {
+			records[i].Err = err
+			continue
+		}
+		records[i].Todo = models.Todo{
+			UID:         todo.UID,
+			Subject:     todo.Subject,
+			DueDate:     todo.DueDate,
+			Completed:   todo.Completed,
+			CompletedAt: todo.CompletedAt,
+			RRule:       todo.RRule,
+			Priority:    todo.Priority,
+			List:        todo.List,
+			Tags:        todo.Tags,
+			Notes:       todo.Notes,
+			Checklist:   todo.Checklist,
+		}
+		records[i].Todo.CreatedAt = todo.CreatedAt
+		for j := range records[i].Todo.Notes {
+			records[i].Todo.Notes[j] = models.Note{Note: todo.Notes[j].Note}
+		}
+		for j, item := range todo.Checklist {
+			records[i].Todo.Checklist[j] = models.ChecklistItem{Text: item.Text, Done: item.Done, Position: item.Position}
+		}
+	}
+	return records, nil
+}
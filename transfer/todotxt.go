@@ -0,0 +1,141 @@
+package transfer
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"my-go-project/models"
+)
+
+// todo.txt has no room for notes or checklists; they are neither written
+// nor touched on import. Due dates, recurrence rules, lists, tags and UIDs
+// are stored as due:, rrule:, list:, tags: and uid: tags, priorities as
+// (A) for high through (C) for low, or a pri: tag once completed. +project and @context words are left
+// in the subject.
+
+type todoTxtEncoder struct {
+	w *bufio.Writer
+}
+
+func newTodoTxtEncoder(w io.Writer) *todoTxtEncoder {
+	return &todoTxtEncoder{w: bufio.NewWriter(w)}
+}
+
+func (e *todoTxtEncoder) Encode(todo *models.Todo) error {
+	var parts []string
+	priority := ""
+	if todo.Priority != models.PriorityNone {
+		priority = string(rune('A' + models.PriorityHigh - todo.Priority))
+	}
+	if todo.Completed {
+		completedAt := todo.UpdatedAt
+		if todo.CompletedAt != nil {
+			completedAt = *todo.CompletedAt
+		}
+		parts = append(parts, "x", completedAt.Format(time.DateOnly))
+	} else if priority != "" {
+		parts = append(parts, "("+priority+")")
+	}
+	parts = append(parts, todo.CreatedAt.Format(time.DateOnly), strings.Join(strings.Fields(todo.Subject), " "))
+	if todo.DueDate != nil {
+		parts = append(parts, "due:"+todo.DueDate.Format(time.DateOnly))
+	}
+	if todo.RRule != "" {
+		parts = append(parts, "rrule:"+todo.RRule)
+	}
+	if todo.List != "" {
+		parts = append(parts, "list:"+strings.Join(strings.Fields(todo.List), "_"))
+	}
+	if len(todo.Tags) > 0 {
+		parts = append(parts, "tags:"+strings.Join(strings.Fields(joinTags(todo.Tags)), "_"))
+	}
+	if todo.Completed && priority != "" {
+		parts = append(parts, "pri:"+priority)
+	}
+	parts = append(parts, "uid:"+todo.UID)
+	_, err := e.w.WriteString(strings.Join(parts, " ") + "\n")
+	return err
+}
+
+func (e *todoTxtEncoder) Close() error {
+	return e.w.Flush()
+}
+
+var (
+	todoTxtDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	todoTxtPriority = regexp.MustCompile(`^\([A-Z]\)$`)
+)
+
+func decodeTodoTxt(r io.Reader) ([]Record, error) {
+	scanner := bufio.NewScanner(r)
+	var records []Record
+	for row := 1; scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record := Record{Row: row}
+		fields := strings.Fields(line)
+
+		if fields[0] == "x" {
+			record.Todo.Completed = true
+			fields = fields[1:]
+			if len(fields) > 0 && todoTxtDate.MatchString(fields[0]) {
+				completedAt, err := time.Parse(time.DateOnly, fields[0])
+				record.Todo.CompletedAt, record.Err = &completedAt, err
+				fields = fields[1:]
+			}
+		} else if todoTxtPriority.MatchString(fields[0]) {
+			record.Todo.Priority = todoTxtPriorityValue(fields[0][1])
+			fields = fields[1:]
+		}
+		if len(fields) > 0 && todoTxtDate.MatchString(fields[0]) {
+			record.Todo.CreatedAt, record.Err = time.Parse(time.DateOnly, fields[0])
+			fields = fields[1:]
+		}
+
+		var words []string
+		for _, field := range fields {
+			key, value, ok := strings.Cut(field, ":")
+			if !ok || value == "" || strings.HasPrefix(value, "//") {
+				words = append(words, field)
+				continue
+			}
+			switch key {
+			case "due":
+				due, err := parseDueDate(value)
+				if err != nil && record.Err == nil {
+					record.Err = err
+				}
+				record.Todo.DueDate = due
+			case "uid":
+				record.Todo.UID = value
+			case "rrule":
+				record.Todo.RRule = value
+			case "pri":
+				if len(value) == 1 && value[0] >= 'A' && value[0] <= 'Z' {
+					record.Todo.Priority = todoTxtPriorityValue(value[0])
+				} else {
+					words = append(words, field)
+				}
+			case "list":
+				record.Todo.List = value
+			case "tags":
+				record.Todo.Tags = splitTags(value)
+			default:
+				words = append(words, field)
+			}
+		}
+		record.Todo.Subject = strings.Join(words, " ")
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// todoTxtPriorityValue maps (A) to high, (B) to medium and anything lower to low.
+func todoTxtPriorityValue(letter byte) int {
+	return max(models.PriorityHigh-int(letter-'A'), models.PriorityLow)
+}
@@ -0,0 +1,173 @@
+// Package transfer moves todos in and out of the app as CSV, JSON or
+// todo.txt files.
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"my-go-project/models"
+	"my-go-project/utils"
+)
+
+// Format is a file format for export and import.
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSON    Format = "json"
+	FormatTodoTxt Format = "todotxt"
+)
+
+// ParseFormat validates a format name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatCSV, FormatJSON, FormatTodoTxt:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected csv, json or todotxt", name)
+}
+
+// FormatFromFilename picks the format matching a file's extension.
+func FormatFromFilename(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".txt":
+		return FormatTodoTxt, nil
+	}
+	return "", fmt.Errorf("cannot tell the format of %q from its extension", name)
+}
+
+// ContentType returns the media type of files in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Filename returns the default export file name.
+func (f Format) Filename() string {
+	switch f {
+	case FormatCSV:
+		return "todos.csv"
+	case FormatJSON:
+		return "todos.json"
+	}
+	return "todo.txt"
+}
+
+// Encoder writes todos one at a time, so exports can be streamed.
+type Encoder interface {
+	// Encode writes one todo with its notes and checklist loaded.
+	Encode(todo *models.Todo) error
+	// Close writes any trailer and flushes buffered output.
+	Close() error
+}
+
+// NewEncoder returns an encoder writing the format to w.
+func NewEncoder(w io.Writer, format Format) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w)
+	case FormatJSON:
+		return newJSONEncoder(w)
+	case FormatTodoTxt:
+		return newTodoTxtEncoder(w), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// Record is one todo read from a file. Notes and Checklist are nil when the
+// row does not say anything about them, so imports leave them alone.
+type Record struct {
+	Row  int // 1-based row, line or array index in the file
+	Todo models.Todo
+	Err  error // Set when the row could not be read
+}
+
+// Decode reads every record of a file. Problems with single rows are
+// reported in Record.Err; an error is only returned if the file as a whole
+// is unreadable.
+func Decode(r io.Reader, format Format) ([]Record, error) {
+	switch format {
+	case FormatCSV:
+		return decodeCSV(r)
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatTodoTxt:
+		return decodeTodoTxt(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// noteSeparator divides notes in formats that have a single notes field.
+const noteSeparator = "\n\n---\n\n"
+
+func joinNotes(notes []models.Note) string {
+	texts := make([]string, len(notes))
+	for i, note := range notes {
+		texts[i] = note.Note
+	}
+	return strings.Join(texts, noteSeparator)
+}
+
+func splitNotes(s string) []models.Note {
+	notes := []models.Note{}
+	for _, text := range strings.Split(s, noteSeparator) {
+		if strings.TrimSpace(text) != "" {
+			notes = append(notes, models.Note{Note: text})
+		}
+	}
+	return notes
+}
+
+// joinTags writes tags as a comma separated list.
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+func splitTags(s string) models.StringList {
+	tags := models.StringList{}
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parsePriority accepts a number from 0 (none) to 3 (high).
+func parsePriority(s string) (int, error) {
+	priority, err := strconv.Atoi(s)
+	if err != nil || priority < models.PriorityNone || priority > models.PriorityHigh {
+		return 0, fmt.Errorf("invalid priority %q", s)
+	}
+	return priority, nil
+}
+
+// parseDueDate accepts the forms models.ParseDueDate does. Times without a
+// zone are read in utils.DefaultLocation.
+func parseDueDate(s string) (*models.DueDate, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return models.ParseDueDate(s, utils.DefaultLocation)
+}
+
+// formatDueDate writes whole days as plain dates.
+func formatDueDate(due *models.DueDate) string {
+	if due == nil {
+		return ""
+	}
+	return due.String()
+}
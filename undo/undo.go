@@ -0,0 +1,175 @@
+package undo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"my-go-project/audit"
+	"my-go-project/database"
+	"my-go-project/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotFound = errors.New("undo token not found")
+	ErrExpired  = errors.New("undo token has expired or was already used")
+	ErrConflict = errors.New("entity has since been modified by someone else")
+)
+
+// Window is how long a change can be undone.
+var Window = 5 * time.Minute
+
+// Record stores how to revert a change and returns the entry holding its token.
+// entity is the model after the change. For models.ActionUpdate, before is the
+// model as it was and fields lists the struct fields to restore from it.
+func Record(ctx context.Context, db *gorm.DB, action string, entity interface{}, before interface{}, fields ...string) (*models.UndoEntry, error) {
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	entry := models.UndoEntry{
+		Action:     action,
+		EntityType: value.Type().Name(),
+		EntityID:   uint(value.FieldByName("ID").Uint()),
+		Fields:     strings.Join(fields, ","),
+		ExpiresAt:  time.Now().Add(Window),
+	}
+	if actor, ok := audit.ActorFrom(ctx); ok {
+		entry.ActorID = &actor.ID
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	entry.Token = hex.EncodeToString(token)
+
+	if before != nil {
+		snapshot, err := json.Marshal(before)
+		if err != nil {
+			return nil, err
+		}
+		entry.Snapshot = string(snapshot)
+	}
+
+	db = db.WithContext(ctx)
+	// Remember the entity's latest activity so later changes can be detected
+	if err := db.Model(&models.Activity{}).Select("COALESCE(MAX(id), 0)").
+		Where("entity_type = ? AND entity_id = ?", entry.EntityType, entry.EntityID).
+		Scan(&entry.ActivityID).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.UndoEntry{}).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Recorder records changes on a database, for service.Undoer.
+type Recorder struct {
+	db *gorm.DB
+}
+
+// NewRecorder returns a recorder storing undo entries in db.
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+// Record stores how to revert a change; see the function Record.
+func (r *Recorder) Record(ctx context.Context, action string, entity, before interface{}, fields ...string) (*models.UndoEntry, error) {
+	return Record(ctx, r.db, action, entity, before, fields...)
+}
+
+// Apply reverts the change recorded under token. The revert is itself an
+// audited change made by the actor in ctx.
+func Apply(ctx context.Context, db *gorm.DB, token string) (*models.UndoEntry, error) {
+	var entry models.UndoEntry
+	err := database.Transaction(db.WithContext(ctx), func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token = ?", token).First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if entry.UsedAt != nil || time.Now().After(entry.ExpiresAt) {
+			return ErrExpired
+		}
+		if err := checkConflict(tx, &entry); err != nil {
+			return err
+		}
+		if err := revert(tx, &entry); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		entry.UsedAt = &now
+		return tx.Model(&entry).Update("used_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// checkConflict fails if anyone other than the original actor changed the
+// entity after the recorded change.
+func checkConflict(tx *gorm.DB, entry *models.UndoEntry) error {
+	query := tx.Model(&models.Activity{}).
+		Where("entity_type = ? AND entity_id = ? AND id > ?", entry.EntityType, entry.EntityID, entry.ActivityID)
+	if entry.ActorID != nil {
+		query = query.Where("actor_id IS NULL OR actor_id <> ?", *entry.ActorID)
+	} else {
+		query = query.Where("actor_id IS NOT NULL")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// revert applies the inverse of the recorded action.
+func revert(tx *gorm.DB, entry *models.UndoEntry) error {
+	model, err := newModel(entry.EntityType)
+	if err != nil {
+		return err
+	}
+
+	switch entry.Action {
+	case models.ActionCreate:
+		return tx.Delete(model, entry.EntityID).Error
+	case models.ActionDelete:
+		return tx.Unscoped().Model(model).Where("id = ?", entry.EntityID).Update("deleted_at", nil).Error
+	case models.ActionUpdate:
+		if err := json.Unmarshal([]byte(entry.Snapshot), model); err != nil {
+			return err
+		}
+		return tx.Model(model).Where("id = ?", entry.EntityID).
+			Select(strings.Split(entry.Fields, ",")).Updates(model).Error
+	}
+	return fmt.Errorf("cannot undo action %q", entry.Action)
+}
+
+// newModel returns a pointer to a new registered model with the given type name.
+func newModel(entityType string) (interface{}, error) {
+	for _, model := range models.GetRegisteredModels() {
+		t := reflect.TypeOf(model).Elem()
+		if t.Name() == entityType {
+			return reflect.New(t).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown entity type %q", entityType)
+}
@@ -1,15 +1,68 @@
 package utils
 
 import (
-	"log"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// ParseDate parses a date string in the format "2006-01-02" and returns a pointer to the time.Time object.
-func ParseDate(dateStr string) *time.Time {
-	parsedDate, err := time.Parse("2006-01-02", dateStr)
-	if err != nil {
-		log.Fatalf("Failed to parse date: %s", err)
+// DateLayout is the format of date-only strings.
+const DateLayout = "2006-01-02"
+
+// localLayouts are the accepted forms of a date and time without a zone.
+var localLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+}
+
+// DefaultLocation is the zone for dates and times sent without one.
+var DefaultLocation = time.Local
+
+// DateTimeKind tells what a parsed string contained.
+type DateTimeKind int
+
+const (
+	KindDate    DateTimeKind = iota // A plain date, "2006-01-02"
+	KindLocal                       // A date and time without a zone
+	KindInstant                     // An RFC 3339 timestamp or a Unix timestamp
+)
+
+// ParseDateTime parses s as an RFC 3339 timestamp, a plain date, a date and
+// time without a zone or a Unix timestamp in seconds (or milliseconds, as
+// JavaScript's Date.now gives). Plain dates and times without a zone are
+// read in loc.
+func ParseDateTime(s string, loc *time.Location) (time.Time, DateTimeKind, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, KindInstant, nil
 	}
-	return &parsedDate
+	if t, err := ParseDateIn(s, loc); err == nil {
+		return t, KindDate, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, KindLocal, nil
+		}
+	}
+	// Short numbers are more likely a mistyped date than a time in 1970
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && len(s) > 8 {
+		if n > 1e11 || n < -1e11 {
+			return time.UnixMilli(n).UTC(), KindInstant, nil
+		}
+		return time.Unix(n, 0).UTC(), KindInstant, nil
+	}
+	return time.Time{}, 0, fmt.Errorf("invalid date %q: use RFC 3339, 2006-01-02, 2006-01-02T15:04 or a Unix timestamp", s)
+}
+
+// ParseDateIn parses a date string in the format "2006-01-02" as midnight in loc.
+func ParseDateIn(dateStr string, loc *time.Location) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, dateStr, loc)
+}
+
+// ParseDate parses a date string in the format "2006-01-02" as midnight UTC.
+func ParseDate(dateStr string) (time.Time, error) {
+	return ParseDateIn(dateStr, time.UTC)
 }